@@ -0,0 +1,98 @@
+package apidump
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/telemetry"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+type adminStatus struct {
+	CapturePaused bool `json:"capture_paused"`
+
+	// Number of HTTP requests and responses dropped while capture was paused.
+	DroppedWhilePaused int64 `json:"dropped_while_paused"`
+}
+
+// Returns a router for the admin endpoints, which pause and resume capture
+// and report whether it is paused.
+func newAdminRouter(pause *trace.CapturePause) *mux.Router {
+	router := mux.NewRouter()
+
+	writeStatus := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(adminStatus{
+			CapturePaused:      pause.Paused(),
+			DroppedWhilePaused: pause.Dropped(),
+		})
+	}
+
+	router.HandleFunc("/admin/pause", func(w http.ResponseWriter, _ *http.Request) {
+		if pause.Pause() {
+			printer.Stderr.Infof("Capture paused. Traffic will be dropped until capture is resumed.\n")
+			telemetry.CapturePaused(true, pause.Dropped())
+		}
+		writeStatus(w)
+	}).Methods("POST")
+
+	router.HandleFunc("/admin/resume", func(w http.ResponseWriter, _ *http.Request) {
+		if pause.Resume() {
+			printer.Stderr.Infof("Capture resumed. Dropped %d requests and responses while paused.\n", pause.Dropped())
+			telemetry.CapturePaused(false, pause.Dropped())
+		}
+		writeStatus(w)
+	}).Methods("POST")
+
+	router.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		writeStatus(w)
+	}).Methods("GET")
+
+	return router
+}
+
+// Starts serving the admin endpoints on the given port on localhost. Returns
+// once the port is bound. The caller must close the returned server once
+// capture has finished.
+func startAdminServer(port int, pause *trace.CapturePause) (*localHTTPServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to start admin server on port %d", port)
+	}
+	return serveLocalHTTP("Admin", listener, newAdminRouter(pause)), nil
+}
+
+// An HTTP server run alongside a capture, such as the admin or health-check
+// server.
+type localHTTPServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// Serves the given handler on the given listener in the background. The name
+// identifies the server in errors.
+func serveLocalHTTP(name string, listener net.Listener, handler http.Handler) *localHTTPServer {
+	s := &localHTTPServer{
+		server:   &http.Server{Handler: handler},
+		listener: listener,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			printer.Stderr.Errorf("%s server stopped: %v\n", name, err)
+		}
+	}()
+	return s
+}
+
+// Stops the server. Its port is released by the time Close returns, even if
+// the server hasn't started serving yet.
+func (s *localHTTPServer) Close() error {
+	err := s.server.Close()
+	s.listener.Close()
+	return err
+}
@@ -0,0 +1,41 @@
+package apidump
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRouter(t *testing.T) {
+	pause := trace.NewCapturePause()
+	router := newAdminRouter(pause)
+
+	request := func(method, path string) adminStatus {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+
+		var status adminStatus
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&status), path)
+		return status
+	}
+
+	assert.False(t, request("GET", "/status").CapturePaused)
+
+	assert.True(t, request("POST", "/admin/pause").CapturePaused)
+	assert.True(t, pause.Paused())
+	assert.True(t, request("GET", "/status").CapturePaused)
+
+	assert.False(t, request("POST", "/admin/resume").CapturePaused)
+	assert.False(t, pause.Paused())
+
+	// Pausing requires POST.
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/pause", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.False(t, pause.Paused())
+}
@@ -0,0 +1,61 @@
+package apidump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+// Writes the observed API surface to the --baseline-output file, and compares
+// it against the --baseline file, if given. Returns an error if the surface
+// differs from the baseline, so that apidump exits with a non-zero status.
+func reportAPISurface(surface *trace.APISurface, baseline []trace.SurfaceEndpoint, args *Args) error {
+	observed := surface.Endpoints()
+	if overflow := surface.Overflow(); overflow > 0 {
+		printer.Stderr.Warningf("Too many endpoints to track the full API surface; %d witnesses were not compared.\n", overflow)
+	}
+
+	if args.BaselineOutput != "" {
+		if err := trace.WriteAPISurface(args.BaselineOutput, observed); err != nil {
+			return err
+		}
+		printer.Stderr.Infof("Wrote API surface with %d endpoints to %s\n", len(observed), args.BaselineOutput)
+	}
+
+	if args.Baseline == "" {
+		return nil
+	}
+
+	diff := trace.DiffAPISurface(baseline, observed)
+	if diff.IsEmpty() {
+		printer.Stderr.Infof("API surface matches the baseline in %s\n", args.Baseline)
+		return nil
+	}
+	printer.Stdout.RawOutput(formatAPISurfaceDiff(diff))
+	return errors.Errorf("API surface differs from the baseline in %s: %d endpoints added, %d removed, %d changed",
+		args.Baseline, len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+func formatAPISurfaceDiff(diff trace.APISurfaceDiff) string {
+	var b strings.Builder
+	for _, e := range diff.Added {
+		fmt.Fprintf(&b, "+ %s\n", e)
+	}
+	for _, e := range diff.Removed {
+		fmt.Fprintf(&b, "- %s\n", e)
+	}
+	for _, c := range diff.Changed {
+		fmt.Fprintf(&b, "~ %s\n", c.Observed)
+		added, removed := c.ParamDiff()
+		for _, k := range added {
+			fmt.Fprintf(&b, "    + %s\n", k)
+		}
+		for _, k := range removed {
+			fmt.Fprintf(&b, "    - %s\n", k)
+		}
+	}
+	return b.String()
+}
@@ -21,12 +21,17 @@ import (
 	"github.com/akitasoftware/akita-libs/tags"
 	"github.com/akitasoftware/go-utils/math"
 	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/jpillora/backoff"
 	"github.com/pkg/errors"
 	"github.com/postmanlabs/postman-insights-agent/apispec"
 	"github.com/postmanlabs/postman-insights-agent/architecture"
 	"github.com/postmanlabs/postman-insights-agent/ci"
 	"github.com/postmanlabs/postman-insights-agent/deployment"
 	"github.com/postmanlabs/postman-insights-agent/env"
+	"github.com/postmanlabs/postman-insights-agent/integrations/eventsocket"
+	"github.com/postmanlabs/postman-insights-agent/integrations/otlp"
+	"github.com/postmanlabs/postman-insights-agent/integrations/postmancollection"
+	"github.com/postmanlabs/postman-insights-agent/integrations/statsd"
 	"github.com/postmanlabs/postman-insights-agent/location"
 	"github.com/postmanlabs/postman-insights-agent/pcap"
 	"github.com/postmanlabs/postman-insights-agent/plugin"
@@ -42,8 +47,12 @@ import (
 	"github.com/spf13/viper"
 )
 
-// TODO(kku): make pcap timings more robust (e.g. inject a sentinel packet to
-// mark start and end of pcap).
+// We inject sentinel packets on the loopback interface to detect when pcap is
+// ready and when it has caught up. These are the longest we wait for a
+// sentinel to be observed; when it isn't (e.g., because the loopback interface
+// isn't being captured), we wait for the full duration. Sentinels say nothing
+// about other interfaces, so we also wait for the full duration whenever a
+// non-loopback interface is captured.
 const (
 	// Empirically, it takes 1s for pcap to be ready to process packets.
 	// We budget for 5x to be safe.
@@ -59,6 +68,11 @@ const (
 
 	// Context timeout for telemetry upload
 	telemetryTimeout = 30 * time.Second
+
+	// Bounds on the delay between attempts to create a learn session during
+	// rotation.
+	learnSessionRetryMinBackoff = time.Second
+	learnSessionRetryMaxBackoff = 30 * time.Second
 )
 
 const (
@@ -102,6 +116,23 @@ type Args struct {
 	SampleRate         float64
 	WitnessesPerMinute float64
 
+	// If positive, the number of witnesses captured per minute for each
+	// endpoint, identified by its method, host, and path template.
+	EndpointRateLimit float64
+
+	// If positive, the number of witnesses captured per minute for each host,
+	// as given by the Host header.
+	HostRateLimit float64
+
+	// Fraction of successful HTTP exchanges to keep. Exchanges with an error
+	// response (4xx or 5xx) are always kept.
+	SuccessSampleRate float64
+
+	// HTTP requests with this header bypass sampling and rate limiting, along
+	// with their responses. Either a header name, which forces capture whenever
+	// the header is present, or "Name=value".
+	ForceCaptureHeader string
+
 	// If set, apidump will run the command in a subshell and terminate
 	// automatically when the subcommand terminates.
 	//
@@ -117,6 +148,19 @@ type Args struct {
 	// How often to rotate learn sessions; set to zero to disable rotation.
 	LearnSessionLifetime time.Duration
 
+	// Number of times to retry creating a learn session during rotation before
+	// staying on the current learn session.
+	LearnSessionRetries int
+
+	// If positive, learn sessions are also rotated once this many witnesses
+	// have been uploaded to the current one.
+	RotateAfterWitnesses int
+
+	// Maximum number of pcap handles open at once. If capturing on every
+	// interface would need more, only some are captured. Zero or less means
+	// there is no limit.
+	MaxPcapHandles int
+
 	// Print packet capture statistics after N seconds.
 	StatsLogDelay int
 
@@ -127,10 +171,27 @@ type Args struct {
 	ProcFSPollingInterval int
 
 	// Whether to report TCP connections and TLS handshakes.
+	//
+	// Deprecated: equivalent to setting both CollectTCPReports and
+	// CollectTLSReports.
 	CollectTCPAndTLSReports bool
 
+	// Whether to report TCP connections.
+	CollectTCPReports bool
+
+	// Whether to report TLS handshakes.
+	CollectTLSReports bool
+
+	// Connections tracked for TCP and TLS reports are evicted after being idle
+	// for this many seconds.
+	ConnectionIdleTimeout int
+
+	// Maximum number of connections tracked at once for TCP and TLS reports, per
+	// interface. Not enforced if non-positive.
+	MaxTrackedConnections int
+
 	// Parse TLS handshake messages (even if not reported)
-	// Invariant: this is true if CollectTCPAndTLSReports is true
+	// Invariant: this is true if CollectTLSReports is true
 	ParseTLSHandshakes bool
 
 	// The maximum witness size to upload. Anything larger is dropped.
@@ -140,6 +201,218 @@ type Args struct {
 	DockerExtensionMode bool
 	// The port to be used by the Docker Extension for health checks
 	HealthCheckPort int
+
+	// If set, witnesses sent to the backend are also exported as OpenTelemetry
+	// spans to this OTLP/HTTP endpoint.
+	OTLPEndpoint string
+
+	// Whether to group requests by their Idempotency-Key header, report
+	// endpoints with frequent client retries, and mark retried requests in the
+	// metadata passed to local outputs.
+	TrackIdempotency bool
+
+	// Whether to print each learn session to stdout, as a line of JSON, when it
+	// is created.
+	PrintSession bool
+
+	// If set along with PrintSession, learn sessions are also appended to this
+	// file.
+	PrintSessionFile string
+
+	// Uploads to the backend are paused after this many consecutive failures.
+	// If non-positive, uploads are paused only when the backend asks for it
+	// with a Retry-After header.
+	UploadFailureThreshold int
+
+	// How long, in seconds, to pause uploads after repeated failures.
+	UploadCooldown int
+
+	// Version of the monitored service (e.g., a git commit or build SHA),
+	// attached to the trace as a tag. Overrides the POSTMAN_SERVICE_VERSION
+	// environment variable.
+	ServiceVersion string
+
+	// If set, witnesses are reduced to the shape of each endpoint before
+	// upload: primitive values are zeroed, path segments that might hold
+	// values are replaced with parameters, and example values are removed.
+	// Applied after all plugins.
+	SchemaOnly bool
+
+	// In schema-only mode, the first this many witnesses of each combination of
+	// endpoint and response status keep their (obfuscated) values, as
+	// examples.
+	ExamplesPerEndpointStatus int
+
+	// Requests whose path ends in one of these file extensions, such as ".js",
+	// are dropped along with their responses. If empty, static assets are
+	// captured like any other request.
+	StaticExtensions []string
+
+	// How redirects are captured: "keep", "collapse", or "drop". Defaults to
+	// "keep".
+	RedirectPolicy string
+
+	// Path to a serialized FileDescriptorSet used to decode Protocol Buffers
+	// bodies whose message type is named in their Content-Type. Without it,
+	// only the field numbers and wire types of such bodies are recorded.
+	ProtoDescriptors string
+
+	// If set, a JSON manifest describing the capture is written to this file
+	// when apidump finishes. The manifest records the agent version, the
+	// capture settings, and summary counts, but no secrets.
+	ManifestOutput string
+
+	// If true, host names are replaced with pseudonyms that are consistent
+	// within a run in the local outputs: the trace files under Out.LocalPath,
+	// CollectionOutput, EventSocket, the S3 sink, and SummaryJSON. Traffic sent
+	// to the backend is not affected.
+	AnonymizeHostsLocal bool
+
+	// If set, the endpoints observed during the capture are compared against
+	// the API surface in this file, as written by BaselineOutput. Added,
+	// removed, and changed endpoints are printed, and apidump fails if there
+	// are any.
+	Baseline string
+
+	// If set, the endpoints observed during the capture, with their parameter
+	// names, are written to this file when apidump finishes.
+	BaselineOutput string
+
+	// If true, guidance meant for a first, interactive run is not printed,
+	// such as the warning that --filter is not set. Errors and the capture
+	// summary are still printed. Implied when running in CI.
+	QuietWarnings bool
+
+	// Maximum number of witnesses redacted at once, across all interfaces.
+	// Witnesses beyond the limit wait for a redaction to finish. If not
+	// positive, defaults to the number of CPUs that Go may use.
+	RedactionConcurrency int
+
+	// If positive, upload batches larger than this are split across several
+	// requests, for proxies and back ends that reject large request bodies.
+	MaxRequestSize_bytes int
+
+	// If true, request and response bodies are captured only for the first
+	// exchange on each connection.
+	FirstExchangeOnly bool
+
+	// If positive, serve endpoints on this port on localhost for pausing and
+	// resuming capture without ending the learn session: POST /admin/pause,
+	// POST /admin/resume, and GET /status.
+	AdminPort int
+
+	// Regular expressions matched against the SNI hostnames of TLS handshakes.
+	// If SNIAllowlist is non-empty, only handshakes with a matching hostname
+	// are reported. Handshakes matching SNIExclusions are not reported.
+	SNIAllowlist  []string
+	SNIExclusions []string
+
+	// If positive, request and response bodies smaller than BodySizeMin_bytes
+	// or larger than BodySizeMax_bytes are dropped, keeping the rest of the
+	// witness.
+	BodySizeMin_bytes int
+	BodySizeMax_bytes int
+
+	// If set, serve newline-delimited JSON events describing each witness sent
+	// to the backend on a Unix domain socket at this path, for local tools to
+	// tail. Events carry only metadata, never bodies.
+	EventSocket string
+
+	// If true, the scheme of Authorization and Proxy-Authorization headers in
+	// requests is captured, with the credential redacted.
+	KeepAuthScheme bool
+
+	// If true, measure the number of fields, nesting depth, and array lengths of
+	// bodies per endpoint, and report the most complex endpoints.
+	ShapeMetrics bool
+
+	// If S3Bucket is set, witnesses sent to the backend are also written in
+	// batches to this bucket of an S3-compatible object store. S3Endpoint
+	// overrides the AWS endpoint, e.g. for MinIO. Credentials and, if
+	// S3Region is empty, the region come from the AWS SDK's default sources,
+	// using S3Profile if set.
+	S3Bucket   string
+	S3Endpoint string
+	S3Region   string
+	S3Prefix   string
+	S3Profile  string
+
+	// Request headers whose values distinguish otherwise identical endpoints,
+	// e.g. an API version header.
+	GroupByHeaders []string
+
+	// If positive, the sample rate is lowered as the agent's resident set size
+	// approaches this many bytes, down to MemoryMinSampleRate, and restored as
+	// memory use falls. Memory use is read each time resource usage is polled.
+	MemoryThreshold_bytes uint64
+	MemoryMinSampleRate   float64
+
+	// If true, only HTTP exchanges that changed a resource are captured:
+	// POST, PUT, PATCH, and DELETE requests with a 2xx response.
+	SuccessfulMutationsOnly bool
+
+	// If set, the endpoints observed are written to this file as a Postman
+	// Collection when the capture ends, with examples taken from the redacted
+	// witnesses. Written whether or not witnesses are sent to the backend.
+	CollectionOutput string
+
+	// How requests are handled when their connection is reset before the
+	// response is seen: "wait", "emit", or "drop". Defaults to "wait". Any
+	// other handling requires TCP reports, which are enabled if needed.
+	OnConnectionReset string
+
+	// If set, agent metrics are sent to the StatsD server at this "host:port"
+	// address each time telemetry is reported, with names qualified by
+	// StatsDPrefix and tagged with StatsDTags.
+	StatsDAddress string
+	StatsDPrefix  string
+	StatsDTags    []string
+
+	// If positive, HTTP traffic observed in the first this-many seconds of
+	// capture is dropped, to ignore noisy startup traffic.
+	WarmupDelay int
+
+	// If positive, HTTP response bodies larger than this are dropped before
+	// they are parsed and redacted, keeping the rest of the witness. The
+	// number dropped is reported in the summary.
+	MaxResponseBodySize_bytes int
+
+	// If set, the value of this request header is kept verbatim on each
+	// witness instead of being obfuscated, so that witnesses can be matched
+	// with other telemetry for the same request.
+	CorrelationHeader string
+
+	// Additional BPF filters. Packets matching Filter or any of these are
+	// captured.
+	Filters []string
+
+	// If set, the capture summary is written to this file as JSON once capture
+	// stops, whether or not it stopped because of a signal.
+	SummaryJSON string
+
+	// If set, each request's raw query string is recorded in the metadata of
+	// its witness, with its values obfuscated or redacted like those of the
+	// parsed query parameters.
+	CaptureRawQuery bool
+
+	// Query parameters whose values are kept verbatim in raw query strings,
+	// unless a plugin redacts them. Only used with CaptureRawQuery.
+	RawQueryAllow []string
+
+	// If set, no learn session is created and no witnesses are uploaded.
+	// Instead, the requests that would have been captured are tallied and
+	// listed in the summary. Witnesses are still passed to other outputs,
+	// such as CollectionOutput.
+	DryRun bool
+	// If set, messages on connections upgraded to WebSocket are captured, each
+	// as its own witness. Text messages are captured with their content, and
+	// binary messages with only their size.
+	CaptureWebSocketMessages bool
+
+	// If positive, an HTTP response that is still streaming its body this many
+	// seconds after its headers arrived is captured with the part of the body
+	// seen so far. Otherwise, responses are captured once their bodies end.
+	StreamingResponseTimeoutSeconds int64
 }
 
 // TODO: either remove write-to-local-HAR-file completely,
@@ -153,13 +426,36 @@ type apidump struct {
 
 	startTime   time.Time
 	dumpSummary *Summary
+
+	// Bounds concurrent redaction by the backend collectors. Nil until the
+	// collectors are created.
+	redactionLimiter *trace.RedactionLimiter
+
+	// Lowers the sample rate under memory pressure. Nil if disabled.
+	memoryPressure *trace.MemoryPressureSampling
+
+	// Sends agent metrics to StatsD. Nil if disabled.
+	statsd *statsd.Client
+
+	// Learn sessions that witnesses were sent to, for the capture manifest.
+	learnSessionsMutex sync.Mutex
+	learnSessions      []akid.LearnSessionID
+
+	// Closed once packet capture has started.
+	started chan struct{}
+
+	// Closed to stop the capture, as SIGINT would. See Session.Stop.
+	stopRequested chan struct{}
+	stopOnce      sync.Once
 }
 
 // Start a new apidump session based on the given arguments.
 func newSession(args *Args) *apidump {
 	a := &apidump{
-		Args:      args,
-		startTime: time.Now(),
+		Args:          args,
+		startTime:     time.Now(),
+		started:       make(chan struct{}),
+		stopRequested: make(chan struct{}),
 	}
 	return a
 }
@@ -255,6 +551,206 @@ func (a *apidump) SendPacketTelemetry(observedDuration int) {
 	}
 
 	a.SendTelemetry(req)
+	a.SendEndpointSizeTelemetry()
+	a.SendEndpointRateTelemetry()
+	a.SendEndpointShapeTelemetry()
+	a.SendRedactionTelemetry()
+	a.SendRuntimeTelemetry()
+	a.SendTCPHealthTelemetry()
+	a.SendStatsDMetrics()
+}
+
+// Report request and response body sizes aggregated across endpoints. Hosts
+// and paths are not reported, since they may identify the customer or hold
+// values such as IDs.
+func (a *apidump) SendEndpointSizeTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() || a.dumpSummary == nil || a.dumpSummary.EndpointSizes == nil {
+		return
+	}
+
+	totals := a.dumpSummary.EndpointSizes.Totals()
+	if totals.Endpoints == 0 {
+		return
+	}
+
+	telemetry.EndpointSizes(map[string]any{
+		"endpoints":              totals.Endpoints,
+		"overflow":               totals.Overflow,
+		"max_avg_request_bytes":  totals.MaxAvgRequest_bytes,
+		"max_p95_request_bytes":  totals.MaxP95Request_bytes,
+		"max_avg_response_bytes": totals.MaxAvgResponse_bytes,
+		"max_p95_response_bytes": totals.MaxP95Response_bytes,
+	})
+}
+
+// Report body shapes aggregated across endpoints. Hosts and paths are not
+// reported, since they may identify the customer or hold values such as IDs.
+func (a *apidump) SendEndpointShapeTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() || a.dumpSummary == nil || a.dumpSummary.EndpointShapes == nil {
+		return
+	}
+
+	totals := a.dumpSummary.EndpointShapes.Totals()
+	if totals.Endpoints == 0 {
+		return
+	}
+
+	telemetry.EndpointShapes(map[string]any{
+		"endpoints":                totals.Endpoints,
+		"overflow":                 totals.Overflow,
+		"max_avg_fields":           totals.MaxAvgFields,
+		"max_p95_fields":           totals.MaxP95Fields,
+		"max_depth":                totals.MaxDepth,
+		"max_avg_max_array_length": totals.MaxAvgMaxArrayLength,
+		"max_p95_max_array_length": totals.MaxP95MaxArrayLength,
+	})
+}
+
+// Report request rates aggregated across endpoints. Hosts and paths are not
+// reported, since they may identify the customer or hold values such as IDs.
+func (a *apidump) SendEndpointRateTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() || a.dumpSummary == nil || a.dumpSummary.EndpointRates == nil {
+		return
+	}
+
+	totals := a.dumpSummary.EndpointRates.Totals()
+	if totals.Endpoints == 0 {
+		return
+	}
+
+	telemetry.EndpointRates(map[string]any{
+		"endpoints":    totals.Endpoints,
+		"overflow":     totals.Overflow,
+		"max_avg_rps":  totals.MaxAvgRPS,
+		"max_peak_rps": totals.MaxPeakRPS,
+	})
+}
+
+// Report how much witnesses waited to be redacted.
+func (a *apidump) SendRedactionTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() || a.redactionLimiter == nil {
+		return
+	}
+
+	stats := a.redactionLimiter.Stats()
+	if stats.Redactions == 0 {
+		return
+	}
+	telemetry.RedactionQueue(map[string]any{
+		"concurrency":      stats.Concurrency,
+		"redactions":       stats.Redactions,
+		"queued":           stats.Queued,
+		"max_queue_depth":  stats.MaxQueueDepth,
+		"avg_wait_seconds": stats.AvgWait().Seconds(),
+		"max_wait_seconds": stats.MaxWait.Seconds(),
+	})
+}
+
+// Report the agent's goroutine count, heap usage, and the sizes of its
+// internal data structures, so that growth can be spotted over time.
+func (a *apidump) SendRuntimeTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() {
+		return
+	}
+
+	stats := usage.GetRuntimeStats()
+	if stats == nil {
+		return
+	}
+
+	props := map[string]any{
+		"observed_at":      stats.ObservedAt,
+		"goroutines":       stats.Goroutines,
+		"heap_alloc_bytes": stats.HeapAlloc_bytes,
+		"heap_objects":     stats.HeapObjects,
+		"num_gc":           stats.NumGC,
+	}
+	for name, size := range stats.Sizes {
+		props[name+"_size"] = size
+	}
+	if a.memoryPressure != nil {
+		props["effective_sample_rate"] = a.memoryPressure.SampleRate()
+	}
+	telemetry.RuntimeStats(props)
+}
+
+// Send capture counts, upload outcomes, drops, and the sizes of internal data
+// structures to StatsD. Counts are running totals, so a missed report loses
+// no data. Unlike other telemetry, this is sent for local captures too.
+func (a *apidump) SendStatsDMetrics() {
+	if a.statsd == nil {
+		return
+	}
+
+	if a.dumpSummary != nil {
+		total := a.dumpSummary.FilterSummary.Total()
+		a.statsd.Count("tcp_packets", int64(total.TCPPackets))
+		a.statsd.Count("http_requests", int64(total.HTTPRequests))
+		a.statsd.Count("http_responses", int64(total.HTTPResponses))
+		a.statsd.Count("unparsed", int64(total.Unparsed))
+		a.statsd.Count("dropped.oversized_witnesses", int64(total.OversizedWitnesses))
+
+		if a.dumpSummary.StaticAssets != nil {
+			a.statsd.Count("dropped.static_assets", a.dumpSummary.StaticAssets.Dropped())
+		}
+		if a.dumpSummary.SuccessfulMutations != nil {
+			a.statsd.Count("dropped.unsuccessful_mutations", a.dumpSummary.SuccessfulMutations.Dropped())
+		}
+		if a.dumpSummary.Warmup != nil {
+			a.statsd.Count("dropped.warmup", a.dumpSummary.Warmup.Skipped())
+		}
+		if a.dumpSummary.ResponseBodyLimit != nil {
+			a.statsd.Count("dropped.response_bodies", a.dumpSummary.ResponseBodyLimit.Skipped())
+		}
+		if a.dumpSummary.UploadBreaker != nil {
+			stats := a.dumpSummary.UploadBreaker.Stats()
+			a.statsd.Count("uploads", int64(stats.Uploads))
+			a.statsd.Count("upload_errors", int64(stats.FailedUploads))
+			a.statsd.Count("dropped.paused_uploads", int64(stats.DroppedReports))
+		}
+	}
+
+	if stats := usage.GetRuntimeStats(); stats != nil {
+		a.statsd.Gauge("goroutines", float64(stats.Goroutines))
+		a.statsd.Gauge("heap_alloc_bytes", float64(stats.HeapAlloc_bytes))
+		for name, size := range stats.Sizes {
+			a.statsd.Gauge(name+"_size", float64(size))
+		}
+	}
+	a.statsd.Flush()
+}
+
+// Report the ports with the most TCP retransmissions and zero-window
+// advertisements.
+func (a *apidump) SendTCPHealthTelemetry() {
+	// Do not send packet capture telemetry for local captures.
+	if !a.TargetIsRemote() || a.dumpSummary == nil || a.dumpSummary.TCPHealth == nil {
+		return
+	}
+
+	byPort := a.dumpSummary.TCPHealth.ByPort()
+	if len(byPort) == 0 {
+		return
+	}
+	if len(byPort) > topNForSummary {
+		byPort = byPort[:topNForSummary]
+	}
+
+	ports := make([]map[string]any, 0, len(byPort))
+	for _, p := range byPort {
+		ports = append(ports, map[string]any{
+			"port":            p.Port,
+			"retransmissions": p.Retransmissions,
+			"zero_windows":    p.ZeroWindows,
+		})
+	}
+	total := a.dumpSummary.TCPHealth.Total()
+	telemetry.TCPHealth(total.Retransmissions, total.ZeroWindows, ports)
 }
 
 // Fill in the client ID and start time and send telemetry to the backend.
@@ -279,6 +775,35 @@ func (a *apidump) SendTelemetry(req *kgxapi.PostClientPacketCaptureStatsRequest)
 
 // Clean up the arguments and warn about any modifications.
 func (args *Args) lint() {
+	// The combined flag implies both kinds of reports.
+	if args.CollectTCPAndTLSReports {
+		args.CollectTCPReports = true
+		args.CollectTLSReports = true
+	}
+
+	// If we collect TLS reports, we have to parse TLS handshakes.
+	if args.CollectTLSReports && !args.ParseTLSHandshakes {
+		printer.Stderr.Warningf("Overriding parse-tls-handshakes=false because TLS report collection is enabled.\n")
+		args.ParseTLSHandshakes = true
+	}
+
+	// Scripted runs in CI don't need first-run guidance.
+	if !args.QuietWarnings && ci.InCI() {
+		printer.Debugln("CI detected; suppressing first-run guidance.")
+		args.QuietWarnings = true
+	}
+
+	// Connection resets are seen through the TCP connection tracker.
+	if args.OnConnectionReset != "" && !strings.EqualFold(args.OnConnectionReset, string(trace.WaitOnConnectionReset)) && !args.CollectTCPReports {
+		printer.Stderr.Warningf("Overriding collect-tcp-reports=false because --on-connection-reset is %q.\n", args.OnConnectionReset)
+		args.CollectTCPReports = true
+	}
+
+	// A zero idle timeout would evict connections as soon as they are seen.
+	if args.ConnectionIdleTimeout <= 0 {
+		args.ConnectionIdleTimeout = apispec.DefaultConnectionIdleTimeout_seconds
+	}
+
 	// Modifies the input to remove empty strings. Returns true if the input was
 	// modified.
 	removeEmptyStrings := func(strings []string) ([]string, bool) {
@@ -301,6 +826,7 @@ func (args *Args) lint() {
 	for paramName, argsPtr := range map[string]*[]string{
 		"--path-exclusions": &args.PathExclusions,
 		"--host-exclusions": &args.HostExclusions,
+		"--sni-exclude":     &args.SNIExclusions,
 	} {
 		modified := false
 		*argsPtr, modified = removeEmptyStrings(*argsPtr)
@@ -315,6 +841,7 @@ func (args *Args) lint() {
 	for paramName, argsPtr := range map[string]*[]string{
 		"--path-allow": &args.PathAllowlist,
 		"--host-allow": &args.HostAllowlist,
+		"--sni-allow":  &args.SNIAllowlist,
 	} {
 		modified := false
 		*argsPtr, modified = removeEmptyStrings(*argsPtr)
@@ -336,8 +863,8 @@ func collectTraceTags(args *Args) map[tags.Key]string {
 	if len(args.Interfaces) > 0 {
 		traceTags[tags.XAkitaDumpInterfacesFlag] = strings.Join(args.Interfaces, ",")
 	}
-	if args.Filter != "" {
-		traceTags[tags.XAkitaDumpFilterFlag] = args.Filter
+	if f := joinBPFFilters(args.bpfFilters()); f != "" {
+		traceTags[tags.XAkitaDumpFilterFlag] = f
 	}
 
 	// Set CI type and tags on trace
@@ -354,6 +881,10 @@ func collectTraceTags(args *Args) map[tags.Key]string {
 	traceTags[tags.XAkitaSource] = tags.DeploymentSource
 	deployment.UpdateTags(traceTags)
 
+	if args.ServiceVersion != "" {
+		traceTags[tags.XAkitaServiceVersion] = args.ServiceVersion
+	}
+
 	// Set source to user by default (if not CI or deployment)
 	if _, ok := traceTags[tags.XAkitaSource]; !ok {
 		traceTags[tags.XAkitaSource] = tags.UserSource
@@ -387,18 +918,92 @@ func (a *apidump) RotateLearnSession(done <-chan struct{}, collectors []trace.Le
 			return
 
 		case <-t.C:
-			traceName := util.RandomLearnSessionName()
-			backendLrn, err := util.NewLearnSession(args.Domain, args.ClientID, a.backendSvc, traceName, traceTags, nil)
-			if err != nil {
-				telemetry.Error("new learn session", err)
-				printer.Errorf("Failed to create trace %s: %v\n", traceName, err)
-				break
+			a.rotateLearnSessionOnce(done, collectors, traceTags)
+		}
+	}
+}
+
+// Creates a new learn session each time the current one has received the
+// number of witnesses set by RotateAfterWitnesses.
+func (a *apidump) rotateLearnSessionWhenFull(done <-chan struct{}, rotation *trace.WitnessCountRotation, collectors []trace.LearnSessionCollector, traceTags map[tags.Key]string) {
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-rotation.C():
+			if !a.rotateLearnSessionOnce(done, collectors, traceTags) {
+				rotation.Retry()
 			}
-			printer.Infof("Rotating to new trace on Postman Cloud: %v\n", traceName)
-			for _, c := range collectors {
-				c.SwitchLearnSession(backendLrn)
+		}
+	}
+}
+
+// Creates a new learn session with a random name and switches the given
+// collectors to it. If the session can't be created, the collectors stay on
+// their current session. Returns true if the collectors were switched.
+func (a *apidump) rotateLearnSessionOnce(done <-chan struct{}, collectors []trace.LearnSessionCollector, traceTags map[tags.Key]string) bool {
+	traceName := util.RandomLearnSessionName()
+	backendLrn, err := a.createRotatedLearnSession(done, traceName, traceTags)
+	if err != nil {
+		telemetry.Error("rotate learn session", err)
+		printer.Errorf("Failed to rotate to new trace %s, continuing with the current trace: %v\n", traceName, err)
+		return false
+	}
+	printer.Infof("Rotating to new trace on Postman Cloud: %v\n", traceName)
+	uri := &akiuri.URI{
+		ObjectType:  akiuri.TRACE.Ptr(),
+		ServiceName: a.Out.AkitaURI.ServiceName,
+		ObjectName:  traceName,
+	}
+	if err := a.emitSession(uri, backendLrn); err != nil {
+		printer.Errorf("%v\n", err)
+	}
+	a.recordLearnSession(backendLrn)
+	for _, c := range collectors {
+		c.SwitchLearnSession(backendLrn)
+	}
+	telemetry.Success("rotate learn session")
+	return true
+}
+
+// Creates a learn session with the given name for rotation. As when the
+// initial learn session is created, a session that already exists with the
+// name is used instead. Other failures are retried with backoff, up to
+// LearnSessionRetries times, or until done is closed.
+func (a *apidump) createRotatedLearnSession(done <-chan struct{}, traceName string, traceTags map[tags.Key]string) (akid.LearnSessionID, error) {
+	retryBackoff := &backoff.Backoff{
+		Min:    learnSessionRetryMinBackoff,
+		Max:    learnSessionRetryMaxBackoff,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 0; ; attempt++ {
+		backendLrn, err := util.NewLearnSessionWithClient(a.learnClient, traceName, traceTags, nil)
+		if err == nil {
+			return backendLrn, nil
+		}
+
+		var httpErr rest.HTTPError
+		if ok := errors.As(err, &httpErr); ok && httpErr.StatusCode == 409 {
+			backendLrn, err = util.GetLearnSessionIDByName(a.learnClient, traceName)
+			if err == nil {
+				printer.Infof("Adding to existing trace %s\n", traceName)
+				return backendLrn, nil
 			}
-			telemetry.Success("rotate learn session")
+			err = errors.Wrapf(err, "failed to lookup ID for existing trace %s", traceName)
+		}
+
+		if attempt >= a.LearnSessionRetries {
+			return akid.LearnSessionID{}, err
+		}
+		printer.Debugf("Failed to create trace %s, retrying: %v\n", traceName, err)
+
+		select {
+		case <-done:
+			return akid.LearnSessionID{}, err
+		case <-time.After(retryBackoff.Duration()):
 		}
 	}
 }
@@ -419,8 +1024,13 @@ func (a *apidump) TelemetryWorker(done <-chan struct{}) {
 	a.SendInitialTelemetry()
 
 	if a.StatsLogDelay > 0 {
-		// Wait while capturing statistics.
-		time.Sleep(time.Duration(a.StatsLogDelay) * time.Second)
+		// Wait while capturing statistics. If capture stops first, the final
+		// report sent by SendFinalTelemetry takes the place of this one.
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Duration(a.StatsLogDelay) * time.Second):
+		}
 
 		// Print telemetry data.
 		printer.Stderr.Infof("Printing packet capture statistics after %d seconds of capture.\n", a.StatsLogDelay)
@@ -445,6 +1055,46 @@ func (a *apidump) TelemetryWorker(done <-chan struct{}) {
 	}
 }
 
+// Goroutine to send StatsD metrics every args.TelemetryInterval seconds, for
+// local captures, which don't otherwise send telemetry. Stops when "done" is
+// closed.
+func (a *apidump) StatsDWorker(done <-chan struct{}) {
+	if a.TelemetryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(a.TelemetryInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			a.SendStatsDMetrics()
+		}
+	}
+}
+
+// Sends a final packet-capture report covering the whole run. Should be
+// called once capture has stopped and all collectors have been flushed, so
+// that the report includes complete packet counts however the run ended.
+//
+// Omits if neither args.StatsLogDelay nor args.TelemetryInterval is positive.
+func (a *apidump) SendFinalTelemetry() {
+	if a.StatsLogDelay <= 0 && a.TelemetryInterval <= 0 {
+		return
+	}
+
+	// The observed duration is the key for upserting packet telemetry. If the
+	// run ended before the first report was due, report under the same
+	// duration as the initial telemetry so that the two are combined.
+	duration := int(time.Since(a.startTime) / time.Second)
+	if duration < a.StatsLogDelay {
+		duration = a.StatsLogDelay
+	}
+	a.SendPacketTelemetry(duration)
+}
+
 type interfaceError struct {
 	interfaceName string
 	err           error
@@ -453,25 +1103,11 @@ type interfaceError struct {
 // Captures packets from the network and adds them to a trace. The trace is
 // created if it doesn't already exist.
 func Run(args Args) error {
-	errChan := make(chan error)
-
-	// The Docker extension expects a health-check server to be running. Only
-	// start this server if it's needed.
-	if args.DockerExtensionMode {
-		go func() {
-			errChan <- startHealthCheckServer(args.HealthCheckPort)
-		}()
+	s, err := Start(args)
+	if err != nil {
+		return err
 	}
-
-	// Run the main packet-capture loop.
-	go func() {
-		args.lint()
-
-		a := newSession(&args)
-		errChan <- a.Run()
-	}()
-
-	return <-errChan
+	return s.Wait()
 }
 
 func (a *apidump) Run() error {
@@ -493,6 +1129,19 @@ func (a *apidump) Run() error {
 		printer.Debugln("Capturing filtered traffic for debugging.")
 	}
 
+	defer resetParserOptions()
+	if err := setParserOptions(args); err != nil {
+		return err
+	}
+
+	var baseline []trace.SurfaceEndpoint
+	if args.Baseline != "" {
+		baseline, err = trace.ReadAPISurface(args.Baseline)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Get the interfaces to listen on.
 	interfaces, err := getEligibleInterfaces(args.Interfaces)
 	if err != nil {
@@ -500,8 +1149,29 @@ func (a *apidump) Run() error {
 		return errors.Wrap(err, "No network interfaces could be used")
 	}
 
+	// Each interface needs a pcap handle, or two when also capturing the
+	// negation of the user's filters. Capture on only as many interfaces as
+	// --max-pcap-handles allows, so as not to run out of file descriptors.
+	handlesPerInterface := 1
+	if capturingNegation {
+		handlesPerInterface = 2
+	}
+	numInterfaces := len(interfaces)
+	if skipped := limitInterfaces(interfaces, handlesPerInterface, args.MaxPcapHandles); len(skipped) > 0 {
+		if len(interfaces) == 0 {
+			return errors.Errorf("--max-pcap-handles is %d, but capturing on an interface needs %d pcap handles", args.MaxPcapHandles, handlesPerInterface)
+		}
+		printer.Stderr.Warningf("At most %d pcap handles may be open, so capturing on only %d of %d interfaces. Not capturing on: %s\n",
+			args.MaxPcapHandles, len(interfaces), numInterfaces, strings.Join(skipped, ", "))
+	}
+
 	// Build the user-specified filter and its negation for each interface.
-	userFilters, negationFilters, err := createBPFFilters(interfaces, args.Filter, capturingNegation, 0)
+	filter, err := combineBPFFilters(args.bpfFilters())
+	if err != nil {
+		a.SendErrorTelemetry(api_schema.ApidumpError_InvalidFilters, err)
+		return err
+	}
+	userFilters, negationFilters, err := createBPFFilters(interfaces, filter, capturingNegation, 0)
 	if err != nil {
 		// Unfortunately the filters aren't actually parsed here.
 		// An error will show up below when we call pcap.Collect()
@@ -536,6 +1206,16 @@ func (a *apidump) Run() error {
 		a.SendErrorTelemetry(api_schema.ApidumpError_InvalidFilters, err)
 		return err
 	}
+	sniAllowlist, err := compileRegexps(args.SNIAllowlist, "SNI filter")
+	if err != nil {
+		a.SendErrorTelemetry(api_schema.ApidumpError_InvalidFilters, err)
+		return err
+	}
+	sniExclusions, err := compileRegexps(args.SNIExclusions, "SNI exclusion")
+	if err != nil {
+		a.SendErrorTelemetry(api_schema.ApidumpError_InvalidFilters, err)
+		return err
+	}
 
 	// Validate args.Out and fill in any missing defaults.
 	if uri := args.Out.AkitaURI; uri != nil {
@@ -549,7 +1229,7 @@ func (a *apidump) Run() error {
 		if uri.ObjectName == "" {
 			uri.ObjectName = util.RandomLearnSessionName()
 		} else {
-			if args.LearnSessionLifetime != time.Duration(0) {
+			if args.LearnSessionLifetime != time.Duration(0) || args.RotateAfterWitnesses > 0 {
 				return errors.Errorf("Cannot automatically rotate sessions when a session name is provided.")
 			}
 		}
@@ -575,7 +1255,9 @@ func (a *apidump) Run() error {
 	// If the output is targeted at the backend, create a shared backend
 	// learn session.
 	var backendLrn akid.LearnSessionID
-	if a.TargetIsRemote() {
+	if a.TargetIsRemote() && args.DryRun {
+		printer.Stderr.Infof("Dry run: not creating a trace or uploading witnesses.\n")
+	} else if a.TargetIsRemote() {
 		uri := a.Out.AkitaURI
 		backendLrn, err = util.NewLearnSession(args.Domain, args.ClientID, a.backendSvc, uri.ObjectName, traceTags, nil)
 		if err == nil {
@@ -593,6 +1275,190 @@ func (a *apidump) Run() error {
 				return errors.Wrap(err, "failed to create trace or fetch existing trace")
 			}
 		}
+		if err := a.emitSession(uri, backendLrn); err != nil {
+			return err
+		}
+		a.recordLearnSession(backendLrn)
+	}
+
+	// Shared by all local outputs, so that a host gets the same pseudonym in
+	// each of them and on every interface.
+	var hostAnonymizer *trace.HostAnonymizer
+	if args.AnonymizeHostsLocal {
+		hostAnonymizer, err = trace.NewHostAnonymizer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Wraps a sink that writes witnesses to a local output, anonymizing hosts
+	// if requested.
+	localSink := func(sink trace.WitnessSink) trace.WitnessSink {
+		if hostAnonymizer != nil {
+			return hostAnonymizer.NewSink(sink)
+		}
+		return sink
+	}
+
+	// If requested, export witnesses as OpenTelemetry spans in addition to
+	// uploading them.
+	var witnessSinks []trace.WitnessSink
+	if args.OTLPEndpoint != "" {
+		serviceName := a.backendSvcName
+		if serviceName == "" {
+			serviceName = "unknown_service"
+		}
+		exporter, err := otlp.NewExporter(args.OTLPEndpoint, serviceName, traceTags)
+		if err != nil {
+			return errors.Wrap(err, "failed to create OTLP exporter")
+		}
+		defer exporter.Close()
+		witnessSinks = append(witnessSinks, exporter)
+		printer.Stderr.Infof("Exporting OpenTelemetry spans to %s\n", args.OTLPEndpoint)
+	}
+
+	// Likewise, stream witness events to local consumers.
+	if args.EventSocket != "" {
+		server, err := eventsocket.NewServer(args.EventSocket)
+		if err != nil {
+			return errors.Wrap(err, "failed to create event socket")
+		}
+		defer server.Close()
+		witnessSinks = append(witnessSinks, localSink(server))
+		printer.Stderr.Infof("Streaming witness events to %s\n", args.EventSocket)
+	}
+
+	// Likewise, write witnesses to an object store.
+	if args.S3Bucket != "" {
+		sink, err := newS3Sink(args)
+		if err != nil {
+			return errors.Wrap(err, "failed to create S3 sink")
+		}
+		defer sink.Close()
+		witnessSinks = append(witnessSinks, localSink(sink))
+		printer.Stderr.Infof("Writing witnesses to S3 bucket %s\n", args.S3Bucket)
+	}
+
+	// Likewise, build a Postman Collection of the endpoints observed.
+	if args.CollectionOutput != "" {
+		name := a.backendSvcName
+		if name == "" {
+			name = "Postman Insights capture"
+		}
+		writer, err := postmancollection.NewWriter(args.CollectionOutput, name)
+		if err != nil {
+			return err
+		}
+		defer writer.Close()
+		witnessSinks = append(witnessSinks, localSink(writer))
+	}
+
+	// Likewise, count witnesses for StatsD.
+	if args.StatsDAddress != "" {
+		client, err := statsd.NewClient(args.StatsDAddress, args.StatsDPrefix, args.StatsDTags)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		witnessSinks = append(witnessSinks, client)
+		a.statsd = client
+		printer.Stderr.Infof("Sending agent metrics to StatsD at %s\n", args.StatsDAddress)
+	}
+
+	// Track body sizes per endpoint for witnesses sent to the backend.
+	endpointSizes := trace.NewEndpointSizeStats()
+	witnessSinks = append(witnessSinks, endpointSizes)
+
+	// Likewise, count response statuses per endpoint.
+	endpointStatuses := trace.NewEndpointStatusStats()
+	witnessSinks = append(witnessSinks, endpointStatuses)
+
+	// And measure request rates per endpoint.
+	endpointRates := trace.NewEndpointRateStats()
+	witnessSinks = append(witnessSinks, endpointRates)
+
+	// Measure body shapes per endpoint, if requested.
+	var endpointShapes *trace.EndpointShapeStats
+	if args.ShapeMetrics {
+		endpointShapes = trace.NewEndpointShapeStats()
+		witnessSinks = append(witnessSinks, endpointShapes)
+	}
+
+	// Collect the API surface, if it is to be compared or saved.
+	var apiSurface *trace.APISurface
+	if args.Baseline != "" || args.BaselineOutput != "" {
+		apiSurface = trace.NewAPISurface()
+		witnessSinks = append(witnessSinks, apiSurface)
+	}
+
+	// Shared by the backend collectors for all interfaces, so that requests and
+	// responses captured on different interfaces can be detected.
+	asymmetricRouting := trace.NewAsymmetricRoutingDetector()
+
+	connTrackerLimits := trace.ConnectionTrackerLimits{
+		IdleTimeout:    time.Duration(args.ConnectionIdleTimeout) * time.Second,
+		MaxConnections: args.MaxTrackedConnections,
+	}
+	connEvictions := trace.NewConnectionEvictions()
+
+	// Shared by the backend collectors for all interfaces, so that a backend
+	// outage pauses uploads from all of them.
+	var uploadBreaker *trace.UploadCircuitBreaker
+	if a.TargetIsRemote() {
+		uploadBreaker = trace.NewUploadCircuitBreaker(args.UploadFailureThreshold, time.Duration(args.UploadCooldown)*time.Second)
+	}
+
+	// Shared by the backend collectors for all interfaces, so that redaction
+	// is bounded across interfaces.
+	a.redactionLimiter = trace.NewRedactionLimiter(args.RedactionConcurrency)
+
+	// Shared by the collectors for all interfaces, so that capture on all of
+	// them is paused and resumed together.
+	capturePause := trace.NewCapturePause()
+	if args.AdminPort > 0 {
+		adminServer, err := startAdminServer(args.AdminPort, capturePause)
+		if err != nil {
+			return err
+		}
+		defer adminServer.Close()
+		printer.Stderr.Infof("Serving admin endpoints on localhost:%d\n", args.AdminPort)
+	}
+
+	// Shared by the backend collectors for all interfaces, so that the number
+	// of examples kept in schema-only mode is bounded across interfaces.
+	var schemaOnly *trace.SchemaOnlyPolicy
+	if args.SchemaOnly {
+		schemaOnly = trace.NewSchemaOnlyPolicy(args.ExamplesPerEndpointStatus)
+	}
+
+	var idempotency *trace.IdempotencyTracker
+	if args.TrackIdempotency {
+		idempotency = trace.NewIdempotencyTracker()
+	}
+
+	httpVersions := trace.NewHTTPVersionCounter()
+	internalTraffic := trace.NewInternalTrafficDetector(interfaceIPs(interfaces))
+	grpcCalls := trace.NewGRPCCallCounter()
+
+	// Shared by the collectors for all interfaces, so that dropped exchanges
+	// are counted across interfaces.
+	var successfulMutations *trace.SuccessfulMutationFilter
+	if args.SuccessfulMutationsOnly {
+		successfulMutations = trace.NewSuccessfulMutationFilter()
+	}
+
+	// Shared by the collectors for all interfaces, so that dropped requests are
+	// counted across interfaces.
+	var staticAssets *trace.StaticAssetFilter
+	if len(args.StaticExtensions) > 0 {
+		staticAssets = trace.NewStaticAssetFilter(args.StaticExtensions)
+	}
+
+	// Shared by the collectors for all interfaces, so that excluded TLS
+	// handshakes are counted across interfaces.
+	var sniFilter *trace.SNIFilter
+	if len(sniAllowlist) > 0 || len(sniExclusions) > 0 {
+		sniFilter = trace.NewSNIFilter(sniAllowlist, sniExclusions)
 	}
 
 	// Initialize packet counts
@@ -609,9 +1475,73 @@ func (a *apidump) Run() error {
 		defer rateLimit.Stop()
 	}
 
+	// Shared by the collectors for all interfaces, so that each endpoint's and
+	// host's limit applies across interfaces.
+	var endpointRateLimit *trace.EndpointRateLimit
+	if args.EndpointRateLimit > 0 {
+		endpointRateLimit = trace.NewEndpointRateLimit(args.EndpointRateLimit)
+	}
+	var hostRateLimit *trace.PerHostRateLimit
+	if args.HostRateLimit > 0 {
+		hostRateLimit = trace.NewPerHostRateLimit(args.HostRateLimit)
+	}
+
+	// Shared by the sampling collectors for all interfaces, and adjusted each
+	// time resource usage is polled.
+	if args.MemoryThreshold_bytes > 0 {
+		a.memoryPressure = trace.NewMemoryPressureSampling(args.SampleRate, args.MemoryMinSampleRate, args.MemoryThreshold_bytes/1024)
+		unregister := usage.RegisterPollListener(func(_ *api_schema.AgentResourceUsage, latestVmHWM_kB uint64) {
+			a.memoryPressure.Update(latestVmHWM_kB)
+		})
+		defer unregister()
+	}
+
+	redirectPolicy := trace.RedirectKeep
+	if args.RedirectPolicy != "" {
+		redirectPolicy, err = trace.ParseRedirectPolicy(args.RedirectPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rawQuery *trace.RawQueryPolicy
+	if args.CaptureRawQuery {
+		rawQuery = trace.NewRawQueryPolicy(args.RawQueryAllow)
+	}
+
+	connectionResets := trace.WaitOnConnectionReset
+	if args.OnConnectionReset != "" {
+		connectionResets, err = trace.ParseConnectionResetHandling(args.OnConnectionReset)
+		if err != nil {
+			return err
+		}
+	}
+
+	var forceCapture *trace.ForceCaptureHeader
+	if args.ForceCaptureHeader != "" {
+		header, err := trace.ParseForceCaptureHeader(args.ForceCaptureHeader)
+		if err != nil {
+			return err
+		}
+		forceCapture = &header
+	}
+
 	// Backend collectors that need trace rotation
 	var toRotate []trace.LearnSessionCollector
 
+	// Shared by the backend collectors for all interfaces, since they upload
+	// to the same learn session.
+	var witnessCountRotation *trace.WitnessCountRotation
+	if args.RotateAfterWitnesses > 0 {
+		witnessCountRotation = trace.NewWitnessCountRotation(args.RotateAfterWitnesses)
+	}
+
+	// Stands in for the backend collectors during a dry run.
+	var dryRun *trace.DryRunTally
+	if args.DryRun {
+		dryRun = trace.NewDryRunTally()
+	}
+
 	a.dumpSummary = NewSummary(
 		capturingNegation,
 		interfaces,
@@ -621,12 +1551,61 @@ func (a *apidump) Run() error {
 		prefilterSummary,
 		negationSummary,
 	)
+	a.dumpSummary.EndpointSizes = endpointSizes
+	a.dumpSummary.EndpointStatuses = endpointStatuses
+	a.dumpSummary.EndpointRates = endpointRates
+	a.dumpSummary.AsymmetricRouting = asymmetricRouting
+	a.dumpSummary.Idempotency = idempotency
+	a.dumpSummary.ConnEvictions = connEvictions
+	a.dumpSummary.UploadBreaker = uploadBreaker
+	a.dumpSummary.HTTPVersions = httpVersions
+	a.dumpSummary.StaticAssets = staticAssets
+	a.dumpSummary.QuietWarnings = args.QuietWarnings
+	a.dumpSummary.SNIFilter = sniFilter
+	a.dumpSummary.EndpointShapes = endpointShapes
+	a.dumpSummary.SuccessfulMutations = successfulMutations
+	a.dumpSummary.InternalTraffic = internalTraffic
+	a.dumpSummary.GRPCCalls = grpcCalls
+	a.dumpSummary.DryRun = dryRun
+	a.dumpSummary.Plugins = args.Plugins
+	a.dumpSummary.HostAnonymizer = hostAnonymizer
+
+	// Shared by the collectors for all interfaces, so that warm-up ends on all
+	// of them at once.
+	var warmup *trace.WarmupFilter
+	if args.WarmupDelay > 0 {
+		warmup = trace.NewWarmupFilter(time.Now(), time.Duration(args.WarmupDelay)*time.Second)
+		a.dumpSummary.Warmup = warmup
+		printer.Stderr.Infof("Ignoring HTTP traffic for the first %d seconds of capture.\n", args.WarmupDelay)
+	}
+
+	var responseBodyLimit *trace.ResponseBodyLimit
+	if args.MaxResponseBodySize_bytes > 0 {
+		responseBodyLimit = trace.NewResponseBodyLimit(args.MaxResponseBodySize_bytes)
+		a.dumpSummary.ResponseBodyLimit = responseBodyLimit
+	}
 
 	// Synchronization for collectors + collector errors, each of which is run in a separate goroutine.
 	var doneWG sync.WaitGroup
 	doneWG.Add(len(userFilters) + len(negationFilters))
 	errChan := make(chan interfaceError, len(userFilters)+len(negationFilters)) // buffered enough so it never blocks
 	stop := make(chan struct{})
+	sentinel := pcap.NewSentinel()
+	awaitSentinel := func(kind pcap.SentinelKind, timeout time.Duration) {
+		if onlyLoopbackInterfaces(interfaces) {
+			sentinel.Await(kind, timeout)
+		} else {
+			time.Sleep(timeout)
+		}
+	}
+
+	// Detect retransmissions and zero-window advertisements, to help tell
+	// network congestion apart from a slow application.
+	var tcpHealth *pcap.TCPHealth
+	if args.CollectTCPReports {
+		tcpHealth = pcap.NewTCPHealth()
+		a.dumpSummary.TCPHealth = tcpHealth
+	}
 
 	// If we're sending traffic to the cloud, then start telemetry and stop
 	// when the main collection process does.
@@ -644,8 +1623,21 @@ func (a *apidump) Run() error {
 		}
 
 		go a.TelemetryWorker(stop)
+	} else {
+		// Resource usage is otherwise only polled for telemetry.
+		if a.memoryPressure != nil || a.statsd != nil {
+			go usage.Poll(stop, 0, time.Duration(a.ProcFSPollingInterval)*time.Second)
+		}
+
+		// StatsD metrics are otherwise sent with telemetry.
+		if a.statsd != nil {
+			go a.StatsDWorker(stop)
+		}
 	}
 
+	// Each collector holds a pcap handle while it runs.
+	warnIfNearFDLimit(len(userFilters) + len(negationFilters))
+
 	// Start collecting -- set up one or two collectors per interface, depending on whether filters are in use
 	numCollectors := 0
 	for _, filterState := range []filterState{matchedFilter, notMatchedFilter} {
@@ -662,6 +1654,10 @@ func (a *apidump) Run() error {
 		for interfaceName, filter := range filters {
 			var collector trace.Collector
 
+			// Passes redirect chains from the redirect collector to the back-end
+			// collector.
+			redirectChains := trace.NewRedirectChains()
+
 			// Build collectors from the inside out (last applied to first applied).
 			//  8. Back-end collector (sink).
 			//  7. Statistics.
@@ -680,37 +1676,92 @@ func (a *apidump) Run() error {
 				// however.
 				collector = trace.NewDummyCollector()
 			} else {
+				if args.Out.AkitaURI == nil && args.Out.LocalPath == nil {
+					return errors.Errorf("invalid output location")
+				}
+
 				var localCollector trace.Collector
 				if args.Out.LocalPath != nil {
 					if lc, err := createLocalCollector(interfaceName, *args.Out.LocalPath, traceTags); err == nil {
 						localCollector = lc
+						if hostAnonymizer != nil {
+							localCollector = hostAnonymizer.NewCollector(lc)
+						}
 					} else {
 						return err
 					}
 				}
 
-				var backendCollector trace.Collector
-				if args.Out.AkitaURI != nil && args.Out.LocalPath != nil {
-					backendCollector = trace.NewBackendCollector(a.backendSvc, backendLrn, a.learnClient, optionals.Some(a.MaxWitnessSize_bytes), summary, args.Plugins)
-					collector = trace.TeeCollector{
-						Dst1: backendCollector,
-						Dst2: localCollector,
+				// Processes witnesses and passes them to the witness sinks. Uploads
+				// them too, unless there is no backend or this is a dry run. Without
+				// uploads, witnesses are still processed for any witness sinks, so
+				// that local sinks such as --collection-output don't depend on the
+				// backend.
+				uploading := args.Out.AkitaURI != nil && dryRun == nil
+				var backendCollector *trace.BackendCollector
+				if uploading {
+					backendCollector = trace.NewBackendCollector(a.backendSvc, backendLrn, a.learnClient, optionals.Some(a.MaxWitnessSize_bytes), summary, args.Plugins).(*trace.BackendCollector)
+					backendCollector.SetWitnessSinks(witnessSinks)
+					backendCollector.SetAsymmetricRoutingDetector(asymmetricRouting)
+					backendCollector.SetUploadCircuitBreaker(uploadBreaker)
+					if args.MaxRequestSize_bytes > 0 {
+						backendCollector.SetMaxUploadRequestSize(args.MaxRequestSize_bytes)
 					}
-				} else if args.Out.AkitaURI != nil {
-					backendCollector = trace.NewBackendCollector(a.backendSvc, backendLrn, a.learnClient, optionals.Some(a.MaxWitnessSize_bytes), summary, args.Plugins)
-					collector = backendCollector
-				} else if args.Out.LocalPath != nil {
-					collector = localCollector
-				} else {
-					return errors.Errorf("invalid output location")
+				} else if len(witnessSinks) > 0 {
+					backendCollector = trace.NewSinkCollector(args.Plugins, witnessSinks)
+				}
+				if backendCollector != nil {
+					backendCollector.SetSchemaOnlyPolicy(schemaOnly)
+					backendCollector.SetRedactionLimiter(a.redactionLimiter)
+					backendCollector.SetConnectionResetHandling(connectionResets)
+					backendCollector.SetRedirectChains(redirectChains)
+					backendCollector.SetIdempotencyTracker(idempotency)
+					if rawQuery != nil {
+						backendCollector.SetRawQueryPolicy(rawQuery)
+					}
+				}
+				if uploading {
+					if witnessCountRotation != nil {
+						backendCollector.SetWitnessCountRotation(witnessCountRotation)
+					}
+					toRotate = append(toRotate, backendCollector)
 				}
 
-				// If the backend collector supports rotation of learn session ID, then set that up.
-				if lsc, ok := backendCollector.(trace.LearnSessionCollector); ok && lsc != nil {
-					toRotate = append(toRotate, lsc)
+				// Send traffic to each of the outputs in use.
+				var outputs []trace.Collector
+				if dryRun != nil {
+					outputs = append(outputs, dryRun.NewCollector())
+				}
+				if backendCollector != nil {
+					outputs = append(outputs, backendCollector)
+				}
+				if localCollector != nil {
+					outputs = append(outputs, localCollector)
+				}
+				collector = outputs[0]
+				for _, output := range outputs[1:] {
+					collector = trace.TeeCollector{
+						Dst1: collector,
+						Dst2: output,
+					}
 				}
 			}
 
+			// Drop witnesses while capture is paused.
+			if filterState == matchedFilter {
+				collector = capturePause.NewCollector(collector)
+			}
+
+			// Drop witnesses during warm-up.
+			if filterState == matchedFilter && warmup != nil {
+				collector = warmup.NewCollector(collector)
+			}
+
+			// Report TLS handshakes only for matching SNI hostnames.
+			if filterState == matchedFilter && sniFilter != nil {
+				collector = sniFilter.NewCollector(collector)
+			}
+
 			// Statistics.
 			//
 			// Count packets that have *passed* filtering (so that we know whether the
@@ -721,13 +1772,71 @@ func (a *apidump) Run() error {
 				Collector:    collector,
 			}
 
-			// Subsampling.
-			collector = trace.NewSamplingCollector(args.SampleRate, collector)
+			// Subsampling. Requests with the force-capture header, and their
+			// responses, skip it.
+			unsampled := collector
+			collector = trace.NewErrorPreservingSamplingCollector(args.SuccessSampleRate, collector)
+			if a.memoryPressure != nil {
+				collector = a.memoryPressure.NewCollector(collector)
+			} else {
+				collector = trace.NewSamplingCollector(args.SampleRate, collector)
+			}
 			if rateLimit != nil {
 				collector = rateLimit.NewCollector(collector)
 			}
+			if endpointRateLimit != nil {
+				collector = endpointRateLimit.NewCollector(collector)
+			}
+			if hostRateLimit != nil {
+				collector = hostRateLimit.NewCollector(collector)
+			}
+			if forceCapture != nil {
+				collector = trace.NewForceCaptureCollector(*forceCapture, collector, unsampled)
+			}
 
-			// Path and host filters.
+			// Retry tracking sees all traffic that passes the filters, so that
+			// sampling doesn't hide retries.
+			if idempotency != nil {
+				collector = idempotency.NewCollector(collector)
+			}
+
+			// Likewise, count HTTP versions before sampling, so that requests
+			// aren't under-represented relative to connections.
+			if filterState == matchedFilter {
+				collector = httpVersions.NewCollector(collector)
+				collector = internalTraffic.NewCollector(collector)
+				collector = grpcCalls.NewCollector(collector)
+			}
+
+			// Apply the redirect policy to traffic that passes the filters below.
+			if filterState == matchedFilter {
+				collector = trace.NewRedirectCollector(redirectPolicy, redirectChains, collector)
+			}
+
+			// Strip bodies from all but the first exchange on each connection.
+			if filterState == matchedFilter && args.FirstExchangeOnly {
+				collector = trace.NewFirstExchangeCollector(collector)
+			}
+
+			// Strip bodies outside the configured size range.
+			if filterState == matchedFilter {
+				collector = trace.NewBodySizeFilterCollector(args.BodySizeMin_bytes, args.BodySizeMax_bytes, collector)
+			}
+
+			// Strip response bodies over the size limit.
+			if filterState == matchedFilter && responseBodyLimit != nil {
+				collector = responseBodyLimit.NewCollector(collector)
+			}
+
+			// Path and host filters. Static assets and exchanges other than
+			// successful mutations are dropped after the user's filters, so that
+			// only requests that would otherwise be captured are counted.
+			if filterState == matchedFilter && successfulMutations != nil {
+				collector = successfulMutations.NewCollector(collector)
+			}
+			if filterState == matchedFilter && staticAssets != nil {
+				collector = staticAssets.NewCollector(collector)
+			}
 			if len(hostExclusions) > 0 {
 				collector = trace.NewHTTPHostFilterCollector(hostExclusions, collector)
 			}
@@ -758,12 +1867,14 @@ func (a *apidump) Run() error {
 
 			// If this is false, we will still parse TLS client and server hello messages
 			// but not process them futher.
-			if args.CollectTCPAndTLSReports {
+			if args.CollectTLSReports {
 				// Process TLS traffic into TLS-connection metadata.
-				collector = tls_conn_tracker.NewCollector(collector)
+				collector = tls_conn_tracker.NewCollector(collector, connTrackerLimits, connEvictions)
+			}
 
+			if args.CollectTCPReports {
 				// Process TCP-packet metadata into TCP-connection metadata.
-				collector = tcp_conn_tracker.NewCollector(collector)
+				collector = tcp_conn_tracker.NewCollector(collector, connTrackerLimits, connEvictions)
 			}
 
 			// Compute the share of the page cache that each collection process may use.
@@ -773,11 +1884,12 @@ func (a *apidump) Run() error {
 			numCollectors++
 			go func(interfaceName, filter string) {
 				defer doneWG.Done()
+
 				// Collect trace. This blocks until stop is closed or an error occurs.
-				if err := pcap.Collect(stop, interfaceName, filter, bufferShare, args.ParseTLSHandshakes, collector, summary, pool); err != nil {
+				if err := pcap.Collect(stop, interfaceName, filter, bufferShare, args.ParseTLSHandshakes, args.CaptureWebSocketMessages, time.Duration(args.StreamingResponseTimeoutSeconds)*time.Second, collector, summary, pool, sentinel, tcpHealth); err != nil {
 					errChan <- interfaceError{
 						interfaceName: interfaceName,
-						err:           errors.Wrapf(err, "failed to collect trace on interface %s", interfaceName),
+						err:           errors.Wrapf(explainFDExhaustion(err), "failed to collect trace on interface %s", interfaceName),
 					}
 				}
 			}(interfaceName, filter)
@@ -788,6 +1900,10 @@ func (a *apidump) Run() error {
 		printer.Debugf("Rotating learn sessions with interval %v\n", args.LearnSessionLifetime)
 		go a.RotateLearnSession(stop, toRotate, traceTags)
 	}
+	if len(toRotate) > 0 && witnessCountRotation != nil {
+		printer.Debugf("Rotating learn sessions after %d witnesses\n", args.RotateAfterWitnesses)
+		go a.rotateLearnSessionWhenFull(stop, witnessCountRotation, toRotate, traceTags)
+	}
 
 	{
 		iNames := make([]string, 0, len(interfaces))
@@ -797,16 +1913,8 @@ func (a *apidump) Run() error {
 		printer.Stderr.Infof("Running learn mode on interfaces %s\n", strings.Join(iNames, ", "))
 	}
 
-	unfiltered := true
-	for _, f := range userFilters {
-		if f != "" {
-			unfiltered = false
-			break
-		}
-	}
-	if unfiltered {
-		printer.Stderr.Infof("%s\n", printer.Color.Yellow("--filter flag is not set; capturing all network traffic to and from your services."))
-	}
+	args.warnIfUnfiltered(userFilters)
+	close(a.started)
 
 	// Keep track of errors by interface, as well as errors from the subcommand
 	// if applicable.
@@ -815,7 +1923,7 @@ func (a *apidump) Run() error {
 	if args.ExecCommand != "" {
 		printer.Stderr.Infof("Running subcommand...\n\n\n")
 
-		time.Sleep(pcapStartWaitTime)
+		awaitSentinel(pcap.StartSentinel, pcapStartWaitTime)
 
 		// Print delimiter so it's easier to differentiate subcommand output from
 		// Akita output.
@@ -863,7 +1971,9 @@ func (a *apidump) Run() error {
 	} else {
 		// Don't sleep pcapStartWaitTime in interactive mode since the user can send
 		// SIGINT while we're sleeping too and sleeping introduces visible lag.
-		printer.Stderr.Infof("Send SIGINT (Ctrl-C) to stop...\n")
+		if !args.QuietWarnings {
+			printer.Stderr.Infof("Send SIGINT (Ctrl-C) to stop...\n")
+		}
 
 		// Set up signal handler to stop packet processors on SIGINT or when one of
 		// the processors returns an error.
@@ -873,6 +1983,7 @@ func (a *apidump) Run() error {
 			sig := make(chan os.Signal, 2)
 			signal.Notify(sig, os.Interrupt)
 			signal.Notify(sig, syscall.SIGTERM)
+			defer signal.Stop(sig)
 
 			// Continue until an interrupt or all collectors have stopped with errors.
 		DoneWaitingForSignal:
@@ -881,6 +1992,9 @@ func (a *apidump) Run() error {
 				case received := <-sig:
 					printer.Stderr.Infof("Received %v, stopping trace collection...\n", received.String())
 					break DoneWaitingForSignal
+				case <-a.stopRequested:
+					printer.Stderr.Infof("Stop requested, stopping trace collection...\n")
+					break DoneWaitingForSignal
 				case interfaceErr := <-errChan:
 					errorsByInterface[interfaceErr.interfaceName] = interfaceErr.err
 
@@ -896,7 +2010,7 @@ func (a *apidump) Run() error {
 		}
 	}
 
-	time.Sleep(pcapStopWaitTime)
+	awaitSentinel(pcap.StopSentinel, pcapStopWaitTime)
 
 	// Signal all processors to stop.
 	close(stop)
@@ -905,6 +2019,25 @@ func (a *apidump) Run() error {
 	doneWG.Wait()
 	printer.Stderr.Infof("Trace collection stopped\n")
 
+	a.SendFinalTelemetry()
+
+	if args.ManifestOutput != "" {
+		manifest := a.newCaptureManifest(interfaces, currentAPIKey(), time.Now())
+		if err := manifest.writeFile(args.ManifestOutput); err != nil {
+			printer.Stderr.Warningf("%v\n", err)
+		} else {
+			printer.Stderr.Infof("Wrote capture manifest to %s\n", args.ManifestOutput)
+		}
+	}
+
+	if args.SummaryJSON != "" {
+		if err := a.dumpSummary.writeJSONFile(args.SummaryJSON); err != nil {
+			printer.Stderr.Warningf("%v\n", err)
+		} else {
+			printer.Stderr.Infof("Wrote capture summary to %s\n", args.SummaryJSON)
+		}
+	}
+
 	// Print errors per interface.
 	reportedFilterError := false
 	if len(errorsByInterface) > 0 {
@@ -942,10 +2075,30 @@ func (a *apidump) Run() error {
 		return errors.New("API trace is empty")
 	}
 
+	if apiSurface != nil {
+		if err := reportAPISurface(apiSurface, baseline, args); err != nil {
+			return err
+		}
+	}
+
 	printer.Stderr.Infof("%s 🎉\n\n", printer.Color.Green("Success!"))
 	return nil
 }
 
+// Warns that all traffic is being captured if no BPF filter was given for any
+// interface, unless warnings are quieted.
+func (args *Args) warnIfUnfiltered(userFilters map[string]string) {
+	if args.QuietWarnings {
+		return
+	}
+	for _, f := range userFilters {
+		if f != "" {
+			return
+		}
+	}
+	printer.Stderr.Infof("%s\n", printer.Color.Yellow("--filter flag is not set; capturing all network traffic to and from your services."))
+}
+
 func createLocalCollector(interfaceName, outDir string, tags map[tags.Key]string) (trace.Collector, error) {
 	if fi, err := os.Stat(outDir); err == nil {
 		// File exists, check if it's a directory.
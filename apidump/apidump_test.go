@@ -0,0 +1,368 @@
+package apidump
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/akiuri"
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/akitasoftware/akita-libs/client_telemetry"
+	"github.com/akitasoftware/akita-libs/tags"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/location"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/rest"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintReportFlags(t *testing.T) {
+	testCases := []struct {
+		name string
+		args Args
+
+		expectTCPReports bool
+		expectTLSReports bool
+		expectParseTLS   bool
+	}{
+		{
+			name:           "no reports",
+			args:           Args{ParseTLSHandshakes: false},
+			expectParseTLS: false,
+		},
+		{
+			name:           "no reports, parse TLS",
+			args:           Args{ParseTLSHandshakes: true},
+			expectParseTLS: true,
+		},
+		{
+			name:             "TCP reports only",
+			args:             Args{CollectTCPReports: true, ParseTLSHandshakes: false},
+			expectTCPReports: true,
+			expectParseTLS:   false,
+		},
+		{
+			name:             "TLS reports only",
+			args:             Args{CollectTLSReports: true, ParseTLSHandshakes: false},
+			expectTLSReports: true,
+			expectParseTLS:   true,
+		},
+		{
+			name:             "TCP and TLS reports",
+			args:             Args{CollectTCPReports: true, CollectTLSReports: true, ParseTLSHandshakes: true},
+			expectTCPReports: true,
+			expectTLSReports: true,
+			expectParseTLS:   true,
+		},
+		{
+			name:             "deprecated combined flag",
+			args:             Args{CollectTCPAndTLSReports: true, ParseTLSHandshakes: false},
+			expectTCPReports: true,
+			expectTLSReports: true,
+			expectParseTLS:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		args := tc.args
+		args.lint()
+		assert.Equal(t, tc.expectTCPReports, args.CollectTCPReports, "["+tc.name+"] TCP reports")
+		assert.Equal(t, tc.expectTLSReports, args.CollectTLSReports, "["+tc.name+"] TLS reports")
+		assert.Equal(t, tc.expectParseTLS, args.ParseTLSHandshakes, "["+tc.name+"] parse TLS")
+	}
+}
+
+// A run that stops before the first packet report is due still sends a final
+// report with the complete packet counts.
+func TestFinalTelemetryForShortRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var reports []kgxapi.PostClientPacketCaptureStatsRequest
+	mockClient.EXPECT().
+		PostInitialClientTelemetry(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(nil)
+	mockClient.EXPECT().
+		PostClientPacketCaptureStats(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(_, _ interface{}, req kgxapi.PostClientPacketCaptureStatsRequest) {
+			reports = append(reports, req)
+		}).
+		Times(1).
+		Return(nil)
+
+	filterSummary := trace.NewPacketCounter()
+	a := newSession(&Args{
+		ServiceID:         akid.NewServiceID(uuid.New()),
+		StatsLogDelay:     60,
+		TelemetryInterval: 300,
+	})
+	a.learnClient = mockClient
+	a.backendSvc = a.ServiceID
+	a.dumpSummary = NewSummary(false, nil, nil, 0, filterSummary, trace.NewPacketCounter(), trace.NewPacketCounter())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.TelemetryWorker(done)
+	}()
+
+	filterSummary.Update(client_telemetry.PacketCounts{
+		Interface:    "eth0",
+		DstPort:      80,
+		TCPPackets:   10,
+		HTTPRequests: 2,
+	})
+
+	// Stop well before the stats log delay. The worker must exit without
+	// sending a packet report of its own.
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	wg.Wait()
+
+	a.SendFinalTelemetry()
+
+	if assert.Equal(t, 1, len(reports)) {
+		assert.Equal(t, 60, reports[0].ObservedDurationInSeconds)
+		if assert.NotNil(t, reports[0].PacketCountSummary) {
+			assert.Equal(t, 10, reports[0].PacketCountSummary.Total.TCPPackets)
+			assert.Equal(t, 2, reports[0].PacketCountSummary.Total.HTTPRequests)
+		}
+	}
+}
+
+func TestServiceVersionTag(t *testing.T) {
+	// Taken from the environment by default.
+	t.Setenv("POSTMAN_SERVICE_VERSION", "env-sha")
+	traceTags := collectTraceTags(&Args{})
+	assert.Equal(t, "env-sha", traceTags[tags.XAkitaServiceVersion])
+
+	// Overridden by --service-version.
+	traceTags = collectTraceTags(&Args{ServiceVersion: "flag-sha"})
+	assert.Equal(t, "flag-sha", traceTags[tags.XAkitaServiceVersion])
+}
+
+func TestQuietWarnings(t *testing.T) {
+	var out bytes.Buffer
+	defer func(p printer.P) { printer.Stderr = p }(printer.Stderr)
+	printer.Stderr = printer.NewP(&out)
+
+	unfiltered := map[string]string{"eth0": "", "lo": ""}
+
+	// By default, the unfiltered-capture warning is printed.
+	t.Setenv("CI", "")
+	args := Args{}
+	args.lint()
+	assert.False(t, args.QuietWarnings)
+	args.warnIfUnfiltered(unfiltered)
+	assert.Contains(t, out.String(), "--filter flag is not set")
+
+	// It isn't printed if any interface is filtered.
+	out.Reset()
+	args.warnIfUnfiltered(map[string]string{"eth0": "port 80", "lo": ""})
+	assert.Empty(t, out.String())
+
+	// --quiet-warnings and CI both suppress it.
+	for _, tc := range []struct {
+		name string
+		ci   string
+		args Args
+	}{
+		{name: "flag", args: Args{QuietWarnings: true}},
+		{name: "CI", ci: "true"},
+	} {
+		out.Reset()
+		t.Setenv("CI", tc.ci)
+		args := tc.args
+		args.lint()
+		assert.True(t, args.QuietWarnings, tc.name)
+		args.warnIfUnfiltered(unfiltered)
+		assert.NotContains(t, out.String(), "--filter flag is not set", tc.name)
+	}
+}
+
+// Drops all traffic.
+type discardCollector struct{}
+
+func (discardCollector) Process(akinet.ParsedNetworkTraffic) error { return nil }
+func (discardCollector) Close() error                              { return nil }
+
+func TestInternalTrafficWarning(t *testing.T) {
+	var out bytes.Buffer
+	defer func(p printer.P) { printer.Stderr = p }(printer.Stderr)
+	printer.Stderr = printer.NewP(&out)
+
+	filterSummary := trace.NewPacketCounter()
+	filterSummary.Update(client_telemetry.PacketCounts{
+		Interface:     "lo",
+		DstPort:       8080,
+		TCPPackets:    10,
+		HTTPRequests:  2,
+		HTTPResponses: 2,
+	})
+	summary := NewSummary(false, nil, nil, 0, filterSummary, trace.NewPacketCounter(), trace.NewPacketCounter())
+	summary.InternalTraffic = trace.NewInternalTrafficDetector(nil)
+
+	col := summary.InternalTraffic.NewCollector(discardCollector{})
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+			SrcIP:   net.ParseIP("127.0.0.1"),
+			DstIP:   net.ParseIP("127.0.0.1"),
+			Content: akinet.HTTPRequest{Method: "GET", URL: &url.URL{Path: "/v1/users"}},
+		}))
+	}
+
+	summary.PrintWarnings()
+	assert.Contains(t, out.String(), "probably not your API's traffic")
+
+	// Not printed with --quiet-warnings.
+	out.Reset()
+	summary.QuietWarnings = true
+	summary.PrintWarnings()
+	assert.NotContains(t, out.String(), "probably not your API's traffic")
+
+	// Nor once a request arrives from elsewhere.
+	out.Reset()
+	summary.QuietWarnings = false
+	assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+		SrcIP:   net.ParseIP("10.0.0.9"),
+		DstIP:   net.ParseIP("10.0.0.5"),
+		Content: akinet.HTTPRequest{Method: "GET", URL: &url.URL{Path: "/v1/users"}},
+	}))
+	summary.PrintWarnings()
+	assert.NotContains(t, out.String(), "probably not your API's traffic")
+}
+
+func TestSummaryToJSON(t *testing.T) {
+	filterSummary := trace.NewPacketCounter()
+	interfaces := map[string]interfaceInfo{"eth0": fakeInterface{}, "lo": fakeInterface{}}
+	summary := NewSummary(false, interfaces, nil, 0, filterSummary, trace.NewPacketCounter(), trace.NewPacketCounter())
+
+	var got struct {
+		Interfaces []string
+		Total      client_telemetry.PacketCounts
+		TopByPort  map[string]client_telemetry.PacketCounts `json:"top_by_port"`
+		TopByHost  map[string]client_telemetry.PacketCounts `json:"top_by_host"`
+		Warnings   []string
+		Empty      bool
+	}
+
+	// An empty capture.
+	b, err := summary.ToJSON()
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, &got)) {
+		assert.Equal(t, []string{"eth0", "lo"}, got.Interfaces)
+		assert.True(t, got.Empty)
+		assert.Contains(t, got.Warnings, "No HTTP calls captured!")
+	}
+
+	filterSummary.Update(client_telemetry.PacketCounts{
+		Interface:     "eth0",
+		DstHost:       "example.com",
+		DstPort:       8080,
+		TCPPackets:    10,
+		HTTPRequests:  2,
+		HTTPResponses: 1,
+	})
+	got.Warnings = nil
+	b, err = summary.ToJSON()
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, &got)) {
+		assert.False(t, got.Empty)
+		assert.Equal(t, 2, got.Total.HTTPRequests)
+		assert.Equal(t, 10, got.TopByPort["8080"].TCPPackets)
+		assert.Equal(t, 2, got.TopByHost["example.com"].HTTPRequests)
+		assert.Empty(t, got.Warnings)
+	}
+}
+
+// Records the learn session to which it is switched.
+type learnSessionRecorder struct {
+	trace.Collector
+	lrn akid.LearnSessionID
+}
+
+func (r *learnSessionRecorder) SwitchLearnSession(lrn akid.LearnSessionID) {
+	r.lrn = lrn
+}
+
+func TestRotateLearnSession(t *testing.T) {
+	oldLrn := akid.NewLearnSessionID(uuid.New())
+	newLrn := akid.NewLearnSessionID(uuid.New())
+
+	testCases := []struct {
+		name      string
+		createErr error
+		lookupErr error
+		expected  akid.LearnSessionID
+	}{
+		{
+			name:     "created",
+			expected: newLrn,
+		},
+		{
+			name:      "name conflict switches to existing session",
+			createErr: rest.HTTPError{StatusCode: 409},
+			expected:  newLrn,
+		},
+		{
+			name:      "name conflict and failed lookup stays on old session",
+			createErr: rest.HTTPError{StatusCode: 409},
+			lookupErr: errors.New("lookup failed"),
+			expected:  oldLrn,
+		},
+		{
+			name:      "other error stays on old session",
+			createErr: rest.HTTPError{StatusCode: 500},
+			expected:  oldLrn,
+		},
+	}
+
+	for _, tc := range testCases {
+		ctrl := gomock.NewController(t)
+		mockClient := mockrest.NewMockLearnClient(ctrl)
+
+		if tc.createErr == nil {
+			mockClient.EXPECT().
+				CreateLearnSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(newLrn, nil)
+		} else {
+			mockClient.EXPECT().
+				CreateLearnSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(akid.LearnSessionID{}, tc.createErr)
+		}
+		if tc.createErr != nil && tc.createErr.(rest.HTTPError).StatusCode == 409 {
+			mockClient.EXPECT().
+				GetLearnSessionIDByName(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(newLrn, tc.lookupErr)
+		}
+
+		a := newSession(&Args{
+			Out: location.Location{AkitaURI: &akiuri.URI{
+				ObjectType:  akiuri.TRACE.Ptr(),
+				ServiceName: "my-service",
+			}},
+		})
+		a.learnClient = mockClient
+
+		collector := &learnSessionRecorder{lrn: oldLrn}
+		a.rotateLearnSessionOnce(make(chan struct{}), []trace.LearnSessionCollector{collector}, nil)
+		assert.Equal(t, tc.expected, collector.lrn, tc.name)
+
+		ctrl.Finish()
+	}
+}
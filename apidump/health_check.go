@@ -2,8 +2,11 @@ package apidump
 
 import (
 	"fmt"
-	"github.com/gorilla/mux"
+	"net"
 	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 // Handles health check requests for the Docker Extension.
@@ -13,10 +16,16 @@ func handleHealthCheck(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(`{"status": "ok"}`))
 }
 
-func startHealthCheckServer(port int) error {
+// Starts serving health checks on the given port. Returns once the port is
+// bound. The caller must close the returned server once capture has finished.
+func startHealthCheckServer(port int) (*localHTTPServer, error) {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/health", handleHealthCheck).Methods("GET")
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to start health-check server on port %d", port)
+	}
+	return serveLocalHTTP("Health-check", listener, router), nil
 }
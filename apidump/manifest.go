@@ -0,0 +1,204 @@
+package apidump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/cfg"
+	"github.com/postmanlabs/postman-insights-agent/version"
+)
+
+// Describes how a capture was performed, for audits and reproducibility.
+// Written as JSON at the end of apidump when --manifest-output is set. Must
+// not contain secrets.
+type captureManifest struct {
+	AgentVersion string    `json:"agent_version"`
+	GitVersion   string    `json:"git_version"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+
+	// Identifies the credentials used without revealing them.
+	APIKeyFingerprint string `json:"api_key_fingerprint,omitempty"`
+
+	ServiceID       string   `json:"service_id,omitempty"`
+	ServiceName     string   `json:"service_name,omitempty"`
+	LearnSessionIDs []string `json:"learn_session_ids,omitempty"`
+
+	// Set when writing HAR files instead of uploading to the backend.
+	OutputDirectory string `json:"output_directory,omitempty"`
+
+	Interfaces []string           `json:"interfaces"`
+	Filters    manifestFilters    `json:"filters"`
+	Sampling   manifestSampling   `json:"sampling"`
+	Redaction  manifestRedaction  `json:"redaction"`
+	Counts     manifestCounts     `json:"counts"`
+	Reports    manifestReportOpts `json:"reports"`
+}
+
+type manifestFilters struct {
+	BPFFilter      string   `json:"bpf_filter,omitempty"`
+	PathExclusions []string `json:"path_exclusions,omitempty"`
+	HostExclusions []string `json:"host_exclusions,omitempty"`
+	PathAllowlist  []string `json:"path_allowlist,omitempty"`
+	HostAllowlist  []string `json:"host_allowlist,omitempty"`
+
+	// File extensions of static assets that were dropped.
+	StaticExtensions []string `json:"static_extensions,omitempty"`
+}
+
+type manifestSampling struct {
+	SampleRate         float64 `json:"sample_rate"`
+	SuccessSampleRate  float64 `json:"success_sample_rate"`
+	WitnessesPerMinute float64 `json:"witnesses_per_minute"`
+	EndpointRateLimit  float64 `json:"endpoint_rate_limit,omitempty"`
+	ForceCaptureHeader string  `json:"force_capture_header,omitempty"`
+}
+
+type manifestRedaction struct {
+	// Names of the plugins applied to each witness, in order. Includes the
+	// built-in redactors and filters.
+	Plugins                   []string `json:"plugins"`
+	SchemaOnly                bool     `json:"schema_only"`
+	ExamplesPerEndpointStatus int      `json:"examples_per_endpoint_status,omitempty"`
+	MaxWitnessSize_bytes      int      `json:"max_witness_size_bytes"`
+}
+
+type manifestReportOpts struct {
+	CollectTCPReports  bool `json:"collect_tcp_reports"`
+	CollectTLSReports  bool `json:"collect_tls_reports"`
+	ParseTLSHandshakes bool `json:"parse_tls_handshakes"`
+}
+
+// Counts of traffic that satisfied the filters.
+type manifestCounts struct {
+	TCPPackets         int `json:"tcp_packets"`
+	HTTPRequests       int `json:"http_requests"`
+	HTTPResponses      int `json:"http_responses"`
+	OversizedWitnesses int `json:"oversized_witnesses"`
+	TLSHello           int `json:"tls_hello"`
+	HTTP2Prefaces      int `json:"http2_prefaces"`
+	QUICHandshakes     int `json:"quic_handshakes"`
+	Unparsed           int `json:"unparsed"`
+}
+
+// Returns a fingerprint of the given API key, or the empty string if there is
+// no key.
+func apiKeyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Returns the API key in use, for fingerprinting.
+func currentAPIKey() string {
+	if key, _ := cfg.GetPostmanAPIKeyAndEnvironment(); key != "" {
+		return key
+	}
+	key, _ := cfg.GetAPIKeyAndSecret()
+	return key
+}
+
+// Records a learn session that witnesses were sent to, for the manifest.
+func (a *apidump) recordLearnSession(lrn akid.LearnSessionID) {
+	a.learnSessionsMutex.Lock()
+	defer a.learnSessionsMutex.Unlock()
+	a.learnSessions = append(a.learnSessions, lrn)
+}
+
+// Assembles the manifest for a capture on the given interfaces that ended at
+// the given time.
+func (a *apidump) newCaptureManifest(interfaces map[string]interfaceInfo, apiKey string, endTime time.Time) captureManifest {
+	m := captureManifest{
+		AgentVersion:      version.ReleaseVersion().String(),
+		GitVersion:        version.GitVersion(),
+		StartTime:         a.startTime,
+		EndTime:           endTime,
+		APIKeyFingerprint: apiKeyFingerprint(apiKey),
+		ServiceName:       a.backendSvcName,
+		Interfaces:        make([]string, 0, len(interfaces)),
+		Filters: manifestFilters{
+			BPFFilter:      joinBPFFilters(a.bpfFilters()),
+			PathExclusions: a.PathExclusions,
+			HostExclusions: a.HostExclusions,
+			PathAllowlist:  a.PathAllowlist,
+			HostAllowlist:  a.HostAllowlist,
+
+			StaticExtensions: a.StaticExtensions,
+		},
+		Sampling: manifestSampling{
+			SampleRate:         a.SampleRate,
+			SuccessSampleRate:  a.SuccessSampleRate,
+			WitnessesPerMinute: a.WitnessesPerMinute,
+			EndpointRateLimit:  a.EndpointRateLimit,
+			ForceCaptureHeader: a.ForceCaptureHeader,
+		},
+		Redaction: manifestRedaction{
+			Plugins:                   []string{},
+			SchemaOnly:                a.SchemaOnly,
+			ExamplesPerEndpointStatus: a.ExamplesPerEndpointStatus,
+			MaxWitnessSize_bytes:      a.MaxWitnessSize_bytes,
+		},
+		Reports: manifestReportOpts{
+			CollectTCPReports:  a.CollectTCPReports,
+			CollectTLSReports:  a.CollectTLSReports,
+			ParseTLSHandshakes: a.ParseTLSHandshakes,
+		},
+	}
+	for name := range interfaces {
+		m.Interfaces = append(m.Interfaces, name)
+	}
+	sort.Strings(m.Interfaces)
+
+	if a.backendSvc != (akid.ServiceID{}) {
+		m.ServiceID = akid.String(a.backendSvc)
+	}
+	if a.Out.LocalPath != nil {
+		m.OutputDirectory = *a.Out.LocalPath
+	}
+
+	a.learnSessionsMutex.Lock()
+	for _, lrn := range a.learnSessions {
+		m.LearnSessionIDs = append(m.LearnSessionIDs, akid.String(lrn))
+	}
+	a.learnSessionsMutex.Unlock()
+
+	for _, p := range a.Plugins {
+		m.Redaction.Plugins = append(m.Redaction.Plugins, p.Name())
+	}
+
+	if a.dumpSummary != nil && a.dumpSummary.FilterSummary != nil {
+		total := a.dumpSummary.FilterSummary.Total()
+		m.Counts = manifestCounts{
+			TCPPackets:         total.TCPPackets,
+			HTTPRequests:       total.HTTPRequests,
+			HTTPResponses:      total.HTTPResponses,
+			OversizedWitnesses: total.OversizedWitnesses,
+			TLSHello:           total.TLSHello,
+			HTTP2Prefaces:      total.HTTP2Prefaces,
+			QUICHandshakes:     total.QUICHandshakes,
+			Unparsed:           total.Unparsed,
+		}
+	}
+	return m
+}
+
+// Writes the manifest to the given file as indented JSON, replacing any
+// existing file.
+func (m captureManifest) writeFile(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal capture manifest")
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write capture manifest to %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package apidump
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/client_telemetry"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	"github.com/postmanlabs/postman-insights-agent/redact"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureManifest(t *testing.T) {
+	const apiKey = "PMAK-0123456789abcdef"
+	svc := akid.NewServiceID(uuid.Must(uuid.Parse("8b2cf196-87fe-4e53-a6b9-1452d7efb863")))
+	lrn := akid.NewLearnSessionID(uuid.Must(uuid.Parse("2b5dd735-9fc0-4365-93e8-74bf86d3f853")))
+
+	dropper, err := redact.NewFieldDropper([]string{"password"})
+	assert.NoError(t, err)
+
+	counts := trace.NewPacketCounter()
+	counts.Update(client_telemetry.PacketCounts{
+		Interface:     "eth0",
+		SrcPort:       8080,
+		TCPPackets:    10,
+		HTTPRequests:  3,
+		HTTPResponses: 2,
+		Unparsed:      1,
+	})
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := &apidump{
+		Args: &Args{
+			Filter:               "port 8080",
+			PathExclusions:       []string{"^/health$"},
+			HostAllowlist:        []string{`\.example\.com$`},
+			SampleRate:           0.5,
+			SuccessSampleRate:    0.1,
+			WitnessesPerMinute:   1000,
+			EndpointRateLimit:    20,
+			ForceCaptureHeader:   "X-Capture",
+			Plugins:              []plugin.AkitaPlugin{dropper},
+			SchemaOnly:           true,
+			MaxWitnessSize_bytes: 1000,
+			ManifestOutput:       filepath.Join(t.TempDir(), "manifest.json"),
+		},
+		backendSvc:     svc,
+		backendSvcName: "my-service",
+		startTime:      start,
+		dumpSummary:    &Summary{FilterSummary: counts},
+	}
+	a.recordLearnSession(lrn)
+
+	interfaces := map[string]interfaceInfo{"lo": nil, "eth0": nil}
+	manifest := a.newCaptureManifest(interfaces, apiKey, start.Add(time.Minute))
+	assert.NoError(t, manifest.writeFile(a.ManifestOutput))
+
+	b, err := os.ReadFile(a.ManifestOutput)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), apiKey)
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &got))
+
+	assert.NotEmpty(t, got["agent_version"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", got["start_time"])
+	assert.Equal(t, "2024-05-01T12:01:00Z", got["end_time"])
+	assert.Equal(t, apiKeyFingerprint(apiKey), got["api_key_fingerprint"])
+	assert.True(t, strings.HasPrefix(got["api_key_fingerprint"].(string), "sha256:"))
+	assert.Equal(t, akid.String(svc), got["service_id"])
+	assert.Equal(t, "my-service", got["service_name"])
+	assert.Equal(t, []interface{}{akid.String(lrn)}, got["learn_session_ids"])
+	assert.Equal(t, []interface{}{"eth0", "lo"}, got["interfaces"])
+
+	assert.Equal(t, map[string]interface{}{
+		"bpf_filter":      "port 8080",
+		"path_exclusions": []interface{}{"^/health$"},
+		"host_allowlist":  []interface{}{`\.example\.com$`},
+	}, got["filters"])
+
+	assert.Equal(t, map[string]interface{}{
+		"sample_rate":          0.5,
+		"success_sample_rate":  0.1,
+		"witnesses_per_minute": 1000.0,
+		"endpoint_rate_limit":  20.0,
+		"force_capture_header": "X-Capture",
+	}, got["sampling"])
+
+	assert.Equal(t, map[string]interface{}{
+		"plugins":                []interface{}{dropper.Name()},
+		"schema_only":            true,
+		"max_witness_size_bytes": 1000.0,
+	}, got["redaction"])
+
+	assert.Equal(t, map[string]interface{}{
+		"tcp_packets":         10.0,
+		"http_requests":       3.0,
+		"http_responses":      2.0,
+		"oversized_witnesses": 0.0,
+		"tls_hello":           0.0,
+		"http2_prefaces":      0.0,
+		"quic_handshakes":     0.0,
+		"unparsed":            1.0,
+	}, got["counts"])
+}
+
+func TestAPIKeyFingerprint(t *testing.T) {
+	assert.Equal(t, "", apiKeyFingerprint(""))
+	assert.Equal(t, apiKeyFingerprint("a"), apiKeyFingerprint("a"))
+	assert.NotEqual(t, apiKeyFingerprint("a"), apiKeyFingerprint("b"))
+}
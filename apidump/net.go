@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/pkg/errors"
 	"github.com/postmanlabs/postman-insights-agent/architecture"
@@ -93,6 +94,30 @@ func showPermissionErrors(sampleError error) error {
 	return NewApidumpError(api_schema.ApidumpError_PCAPInterfaceOther, "Error while checking permissions.")
 }
 
+// Determines whether all of the given interfaces are loopback interfaces,
+// judging by their addresses.
+func onlyLoopbackInterfaces(interfaces map[string]interfaceInfo) bool {
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil || len(addrs) == 0 {
+			return false
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch a := addr.(type) {
+			case *net.IPNet:
+				ip = a.IP
+			case *net.IPAddr:
+				ip = a.IP
+			}
+			if !ip.IsLoopback() {
+				return false
+			}
+		}
+	}
+	return len(interfaces) > 0
+}
+
 // Get the list of interface names that we should listen on. By default, this is
 // all interfaces on the machine that are up. User may override this with
 // --interface flag.
@@ -216,6 +241,77 @@ func checkPcapPermissions(interfaces map[string]interfaceInfo) map[string]error
 	return errs
 }
 
+// Returns the IP addresses assigned to an interface, given its addresses.
+func addrIPs(addrs []net.Addr) []net.IP {
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		switch ta := addr.(type) {
+		case *net.IPAddr:
+			ips = append(ips, ta.IP)
+		case *net.IPNet:
+			// Only take the IP assigned to the interface, not the full network.
+			ips = append(ips, ta.IP)
+		case *net.TCPAddr:
+			ips = append(ips, ta.IP)
+		case *net.UDPAddr:
+			ips = append(ips, ta.IP)
+		}
+	}
+	return ips
+}
+
+// Returns the IP addresses assigned to the given interfaces. Interfaces whose
+// addresses can't be read are skipped.
+func interfaceIPs(interfaces map[string]interfaceInfo) []net.IP {
+	var ips []net.IP
+	for _, iface := range interfaces {
+		if addrs, err := iface.Addrs(); err == nil {
+			ips = append(ips, addrIPs(addrs)...)
+		}
+	}
+	return ips
+}
+
+// Returns the user's BPF filters, including Filter.
+func (args *Args) bpfFilters() []string {
+	return append([]string{args.Filter}, args.Filters...)
+}
+
+// Returns a BPF filter matching packets that match any of the given filters.
+// Empty filters are ignored. Each filter is compiled on its own first, so that
+// an invalid one is reported by itself.
+func combineBPFFilters(filters []string) (string, error) {
+	for _, f := range filters {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, 65535, f); err != nil {
+			return "", errors.Wrapf(err, "invalid BPF filter %q", f)
+		}
+	}
+	return joinBPFFilters(filters), nil
+}
+
+// Returns the union of the given BPF filters, ignoring empty ones. A single
+// filter is returned as is.
+func joinBPFFilters(filters []string) string {
+	nonEmpty := make([]string, 0, len(filters))
+	for _, f := range filters {
+		if f = strings.TrimSpace(f); f != "" {
+			nonEmpty = append(nonEmpty, f)
+		}
+	}
+	if len(nonEmpty) == 1 {
+		return nonEmpty[0]
+	}
+
+	parts := make([]string, len(nonEmpty))
+	for i, f := range nonEmpty {
+		parts[i] = "(" + f + ")"
+	}
+	return strings.Join(parts, " or ")
+}
+
 // Returns BPF filter for inbound API spec traffic on each interface.
 func getInboundBPFFilter(interfaces map[string]interfaceInfo, bpfFilter string, port uint16) (map[string]string, error) {
 	results := make(map[string]string, len(interfaces))
@@ -245,20 +341,7 @@ func getInboundBPFFilter(interfaces map[string]interfaceInfo, bpfFilter string,
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get interface addresses")
 		}
-		ips := make([]net.IP, 0, len(addrs))
-		for _, addr := range addrs {
-			switch ta := addr.(type) {
-			case *net.IPAddr:
-				ips = append(ips, ta.IP)
-			case *net.IPNet:
-				// Only take the IP assigned to the interface, not the full network.
-				ips = append(ips, ta.IP)
-			case *net.TCPAddr:
-				ips = append(ips, ta.IP)
-			case *net.UDPAddr:
-				ips = append(ips, ta.IP)
-			}
-		}
+		ips := addrIPs(addrs)
 
 		printer.Debugf("Interface %s IPs: %v\n", name, ips)
 
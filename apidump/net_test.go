@@ -23,6 +23,10 @@ func TestGetInboundBPFFilter(t *testing.T) {
 		"lo": fakeInterface([]net.Addr{
 			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.IPv4Mask(255, 0, 0, 0)},
 		}),
+		"eth1": fakeInterface([]net.Addr{
+			&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth1"},
+		}),
 	}
 
 	testCases := []struct {
@@ -37,6 +41,7 @@ func TestGetInboundBPFFilter(t *testing.T) {
 			expected: map[string]string{
 				"eth0": "",
 				"lo":   "",
+				"eth1": "",
 			},
 		},
 		{
@@ -45,6 +50,7 @@ func TestGetInboundBPFFilter(t *testing.T) {
 			expected: map[string]string{
 				"eth0": "(src host 1.2.3.4 and src port 25482) or (dst host 1.2.3.4 and dst port 25482)",
 				"lo":   "(src host 127.0.0.1 and src port 25482) or (dst host 127.0.0.1 and dst port 25482)",
+				"eth1": "(src host 2001:db8::1 and src port 25482) or (dst host 2001:db8::1 and dst port 25482) or (src host fe80::1 and src port 25482) or (dst host fe80::1 and dst port 25482)",
 			},
 		},
 		{
@@ -53,6 +59,7 @@ func TestGetInboundBPFFilter(t *testing.T) {
 			expected: map[string]string{
 				"eth0": "(ether host aa:bb:cc:dd:ee:ff and port 25482) or (ether host 11:22:33:44:55:66 and port 8080)",
 				"lo":   "(ether host aa:bb:cc:dd:ee:ff and port 25482) or (ether host 11:22:33:44:55:66 and port 8080)",
+				"eth1": "(ether host aa:bb:cc:dd:ee:ff and port 25482) or (ether host 11:22:33:44:55:66 and port 8080)",
 			},
 		},
 		{
@@ -79,3 +86,44 @@ func TestGetInboundBPFFilter(t *testing.T) {
 		assert.Equal(t, c.expected, filters, c.name)
 	}
 }
+
+func TestJoinBPFFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  []string
+		expected string
+	}{
+		{"none", nil, ""},
+		{"only empty", []string{"", " "}, ""},
+		{"single", []string{"", "tcp port 8080"}, "tcp port 8080"},
+		{
+			"several",
+			[]string{"tcp port 8080", "", "tcp port 9090 or tcp port 3000"},
+			"(tcp port 8080) or (tcp port 9090 or tcp port 3000)",
+		},
+	}
+	for _, c := range testCases {
+		assert.Equal(t, c.expected, joinBPFFilters(c.filters), c.name)
+	}
+
+	// The negation covers the whole union.
+	filter := joinBPFFilters([]string{"tcp port 8080", "tcp port 9090"})
+	_, negations, err := createBPFFilters(map[string]interfaceInfo{"eth0": fakeInterface{}}, filter, true, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "not ((tcp port 8080) or (tcp port 9090))", negations["eth0"])
+}
+
+func TestOnlyLoopbackInterfaces(t *testing.T) {
+	lo := fakeInterface([]net.Addr{
+		&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.IPv4Mask(255, 0, 0, 0)},
+		&net.IPNet{IP: net.ParseIP("::1"), Mask: net.CIDRMask(128, 128)},
+	})
+	eth0 := fakeInterface([]net.Addr{
+		&net.IPAddr{IP: net.ParseIP("1.2.3.4")},
+	})
+
+	assert.True(t, onlyLoopbackInterfaces(map[string]interfaceInfo{"lo": lo}))
+	assert.False(t, onlyLoopbackInterfaces(map[string]interfaceInfo{"lo": lo, "eth0": eth0}))
+	assert.False(t, onlyLoopbackInterfaces(map[string]interfaceInfo{"eth0": eth0}))
+	assert.False(t, onlyLoopbackInterfaces(map[string]interfaceInfo{"empty": fakeInterface(nil)}))
+}
@@ -0,0 +1,67 @@
+package apidump
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+// Chooses the interfaces to capture on when each needs the given number of
+// pcap handles and at most limit handles may be open at once, removing the
+// rest from the given map. Interfaces are chosen in order of name, so that the
+// choice is the same from run to run. Returns the names of the interfaces
+// removed, in order. A limit of zero or less means there is no limit.
+func limitInterfaces(interfaces map[string]interfaceInfo, handlesPerInterface int, limit int) []string {
+	if limit <= 0 || len(interfaces)*handlesPerInterface <= limit {
+		return nil
+	}
+
+	names := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	kept := limit / handlesPerInterface
+	skipped := names[kept:]
+	for _, name := range skipped {
+		delete(interfaces, name)
+	}
+	return skipped
+}
+
+// Warns if opening the given number of pcap handles would bring the process
+// close to its limit on open file descriptors.
+func warnIfNearFDLimit(handles int) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		printer.Debugf("Unable to get the open file limit: %v\n", err)
+		return
+	}
+
+	// Count the descriptors already open, where the OS makes that possible.
+	open := 0
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		open = len(entries)
+	}
+
+	needed := uint64(open + handles)
+	if needed*10 >= rlimit.Cur*9 {
+		printer.Stderr.Warningf("Capturing on %d interfaces needs about %d file descriptors, close to the limit of %d. "+
+			"Use --max-pcap-handles to capture on fewer interfaces, or raise the limit with \"ulimit -n\".\n",
+			handles, needed, rlimit.Cur)
+	}
+}
+
+// Adds advice to errors caused by running out of file descriptors, which pcap
+// reports in ways that are otherwise hard to recognize.
+func explainFDExhaustion(err error) error {
+	if errors.Is(err, syscall.EMFILE) || strings.Contains(err.Error(), "too many open files") {
+		return errors.Wrap(err, "ran out of file descriptors; use --max-pcap-handles to capture on fewer interfaces, or raise the limit with \"ulimit -n\"")
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package apidump
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitInterfaces(t *testing.T) {
+	newInterfaces := func() map[string]interfaceInfo {
+		return map[string]interfaceInfo{
+			"eth0": nil,
+			"eth1": nil,
+			"lo":   nil,
+			"wlan": nil,
+		}
+	}
+
+	testCases := []struct {
+		name                string
+		handlesPerInterface int
+		limit               int
+		expectedKept        []string
+		expectedSkipped     []string
+	}{
+		{"unlimited", 1, 0, []string{"eth0", "eth1", "lo", "wlan"}, nil},
+		{"under limit", 2, 8, []string{"eth0", "eth1", "lo", "wlan"}, nil},
+		{"over limit", 1, 3, []string{"eth0", "eth1", "lo"}, []string{"wlan"}},
+		{"two handles each", 2, 5, []string{"eth0", "eth1"}, []string{"lo", "wlan"}},
+		{"too few handles", 2, 1, nil, []string{"eth0", "eth1", "lo", "wlan"}},
+	}
+
+	for _, tc := range testCases {
+		interfaces := newInterfaces()
+		skipped := limitInterfaces(interfaces, tc.handlesPerInterface, tc.limit)
+		assert.Equal(t, tc.expectedSkipped, skipped, tc.name)
+
+		var kept []string
+		for name := range interfaces {
+			kept = append(kept, name)
+		}
+		sort.Strings(kept)
+		assert.Equal(t, tc.expectedKept, kept, tc.name)
+	}
+}
+
+func TestExplainFDExhaustion(t *testing.T) {
+	err := errors.New("eth0: socket: too many open files")
+	assert.Contains(t, explainFDExhaustion(err).Error(), "--max-pcap-handles")
+
+	err = errors.New("eth0: no such device exists")
+	assert.Equal(t, err, explainFDExhaustion(err))
+}
@@ -0,0 +1,38 @@
+package apidump
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/integrations/s3sink"
+)
+
+// Creates a sink that writes witnesses to the S3 bucket named in args, using
+// credentials from the AWS SDK's default sources: the environment, the shared
+// config and credentials files, and the instance or task role.
+func newS3Sink(args *Args) (*s3sink.Sink, error) {
+	var opts []func(*config.LoadOptions) error
+	if args.S3Region != "" {
+		opts = append(opts, config.WithRegion(args.S3Region))
+	}
+	if args.S3Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(args.S3Profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load AWS configuration")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("no region found for the S3 bucket; use --s3-region to specify one")
+	}
+
+	return s3sink.NewSink(s3sink.Config{
+		Bucket:      args.S3Bucket,
+		Endpoint:    args.S3Endpoint,
+		Region:      cfg.Region,
+		Prefix:      args.S3Prefix,
+		Credentials: cfg.Credentials,
+	})
+}
@@ -0,0 +1,123 @@
+package apidump
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// Nonzero while a Session is running. The HTTP parser's options are global to
+// the process, so only one session may run at a time.
+var sessionRunning int32
+
+// A capture running in the background, for programs that embed the agent and
+// need to stop it without sending signals.
+type Session struct {
+	a *apidump
+
+	// Closed once the capture has finished. err is set before then.
+	done chan struct{}
+	err  error
+}
+
+// Starts capturing packets in the background, as Run does. Returns once
+// packet capture has started, or with the error that prevented it from
+// starting. Only one session may run in a process at a time; Start returns an
+// error if another session has not yet finished.
+func Start(args Args) (*Session, error) {
+	if !atomic.CompareAndSwapInt32(&sessionRunning, 0, 1) {
+		return nil, errors.New("another capture session is already running in this process")
+	}
+
+	// The Docker extension expects a health-check server to be running. Only
+	// start this server if it's needed.
+	var healthCheck *localHTTPServer
+	if args.DockerExtensionMode {
+		var err error
+		healthCheck, err = startHealthCheckServer(args.HealthCheckPort)
+		if err != nil {
+			atomic.StoreInt32(&sessionRunning, 0)
+			return nil, err
+		}
+	}
+
+	args.lint()
+	s := &Session{
+		a:    newSession(&args),
+		done: make(chan struct{}),
+	}
+
+	// Run the main packet-capture loop. The session ends when it returns.
+	go func() {
+		s.err = s.a.Run()
+		if healthCheck != nil {
+			healthCheck.Close()
+		}
+		atomic.StoreInt32(&sessionRunning, 0)
+		close(s.done)
+	}()
+
+	select {
+	case <-s.a.started:
+		return s, nil
+	case <-s.done:
+		if s.err != nil {
+			return nil, s.err
+		}
+		return s, nil
+	}
+}
+
+// Stops the capture, as SIGINT would, and waits for it to finish. Returns
+// the capture's error, if any. If a subcommand is being run, the capture
+// instead stops when the subcommand exits. Safe to call more than once.
+func (s *Session) Stop() error {
+	s.a.requestStop()
+	return s.Wait()
+}
+
+// Waits for the capture to finish without stopping it, and returns its
+// error, if any.
+func (s *Session) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Waits for the capture to finish, and returns the summary of the traffic
+// captured. Nil if the capture stopped before packet capture started.
+func (s *Session) Summary() *Summary {
+	<-s.done
+	return s.a.dumpSummary
+}
+
+// Configures the HTTP parser, whose options are global to the process, for a
+// capture.
+func setParserOptions(args *Args) error {
+	learn.KeepAuthScheme(args.KeepAuthScheme)
+	learn.GroupByHeaders(args.GroupByHeaders)
+	learn.SetCorrelationHeader(args.CorrelationHeader)
+
+	if args.ProtoDescriptors != "" {
+		if err := learn.LoadProtoDescriptors(args.ProtoDescriptors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restores the HTTP parser's default options once a capture has finished, so
+// that a later session in the same process doesn't inherit them.
+func resetParserOptions() {
+	learn.KeepAuthScheme(false)
+	learn.GroupByHeaders(nil)
+	learn.SetCorrelationHeader("")
+	learn.UnloadProtoDescriptors()
+}
+
+// Signals the capture to stop.
+func (a *apidump) requestStop() {
+	a.stopOnce.Do(func() {
+		close(a.stopRequested)
+	})
+}
@@ -0,0 +1,73 @@
+package apidump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akiuri"
+	"github.com/pkg/errors"
+)
+
+// Identifies a learn session that apidump is sending witnesses to. Emitted as
+// a single line of JSON when --print-session is set, so that automation
+// wrapping the agent can link to the trace later.
+type sessionInfo struct {
+	ServiceID      string `json:"service_id"`
+	ServiceName    string `json:"service_name"`
+	LearnSessionID string `json:"learn_session_id"`
+	SessionName    string `json:"session_name"`
+	AkitaURI       string `json:"akita_uri"`
+	URL            string `json:"url"`
+}
+
+func newSessionInfo(domain string, svc akid.ServiceID, uri *akiuri.URI, lrn akid.LearnSessionID) sessionInfo {
+	return sessionInfo{
+		ServiceID:      akid.String(svc),
+		ServiceName:    uri.ServiceName,
+		LearnSessionID: akid.String(lrn),
+		SessionName:    uri.ObjectName,
+		AkitaURI:       uri.String(),
+		URL:            learnSessionURL(domain, svc, lrn),
+	}
+}
+
+// Returns the backend URL of the given learn session.
+func learnSessionURL(domain string, svc akid.ServiceID, lrn akid.LearnSessionID) string {
+	p := path.Join("/v1/services", akid.String(svc), "learn", akid.String(lrn))
+	return fmt.Sprintf("https://%s%s", domain, p)
+}
+
+// Writes the session as a single line of JSON.
+func (s sessionInfo) write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s) // includes newline
+}
+
+// Emits a newly created or joined learn session, if requested by
+// args.PrintSession. The session is written to stdout and, if
+// args.PrintSessionFile is set, appended to that file.
+func (a *apidump) emitSession(uri *akiuri.URI, lrn akid.LearnSessionID) error {
+	if !a.PrintSession {
+		return nil
+	}
+
+	info := newSessionInfo(a.Domain, a.backendSvc, uri, lrn)
+	if err := info.write(os.Stdout); err != nil {
+		return errors.Wrap(err, "failed to print session")
+	}
+
+	if a.PrintSessionFile != "" {
+		f, err := os.OpenFile(a.PrintSessionFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", a.PrintSessionFile)
+		}
+		defer f.Close()
+		if err := info.write(f); err != nil {
+			return errors.Wrapf(err, "failed to write session to %s", a.PrintSessionFile)
+		}
+	}
+	return nil
+}
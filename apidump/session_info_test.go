@@ -0,0 +1,40 @@
+package apidump
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akiuri"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionInfoWrite(t *testing.T) {
+	svc := akid.NewServiceID(uuid.Must(uuid.Parse("8b2cf196-87fe-4e53-a6b9-1452d7efb863")))
+	lrn := akid.NewLearnSessionID(uuid.Must(uuid.Parse("2b5dd735-9fc0-4365-93e8-74bf86d3f853")))
+	uri := &akiuri.URI{
+		ObjectType:  akiuri.TRACE.Ptr(),
+		ServiceName: "my-service",
+		ObjectName:  "my-trace",
+	}
+
+	var buf bytes.Buffer
+	err := newSessionInfo("api.example.com", svc, uri, lrn).write(&buf)
+	assert.NoError(t, err)
+
+	// Exactly one line per session.
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	var got map[string]string
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]string{
+		"service_id":       akid.String(svc),
+		"service_name":     "my-service",
+		"learn_session_id": akid.String(lrn),
+		"session_name":     "my-trace",
+		"akita_uri":        uri.String(),
+		"url":              "https://api.example.com/v1/services/" + akid.String(svc) + "/learn/" + akid.String(lrn),
+	}, got)
+}
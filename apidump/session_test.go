@@ -0,0 +1,73 @@
+package apidump
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartReturnsStartupError(t *testing.T) {
+	s, err := Start(Args{
+		ProtoDescriptors: filepath.Join(t.TempDir(), "missing.pb"),
+	})
+	assert.Error(t, err)
+	assert.Nil(t, s)
+}
+
+func TestRequestStopIsIdempotent(t *testing.T) {
+	a := newSession(&Args{})
+	a.requestStop()
+	a.requestStop()
+
+	select {
+	case <-a.stopRequested:
+	default:
+		t.Error("stop was not requested")
+	}
+}
+
+// Returns a local TCP port that is free at the time of the call.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestStartReleasesSessionAndHealthCheck(t *testing.T) {
+	args := Args{
+		ProtoDescriptors:    filepath.Join(t.TempDir(), "missing.pb"),
+		DockerExtensionMode: true,
+		HealthCheckPort:     freePort(t),
+	}
+
+	_, err := Start(args)
+	assert.Error(t, err)
+
+	// The session and its health-check port are released once it finishes,
+	// so a later session fails in the same way rather than being rejected.
+	_, again := Start(args)
+	if assert.Error(t, again) {
+		assert.Equal(t, err.Error(), again.Error())
+	}
+}
+
+func TestAdminServerReleasesPortOnClose(t *testing.T) {
+	port := freePort(t)
+
+	server, err := startAdminServer(port, trace.NewCapturePause())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, server.Close())
+
+	server, err = startAdminServer(port, trace.NewCapturePause())
+	if assert.NoError(t, err) {
+		server.Close()
+	}
+}
@@ -1,14 +1,20 @@
 package apidump
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
+	"strings"
 
 	"github.com/akitasoftware/akita-libs/client_telemetry"
 	"github.com/akitasoftware/go-utils/math"
+	"github.com/pkg/errors"
 	"github.com/postmanlabs/postman-insights-agent/env"
 	"github.com/postmanlabs/postman-insights-agent/pcap"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
 	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/redact"
 	"github.com/postmanlabs/postman-insights-agent/trace"
 	"github.com/spf13/viper"
 )
@@ -27,6 +33,73 @@ type Summary struct {
 	FilterSummary    *trace.PacketCounter
 	PrefilterSummary *trace.PacketCounter
 	NegationSummary  *trace.PacketCounter
+
+	// Body sizes per endpoint, for witnesses sent to the backend.
+	EndpointSizes *trace.EndpointSizeStats
+
+	// Response statuses per endpoint, for witnesses sent to the backend.
+	EndpointStatuses *trace.EndpointStatusStats
+
+	// Request rates per endpoint, for witnesses sent to the backend.
+	EndpointRates *trace.EndpointRateStats
+
+	// Requests and responses that were split across interfaces.
+	AsymmetricRouting *trace.AsymmetricRoutingDetector
+
+	// Client retries grouped by Idempotency-Key. Nil unless enabled.
+	Idempotency *trace.IdempotencyTracker
+
+	// Connections evicted by the TCP- and TLS-connection trackers.
+	ConnEvictions *trace.ConnectionEvictions
+
+	// Pauses uploads to the backend after repeated failures. Nil if not
+	// uploading to the backend.
+	UploadBreaker *trace.UploadCircuitBreaker
+
+	// HTTP versions observed per port and host.
+	HTTPVersions *trace.HTTPVersionCounter
+
+	// Drops requests for static assets. Nil if disabled.
+	StaticAssets *trace.StaticAssetFilter
+
+	// If true, guidance meant for a first, interactive run is not printed.
+	QuietWarnings bool
+
+	// Drops TLS handshake reports by SNI hostname. Nil if disabled.
+	SNIFilter *trace.SNIFilter
+
+	// Body shapes per endpoint. Nil unless enabled.
+	EndpointShapes *trace.EndpointShapeStats
+
+	// TCP retransmissions and zero-window advertisements. Nil unless TCP
+	// reports are collected.
+	TCPHealth *pcap.TCPHealth
+
+	// Drops HTTP exchanges other than successful mutations. Nil if disabled.
+	SuccessfulMutations *trace.SuccessfulMutationFilter
+
+	// Drops witnesses during the warm-up delay. Nil if disabled.
+	Warmup *trace.WarmupFilter
+
+	// Strips response bodies over a size limit. Nil if disabled.
+	ResponseBodyLimit *trace.ResponseBodyLimit
+
+	// HTTP requests that never left the host or were health checks.
+	InternalTraffic *trace.InternalTrafficDetector
+
+	// gRPC calls seen.
+	GRPCCalls *trace.GRPCCallCounter
+
+	// Requests that would have been captured during a dry run. Nil otherwise.
+	DryRun *trace.DryRunTally
+
+	// Plugins applied to witnesses sent to the backend. Those that trim
+	// witnesses report what they trimmed.
+	Plugins []plugin.AkitaPlugin
+
+	// Replaces host names in the JSON summary. Nil if hosts are not
+	// anonymized.
+	HostAnonymizer *trace.HostAnonymizer
 }
 
 func NewSummary(
@@ -49,6 +122,9 @@ func NewSummary(
 	}
 }
 
+// Maximum number of ports, hosts, and endpoints listed in the summary.
+const summaryLimit = 20
+
 // Dumps packet counters for packets captured and sent to the Akita backend.
 // If the debug flag is set, also prints packets taht were captured but not
 // sent to the backend.
@@ -71,7 +147,6 @@ func (s *Summary) PrintPacketCounts() {
 // Summarize the top sources of traffic seen in a log-friendly format.
 // This appears before PrintWarnings, and should highlight the raw data.
 func (s *Summary) PrintPacketCountHighlights() {
-	summaryLimit := 20
 	top := s.FilterSummary.Summary(summaryLimit)
 
 	totalTraffic := top.Total.TCPPackets
@@ -94,6 +169,304 @@ func (s *Summary) PrintPacketCountHighlights() {
 
 	printer.Stderr.Infof("Top hosts by traffic volume:\n")
 	s.printHostHighlights(top)
+
+	s.printHTTPVersionHighlights(summaryLimit)
+	s.printGRPCCalls()
+	s.printDryRunHighlights(summaryLimit)
+	s.printEndpointSizeHighlights(summaryLimit)
+	s.printEndpointShapeHighlights(summaryLimit)
+	s.printEndpointStatusHighlights(summaryLimit)
+	s.printEndpointRateHighlights(summaryLimit)
+	s.printRetryHighlights(summaryLimit)
+	s.printConnectionEvictions()
+	s.printStaticAssetsDropped()
+	s.printSuccessfulMutationsDropped()
+	s.printWarmupSkipped()
+	s.printResponseBodiesSkipped()
+	s.printSNIExcluded()
+	s.printPluginTrims()
+	s.printTCPHealthHighlights(summaryLimit)
+}
+
+// Reports requests for static assets that were dropped.
+func (s *Summary) printStaticAssetsDropped() {
+	if s.StaticAssets == nil {
+		return
+	}
+	if dropped := s.StaticAssets.Dropped(); dropped > 0 {
+		printer.Stderr.Infof("Dropped %d requests for static assets. Use --static-extensions=\"\" to capture them.\n", dropped)
+	}
+}
+
+// Reports HTTP exchanges that were dropped because they were not successful
+// mutations.
+func (s *Summary) printSuccessfulMutationsDropped() {
+	if s.SuccessfulMutations == nil {
+		return
+	}
+	if dropped := s.SuccessfulMutations.Dropped(); dropped > 0 {
+		printer.Stderr.Infof("Dropped %d HTTP exchanges that were not successful POST, PUT, PATCH, or DELETE requests.\n", dropped)
+	}
+}
+
+// Reports witnesses that were skipped during the warm-up delay.
+func (s *Summary) printWarmupSkipped() {
+	if s.Warmup == nil {
+		return
+	}
+	if skipped := s.Warmup.Skipped(); skipped > 0 {
+		printer.Stderr.Infof("Skipped %d witnesses during the warm-up delay.\n", skipped)
+	}
+}
+
+// Reports response bodies that were dropped for being over the size limit.
+func (s *Summary) printResponseBodiesSkipped() {
+	if s.ResponseBodyLimit == nil {
+		return
+	}
+	if skipped := s.ResponseBodyLimit.Skipped(); skipped > 0 {
+		printer.Stderr.Infof("Dropped the bodies of %d HTTP responses over --filter-by-response-size.\n", skipped)
+	}
+}
+
+// Reports TLS handshakes that were excluded by SNI hostname.
+func (s *Summary) printSNIExcluded() {
+	if s.SNIFilter == nil {
+		return
+	}
+	if excluded := s.SNIFilter.Excluded(); excluded > 0 {
+		printer.Stderr.Infof("Excluded %d TLS handshakes by SNI hostname.\n", excluded)
+	}
+}
+
+// Reports what plugins trimmed from witnesses.
+func (s *Summary) printPluginTrims() {
+	for _, p := range s.Plugins {
+		switch p := p.(type) {
+		case *redact.ArrayLimiter:
+			if truncated := p.Truncated(); truncated > 0 {
+				printer.Stderr.Infof("Omitted %d array elements from %d witnesses over --max-array-elements.\n", p.Omitted(), truncated)
+			}
+		case *redact.QueryParamLimiter:
+			if limited := p.Limited(); limited > 0 {
+				printer.Stderr.Infof("Omitted %d query parameters from %d witnesses over --max-query-params.\n", p.Omitted(), limited)
+			}
+		}
+	}
+}
+
+// Reports connections that the TCP- and TLS-connection trackers stopped
+// tracking before seeing them close.
+func (s *Summary) printConnectionEvictions() {
+	if s.ConnEvictions == nil {
+		return
+	}
+	idle, overflow := s.ConnEvictions.Idle(), s.ConnEvictions.Overflow()
+	if idle == 0 && overflow == 0 {
+		return
+	}
+	printer.Stderr.Infof("Stopped tracking %d idle connections and %d connections over the connection limit before they closed.\n", idle, overflow)
+}
+
+// Lists the ports with the most TCP retransmissions and zero-window
+// advertisements. These point to network congestion or an overloaded
+// receiver, rather than a slow application.
+func (s *Summary) printTCPHealthHighlights(limit int) {
+	if s.TCPHealth == nil {
+		return
+	}
+	byPort := s.TCPHealth.ByPort()
+	if len(byPort) == 0 {
+		printer.Stderr.Infof("No TCP retransmissions or zero-window advertisements detected.\n")
+		return
+	}
+	if len(byPort) > limit {
+		byPort = byPort[:limit]
+	}
+
+	printer.Stderr.Infof("Top ports by TCP retransmissions and zero-window advertisements:\n")
+	for _, p := range byPort {
+		printer.Stderr.Infof("Port %d: %d retransmissions, %d zero-window advertisements.\n",
+			p.Port, p.Retransmissions, p.ZeroWindows)
+	}
+}
+
+// Lists the endpoints with the most client retries, as identified by repeated
+// Idempotency-Key headers.
+func (s *Summary) printRetryHighlights(limit int) {
+	if s.Idempotency == nil {
+		return
+	}
+	top := s.Idempotency.TopN(limit)
+	if len(top) == 0 {
+		printer.Stderr.Infof("No retried requests detected by Idempotency-Key.\n")
+		return
+	}
+
+	printer.Stderr.Infof("Top endpoints by retried requests (same Idempotency-Key):\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d retries of %d keyed requests (%3.1f%%) in %d retry groups.\n",
+			e.Method, e.Host, e.Path, e.Retries, e.Requests, 100.0*e.RetryRate(), e.RetryGroups)
+	}
+	if overflow := s.Idempotency.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("Retries were not tracked for %d requests because too many endpoints or keys were seen.\n", overflow)
+	}
+}
+
+// Lists the HTTP versions observed on the busiest ports and hosts.
+func (s *Summary) printHTTPVersionHighlights(limit int) {
+	if s.HTTPVersions == nil {
+		return
+	}
+	ports := s.HTTPVersions.TopPorts(limit)
+	if len(ports) == 0 {
+		return
+	}
+
+	printer.Stderr.Infof("HTTP versions by port:\n")
+	for _, p := range ports {
+		printer.Stderr.Infof("TCP Port %5d: %s.\n", p.Port, p.HTTPVersionCounts)
+	}
+
+	if hosts := s.HTTPVersions.TopHosts(limit); len(hosts) > 0 {
+		printer.Stderr.Infof("HTTP versions by host:\n")
+		for _, h := range hosts {
+			printer.Stderr.Infof("%s: %s.\n", h.Host, h.HTTPVersionCounts)
+		}
+	}
+
+	if overflow := s.HTTPVersions.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("HTTP versions were not tracked for %d requests and connections because too many ports or hosts were seen.\n", overflow)
+	}
+}
+
+// Reports the number of gRPC calls seen, if any.
+func (s *Summary) printGRPCCalls() {
+	if s.GRPCCalls == nil {
+		return
+	}
+	if calls := s.GRPCCalls.Calls(); calls > 0 {
+		printer.Stderr.Infof("%d gRPC calls seen.\n", calls)
+	}
+}
+
+// Lists the endpoints that would have produced the most witnesses during a
+// dry run.
+func (s *Summary) printDryRunHighlights(limit int) {
+	if s.DryRun == nil {
+		return
+	}
+	top := s.DryRun.TopN(limit)
+	if len(top) == 0 {
+		printer.Stderr.Infof("Dry run: no requests would have been captured.\n")
+		return
+	}
+
+	printer.Stderr.Infof("Dry run: top endpoints that would have been captured:\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d requests.\n", e.Method, e.Host, e.Path, e.Requests)
+	}
+	if overflow := s.DryRun.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("%d requests were not listed because too many endpoints were seen.\n", overflow)
+	}
+}
+
+// Lists the endpoints with the largest request and response bodies.
+func (s *Summary) printEndpointSizeHighlights(limit int) {
+	if s.EndpointSizes == nil {
+		return
+	}
+	top := s.EndpointSizes.TopN(limit)
+	if len(top) == 0 {
+		return
+	}
+
+	printer.Stderr.Infof("Top endpoints by body size (average / p95 bytes):\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d calls, request %d / %d, response %d / %d.\n",
+			e.Method, e.Host, e.PathTemplate, e.Count,
+			e.AvgRequest_bytes, e.P95Request_bytes,
+			e.AvgResponse_bytes, e.P95Response_bytes)
+	}
+	if overflow := s.EndpointSizes.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("Body sizes were not tracked for %d calls because too many endpoints were seen.\n", overflow)
+	}
+}
+
+// Lists the endpoints with the most complex bodies.
+func (s *Summary) printEndpointShapeHighlights(limit int) {
+	if s.EndpointShapes == nil {
+		return
+	}
+	top := s.EndpointShapes.TopN(limit)
+	if len(top) == 0 {
+		return
+	}
+
+	printer.Stderr.Infof("Top endpoints by body complexity (average / p95):\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d calls, %d / %d fields, depth up to %d, longest array %d / %d.\n",
+			e.Method, e.Host, e.PathTemplate, e.Count,
+			e.AvgFields, e.P95Fields, e.MaxDepth,
+			e.AvgMaxArrayLength, e.P95MaxArrayLength)
+	}
+	if overflow := s.EndpointShapes.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("Body shapes were not tracked for %d calls because too many endpoints were seen.\n", overflow)
+	}
+}
+
+// Lists the response status distribution of the busiest endpoints.
+func (s *Summary) printEndpointStatusHighlights(limit int) {
+	if s.EndpointStatuses == nil {
+		return
+	}
+	top := s.EndpointStatuses.TopN(limit)
+	if len(top) == 0 {
+		return
+	}
+
+	printer.Stderr.Infof("Top endpoints by calls, with response statuses:\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d calls, %s.\n",
+			e.Method, e.Host, e.PathTemplate, e.Count, formatStatusDistribution(e))
+	}
+	if overflow := s.EndpointStatuses.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("Response statuses were not tracked for %d calls because too many endpoints were seen.\n", overflow)
+	}
+}
+
+// Lists the endpoints with the highest peak request rates.
+func (s *Summary) printEndpointRateHighlights(limit int) {
+	if s.EndpointRates == nil {
+		return
+	}
+	top := s.EndpointRates.TopN(limit)
+	if len(top) == 0 {
+		return
+	}
+
+	printer.Stderr.Infof("Top endpoints by peak requests per second:\n")
+	for _, e := range top {
+		printer.Stderr.Infof("%s %s%s: %d calls, %.1f requests/s on average, %.1f requests/s at peak.\n",
+			e.Method, e.Host, e.PathTemplate, e.Count, e.AvgRPS, e.PeakRPS)
+	}
+	if overflow := s.EndpointRates.Overflow(); overflow > 0 {
+		printer.Stderr.Infof("Request rates were not tracked for %d calls because too many endpoints were seen.\n", overflow)
+	}
+}
+
+// Formats an endpoint's status distribution as, e.g., "80% 200, 15% 422, 5%
+// 500".
+func formatStatusDistribution(e trace.EndpointStatusSummary) string {
+	parts := make([]string, 0, len(e.Statuses))
+	for _, c := range e.Statuses {
+		status := fmt.Sprint(c.Status)
+		if c.Status == 0 {
+			status = "no response"
+		}
+		parts = append(parts, fmt.Sprintf("%.0f%% %s", 100.0*e.Fraction(c), status))
+	}
+	return strings.Join(parts, ", ")
 }
 
 func (s *Summary) printPortHighlights(top *client_telemetry.PacketCountSummary) {
@@ -134,9 +507,6 @@ func (s *Summary) printPortHighlights(top *client_telemetry.PacketCountSummary)
 			} else if thisPort.Unparsed > thisPort.TCPPackets*3/10 {
 				printer.Stderr.Infof("TCP Port %5d: has an unusually high amount of traffic that Postman cannot parse.\n", p)
 			}
-			if thisPort.HTTP2Prefaces > 0 {
-				printer.Stderr.Infof("TCP Port %5d: Contains HTTP/2 traffic (%d connections detected), which Postman cannot parse.\n", p, thisPort.HTTP2Prefaces)
-			}
 			continue
 		}
 
@@ -155,9 +525,9 @@ func (s *Summary) printPortHighlights(top *client_telemetry.PacketCountSummary)
 			continue
 		}
 
-		// If we saw HTTP/2, report it.
+		// If we saw HTTP/2 connections without requests or responses, report them.
 		if thisPort.HTTP2Prefaces > 0 {
-			printer.Stderr.Infof("TCP port %5d: %5d packets (%d%% of total), no HTTP/1.1 requests or responses, %d HTTP/2 connection attempts. Postman cannot currently parse HTTP/2.\n",
+			printer.Stderr.Infof("TCP port %5d: %5d packets (%d%% of total), no HTTP requests or responses, %d HTTP/2 connection attempts.\n",
 				p, thisPort.TCPPackets, pct, thisPort.HTTP2Prefaces)
 			continue
 		}
@@ -261,18 +631,67 @@ func (s *Summary) printHostHighlights(top *client_telemetry.PacketCountSummary)
 	}
 }
 
+// How a warning in the summary is printed.
+type warningLevel int
+
+const (
+	// Printed as information.
+	warningInfo warningLevel = iota
+
+	// Printed as highlighted information.
+	warningNotice
+
+	// Printed as a warning.
+	warningCaution
+
+	// Printed as an error.
+	warningError
+)
+
+// A problem with the capture, printed by PrintWarnings and included in the
+// JSON summary.
+type summaryWarning struct {
+	level   warningLevel
+	message string
+}
+
+func (w summaryWarning) print() {
+	switch w.level {
+	case warningInfo:
+		printer.Stderr.Infof("%s\n", w.message)
+	case warningNotice:
+		printer.Stderr.Infof("%s\n", printer.Color.Yellow(w.message))
+	case warningCaution:
+		printer.Stderr.Warningf("%s ⚠\n\n", printer.Color.Yellow(w.message))
+	case warningError:
+		printer.Stderr.Errorf("%s 🛑\n\n", printer.Color.Red(w.message))
+	}
+}
+
 // Prints warnings based on packet capture behavior, such as not capturing
 // any packets, capturing packets but failing to parse them, etc.
 func (s *Summary) PrintWarnings() {
+	for _, w := range s.warnings() {
+		w.print()
+	}
+}
+
+// Returns the problems with the capture, in the order they are printed.
+func (s *Summary) warnings() []summaryWarning {
+	var result []summaryWarning
+
 	// Report on recoverable error counts during trace
 	if pcap.CountNilAssemblerContext > 0 || pcap.CountNilAssemblerContextAfterParse > 0 || pcap.CountBadAssemblerContextType > 0 {
-		printer.Stderr.Infof("Detected packet assembly context problems during capture: %v empty, %v bad type, %v empty after parse. ",
+		msg := fmt.Sprintf("Detected packet assembly context problems during capture: %v empty, %v bad type, %v empty after parse. ",
 			pcap.CountNilAssemblerContext,
 			pcap.CountBadAssemblerContextType,
-			pcap.CountNilAssemblerContextAfterParse)
-		printer.Stderr.Infof("These errors may cause some packets to be missing from the trace.\n")
+			pcap.CountNilAssemblerContextAfterParse) +
+			"These errors may cause some packets to be missing from the trace."
+		result = append(result, summaryWarning{warningInfo, msg})
 	}
 
+	result = append(result, s.uploadBreakerWarnings()...)
+
 	// Check summary to see if the trace will have anything in it.
 	totalCount := s.FilterSummary.Total()
 	if totalCount.HTTPRequests == 0 && totalCount.HTTPResponses == 0 {
@@ -281,36 +700,120 @@ func (s *Summary) PrintWarnings() {
 				msg := "Did not capture any TCP packets during the trace. " +
 					"This may mean the traffic is on a different interface, or that " +
 					"there is a problem sending traffic to the API."
-				printer.Stderr.Infof("%s\n", printer.Color.Yellow(msg))
+				result = append(result, summaryWarning{warningNotice, msg})
 			} else {
 				msg := "Did not capture any TCP packets matching the filter. " +
 					"This may mean your filter is incorrect, such as the wrong TCP port."
-				printer.Stderr.Infof("%s\n", printer.Color.Yellow(msg))
+				result = append(result, summaryWarning{warningNotice, msg})
 			}
 		} else if totalCount.TLSHello > 0 {
 			msg := fmt.Sprintf("Captured %d TLS handshake messages out of %d total TCP segments. ", totalCount.TLSHello, totalCount.TCPPackets) +
 				"This may mean you are trying to capture HTTPS traffic, which is currently unsupported."
-			printer.Stderr.Infof("%s\n", msg)
+			result = append(result, summaryWarning{warningInfo, msg})
 		} else if totalCount.Unparsed > 0 {
 			msg := fmt.Sprintf("Captured %d TCP packets total; %d unparsed TCP segments. ", totalCount.TCPPackets, totalCount.Unparsed) +
-				"No TLS headers were found, so this may represent a network protocol that the agent does not know how to parse."
-			printer.Stderr.Infof("%s\n", msg)
+				unparsedTrafficGuidance()
+			result = append(result, summaryWarning{warningInfo, msg})
 		} else if s.NumUserFilters > 0 && s.PrefilterSummary.Total().HTTPRequests != 0 {
-			printer.Stderr.Infof("Captured %d HTTP requests before allow and exclude rules, but all were filtered.\n",
+			msg := fmt.Sprintf("Captured %d HTTP requests before allow and exclude rules, but all were filtered.",
 				s.PrefilterSummary.Total().HTTPRequests)
+			result = append(result, summaryWarning{warningInfo, msg})
 		}
-		if env.InDocker() && env.HasDockerInternalHostAddress() {
-			printer.Stderr.Infof("If you're using macOS and your service is not running in a Docker container, try using the native Postman Insights Agent with `brew install postman-insights-agent`.\n")
+		if !s.QuietWarnings && env.InDocker() && env.HasDockerInternalHostAddress() {
+			msg := "If you're using macOS and your service is not running in a Docker container, try using the native Postman Insights Agent with `brew install postman-insights-agent`."
+			result = append(result, summaryWarning{warningInfo, msg})
 		}
-		printer.Stderr.Errorf("%s 🛑\n\n", printer.Color.Red("No HTTP calls captured!"))
-		return
+		return append(result, summaryWarning{warningError, "No HTTP calls captured!"})
 	}
 	if totalCount.HTTPRequests == 0 {
-		printer.Stderr.Warningf("%s ⚠\n\n", printer.Color.Yellow("Saw HTTP responses, but not requests."))
+		result = append(result, summaryWarning{warningCaution, "Saw HTTP responses, but not requests."})
 	}
 	if totalCount.HTTPResponses == 0 {
-		printer.Stderr.Warningf("%s ⚠\n\n", printer.Color.Yellow("Saw HTTP requests, but not responses."))
+		result = append(result, summaryWarning{warningCaution, "Saw HTTP requests, but not responses."})
+	}
+	result = append(result, s.internalTrafficWarnings()...)
+	result = append(result, s.asymmetricRoutingWarnings()...)
+	return result
+}
+
+// Explains what the unparsed TCP data most likely was, based on the kinds of
+// unparsed data seen during capture.
+func unparsedTrafficGuidance() string {
+	kind := pcap.UnparsedUnknown
+	var most uint64
+	for _, k := range []pcap.UnparsedKind{pcap.UnparsedEncrypted, pcap.UnparsedCompressed, pcap.UnparsedHighEntropy, pcap.UnparsedUnknown} {
+		if n := pcap.CountUnparsed(k); n > most {
+			kind, most = k, n
+		}
+	}
+
+	switch kind {
+	case pcap.UnparsedEncrypted:
+		return "Most of it looks like encrypted TLS traffic whose handshakes were not captured. The agent cannot parse encrypted traffic."
+	case pcap.UnparsedCompressed:
+		return "Most of it looks like compressed HTTP bodies whose headers were not captured, such as on connections that were already open when capture started."
+	case pcap.UnparsedHighEntropy:
+		return "Most of it looks like encrypted or compressed data without a recognizable header."
 	}
+	return "No TLS headers were found, so this may represent a network protocol that the agent does not know how to parse."
+}
+
+// Warns if every HTTP request captured was sent over loopback, between the
+// host's own addresses, or to a health-check path, since that usually means
+// the agent is capturing on the wrong interface or with the wrong filter.
+func (s *Summary) internalTrafficWarnings() []summaryWarning {
+	if s.InternalTraffic == nil || s.QuietWarnings || !s.InternalTraffic.AllInternal() {
+		return nil
+	}
+	_, total := s.InternalTraffic.Counts()
+	msg := fmt.Sprintf("All %d HTTP requests captured were loopback, host-internal, or health-check traffic, so this is probably not your API's traffic. ", total) +
+		"Check that --interfaces includes the interface your service receives requests on, and that --filter matches your service's port."
+	return []summaryWarning{{warningCaution, msg}}
+}
+
+// Warns about requests and responses that were captured on different
+// interfaces, and so could not be paired.
+func (s *Summary) asymmetricRoutingWarnings() []summaryWarning {
+	if s.AsymmetricRouting == nil {
+		return nil
+	}
+
+	mismatches := s.AsymmetricRouting.Mismatches()
+	pairs := make([]trace.InterfacePair, 0, len(mismatches))
+	for p := range mismatches {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return mismatches[pairs[i]] > mismatches[pairs[j]]
+	})
+
+	result := make([]summaryWarning, 0, len(pairs))
+	for _, p := range pairs {
+		msg := fmt.Sprintf("%s (%d calls affected.)", p.Warning(), mismatches[p])
+		result = append(result, summaryWarning{warningCaution, msg})
+	}
+	return result
+}
+
+// Warns if uploads to the backend were paused because of repeated failures.
+func (s *Summary) uploadBreakerWarnings() []summaryWarning {
+	if s.UploadBreaker == nil {
+		return nil
+	}
+
+	stats := s.UploadBreaker.Stats()
+	if stats.TimesOpened == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Uploads to Postman were paused because of repeated failures (%d pauses), and are currently %s.", stats.TimesOpened, stats.State)
+	if stats.State == trace.CircuitClosed {
+		msg = fmt.Sprintf("Uploads to Postman were paused because of repeated failures (%d pauses), but have since resumed.", stats.TimesOpened)
+	}
+	if stats.DroppedReports > 0 {
+		msg += fmt.Sprintf(" %d witnesses and other reports were dropped while paused.", stats.DroppedReports)
+	}
+	return []summaryWarning{{warningCaution, msg}}
 }
 
 // Returns true if the trace generated from this apidump will be empty.
@@ -320,6 +823,63 @@ func (s *Summary) IsEmpty() bool {
 	return totalCount.HTTPRequests == 0 && totalCount.HTTPResponses == 0
 }
 
+// The summary of a capture in machine-readable form. Counts are of packets
+// that matched the filters.
+type summaryJSON struct {
+	Interfaces []string                                  `json:"interfaces"`
+	Total      client_telemetry.PacketCounts             `json:"total"`
+	TopByPort  map[int]*client_telemetry.PacketCounts    `json:"top_by_port"`
+	TopByHost  map[string]*client_telemetry.PacketCounts `json:"top_by_host"`
+	Warnings   []string                                  `json:"warnings"`
+	Empty      bool                                      `json:"empty"`
+}
+
+// Returns the summary as JSON: the interfaces captured, the busiest ports and
+// hosts, the warnings that PrintWarnings prints, and whether the trace is
+// empty.
+func (s *Summary) ToJSON() ([]byte, error) {
+	top := s.FilterSummary.Summary(summaryLimit)
+	result := summaryJSON{
+		Interfaces: make([]string, 0, len(s.Interfaces)),
+		Total:      top.Total,
+		TopByPort:  top.TopByPort,
+		TopByHost:  top.TopByHost,
+		Warnings:   []string{},
+		Empty:      s.IsEmpty(),
+	}
+	if s.HostAnonymizer != nil {
+		result.TopByHost = make(map[string]*client_telemetry.PacketCounts, len(top.TopByHost))
+		for host, counts := range top.TopByHost {
+			result.TopByHost[s.HostAnonymizer.Pseudonym(host)] = counts
+		}
+	}
+	for name := range s.Interfaces {
+		result.Interfaces = append(result.Interfaces, name)
+	}
+	sort.Strings(result.Interfaces)
+	for _, w := range s.warnings() {
+		result.Warnings = append(result.Warnings, w.message)
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal capture summary")
+	}
+	return b, nil
+}
+
+// Writes the summary as JSON to the given file.
+func (s *Summary) writeJSONFile(path string) error {
+	b, err := s.ToJSON()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write capture summary to %s", path)
+	}
+	return nil
+}
+
 // DumpPacketCounters prints the accumulated packet counts per interface and per port,
 // to the logging function specified in the first argument.
 // The "interfaces" argument should be the map keyed by interface names (as created
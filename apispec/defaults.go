@@ -8,11 +8,28 @@ import "time"
 // So we put these constants here to avoid pulling in libpcap when importing
 // these constants.
 const (
-	// Whether to send TCP and TLS reports to the back end.
+	// Whether to send TCP and TLS reports to the back end. Deprecated in favor
+	// of DefaultCollectTCPReports and DefaultCollectTLSReports.
 	//
 	// Invariant: if this is true, then so is DefaultParseTLSHandshakes.
 	DefaultCollectTCPAndTLSReports = false
 
+	// Whether to send TCP-connection reports to the back end.
+	DefaultCollectTCPReports = false
+
+	// Whether to send TLS-handshake reports to the back end.
+	//
+	// Invariant: if this is true, then so is DefaultParseTLSHandshakes.
+	DefaultCollectTLSReports = false
+
+	// How long a TCP or TLS connection may be idle before the connection
+	// trackers stop tracking it.
+	DefaultConnectionIdleTimeout_seconds = 30
+
+	// The maximum number of connections tracked by each TCP- or TLS-connection
+	// tracker.
+	DefaultMaxTrackedConnections = 10_000
+
 	// The name of the deployment.
 	DefaultDeployment = "default"
 
@@ -21,7 +38,8 @@ const (
 
 	// Whether to enable parsing of TLS handshakes.
 	//
-	// Invariant: if this is false, then so is DefaultCollectTCPAndTLSReports.
+	// Invariant: if this is false, then so are DefaultCollectTCPAndTLSReports
+	// and DefaultCollectTLSReports.
 	DefaultParseTLSHandshakes = true
 
 	// How many requests to capture per minute.
@@ -36,6 +54,15 @@ const (
 	// How often to upload client telemetry.
 	DefaultProcFSPollingInterval_seconds = 5 * 60 // 5 minutes
 
+	// How many consecutive upload failures pause uploads to the back end.
+	DefaultUploadFailureThreshold = 5
+
+	// How long to pause uploads to the back end after repeated failures.
+	DefaultUploadCooldown_seconds = 5 * 60 // 5 minutes
+
 	// How often to rotate traces in the back end.
 	DefaultTraceRotateInterval = time.Hour
+
+	// How many times to retry creating a trace during rotation.
+	DefaultTraceRotateRetries = 3
 )
@@ -0,0 +1,157 @@
+package bench
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akid"
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/apispec"
+	"github.com/postmanlabs/postman-insights-agent/pcap"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/rest"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+type Args struct {
+	// Path to a pcap or pcapng file whose packets are processed.
+	InputPath string
+
+	// The packets are processed repeatedly until at least this much time has
+	// passed. They are always processed at least once.
+	Duration time.Duration
+
+	// Plugins applied to each witness, as in apidump.
+	Plugins []plugin.AkitaPlugin
+}
+
+type Result struct {
+	// Number of times the packets were processed.
+	Iterations int
+
+	// Totals across all iterations.
+	Packets   int64
+	Witnesses int64
+
+	// Wall-clock and CPU time spent processing.
+	Elapsed time.Duration
+	CPUTime time.Duration
+
+	// Bytes allocated while processing, and memory obtained from the OS by the
+	// end of the run.
+	Allocated_bytes uint64
+	Sys_bytes       uint64
+}
+
+func (r Result) WitnessesPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Witnesses) / r.Elapsed.Seconds()
+}
+
+func (r Result) PacketsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Packets) / r.Elapsed.Seconds()
+}
+
+// Measures how quickly the agent processes the packets in a capture file.
+// Packets go through the same pipeline as in apidump, from reassembly and
+// parsing through pairing, plugins, and obfuscation, to preparing reports for
+// upload. Nothing is uploaded.
+func Run(args Args) (Result, error) {
+	packets, err := pcap.ReadPacketFile(args.InputPath)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(packets) == 0 {
+		return Result{}, errors.Errorf("no packets found in %s", args.InputPath)
+	}
+	printer.Stderr.Infof("Read %d packets from %s\n", len(packets), args.InputPath)
+
+	pool, err := buffer_pool.MakeBufferPool(20*1024*1024, 4*1024)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to create buffer pool")
+	}
+
+	counter := &witnessCounter{}
+
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	cpuBefore, err := cpuTime()
+	if err != nil {
+		return Result{}, err
+	}
+	start := time.Now()
+
+	result := Result{}
+	for result.Iterations == 0 || time.Since(start) < args.Duration {
+		collector := trace.NewBackendCollector(
+			akid.ServiceID{},
+			akid.LearnSessionID{},
+			discardClient{},
+			optionals.Some(apispec.DefaultMaxWitnessSize_bytes),
+			&trace.PacketCountDiscard{},
+			args.Plugins,
+		)
+		collector.(*trace.BackendCollector).SetWitnessSinks([]trace.WitnessSink{counter})
+		if err := pcap.Replay(packets, true, false, collector, pool); err != nil {
+			return Result{}, errors.Wrap(err, "failed to process packets")
+		}
+		result.Iterations += 1
+		result.Packets += int64(len(packets))
+	}
+
+	result.Elapsed = time.Since(start)
+	cpuAfter, err := cpuTime()
+	if err != nil {
+		return Result{}, err
+	}
+	result.CPUTime = cpuAfter - cpuBefore
+
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+	result.Allocated_bytes = memAfter.TotalAlloc - memBefore.TotalAlloc
+	result.Sys_bytes = memAfter.Sys
+	result.Witnesses = atomic.LoadInt64(&counter.count)
+
+	return result, nil
+}
+
+// Returns the user and system CPU time used by this process so far.
+func cpuTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, errors.Wrap(err, "failed to get CPU usage")
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
+
+// Counts the witnesses that make it through the pipeline.
+type witnessCounter struct {
+	count int64
+}
+
+func (c *witnessCounter) ExportWitness(*pb.Witness, time.Time, trace.WitnessInfo) {
+	atomic.AddInt64(&c.count, 1)
+}
+
+// A learn client that discards uploaded reports. Only report uploads are
+// expected; any other call panics.
+type discardClient struct {
+	rest.LearnClient
+}
+
+func (discardClient) AsyncReportsUpload(context.Context, akid.LearnSessionID, *kgxapi.UploadReportsRequest) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	result, err := Run(Args{InputPath: "testdata/sample.pcap"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The sample holds two HTTP exchanges, and is processed once.
+	assert.Equal(t, 1, result.Iterations)
+	assert.Equal(t, int64(2), result.Witnesses)
+	assert.Greater(t, result.Packets, int64(0))
+	assert.Greater(t, result.WitnessesPerSecond(), 0.0)
+	assert.Greater(t, result.Sys_bytes, uint64(0))
+}
+
+func TestRunMissingInput(t *testing.T) {
+	_, err := Run(Args{InputPath: "testdata/missing.pcap"})
+	assert.Error(t, err)
+}
@@ -97,6 +97,13 @@ func debugDumpEnv(vars []string) {
 	}
 }
 
+// Indicates whether the CI environment variable is set to true, as it is in
+// most CI environments.
+func InCI() bool {
+	inCI, err := strconv.ParseBool(os.Getenv("CI"))
+	return err == nil && inCI
+}
+
 // Returns learn session tags for common CI environments.
 // Currently, we support:
 // - CircleCI
@@ -1,6 +1,7 @@
 package apidump
 
 import (
+	"os"
 	"time"
 
 	"github.com/akitasoftware/akita-libs/akid"
@@ -10,9 +11,12 @@ import (
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/cmderr"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/pluginloader"
 	"github.com/postmanlabs/postman-insights-agent/location"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
 	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/redact"
 	"github.com/postmanlabs/postman-insights-agent/rest"
 	"github.com/postmanlabs/postman-insights-agent/telemetry"
+	"github.com/postmanlabs/postman-insights-agent/trace"
 	"github.com/postmanlabs/postman-insights-agent/util"
 	"github.com/spf13/cobra"
 )
@@ -23,8 +27,9 @@ var (
 	projectID               string
 	postmanCollectionID     string
 	interfacesFlag          []string
-	filterFlag              string
+	filterFlag              []string
 	sampleRateFlag          float64
+	sampleSuccessesRateFlag float64
 	rateLimitFlag           float64
 	tagsFlag                []string
 	appendByTagFlag         bool
@@ -40,10 +45,84 @@ var (
 	telemetryInterval       int
 	procFSPollingInterval   int
 	collectTCPAndTLSReports bool
+	collectTCPReports       bool
+	collectTLSReports       bool
 	parseTLSHandshakes      bool
+	connectionIdleTimeout   int
+	maxTrackedConnections   int
 	maxWitnessSize_bytes    int
 	dockerExtensionMode     bool
 	healthCheckPort         int
+	otlpEndpointFlag        string
+	detectHighEntropyFlag   bool
+	highEntropyMinLength    int
+	highEntropyThreshold    float64
+	highEntropyAllowFlag    []string
+	captureBodiesFlag       string
+	trackIdempotencyFlag    bool
+	printSessionFlag        bool
+	printSessionFileFlag    string
+	uploadFailureThreshold  int
+	uploadCooldown          int
+	serviceVersionFlag      string
+	dropFieldsFlag          []string
+	schemaOnlyFlag          bool
+	forceCaptureHeaderFlag  string
+	examplesPerEndpointFlag int
+	rateLimitPerEndpoint    float64
+	rateLimitPerHost        float64
+	manifestOutputFlag      string
+	staticExtensionsFlag    []string
+	protoDescriptorsFlag    string
+	redirectPolicyFlag      string
+	anonymizeHostsLocalFlag bool
+	baselineFlag            string
+	baselineOutputFlag      string
+	quietWarningsFlag       bool
+	redactionConcurrency    int
+	maxUploadRequestSize    int
+	firstExchangeOnlyFlag   bool
+	adminPortFlag           int
+	maxQueryParamsFlag      int
+	sniAllowFlag            []string
+	sniExcludeFlag          []string
+	bodySizeMinFlag         int
+	bodySizeMaxFlag         int
+	eventSocketFlag         string
+	keepAuthSchemeFlag      bool
+	redactEnvValuesFlag     []string
+	shapeMetricsFlag        bool
+	traceRotateRetriesFlag  int
+	maxPcapHandlesFlag      int
+	s3BucketFlag            string
+	s3EndpointFlag          string
+	s3RegionFlag            string
+	s3PrefixFlag            string
+	s3ProfileFlag           string
+	groupByHeaderFlag       []string
+	memoryThresholdMBFlag   int
+	memoryMinRateFlag       float64
+	successfulMutationsFlag bool
+	redactKeyPatternsFlag   []string
+	redactKeyPatternsFile   string
+	maxArrayElementsFlag    int
+	collectionOutputFlag    string
+	connectionResetFlag     string
+	statsdAddressFlag       string
+	statsdPrefixFlag        string
+	statsdTagsFlag          []string
+	warmupDelayFlag         int
+	maxRespBodySizeFlag     int
+	correlationHeaderFlag   string
+	summaryJSONFlag         string
+	redactionConfigFlag     string
+	captureRawQueryFlag     bool
+	rawQueryAllowFlag       []string
+	rotateAfterWitnessFlag  int
+	dryRunFlag              bool
+	captureWebSocketFlag    bool
+	streamingTimeoutFlag    int64
+	bodySampleRateFlag      float64
 )
 
 var Cmd = &cobra.Command{
@@ -58,11 +137,121 @@ var Cmd = &cobra.Command{
 			return err
 		}
 
-		plugins, err := pluginloader.Load(pluginsFlag)
+		userPlugins, err := pluginloader.Load(pluginsFlag)
 		if err != nil {
 			return errors.Wrap(err, "failed to load plugins")
 		}
 
+		// Built-in plugins, grouped by the stage in which they run. See below
+		// for the order of the stages.
+		var bodyPlugins, trimPlugins, redactPlugins, limitPlugins []plugin.AkitaPlugin
+
+		// Keep bodies for only a sampled fraction of witnesses.
+		if bodySampleRateFlag < 0.0 || bodySampleRateFlag > 1.0 {
+			return errors.New("--body-sample-rate must be between 0.0 and 1.0")
+		} else if bodySampleRateFlag < 1.0 {
+			bodyPlugins = append(bodyPlugins, redact.NewBodySampler(bodySampleRateFlag))
+		}
+
+		// Drop unwanted bodies.
+		bodyCaptureMode, err := redact.ParseBodyCaptureMode(captureBodiesFlag)
+		if err != nil {
+			return errors.Wrap(err, "invalid --capture-bodies")
+		}
+		if bodyCaptureMode != redact.CaptureAllBodies {
+			bodyPlugins = append(bodyPlugins, redact.NewBodyFilter(bodyCaptureMode))
+		}
+
+		// Truncate large arrays.
+		if maxArrayElementsFlag < 0 {
+			return errors.New("--max-array-elements must not be negative")
+		} else if maxArrayElementsFlag > 0 {
+			trimPlugins = append(trimPlugins, redact.NewArrayLimiter(maxArrayElementsFlag))
+		}
+
+		// Drop unwanted fields.
+		if len(dropFieldsFlag) > 0 {
+			dropper, err := redact.NewFieldDropper(dropFieldsFlag)
+			if err != nil {
+				return errors.Wrap(err, "invalid --drop-fields")
+			}
+			trimPlugins = append(trimPlugins, dropper)
+		}
+
+		// Redact the values of the given environment variables wherever they
+		// appear.
+		if len(redactEnvValuesFlag) > 0 {
+			secrets := make([]string, 0, len(redactEnvValuesFlag))
+			for _, name := range redactEnvValuesFlag {
+				value, ok := os.LookupEnv(name)
+				if !ok {
+					printer.Warningf("Environment variable %s is not set, so its value will not be redacted.\n", name)
+					continue
+				}
+				if len(value) < redact.MinSecretValueLength {
+					printer.Warningf("The value of environment variable %s is shorter than %d characters, so it will not be redacted.\n", name, redact.MinSecretValueLength)
+					continue
+				}
+				secrets = append(secrets, value)
+			}
+			redactPlugins = append(redactPlugins, redact.NewSecretValueRedactor(secrets))
+		}
+
+		// Redact the values of fields, headers, query parameters, and cookies
+		// whose names match the given patterns, and any values matching the
+		// patterns in the redaction config.
+		if len(redactKeyPatternsFlag) > 0 || redactKeyPatternsFile != "" || redactionConfigFlag != "" {
+			patterns := redactKeyPatternsFlag
+			if redactKeyPatternsFile != "" {
+				filePatterns, err := redact.LoadKeyPatterns(redactKeyPatternsFile)
+				if err != nil {
+					return err
+				}
+				patterns = append(patterns, filePatterns...)
+			}
+			config := &redact.Config{}
+			if redactionConfigFlag != "" {
+				config, err = redact.LoadConfig(redactionConfigFlag)
+				if err != nil {
+					return err
+				}
+			}
+			redactors, err := config.Plugins(patterns)
+			if err != nil {
+				return errors.Wrap(err, "invalid redaction rules")
+			}
+			redactPlugins = append(redactPlugins, redactors...)
+		}
+
+		// Redact high-entropy values.
+		if detectHighEntropyFlag {
+			redactor := redact.NewEntropyRedactor(redact.EntropyConfig{
+				MinLength:       highEntropyMinLength,
+				MinEntropy_bits: highEntropyThreshold,
+				AllowedNames:    highEntropyAllowFlag,
+			})
+			redactPlugins = append(redactPlugins, redactor)
+		}
+
+		// Limit query parameters.
+		if maxQueryParamsFlag < 0 {
+			return errors.New("--max-query-params must not be negative")
+		} else if maxQueryParamsFlag > 0 {
+			limitPlugins = append(limitPlugins, redact.NewQueryParamLimiter(maxQueryParamsFlag))
+		}
+
+		// Drop and sample bodies first, so that no other plugin sees the bodies
+		// dropped. Then truncate arrays and drop unwanted fields, so that only
+		// what is kept is redacted. Redact before user-provided plugins see any
+		// values. Limit query parameters last, so that redaction decisions are
+		// made on the full set of parameters.
+		var plugins []plugin.AkitaPlugin
+		plugins = append(plugins, bodyPlugins...)
+		plugins = append(plugins, trimPlugins...)
+		plugins = append(plugins, redactPlugins...)
+		plugins = append(plugins, userPlugins...)
+		plugins = append(plugins, limitPlugins...)
+
 		// Check that exactly one of --project or --collection is specified.
 		if projectID == "" && postmanCollectionID == "" {
 			return errors.New("exactly one of --project or --collection must be specified")
@@ -117,46 +306,149 @@ var Cmd = &cobra.Command{
 			}
 		}
 
+		if rotateAfterWitnessFlag < 0 {
+			return errors.New("--rotate-after-witnesses must not be negative")
+		}
+
 		// Rate limit must be greater than zero.
 		if rateLimitFlag <= 0.0 {
 			rateLimitFlag = 1000.0
 		}
 
-		// If we collect TLS information, we have to parse it
-		if collectTCPAndTLSReports {
-			if !parseTLSHandshakes {
-				printer.Stderr.Warningf("Overriding parse-tls-handshakes=false because TLS report collection is enabled.\n")
-				parseTLSHandshakes = true
-			}
+		if printSessionFileFlag != "" && !printSessionFlag {
+			return errors.New("--print-session-file can only be used with --print-session")
+		}
+
+		if examplesPerEndpointFlag != 0 && !schemaOnlyFlag {
+			return errors.New("--examples-per-endpoint-status can only be used with --schema-only")
+		}
+		if examplesPerEndpointFlag < 0 {
+			return errors.New("--examples-per-endpoint-status must not be negative")
+		}
+
+		if _, err := trace.ParseRedirectPolicy(redirectPolicyFlag); err != nil {
+			return errors.Wrap(err, "invalid --redirect-policy")
+		}
+
+		if _, err := trace.ParseConnectionResetHandling(connectionResetFlag); err != nil {
+			return errors.Wrap(err, "invalid --on-connection-reset")
+		}
+
+		if sampleSuccessesRateFlag < 0.0 || sampleSuccessesRateFlag > 1.0 {
+			return errors.New("--sample-successes-rate must be between 0.0 and 1.0")
+		}
+
+		if warmupDelayFlag < 0 {
+			return errors.New("--warmup-delay must not be negative")
+		}
+
+		if maxRespBodySizeFlag < 0 {
+			return errors.New("--filter-by-response-size must not be negative")
+		}
+
+		if memoryThresholdMBFlag < 0 {
+			return errors.New("--memory-threshold-mb must not be negative")
+		}
+		if memoryMinRateFlag < 0.0 || memoryMinRateFlag > 1.0 {
+			return errors.New("--memory-min-sample-rate must be between 0.0 and 1.0")
+		}
+
+		if bodySizeMinFlag < 0 || bodySizeMaxFlag < 0 {
+			return errors.New("--body-size-min and --body-size-max must not be negative")
+		}
+		if bodySizeMaxFlag > 0 && bodySizeMinFlag > bodySizeMaxFlag {
+			return errors.New("--body-size-min must not be greater than --body-size-max")
 		}
 
 		args := apidump.Args{
-			ClientID:                telemetry.GetClientID(),
-			Domain:                  rest.Domain,
-			Out:                     outFlag,
-			PostmanCollectionID:     postmanCollectionID,
-			ServiceID:               serviceID,
-			Tags:                    traceTags,
-			SampleRate:              sampleRateFlag,
-			WitnessesPerMinute:      rateLimitFlag,
-			Interfaces:              interfacesFlag,
-			Filter:                  filterFlag,
-			PathExclusions:          pathExclusionsFlag,
-			HostExclusions:          hostExclusionsFlag,
-			PathAllowlist:           pathAllowlistFlag,
-			HostAllowlist:           hostAllowlistFlag,
-			ExecCommand:             execCommandFlag,
-			ExecCommandUser:         execCommandUserFlag,
-			Plugins:                 plugins,
-			LearnSessionLifetime:    traceRotateInterval,
-			StatsLogDelay:           statsLogDelay,
-			TelemetryInterval:       telemetryInterval,
-			ProcFSPollingInterval:   procFSPollingInterval,
-			CollectTCPAndTLSReports: collectTCPAndTLSReports,
-			ParseTLSHandshakes:      parseTLSHandshakes,
-			MaxWitnessSize_bytes:    maxWitnessSize_bytes,
-			DockerExtensionMode:     dockerExtensionMode,
-			HealthCheckPort:         healthCheckPort,
+			ClientID:                        telemetry.GetClientID(),
+			Domain:                          rest.Domain,
+			Out:                             outFlag,
+			PostmanCollectionID:             postmanCollectionID,
+			ServiceID:                       serviceID,
+			Tags:                            traceTags,
+			SampleRate:                      sampleRateFlag,
+			WitnessesPerMinute:              rateLimitFlag,
+			EndpointRateLimit:               rateLimitPerEndpoint,
+			HostRateLimit:                   rateLimitPerHost,
+			SuccessSampleRate:               sampleSuccessesRateFlag,
+			Interfaces:                      interfacesFlag,
+			Filters:                         filterFlag,
+			PathExclusions:                  pathExclusionsFlag,
+			HostExclusions:                  hostExclusionsFlag,
+			PathAllowlist:                   pathAllowlistFlag,
+			HostAllowlist:                   hostAllowlistFlag,
+			ExecCommand:                     execCommandFlag,
+			ExecCommandUser:                 execCommandUserFlag,
+			Plugins:                         plugins,
+			LearnSessionLifetime:            traceRotateInterval,
+			RotateAfterWitnesses:            rotateAfterWitnessFlag,
+			StatsLogDelay:                   statsLogDelay,
+			TelemetryInterval:               telemetryInterval,
+			ProcFSPollingInterval:           procFSPollingInterval,
+			CollectTCPAndTLSReports:         collectTCPAndTLSReports,
+			CollectTCPReports:               collectTCPReports,
+			CollectTLSReports:               collectTLSReports,
+			ParseTLSHandshakes:              parseTLSHandshakes,
+			ConnectionIdleTimeout:           connectionIdleTimeout,
+			MaxTrackedConnections:           maxTrackedConnections,
+			MaxWitnessSize_bytes:            maxWitnessSize_bytes,
+			DockerExtensionMode:             dockerExtensionMode,
+			HealthCheckPort:                 healthCheckPort,
+			OTLPEndpoint:                    otlpEndpointFlag,
+			TrackIdempotency:                trackIdempotencyFlag,
+			PrintSession:                    printSessionFlag,
+			PrintSessionFile:                printSessionFileFlag,
+			UploadFailureThreshold:          uploadFailureThreshold,
+			UploadCooldown:                  uploadCooldown,
+			ServiceVersion:                  serviceVersionFlag,
+			SchemaOnly:                      schemaOnlyFlag,
+			ExamplesPerEndpointStatus:       examplesPerEndpointFlag,
+			ForceCaptureHeader:              forceCaptureHeaderFlag,
+			ManifestOutput:                  manifestOutputFlag,
+			StaticExtensions:                staticExtensionsFlag,
+			ProtoDescriptors:                protoDescriptorsFlag,
+			RedirectPolicy:                  redirectPolicyFlag,
+			AnonymizeHostsLocal:             anonymizeHostsLocalFlag,
+			Baseline:                        baselineFlag,
+			BaselineOutput:                  baselineOutputFlag,
+			QuietWarnings:                   quietWarningsFlag,
+			RedactionConcurrency:            redactionConcurrency,
+			MaxRequestSize_bytes:            maxUploadRequestSize,
+			FirstExchangeOnly:               firstExchangeOnlyFlag,
+			AdminPort:                       adminPortFlag,
+			SNIAllowlist:                    sniAllowFlag,
+			SNIExclusions:                   sniExcludeFlag,
+			BodySizeMin_bytes:               bodySizeMinFlag,
+			BodySizeMax_bytes:               bodySizeMaxFlag,
+			EventSocket:                     eventSocketFlag,
+			KeepAuthScheme:                  keepAuthSchemeFlag,
+			ShapeMetrics:                    shapeMetricsFlag,
+			LearnSessionRetries:             traceRotateRetriesFlag,
+			MaxPcapHandles:                  maxPcapHandlesFlag,
+			S3Bucket:                        s3BucketFlag,
+			S3Endpoint:                      s3EndpointFlag,
+			S3Region:                        s3RegionFlag,
+			S3Prefix:                        s3PrefixFlag,
+			S3Profile:                       s3ProfileFlag,
+			GroupByHeaders:                  groupByHeaderFlag,
+			MemoryThreshold_bytes:           uint64(memoryThresholdMBFlag) * 1024 * 1024,
+			MemoryMinSampleRate:             memoryMinRateFlag,
+			SuccessfulMutationsOnly:         successfulMutationsFlag,
+			CollectionOutput:                collectionOutputFlag,
+			OnConnectionReset:               connectionResetFlag,
+			StatsDAddress:                   statsdAddressFlag,
+			StatsDPrefix:                    statsdPrefixFlag,
+			StatsDTags:                      statsdTagsFlag,
+			WarmupDelay:                     warmupDelayFlag,
+			MaxResponseBodySize_bytes:       maxRespBodySizeFlag,
+			CorrelationHeader:               correlationHeaderFlag,
+			SummaryJSON:                     summaryJSONFlag,
+			CaptureRawQuery:                 captureRawQueryFlag,
+			RawQueryAllow:                   rawQueryAllowFlag,
+			DryRun:                          dryRunFlag,
+			CaptureWebSocketMessages:        captureWebSocketFlag,
+			StreamingResponseTimeoutSeconds: streamingTimeoutFlag,
 		}
 		if err := apidump.Run(args); err != nil {
 			return cmderr.AkitaErr{Err: err}
@@ -181,11 +473,11 @@ func init() {
 
 	Cmd.MarkFlagsMutuallyExclusive("project", "collection")
 
-	Cmd.Flags().StringVar(
+	Cmd.Flags().StringArrayVar(
 		&filterFlag,
 		"filter",
-		"",
-		"Used to match packets going to and coming from your API service.")
+		nil,
+		"Used to match packets going to and coming from your API service. May be given more than once to capture packets matching any of the filters.")
 
 	Cmd.Flags().StringSliceVar(
 		&interfacesFlag,
@@ -201,6 +493,13 @@ func init() {
 	)
 	Cmd.Flags().MarkDeprecated("sample-rate", "use --rate-limit instead.")
 
+	Cmd.Flags().Float64Var(
+		&sampleSuccessesRateFlag,
+		"sample-successes-rate",
+		1.0,
+		"A number between [0.0, 1.0] to control sampling of successful requests. Requests with 4xx or 5xx responses are not subject to this sampling, but may still be dropped by --rate-limit, --rate-limit-per-endpoint, --rate-limit-per-host, or by --memory-threshold-mb.",
+	)
+
 	Cmd.Flags().Float64Var(
 		&rateLimitFlag,
 		"rate-limit",
@@ -208,6 +507,20 @@ func init() {
 		"Number of requests per minute to capture.",
 	)
 
+	Cmd.Flags().Float64Var(
+		&rateLimitPerEndpoint,
+		"rate-limit-per-endpoint",
+		0,
+		"Number of requests per minute to capture for each endpoint, so that busy endpoints don't crowd out the rest. Endpoints are identified by method, host, and path, with path segments that look like identifiers treated as parameters. Disabled if 0.",
+	)
+
+	Cmd.Flags().Float64Var(
+		&rateLimitPerHost,
+		"rate-limit-per-host",
+		0,
+		"Number of requests per minute to capture for each host, as given by the Host header, so that a chatty host doesn't crowd out the rest. Requests without a Host header are subject only to the other rate limits. Disabled if 0.",
+	)
+
 	Cmd.Flags().StringSliceVar(
 		&tagsFlag,
 		"tags",
@@ -312,6 +625,23 @@ func init() {
 		"Collect TCP and TLS reports.",
 	)
 	Cmd.Flags().MarkHidden("report-tcp-and-tls")
+	Cmd.Flags().MarkDeprecated("report-tcp-and-tls", "use --collect-tcp-reports and --collect-tls-reports instead.")
+
+	Cmd.Flags().BoolVar(
+		&collectTCPReports,
+		"collect-tcp-reports",
+		apispec.DefaultCollectTCPReports,
+		"Collect TCP connection reports.",
+	)
+	Cmd.Flags().MarkHidden("collect-tcp-reports")
+
+	Cmd.Flags().BoolVar(
+		&collectTLSReports,
+		"collect-tls-reports",
+		apispec.DefaultCollectTLSReports,
+		"Collect TLS handshake reports. Implies --parse-tls-handshakes.",
+	)
+	Cmd.Flags().MarkHidden("collect-tls-reports")
 
 	Cmd.Flags().BoolVar(
 		&parseTLSHandshakes,
@@ -321,6 +651,38 @@ func init() {
 	)
 	Cmd.Flags().MarkHidden("parse-tls-handshakes")
 
+	Cmd.Flags().IntVar(
+		&connectionIdleTimeout,
+		"connection-idle-timeout",
+		apispec.DefaultConnectionIdleTimeout_seconds,
+		"Stop tracking a connection for TCP and TLS reports after it has been idle for N seconds.",
+	)
+	Cmd.Flags().MarkHidden("connection-idle-timeout")
+
+	Cmd.Flags().IntVar(
+		&maxTrackedConnections,
+		"max-tracked-connections",
+		apispec.DefaultMaxTrackedConnections,
+		"Maximum number of connections tracked at once for TCP and TLS reports, per interface. The least recently active connection is evicted when the limit is reached. Set to 0 for no limit.",
+	)
+	Cmd.Flags().MarkHidden("max-tracked-connections")
+
+	Cmd.Flags().IntVar(
+		&uploadFailureThreshold,
+		"upload-failure-threshold",
+		apispec.DefaultUploadFailureThreshold,
+		"Pause uploads to Postman after N consecutive failures. Set to 0 to pause only when Postman asks for it.",
+	)
+	Cmd.Flags().MarkHidden("upload-failure-threshold")
+
+	Cmd.Flags().IntVar(
+		&uploadCooldown,
+		"upload-cooldown",
+		apispec.DefaultUploadCooldown_seconds,
+		"Pause uploads to Postman for N seconds after repeated failures, or longer if Postman asks for it.",
+	)
+	Cmd.Flags().MarkHidden("upload-cooldown")
+
 	Cmd.Flags().IntVar(
 		&maxWitnessSize_bytes,
 		"max-witness-size-bytes",
@@ -344,4 +706,469 @@ func init() {
 		"Port to listen on for Docker extension health checks. This is an internal flag used by the Akita Docker extension.",
 	)
 	_ = Cmd.Flags().MarkHidden("health-check-port")
+
+	Cmd.Flags().StringVar(
+		&otlpEndpointFlag,
+		"otlp-endpoint",
+		"",
+		"OTLP/HTTP endpoint of an OpenTelemetry collector (e.g. http://localhost:4318). If set, captured API calls are also exported as spans.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&detectHighEntropyFlag,
+		"detect-high-entropy",
+		false,
+		"Redact string values that look like randomly generated secrets, based on their length and entropy. May redact some legitimate values.",
+	)
+
+	Cmd.Flags().IntVar(
+		&highEntropyMinLength,
+		"high-entropy-min-length",
+		redact.DefaultMinEntropyLength,
+		"Minimum length of values redacted by --detect-high-entropy.",
+	)
+	Cmd.Flags().MarkHidden("high-entropy-min-length")
+
+	Cmd.Flags().Float64Var(
+		&highEntropyThreshold,
+		"high-entropy-threshold",
+		redact.DefaultMinEntropy_bits,
+		"Minimum Shannon entropy, in bits per character, of values redacted by --detect-high-entropy.",
+	)
+	Cmd.Flags().MarkHidden("high-entropy-threshold")
+
+	Cmd.Flags().StringSliceVar(
+		&highEntropyAllowFlag,
+		"high-entropy-allow",
+		nil,
+		"Names of fields, headers, query parameters, and cookies whose values are never redacted by --detect-high-entropy.",
+	)
+
+	Cmd.Flags().StringVar(
+		&captureBodiesFlag,
+		"capture-bodies",
+		string(redact.CaptureAllBodies),
+		"Which HTTP bodies to capture: request, response, both, or none. Headers and response codes are captured regardless.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&trackIdempotencyFlag,
+		"track-idempotency",
+		false,
+		"Group requests by their Idempotency-Key header, summarize the endpoints with the most client retries, and mark retried requests in their metadata.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&printSessionFlag,
+		"print-session",
+		false,
+		"Print each trace to stdout as a line of JSON when it is created, including its service, name, ID, and URL.",
+	)
+
+	Cmd.Flags().StringVar(
+		&printSessionFileFlag,
+		"print-session-file",
+		"",
+		"Also append the output of --print-session to this file.",
+	)
+
+	Cmd.Flags().StringVar(
+		&serviceVersionFlag,
+		"service-version",
+		"",
+		"Version of the monitored service, such as a git commit or build SHA, to attach to the trace. Defaults to the POSTMAN_SERVICE_VERSION environment variable.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&dropFieldsFlag,
+		"drop-fields",
+		nil,
+		"Fields to remove from request and response bodies before upload, so they are left out of the API model. Each is either a field name, matched at any depth, or a JSONPath such as $.items[*].description.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&schemaOnlyFlag,
+		"schema-only",
+		false,
+		"Upload only the shape of each endpoint, with no values. Path segments that might hold identifiers are replaced with parameters.",
+	)
+
+	Cmd.Flags().StringVar(
+		&forceCaptureHeaderFlag,
+		"force-capture-header",
+		"",
+		"Always capture requests with this header, and their responses, regardless of sampling and rate limits. Either a header name, such as X-Postman-Capture, or a name and value, such as X-Postman-Capture=1.",
+	)
+
+	Cmd.Flags().IntVar(
+		&examplesPerEndpointFlag,
+		"examples-per-endpoint-status",
+		0,
+		"With --schema-only, keep the values of the first N API calls of each endpoint and response status as examples. Values are still obfuscated.",
+	)
+
+	Cmd.Flags().StringVar(
+		&manifestOutputFlag,
+		"manifest-output",
+		"",
+		"When the capture ends, write a JSON manifest describing it to this file: the agent version, filters, sampling and redaction settings, learn sessions, and traffic counts. The API key is recorded only as a fingerprint.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&staticExtensionsFlag,
+		"static-extensions",
+		trace.DefaultStaticExtensions,
+		"Drop requests whose path ends in one of these file extensions, such as static scripts, stylesheets, images, and fonts. Set to \"\" to capture static assets.",
+	)
+
+	Cmd.Flags().StringVar(
+		&protoDescriptorsFlag,
+		"proto-descriptors",
+		"",
+		"Path to a FileDescriptorSet, as produced by protoc --descriptor_set_out --include_imports, used to decode Protocol Buffers bodies. The message type is taken from the messageType or proto parameter of the Content-Type header. Without it, only field numbers and wire types are recorded.",
+	)
+
+	Cmd.Flags().StringVar(
+		&redirectPolicyFlag,
+		"redirect-policy",
+		string(trace.RedirectKeep),
+		"How to capture redirects (3xx responses with a Location header). One of: keep, to capture them like any other response; collapse, to drop them and record the locations that the request they lead to was redirected from as metadata of its witness; or drop, to drop them.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&anonymizeHostsLocalFlag,
+		"anonymize-hosts-local",
+		false,
+		"Replace host names with pseudonyms that are consistent within a run in the outputs written locally or to your own storage, so they can be shared: local --out trace files, --collection-output, --event-socket, --s3-bucket, and --summary-json. Traffic sent to Postman is not affected.",
+	)
+
+	Cmd.Flags().StringVar(
+		&baselineFlag,
+		"baseline",
+		"",
+		"Compare the endpoints observed during the capture, with their method, path template, and parameter names, against the API surface in this file, as written by --baseline-output. Added, removed, and changed endpoints are printed, and the command exits with a non-zero status if there are any.",
+	)
+
+	Cmd.Flags().StringVar(
+		&baselineOutputFlag,
+		"baseline-output",
+		"",
+		"When the capture ends, write the endpoints observed during the capture, with their method, path template, and parameter names, to this file for use with --baseline.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&quietWarningsFlag,
+		"quiet-warnings",
+		false,
+		"Don't print guidance meant for a first, interactive run, such as the warning that --filter is not set. Errors and the capture summary are still printed. Implied when the CI environment variable is true.",
+	)
+
+	Cmd.Flags().IntVar(
+		&redactionConcurrency,
+		"redaction-concurrency",
+		0,
+		"Maximum number of witnesses to redact at once, across all interfaces. Witnesses beyond the limit wait their turn, which bounds CPU usage under heavy traffic. Defaults to the number of CPUs available.",
+	)
+
+	Cmd.Flags().IntVar(
+		&maxUploadRequestSize,
+		"max-upload-request-size-bytes",
+		0,
+		"If positive, split uploads larger than this across several requests, for proxies that reject large request bodies. Reports are never split.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&firstExchangeOnlyFlag,
+		"first-exchange-only",
+		false,
+		"Capture request and response bodies only for the first exchange on each connection. Later exchanges are captured without their bodies.",
+	)
+
+	Cmd.Flags().IntVar(
+		&adminPortFlag,
+		"admin-port",
+		0,
+		"If positive, serve endpoints on this port on localhost for pausing and resuming capture: POST /admin/pause, POST /admin/resume, and GET /status.",
+	)
+
+	Cmd.Flags().IntVar(
+		&maxQueryParamsFlag,
+		"max-query-params",
+		0,
+		"If positive, record at most this many query parameters per request, in order of their names. The rest are omitted, and the number omitted is reported in the capture summary.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&sniAllowFlag,
+		"sni-allow",
+		nil,
+		"Reports only TLS handshakes whose SNI hostname matches regular expressions.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&sniExcludeFlag,
+		"sni-exclude",
+		nil,
+		"Removes TLS handshakes whose SNI hostname matches regular expressions.",
+	)
+
+	Cmd.Flags().IntVar(
+		&bodySizeMinFlag,
+		"body-size-min",
+		0,
+		"If positive, drop request and response bodies smaller than this many bytes, keeping the rest of the witness.",
+	)
+
+	Cmd.Flags().IntVar(
+		&bodySizeMaxFlag,
+		"body-size-max",
+		0,
+		"If positive, drop request and response bodies larger than this many bytes, keeping the rest of the witness.",
+	)
+
+	Cmd.Flags().StringVar(
+		&eventSocketFlag,
+		"event-socket",
+		"",
+		"If set, serve newline-delimited JSON events describing each witness sent to Postman on a Unix domain socket at this path. Events include the method, host, path template, status, and latency, but never bodies.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&keepAuthSchemeFlag,
+		"keep-auth-scheme",
+		false,
+		"If set, capture the scheme of Authorization and Proxy-Authorization headers in requests (e.g. \"Bearer *REDACTED*\"). The credential is always redacted.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&redactEnvValuesFlag,
+		"redact-env-values",
+		nil,
+		"Names of environment variables holding secrets. Any captured value exactly equal to one of their values is redacted, regardless of where it appears.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&shapeMetricsFlag,
+		"shape-metrics",
+		false,
+		"If set, measure the number of fields, nesting depth, and array lengths of bodies per endpoint, and report the most complex endpoints in the summary.",
+	)
+
+	Cmd.Flags().IntVar(
+		&traceRotateRetriesFlag,
+		"trace-rotate-retries",
+		apispec.DefaultTraceRotateRetries,
+		"Number of times to retry creating a new trace during rotation before continuing with the current trace.",
+	)
+	Cmd.Flags().MarkHidden("trace-rotate-retries")
+
+	Cmd.Flags().IntVar(
+		&maxPcapHandlesFlag,
+		"max-pcap-handles",
+		0,
+		"If positive, the maximum number of pcap handles open at once. Each interface uses one, or two if --filter is set. If capturing on every interface would need more, interfaces are chosen in order of name and the rest are not captured. Use this to avoid running out of file descriptors on hosts with many interfaces.",
+	)
+
+	Cmd.Flags().StringVar(
+		&s3BucketFlag,
+		"s3-bucket",
+		"",
+		"If set, also write witnesses sent to Postman to this bucket of an S3-compatible object store, as batches of JSON witness reports. Credentials are read from the standard AWS environment variables and configuration files.",
+	)
+
+	Cmd.Flags().StringVar(
+		&s3EndpointFlag,
+		"s3-endpoint",
+		"",
+		"Base URL of an S3-compatible object store to use with --s3-bucket (e.g. http://localhost:9000). Defaults to AWS S3.",
+	)
+
+	Cmd.Flags().StringVar(
+		&s3RegionFlag,
+		"s3-region",
+		"",
+		"Region of the bucket given by --s3-bucket. Defaults to the region in the AWS configuration.",
+	)
+
+	Cmd.Flags().StringVar(
+		&s3PrefixFlag,
+		"s3-prefix",
+		"",
+		"Prefix for the keys of objects written to the bucket given by --s3-bucket.",
+	)
+
+	Cmd.Flags().StringVar(
+		&s3ProfileFlag,
+		"s3-profile",
+		"",
+		"AWS profile from which to read credentials for --s3-bucket.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&groupByHeaderFlag,
+		"group-by-header",
+		nil,
+		"Request headers whose values distinguish endpoints, for APIs that route by header (e.g. X-API-Version). The values are added to the path template of each endpoint, so they must not contain secrets. Only the first 20 distinct values of each header are kept apart.",
+	)
+
+	Cmd.Flags().IntVar(
+		&memoryThresholdMBFlag,
+		"memory-threshold-mb",
+		0,
+		"If positive, lower the sample rate as the agent's memory use approaches this many megabytes, down to --memory-min-sample-rate, and restore it as memory use falls. Memory use is checked every --proc-polling-interval seconds.",
+	)
+
+	Cmd.Flags().Float64Var(
+		&memoryMinRateFlag,
+		"memory-min-sample-rate",
+		0.1,
+		"The lowest sample rate used under memory pressure when --memory-threshold-mb is set.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&successfulMutationsFlag,
+		"capture-successful-mutations",
+		false,
+		"Capture only HTTP requests that changed a resource: POST, PUT, PATCH, and DELETE requests with a 2xx response. Other requests and their responses are dropped.",
+	)
+
+	Cmd.Flags().StringArrayVar(
+		&redactKeyPatternsFlag,
+		"redact-key-patterns",
+		nil,
+		`Redact the values of fields, headers, query parameters, and cookies whose names match this pattern, including all values nested within matching fields. Patterns are case-insensitive globs, as in "*secret*" or "x-*-key", or regular expressions between slashes, as in "/_token_secret$/". Names in bracket notation, as in the form field "user[token]", match if any of their parts does. May be repeated.`,
+	)
+
+	Cmd.Flags().StringVar(
+		&redactKeyPatternsFile,
+		"redact-key-patterns-file",
+		"",
+		`File of patterns for --redact-key-patterns, one per line. Blank lines and lines starting with "#" are ignored.`,
+	)
+
+	Cmd.Flags().IntVar(
+		&maxArrayElementsFlag,
+		"max-array-elements",
+		0,
+		"If positive, record at most this many elements of each array in request and response bodies. The rest are omitted, and the number omitted is reported in the capture summary.",
+	)
+
+	Cmd.Flags().StringVar(
+		&collectionOutputFlag,
+		"collection-output",
+		"",
+		"When the capture ends, write the endpoints observed to this file as a Postman Collection that can be imported into Postman. Requests are grouped into folders by host, with example requests and responses taken from the redacted witnesses.",
+	)
+
+	Cmd.Flags().StringVar(
+		&connectionResetFlag,
+		"on-connection-reset",
+		string(trace.WaitOnConnectionReset),
+		"How to capture requests whose TCP connection is reset before a response is seen. One of: wait, to keep them until they expire like any other request without a response; emit, to send them as soon as the reset is seen, marked as reset in their metadata; or drop, to drop them. Any value but wait also enables TCP connection reports.",
+	)
+
+	Cmd.Flags().StringVar(
+		&statsdAddressFlag,
+		"statsd-address",
+		"",
+		`Send agent metrics, such as witnesses captured, uploads, upload errors, drops, and internal queue sizes, to the StatsD or DogStatsD server at this "host:port" address over UDP. Metrics are sent each time telemetry is reported.`,
+	)
+
+	Cmd.Flags().StringVar(
+		&statsdPrefixFlag,
+		"statsd-prefix",
+		"postman_insights_agent",
+		"Prefix for the names of metrics sent to --statsd-address.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&statsdTagsFlag,
+		"statsd-tags",
+		nil,
+		`Tags to add to metrics sent to --statsd-address, as "key:value" pairs, in DogStatsD format. Specify multiple tags by repeating this flag or separating them with commas.`,
+	)
+
+	Cmd.Flags().IntVar(
+		&warmupDelayFlag,
+		"warmup-delay",
+		0,
+		"Ignore HTTP traffic for the first N seconds of capture, such as noisy startup and health-check traffic. Packets are still captured and parsed during this time, and the number of witnesses skipped is reported.",
+	)
+
+	Cmd.Flags().IntVar(
+		&maxRespBodySizeFlag,
+		"filter-by-response-size",
+		0,
+		"Drop HTTP response bodies larger than this many bytes before they are processed, keeping the rest of the witness. Unlike --body-size-max, requests are unaffected, and the number of bodies dropped is reported. 0 means no limit.",
+	)
+
+	Cmd.Flags().StringVar(
+		&correlationHeaderFlag,
+		"correlation-header",
+		"",
+		"A request header, such as X-Request-Id, whose value is kept unobfuscated on each witness so that witnesses can be matched with logs and traces for the same request. The value is sent verbatim, so the header must not contain secrets.",
+	)
+
+	Cmd.Flags().StringVar(
+		&summaryJSONFlag,
+		"summary-json",
+		"",
+		"When the capture ends, write its summary to this file as JSON: the interfaces captured, packet and HTTP counts for the busiest ports and hosts, any warnings, and whether the trace is empty. The text summary is still printed.",
+	)
+
+	Cmd.Flags().StringVar(
+		&redactionConfigFlag,
+		"redaction-config",
+		"",
+		`YAML or JSON file of redaction rules: "key_patterns", a list of patterns as for --redact-key-patterns, and "value_patterns", a list of regular expressions for string values to redact wherever they appear. Combined with --redact-key-patterns.`,
+	)
+
+	Cmd.Flags().BoolVar(
+		&captureRawQueryFlag,
+		"capture-raw-query",
+		false,
+		"Also record each request's raw query string, preserving the order of parameters and repeated parameters, in the metadata of its witness. Values are obfuscated like those of the parsed query parameters, except for the parameters named by --raw-query-allow. The values of parameters that are redacted or dropped are replaced with *REDACTED*.",
+	)
+
+	Cmd.Flags().StringSliceVar(
+		&rawQueryAllowFlag,
+		"raw-query-allow",
+		nil,
+		"Query parameters whose values are kept verbatim in raw query strings recorded by --capture-raw-query, unless they are redacted. May be specified multiple times or as a comma-separated list.",
+	)
+
+	Cmd.Flags().IntVar(
+		&rotateAfterWitnessFlag,
+		"rotate-after-witnesses",
+		0,
+		"Rotate to a new trace once this many witnesses have been uploaded to the current one, in addition to rotating periodically, so that traces have a predictable size. A few more witnesses may be uploaded while the new trace is created. Disabled if 0.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&dryRunFlag,
+		"dry-run",
+		false,
+		"Capture and filter traffic as usual, but do not create a trace or upload any witnesses. Instead, list the endpoints that would have been captured when capture stops. Other outputs, such as --collection-output, are still written.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&captureWebSocketFlag,
+		"capture-websocket-messages",
+		false,
+		"Capture the messages sent on connections upgraded to WebSocket, each as its own witness of the upgraded endpoint, redacted like other witnesses. Text messages are captured with their content, and binary messages with only their size. Up to 100 messages are captured per connection, and text messages over 64 KiB are captured with only their size.",
+	)
+
+	Cmd.Flags().Int64Var(
+		&streamingTimeoutFlag,
+		"streaming-response-timeout-seconds",
+		0,
+		"If positive, capture an HTTP response that is still streaming its body this many seconds after its headers arrived, such as a server-sent event stream or long poll, with the part of the body seen so far. By default, responses are captured once their bodies end.",
+	)
+
+	Cmd.Flags().Float64Var(
+		&bodySampleRateFlag,
+		"body-sample-rate",
+		1.0,
+		"A number between [0.0, 1.0] to control the fraction of witnesses that keep their request and response bodies. Every witness is still captured with its metadata, including headers, query parameters, and response codes. Independent of --rate-limit, which limits how many witnesses are captured.",
+	)
 }
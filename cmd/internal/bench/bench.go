@@ -0,0 +1,81 @@
+package bench
+
+import (
+	"time"
+
+	"github.com/postmanlabs/postman-insights-agent/bench"
+	"github.com/postmanlabs/postman-insights-agent/cmd/internal/cmderr"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/redact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Mandatory flag: the capture file to process.
+	inputFlag string
+
+	durationFlag          time.Duration
+	detectHighEntropyFlag bool
+)
+
+var Cmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure how quickly captured traffic is processed.",
+	Long: "Process the packets in a pcap file repeatedly, as apidump would, and report the throughput and resources used. " +
+		"Nothing is uploaded. Use this to size the resources given to the agent.",
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		var plugins []plugin.AkitaPlugin
+		if detectHighEntropyFlag {
+			plugins = append(plugins, redact.NewEntropyRedactor(redact.EntropyConfig{
+				MinLength:       redact.DefaultMinEntropyLength,
+				MinEntropy_bits: redact.DefaultMinEntropy_bits,
+			}))
+		}
+
+		result, err := bench.Run(bench.Args{
+			InputPath: inputFlag,
+			Duration:  durationFlag,
+			Plugins:   plugins,
+		})
+		if err != nil {
+			return cmderr.AkitaErr{Err: err}
+		}
+
+		printer.Stdout.Infof("Processed %d packets and %d witnesses in %d iterations over %s.\n",
+			result.Packets, result.Witnesses, result.Iterations, result.Elapsed.Round(time.Millisecond))
+		printer.Stdout.Infof("Throughput: %.1f witnesses/sec, %.1f packets/sec\n",
+			result.WitnessesPerSecond(), result.PacketsPerSecond())
+		printer.Stdout.Infof("CPU: %s (%.2f cores)\n",
+			result.CPUTime.Round(time.Millisecond), result.CPUTime.Seconds()/result.Elapsed.Seconds())
+		printer.Stdout.Infof("Memory: %.1f MB allocated, %.1f MB obtained from the OS\n",
+			float64(result.Allocated_bytes)/1_000_000, float64(result.Sys_bytes)/1_000_000)
+		return nil
+	},
+}
+
+func init() {
+	Cmd.Flags().StringVar(
+		&inputFlag,
+		"input",
+		"",
+		"Path to a pcap or pcapng file of captured traffic.",
+	)
+	Cmd.MarkFlagRequired("input")
+
+	Cmd.Flags().DurationVar(
+		&durationFlag,
+		"duration",
+		10*time.Second,
+		"Keep processing the packets until this much time has passed. They are always processed at least once.",
+	)
+
+	Cmd.Flags().BoolVar(
+		&detectHighEntropyFlag,
+		"detect-high-entropy",
+		false,
+		"Include the cost of redacting high-entropy values, as with apidump --detect-high-entropy.",
+	)
+}
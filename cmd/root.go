@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	goflag "flag"
 	httpserv "net/http"
 	_ "net/http/pprof"
@@ -12,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/apidump"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/ascii"
+	"github.com/postmanlabs/postman-insights-agent/cmd/internal/bench"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/cmderr"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/ec2"
 	"github.com/postmanlabs/postman-insights-agent/cmd/internal/ecs"
@@ -21,6 +23,7 @@ import (
 	"github.com/postmanlabs/postman-insights-agent/printer"
 	"github.com/postmanlabs/postman-insights-agent/rest"
 	"github.com/postmanlabs/postman-insights-agent/telemetry"
+	"github.com/postmanlabs/postman-insights-agent/updatecheck"
 	"github.com/postmanlabs/postman-insights-agent/util"
 	"github.com/postmanlabs/postman-insights-agent/version"
 	"github.com/spf13/cobra"
@@ -90,6 +93,10 @@ func preRun(cmd *cobra.Command, args []string) {
 	// commands or the usage information if no command is given.
 	printer.Stderr.Infof("Postman Insights Agent %s\n", version.ReleaseVersion())
 
+	// Let the user know if a newer version is available. This runs in the
+	// background so that it never delays the command.
+	go updatecheck.Notify(context.Background())
+
 	// This is after argument parsing so that rest.Domain is correct,
 	// but won't be called if there is an error parsing the flags.
 	telemetry.CommandLine(cmd.Name(), os.Args)
@@ -255,6 +262,7 @@ func init() {
 	}
 
 	rootCmd.AddCommand(apidump.Cmd)
+	rootCmd.AddCommand(bench.Cmd)
 
 	rootCmd.AddCommand(ecs.Cmd)
 	rootCmd.AddCommand(kube.Cmd)
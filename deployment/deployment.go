@@ -26,6 +26,7 @@ const (
 var environmentToTag map[Deployment]map[string]tags.Key = map[Deployment]map[string]tags.Key{
 	Any: {
 		"POSTMAN_DEPLOYMENT_COMMIT": tags.XAkitaGitCommit,
+		"POSTMAN_SERVICE_VERSION":   tags.XAkitaServiceVersion,
 	},
 	AWS: {
 		"POSTMAN_AWS_REGION": tags.XAkitaAWSRegion,
@@ -68,7 +69,8 @@ func GetDeploymentInfo() (Deployment, map[tags.Key]string) {
 
 	// Allow the user to specify the name (not type) of deployment environment,
 	// even if it's of an unknown type.
-	// If there is a git commit associated with this deployment, then record it.
+	// If there is a git commit or service version associated with this
+	// deployment, then record it.
 	if Any.getTagsFromEnvironment(tagset) {
 		deploymentType = Unknown
 	}
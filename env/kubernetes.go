@@ -0,0 +1,10 @@
+package env
+
+import "os"
+
+// Returns true if the CLI is running in a Kubernetes pod, such as the
+// Insights Agent daemonset or a sidecar.
+func InKubernetes() bool {
+	_, inKubernetes := os.LookupEnv("KUBERNETES_SERVICE_HOST")
+	return inKubernetes
+}
@@ -0,0 +1,266 @@
+package eventsocket
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+const (
+	// Number of events that may be waiting to be written to each consumer.
+	// Events arriving while a consumer's queue is full are dropped for that
+	// consumer.
+	eventQueueSize = 1024
+
+	// Timeout for writing a single event to a consumer.
+	writeTimeout = time.Second
+)
+
+// A witness, as written to consumers. Events carry only metadata, never
+// bodies or other values, apart from the configured correlation header and
+// the values of allowed parameters in the raw query string.
+type event struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	Host         string    `json:"host"`
+	PathTemplate string    `json:"path_template"`
+
+	// Omitted if the witness has no response.
+	Status int32 `json:"status,omitempty"`
+
+	LatencyMS float32 `json:"latency_ms"`
+
+	// True if the response was still streaming when it was captured.
+	BodyOpen bool `json:"body_open,omitempty"`
+
+	// Value of the request's correlation header, if one is configured.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// The service and method called, if the request is a gRPC call.
+	GRPCService string `json:"grpc_service,omitempty"`
+	GRPCMethod  string `json:"grpc_method,omitempty"`
+
+	// If the witness is of a WebSocket message, the side that sent it:
+	// "client" or "server".
+	WebSocketSender string `json:"websocket_sender,omitempty"`
+
+	// If the request repeated the Idempotency-Key of an earlier request, the
+	// number of earlier requests with that key.
+	RetryAttempt int `json:"retry_attempt,omitempty"`
+
+	// The request's raw query string, if --capture-raw-query is set, with its
+	// values obfuscated or redacted except for allowed parameters.
+	RawQuery string `json:"raw_query,omitempty"`
+}
+
+// Serves a live stream of witness events on a Unix domain socket. Each
+// consumer that connects receives newline-delimited JSON events for the
+// witnesses completed after it connects.
+//
+// Serving is non-blocking: events are queued for each consumer and written by
+// a goroutine per consumer, and events are dropped for consumers that can't
+// keep up. Implements trace.WitnessSink.
+type Server struct {
+	path     string
+	listener net.Listener
+
+	mutex     sync.Mutex
+	consumers map[*consumer]struct{}
+	closed    bool
+
+	wg sync.WaitGroup
+
+	numDropped uint64
+}
+
+var _ trace.WitnessSink = (*Server)(nil)
+
+type consumer struct {
+	conn   net.Conn
+	events chan []byte
+}
+
+// Listens for consumers on a Unix domain socket at the given path. A stale
+// socket left at the path is replaced, but any other file is an error.
+func NewServer(path string) (*Server, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrapf(err, "failed to remove stale socket %s", path)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", path)
+	}
+
+	s := &Server{
+		path:      path,
+		listener:  listener,
+		consumers: map[*consumer]struct{}{},
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// The listener was closed.
+			return
+		}
+
+		c := &consumer{
+			conn:   conn,
+			events: make(chan []byte, eventQueueSize),
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.consumers[c] = struct{}{}
+		s.mutex.Unlock()
+
+		printer.Debugf("Event socket consumer connected\n")
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// Writes queued events to the consumer until the consumer disconnects or the
+// server is closed.
+func (s *Server) serve(c *consumer) {
+	defer s.wg.Done()
+	defer c.conn.Close()
+
+	for e := range c.events {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := c.conn.Write(e); err != nil {
+			printer.Debugf("Event socket consumer disconnected: %v\n", err)
+			s.remove(c)
+
+			// Drain the queue so that ExportWitness never blocks on it.
+			for range c.events {
+			}
+			return
+		}
+	}
+}
+
+// Stops sending events to the consumer.
+func (s *Server) remove(c *consumer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.consumers[c]; ok {
+		delete(s.consumers, c)
+		close(c.events)
+	}
+}
+
+// Queues an event for the given witness for each connected consumer. The
+// witness is expected to have been obfuscated already; only its metadata is
+// sent.
+//
+// Never blocks; if a consumer's queue is full, the event is dropped for that
+// consumer.
+func (s *Server) ExportWitness(w *pb.Witness, observationTime time.Time, info trace.WitnessInfo) {
+	e, ok := eventFromWitness(w, observationTime, info)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.consumers) == 0 {
+		return
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	for c := range s.consumers {
+		select {
+		case c.events <- line:
+		default:
+			atomic.AddUint64(&s.numDropped, 1)
+		}
+	}
+}
+
+// Disconnects all consumers and removes the socket. ExportWitness must not
+// be called after Close.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.listener.Close()
+	for c := range s.consumers {
+		delete(s.consumers, c)
+		close(c.events)
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+
+	if dropped := atomic.LoadUint64(&s.numDropped); dropped > 0 {
+		printer.Stderr.Warningf("Dropped %d events on %s because consumers could not keep up.\n", dropped, s.path)
+	}
+	return err
+}
+
+// Converts a witness to an event. Returns false if the witness has no HTTP
+// metadata.
+func eventFromWitness(w *pb.Witness, observationTime time.Time, info trace.WitnessInfo) (event, bool) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return event{}, false
+	}
+
+	e := event{
+		Time:            observationTime,
+		Method:          meta.Method,
+		Host:            meta.Host,
+		PathTemplate:    meta.PathTemplate,
+		LatencyMS:       meta.ProcessingLatency,
+		BodyOpen:        info.ResponseOpen,
+		CorrelationID:   info.CorrelationID,
+		GRPCService:     info.GRPCMethod.Service,
+		GRPCMethod:      info.GRPCMethod.Method,
+		WebSocketSender: info.WebSocketSender,
+		RetryAttempt:    info.RetryAttempt,
+		RawQuery:        info.RawQuery,
+	}
+	if code, err := spec_util.HTTPResponseCode(w.GetMethod()); err == nil {
+		e.Status = code
+	}
+	return e, true
+}
@@ -0,0 +1,134 @@
+package eventsocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/postmanlabs/postman-insights-agent/integrations/internal/witnesstest"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "hunter2"
+
+func newTestWitness(t *testing.T, status int, latency_ms float32) *pb.Witness {
+	return witnesstest.New(t, witnesstest.Exchange{
+		Method:       "POST",
+		Host:         "example.com",
+		Path:         "/v1/doggos",
+		RequestBody:  `"` + testSecret + `"`,
+		StatusCode:   status,
+		ResponseBody: `{"id": 1}`,
+		Latency_ms:   latency_ms,
+	})
+}
+
+// Unix socket paths are limited in length, so avoid the long paths from
+// t.TempDir.
+func newSocketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "events.sock")
+}
+
+// Waits for the server to register the given number of consumers.
+func waitForConsumers(t *testing.T, s *Server, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mutex.Lock()
+		count := len(s.consumers)
+		s.mutex.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d consumers", n)
+}
+
+func TestServer(t *testing.T) {
+	path := newSocketPath(t)
+	s, err := NewServer(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Witnesses completed before a consumer connects are not sent.
+	s.ExportWitness(newTestWitness(t, 500, 1), time.Now(), trace.WitnessInfo{})
+
+	conn, err := net.Dial("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	waitForConsumers(t, s, 1)
+
+	observed := time.Unix(1_700_000_000, 0).UTC()
+	s.ExportWitness(newTestWitness(t, 201, 12.5), observed, trace.WitnessInfo{Request_bytes: 20, Response_bytes: 0})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Only metadata is sent.
+	assert.NotContains(t, line, testSecret)
+
+	var e event
+	assert.NoError(t, json.Unmarshal([]byte(line), &e))
+	assert.Equal(t, event{
+		Time:         observed,
+		Method:       "POST",
+		Host:         "example.com",
+		PathTemplate: "/v1/doggos",
+		Status:       201,
+		LatencyMS:    12.5,
+	}, e)
+
+	// Closing the server disconnects the consumer and removes the socket.
+	assert.NoError(t, s.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// A consumer that doesn't read never blocks the sender.
+func TestServerSlowConsumer(t *testing.T) {
+	path := newSocketPath(t)
+	s, err := NewServer(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	conn, err := net.Dial("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	waitForConsumers(t, s, 1)
+
+	w := newTestWitness(t, 200, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100*eventQueueSize; i++ {
+			s.ExportWitness(w, time.Now(), trace.WitnessInfo{})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("ExportWitness blocked on a slow consumer")
+	}
+	assert.NoError(t, s.Close())
+}
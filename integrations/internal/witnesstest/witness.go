@@ -0,0 +1,74 @@
+// Package witnesstest builds witnesses for the tests of the witness sinks in
+// the integrations packages.
+package witnesstest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// An HTTP exchange from which to build a witness. Bodies are sent as JSON.
+type Exchange struct {
+	Method   string
+	Host     string
+	Path     string
+	RawQuery string
+
+	// Added to the request alongside the JSON content type.
+	RequestHeader http.Header
+	RequestBody   string
+
+	StatusCode   int
+	ResponseBody string
+
+	// Recorded as the witness's processing latency.
+	Latency_ms float32
+}
+
+// Returns the witness that the agent would learn from the given exchange.
+func New(t testing.TB, e Exchange) *pb.Witness {
+	t.Helper()
+
+	reqHeader := http.Header{"Content-Type": {"application/json"}}
+	for k, v := range e.RequestHeader {
+		reqHeader[k] = v
+	}
+
+	streamID := uuid.New()
+	req := akinet.HTTPRequest{
+		StreamID: streamID,
+		Seq:      1,
+		Method:   e.Method,
+		URL:      &url.URL{Path: e.Path, RawQuery: e.RawQuery},
+		Host:     e.Host,
+		Header:   reqHeader,
+		Body:     memview.New([]byte(e.RequestBody)),
+	}
+	resp := akinet.HTTPResponse{
+		StreamID:   streamID,
+		Seq:        1,
+		StatusCode: e.StatusCode,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       memview.New([]byte(e.ResponseBody)),
+	}
+
+	reqPartial, err := learn.ParseHTTP(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respPartial, err := learn.ParseHTTP(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := reqPartial.Witness
+	w.Method.Responses = respPartial.Witness.GetMethod().GetResponses()
+	w.GetMethod().GetMeta().GetHttp().ProcessingLatency = e.Latency_ms
+	return w
+}
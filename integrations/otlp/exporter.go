@@ -0,0 +1,304 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/akitasoftware/akita-libs/tags"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/postmanlabs/postman-insights-agent/version"
+)
+
+const (
+	// Number of spans that may be waiting for export. Spans arriving while the
+	// queue is full are dropped.
+	spanQueueSize = 4096
+
+	// Maximum number of spans sent in a single export request.
+	maxBatchSize = 512
+
+	// How often to export a partial batch.
+	batchFlushInterval = 5 * time.Second
+
+	// Timeout for a single export request.
+	exportTimeout = 10 * time.Second
+
+	// Path for OTLP/HTTP trace export, used when the endpoint has no path.
+	defaultTracesPath = "/v1/traces"
+
+	instrumentationScope = "postman-insights-agent"
+
+	// OTLP span kind and status codes.
+	spanKindServer  = 2
+	statusCodeError = 2
+)
+
+// Maps Kubernetes deployment tags to OpenTelemetry resource attributes.
+var k8sResourceAttributes = map[tags.Key]string{
+	tags.XAkitaKubernetesNamespace: "k8s.namespace.name",
+	tags.XAkitaKubernetesNode:      "k8s.node.name",
+	tags.XAkitaKubernetesPod:       "k8s.pod.name",
+	tags.XAkitaKubernetesDaemonset: "k8s.daemonset.name",
+	tags.XAkitaKubernetesHostIP:    "k8s.host.ip",
+	tags.XAkitaKubernetesPodIP:     "k8s.pod.ip",
+}
+
+// Exports witnesses as spans to an OpenTelemetry collector, using OTLP/HTTP
+// with JSON encoding.
+//
+// Export is non-blocking: spans are queued and sent in batches by a
+// background goroutine, and spans are dropped if the queue is full.
+type Exporter struct {
+	endpoint string
+	client   *http.Client
+	resource resource
+
+	spans chan span
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	closeOnce sync.Once
+
+	numDropped  uint64
+	numExported uint64
+}
+
+// Creates an exporter that sends spans to the given OTLP/HTTP endpoint. If
+// the endpoint has no path, spans are sent to /v1/traces. The service name
+// and any Kubernetes tags are attached to every span as resource attributes.
+func NewExporter(endpoint string, serviceName string, traceTags map[tags.Key]string) (*Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse OTLP endpoint %q", endpoint)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultTracesPath
+	}
+
+	e := &Exporter{
+		endpoint: u.String(),
+		client:   &http.Client{Timeout: exportTimeout},
+		resource: newResource(serviceName, traceTags),
+		spans:    make(chan span, spanQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	e.wg.Add(1)
+	go e.run()
+
+	return e, nil
+}
+
+func newResource(serviceName string, traceTags map[tags.Key]string) resource {
+	attrs := []keyValue{
+		stringAttr("service.name", serviceName),
+		stringAttr("telemetry.sdk.name", instrumentationScope),
+		stringAttr("telemetry.sdk.version", version.ReleaseVersion().String()),
+	}
+	for tag, attr := range k8sResourceAttributes {
+		if v, ok := traceTags[tag]; ok && v != "" {
+			attrs = append(attrs, stringAttr(attr, v))
+		}
+	}
+	return resource{Attributes: attrs}
+}
+
+// Queues a span for the given witness. The span starts when the witness was
+// first observed and lasts for the witness's processing latency. The witness
+// is expected to have been obfuscated already. Witnesses without a response
+// are skipped, since their latency is unknown.
+//
+// Never blocks; if the export queue is full, the span is dropped.
+func (e *Exporter) ExportWitness(w *pb.Witness, observationTime time.Time, info trace.WitnessInfo) {
+	s, ok := spanFromWitness(w, observationTime, info)
+	if !ok {
+		return
+	}
+
+	select {
+	case e.spans <- s:
+	default:
+		atomic.AddUint64(&e.numDropped, 1)
+	}
+}
+
+// Flushes any queued spans and stops the exporter. ExportWitness must not
+// be called after Close.
+func (e *Exporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		e.wg.Wait()
+
+		exported := atomic.LoadUint64(&e.numExported)
+		dropped := atomic.LoadUint64(&e.numDropped)
+		printer.Debugf("OTLP exporter sent %d spans and dropped %d\n", exported, dropped)
+		if dropped > 0 {
+			printer.Stderr.Warningf("Dropped %d OpenTelemetry spans because the exporter could not keep up.\n", dropped)
+		}
+	})
+	return nil
+}
+
+func (e *Exporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(batchFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]span, 0, maxBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			atomic.AddUint64(&e.numDropped, uint64(len(batch)))
+			printer.Debugf("Failed to export %d spans: %v\n", len(batch), err)
+		} else {
+			atomic.AddUint64(&e.numExported, uint64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			// Drain whatever is left in the queue.
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+					if len(batch) >= maxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) send(batch []span) error {
+	body, err := json.Marshal(exportTraceServiceRequest{
+		ResourceSpans: []resourceSpans{
+			{
+				Resource: e.resource,
+				ScopeSpans: []scopeSpans{
+					{
+						Scope: instrumentationScopeInfo{
+							Name:    instrumentationScope,
+							Version: version.ReleaseVersion().String(),
+						},
+						Spans: batch,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal spans")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create OTLP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send spans")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("OTLP endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Converts a witness to a span. Returns false if the witness has no HTTP
+// metadata.
+func spanFromWitness(w *pb.Witness, observationTime time.Time, info trace.WitnessInfo) (span, bool) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return span{}, false
+	}
+	code, err := spec_util.HTTPResponseCode(w.GetMethod())
+	if err != nil {
+		return span{}, false
+	}
+
+	latency := time.Duration(float64(meta.ProcessingLatency) * float64(time.Millisecond))
+	start := observationTime
+	end := start.Add(latency)
+
+	traceID := uuid.New()
+	spanID := uuid.New()
+
+	s := span{
+		TraceID:           hex.EncodeToString(traceID[:]),
+		SpanID:            hex.EncodeToString(spanID[:8]),
+		Name:              strings.TrimSpace(meta.Method + " " + meta.PathTemplate),
+		Kind:              spanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: []keyValue{
+			stringAttr("http.request.method", meta.Method),
+			stringAttr("server.address", meta.Host),
+			stringAttr("http.route", meta.PathTemplate),
+			doubleAttr("postman.processing_latency_ms", float64(meta.ProcessingLatency)),
+			intAttr("http.response.status_code", int64(code)),
+		},
+	}
+	if code >= 500 {
+		s.Status = &status{Code: statusCodeError}
+	}
+
+	if info.Request_bytes >= 0 {
+		s.Attributes = append(s.Attributes, intAttr("http.request.body.size", info.Request_bytes))
+	}
+	if info.Response_bytes >= 0 {
+		s.Attributes = append(s.Attributes, intAttr("http.response.body.size", info.Response_bytes))
+	}
+	if info.CorrelationID != "" {
+		s.Attributes = append(s.Attributes, stringAttr("postman.correlation_id", info.CorrelationID))
+	}
+	if m := info.GRPCMethod; m.Service != "" {
+		s.Attributes = append(s.Attributes,
+			stringAttr("rpc.system", "grpc"),
+			stringAttr("rpc.service", m.Service),
+			stringAttr("rpc.method", m.Method),
+		)
+	}
+
+	return s, true
+}
@@ -0,0 +1,95 @@
+package otlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/tags"
+	"github.com/postmanlabs/postman-insights-agent/integrations/internal/witnesstest"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWitness(t *testing.T, status int, latency_ms float32) *pb.Witness {
+	return witnesstest.New(t, witnesstest.Exchange{
+		Method:       "GET",
+		Host:         "example.com",
+		Path:         "/v1/doggos",
+		StatusCode:   status,
+		ResponseBody: `{"ok": true}`,
+		Latency_ms:   latency_ms,
+	})
+}
+
+func TestExportWitness(t *testing.T) {
+	var mu sync.Mutex
+	var received []exportTraceServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, defaultTracesPath, r.URL.Path)
+		var req exportTraceServiceRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	e, err := NewExporter(server.URL, "my-service", map[tags.Key]string{
+		tags.XAkitaKubernetesNamespace: "default",
+	})
+	assert.NoError(t, err)
+
+	start := time.Unix(1000, 0)
+	e.ExportWitness(newTestWitness(t, 503, 8), start, trace.WitnessInfo{Request_bytes: 12, Response_bytes: -1})
+	assert.NoError(t, e.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Equal(t, 1, len(received)) {
+		return
+	}
+
+	rs := received[0].ResourceSpans[0]
+	assert.Contains(t, rs.Resource.Attributes, stringAttr("service.name", "my-service"))
+	assert.Contains(t, rs.Resource.Attributes, stringAttr("k8s.namespace.name", "default"))
+
+	spans := rs.ScopeSpans[0].Spans
+	if !assert.Equal(t, 1, len(spans)) {
+		return
+	}
+	s := spans[0]
+	assert.Equal(t, "GET /v1/doggos", s.Name)
+	assert.Equal(t, "1000000000000", s.StartTimeUnixNano)
+	assert.Equal(t, "1000008000000", s.EndTimeUnixNano)
+	assert.Contains(t, s.Attributes, stringAttr("server.address", "example.com"))
+	assert.Contains(t, s.Attributes, intAttr("http.response.status_code", 503))
+	assert.Contains(t, s.Attributes, intAttr("http.request.body.size", 12))
+	assert.NotContains(t, s.Attributes, intAttr("http.response.body.size", -1))
+	assert.Equal(t, &status{Code: statusCodeError}, s.Status)
+}
+
+func TestExportWitnessSkipsUnansweredRequests(t *testing.T) {
+	e := &Exporter{spans: make(chan span, 1)}
+
+	w := newTestWitness(t, 200, 0)
+	w.Method.Responses = nil
+	e.ExportWitness(w, time.Now(), trace.WitnessInfo{})
+
+	assert.Equal(t, 0, len(e.spans))
+	assert.Equal(t, uint64(0), e.numDropped)
+}
+
+func TestExportWitnessDropsWhenFull(t *testing.T) {
+	// An exporter whose background goroutine never runs, so the queue fills.
+	e := &Exporter{spans: make(chan span, 1)}
+
+	e.ExportWitness(newTestWitness(t, 200, 1), time.Now(), trace.WitnessInfo{})
+	e.ExportWitness(newTestWitness(t, 200, 1), time.Now(), trace.WitnessInfo{})
+
+	assert.Equal(t, uint64(1), e.numDropped)
+}
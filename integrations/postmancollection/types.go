@@ -0,0 +1,79 @@
+package postmancollection
+
+// JSON encoding of a Postman Collection, version 2.1. Only the fields we
+// populate are included. See
+// https://schema.postman.com/collection/json/v2.1.0/draft-07/docs/index.html
+
+const collectionSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+type collection struct {
+	Info info     `json:"info"`
+	Item []folder `json:"item"`
+}
+
+type info struct {
+	PostmanID string `json:"_postman_id"`
+	Name      string `json:"name"`
+	Schema    string `json:"schema"`
+}
+
+// A folder of requests to a single host.
+type folder struct {
+	Name string `json:"name"`
+	Item []item `json:"item"`
+}
+
+type item struct {
+	Name     string     `json:"name"`
+	Request  request    `json:"request"`
+	Response []response `json:"response"`
+}
+
+type request struct {
+	Method string     `json:"method"`
+	Header []header   `json:"header"`
+	URL    requestURL `json:"url"`
+	Body   *body      `json:"body,omitempty"`
+}
+
+type header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type requestURL struct {
+	Raw      string       `json:"raw"`
+	Protocol string       `json:"protocol,omitempty"`
+	Host     []string     `json:"host"`
+	Path     []string     `json:"path"`
+	Query    []queryParam `json:"query,omitempty"`
+}
+
+type queryParam struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type body struct {
+	Mode    string       `json:"mode"`
+	Raw     string       `json:"raw"`
+	Options *bodyOptions `json:"options,omitempty"`
+}
+
+type bodyOptions struct {
+	Raw rawOptions `json:"raw"`
+}
+
+type rawOptions struct {
+	Language string `json:"language"`
+}
+
+// An example response, saved with the request that produced it.
+type response struct {
+	Name            string   `json:"name"`
+	OriginalRequest request  `json:"originalRequest"`
+	Status          string   `json:"status,omitempty"`
+	Code            int      `json:"code"`
+	Header          []header `json:"header"`
+	Body            string   `json:"body"`
+}
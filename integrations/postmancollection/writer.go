@@ -0,0 +1,347 @@
+package postmancollection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+// Maximum number of requests in a collection. Witnesses for further endpoints
+// are not added.
+const maxRequests = 1000
+
+// Builds a Postman Collection from witnesses and writes it to a file when
+// closed. The collection has a folder for each host, holding a request for
+// each combination of method and path template. The first witness seen for
+// an endpoint provides the example request, and the first witness seen for
+// each response status provides an example response.
+//
+// Witnesses are expected to have been obfuscated already, so examples carry
+// only placeholder values. Implements trace.WitnessSink.
+type Writer struct {
+	name string
+	file *os.File
+
+	mutex sync.Mutex
+	items map[endpoint]*item
+
+	// Response statuses already recorded for each endpoint.
+	statuses map[endpoint]map[int]struct{}
+
+	// Number of witnesses not added because there were too many endpoints.
+	overflow int64
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ trace.WitnessSink = (*Writer)(nil)
+
+type endpoint struct {
+	host         string
+	method       string
+	pathTemplate string
+}
+
+// Creates a writer for a collection with the given name, to be written to the
+// given path. The file is created immediately, so that an unwritable path is
+// reported before capture starts.
+func NewWriter(path string, name string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create collection file %s", path)
+	}
+	return &Writer{
+		name:     name,
+		file:     f,
+		items:    map[endpoint]*item{},
+		statuses: map[endpoint]map[int]struct{}{},
+	}, nil
+}
+
+func (w *Writer) ExportWitness(witness *pb.Witness, _ time.Time, _ trace.WitnessInfo) {
+	m := witness.GetMethod()
+	meta := spec_util.HTTPMetaFromMethod(m)
+	if meta == nil {
+		return
+	}
+	e := endpoint{
+		host:         meta.GetHost(),
+		method:       meta.GetMethod(),
+		pathTemplate: meta.GetPathTemplate(),
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	it, ok := w.items[e]
+	if !ok {
+		if len(w.items) >= maxRequests {
+			w.overflow += 1
+			return
+		}
+		it = &item{
+			Name:     e.method + " " + e.pathTemplate,
+			Request:  buildRequest(e, m.GetArgs()),
+			Response: []response{},
+		}
+		w.items[e] = it
+		w.statuses[e] = map[int]struct{}{}
+	}
+
+	if len(m.GetResponses()) == 0 {
+		return
+	}
+	resp := buildResponse(it.Request, m.GetResponses())
+	if _, seen := w.statuses[e][resp.Code]; seen {
+		return
+	}
+	w.statuses[e][resp.Code] = struct{}{}
+	it.Response = append(it.Response, resp)
+}
+
+// Writes the collection and closes the file.
+func (w *Writer) Close() error {
+	w.closeOnce.Do(func() {
+		w.closeErr = w.write()
+		if err := w.file.Close(); err != nil && w.closeErr == nil {
+			w.closeErr = errors.Wrapf(err, "failed to close collection file %s", w.file.Name())
+		}
+	})
+	return w.closeErr
+}
+
+func (w *Writer) write() error {
+	c := w.collection()
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal collection")
+	}
+	if _, err := w.file.Write(append(b, '\n')); err != nil {
+		return errors.Wrapf(err, "failed to write collection to %s", w.file.Name())
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	printer.Stderr.Infof("Wrote a Postman Collection with %d requests to %s\n", len(w.items), w.file.Name())
+	if w.overflow > 0 {
+		printer.Stderr.Warningf("Left %d witnesses out of the collection because it reached %d requests.\n", w.overflow, maxRequests)
+	}
+	return nil
+}
+
+// Returns the collection, with folders sorted by host and requests sorted by
+// path template and method.
+func (w *Writer) collection() collection {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	endpoints := make([]endpoint, 0, len(w.items))
+	for e := range w.items {
+		endpoints = append(endpoints, e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.pathTemplate != b.pathTemplate {
+			return a.pathTemplate < b.pathTemplate
+		}
+		return a.method < b.method
+	})
+
+	c := collection{
+		Info: info{
+			PostmanID: uuid.New().String(),
+			Name:      w.name,
+			Schema:    collectionSchema,
+		},
+		Item: []folder{},
+	}
+	for _, e := range endpoints {
+		if n := len(c.Item); n == 0 || c.Item[n-1].Name != e.host {
+			c.Item = append(c.Item, folder{Name: e.host})
+		}
+		f := &c.Item[len(c.Item)-1]
+		f.Item = append(f.Item, *w.items[e])
+	}
+	return c
+}
+
+// Builds a request from the arguments of a witness.
+func buildRequest(e endpoint, args map[string]*pb.Data) request {
+	r := request{
+		Method: e.method,
+		Header: []header{},
+		URL: requestURL{
+			Protocol: "http",
+			Host:     []string{e.host},
+			Path:     postmanPath(e.pathTemplate),
+		},
+	}
+
+	for _, d := range args {
+		meta := d.GetMeta().GetHttp()
+		switch {
+		case meta.GetHeader() != nil:
+			r.Header = append(r.Header, header{Key: meta.GetHeader().GetKey(), Value: primitiveString(d)})
+		case meta.GetAuth() != nil:
+			r.Header = append(r.Header, header{Key: "Authorization", Value: primitiveString(d)})
+		case meta.GetQuery() != nil:
+			r.URL.Query = append(r.URL.Query, queryParam{Key: meta.GetQuery().GetKey(), Value: primitiveString(d)})
+		case meta.GetBody() != nil:
+			r.Body = buildBody(d)
+		}
+	}
+	sortHeaders(r.Header)
+	sort.Slice(r.URL.Query, func(i, j int) bool {
+		return r.URL.Query[i].Key < r.URL.Query[j].Key
+	})
+
+	r.URL.Raw = "http://" + e.host + "/" + strings.Join(r.URL.Path, "/")
+	for i, q := range r.URL.Query {
+		sep := "&"
+		if i == 0 {
+			sep = "?"
+		}
+		r.URL.Raw += sep + q.Key + "=" + q.Value
+	}
+	return r
+}
+
+// Builds an example response from the responses of a witness.
+func buildResponse(req request, responses map[string]*pb.Data) response {
+	resp := response{
+		OriginalRequest: req,
+		Header:          []header{},
+	}
+	for _, d := range responses {
+		meta := d.GetMeta().GetHttp()
+		if code := int(meta.GetResponseCode()); code != 0 {
+			resp.Code = code
+		}
+		switch {
+		case meta.GetHeader() != nil:
+			resp.Header = append(resp.Header, header{Key: meta.GetHeader().GetKey(), Value: primitiveString(d)})
+		case meta.GetBody() != nil:
+			if b := buildBody(d); b != nil {
+				resp.Body = b.Raw
+			}
+		}
+	}
+	sortHeaders(resp.Header)
+
+	resp.Status = http.StatusText(resp.Code)
+	resp.Name = fmt.Sprintf("%d %s", resp.Code, resp.Status)
+	return resp
+}
+
+func sortHeaders(headers []header) {
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Key < headers[j].Key
+	})
+}
+
+// Returns a raw body for the given datum. Structured bodies are encoded as
+// JSON.
+func buildBody(d *pb.Data) *body {
+	if _, isPrimitive := d.GetValue().(*pb.Data_Primitive); isPrimitive {
+		return &body{Mode: "raw", Raw: primitiveString(d)}
+	}
+
+	b, err := json.MarshalIndent(dataValue(d), "", "  ")
+	if err != nil {
+		printer.Debugf("Failed to encode example body: %v\n", err)
+		return nil
+	}
+	return &body{
+		Mode:    "raw",
+		Raw:     string(b),
+		Options: &bodyOptions{Raw: rawOptions{Language: "json"}},
+	}
+}
+
+// Converts a datum to a value that can be encoded as JSON. Only the first
+// option of a one-of is used.
+func dataValue(d *pb.Data) interface{} {
+	switch v := d.GetValue().(type) {
+	case *pb.Data_Primitive:
+		pv, err := spec_util.PrimitiveValueFromProto(v.Primitive)
+		if err != nil {
+			return nil
+		}
+		return pv.GoValue()
+
+	case *pb.Data_Struct:
+		fields := make(map[string]interface{}, len(v.Struct.GetFields()))
+		for name, field := range v.Struct.GetFields() {
+			fields[name] = dataValue(field)
+		}
+		return fields
+
+	case *pb.Data_List:
+		elems := make([]interface{}, 0, len(v.List.GetElems()))
+		for _, elem := range v.List.GetElems() {
+			elems = append(elems, dataValue(elem))
+		}
+		return elems
+
+	case *pb.Data_Optional:
+		return dataValue(v.Optional.GetData())
+
+	case *pb.Data_Oneof:
+		keys := make([]string, 0, len(v.Oneof.GetOptions()))
+		for k := range v.Oneof.GetOptions() {
+			keys = append(keys, k)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		sort.Strings(keys)
+		return dataValue(v.Oneof.GetOptions()[keys[0]])
+	}
+	return nil
+}
+
+// Returns the value of a primitive datum as a string, or the empty string if
+// the datum is not a primitive.
+func primitiveString(d *pb.Data) string {
+	p := d.GetPrimitive()
+	if p == nil {
+		return ""
+	}
+	pv, err := spec_util.PrimitiveValueFromProto(p)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprint(pv.GoValue())
+}
+
+// Splits a path template into segments, writing path parameters in Postman's
+// ":name" form rather than "{name}".
+func postmanPath(pathTemplate string) []string {
+	segments := strings.Split(strings.Trim(pathTemplate, "/"), "/")
+	if len(segments) == 1 && segments[0] == "" {
+		return []string{}
+	}
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return segments
+}
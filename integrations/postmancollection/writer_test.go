@@ -0,0 +1,150 @@
+package postmancollection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/integrations/internal/witnesstest"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a witness for an exchange with the given request and response.
+func newTestWitness(t *testing.T, method, host, path, reqBody string, status int, respBody string) *pb.Witness {
+	return witnesstest.New(t, witnesstest.Exchange{
+		Method:        method,
+		Host:          host,
+		Path:          path,
+		RawQuery:      "limit=10",
+		RequestHeader: http.Header{"X-Request-Id": {"abc"}},
+		RequestBody:   reqBody,
+		StatusCode:    status,
+		ResponseBody:  respBody,
+	})
+}
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collection.json")
+	w, err := NewWriter(path, "Test capture")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, witness := range []*pb.Witness{
+		newTestWitness(t, "POST", "api.example.com", "/v1/doggos", `{"name": "prince"}`, 201, `{"id": 1}`),
+		newTestWitness(t, "POST", "api.example.com", "/v1/doggos", `{"name": "rex"}`, 201, `{"id": 2}`),
+		newTestWitness(t, "POST", "api.example.com", "/v1/doggos", `{}`, 400, `{"error": "missing name"}`),
+		newTestWitness(t, "GET", "auth.example.com", "/login", ``, 200, `{"ok": true}`),
+	} {
+		w.ExportWitness(witness, time.Now(), trace.WitnessInfo{})
+	}
+	assert.NoError(t, w.Close())
+
+	b, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var c collection
+	if !assert.NoError(t, json.Unmarshal(b, &c)) {
+		return
+	}
+
+	assert.Equal(t, "Test capture", c.Info.Name)
+	assert.Equal(t, collectionSchema, c.Info.Schema)
+	assert.NotEmpty(t, c.Info.PostmanID)
+
+	// One folder per host, sorted by host.
+	if !assert.Len(t, c.Item, 2) {
+		return
+	}
+	assert.Equal(t, "api.example.com", c.Item[0].Name)
+	assert.Equal(t, "auth.example.com", c.Item[1].Name)
+
+	if !assert.Len(t, c.Item[0].Item, 1) {
+		return
+	}
+	post := c.Item[0].Item[0]
+	assert.Equal(t, "POST /v1/doggos", post.Name)
+	assert.Equal(t, "POST", post.Request.Method)
+	assert.Equal(t, "http://api.example.com/v1/doggos?limit=10", post.Request.URL.Raw)
+	assert.Equal(t, []string{"v1", "doggos"}, post.Request.URL.Path)
+	assert.Contains(t, post.Request.Header, header{Key: "X-Request-Id", Value: "abc"})
+	if assert.NotNil(t, post.Request.Body) {
+		assert.JSONEq(t, `{"name": "prince"}`, post.Request.Body.Raw)
+	}
+
+	// One example response per status.
+	if assert.Len(t, post.Response, 2) {
+		codes := map[int]string{}
+		for _, r := range post.Response {
+			codes[r.Code] = r.Body
+		}
+		assert.JSONEq(t, `{"id": 1}`, codes[201])
+		assert.JSONEq(t, `{"error": "missing name"}`, codes[400])
+	}
+
+	if assert.Len(t, c.Item[1].Item, 1) {
+		get := c.Item[1].Item[0]
+		assert.Equal(t, "GET /login", get.Name)
+		assert.Nil(t, get.Request.Body)
+		if assert.Len(t, get.Response, 1) {
+			assert.Equal(t, "OK", get.Response[0].Status)
+		}
+	}
+}
+
+// Witnesses reach the collection through a sink collector, with no backend to
+// upload them to.
+func TestWriterWithoutBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collection.json")
+	w, err := NewWriter(path, "Local capture")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	streamID := uuid.New()
+	col := trace.NewSinkCollector(nil, []trace.WitnessSink{w})
+	assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "api.example.com",
+		},
+	}))
+	assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1,
+			StatusCode: 200,
+		},
+	}))
+	assert.NoError(t, col.Close())
+	assert.NoError(t, w.Close())
+
+	b, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var c collection
+	if !assert.NoError(t, json.Unmarshal(b, &c)) {
+		return
+	}
+	if assert.Len(t, c.Item, 1) && assert.Len(t, c.Item[0].Item, 1) {
+		assert.Equal(t, "GET /v1/doggos", c.Item[0].Item[0].Name)
+	}
+}
+
+func TestPostmanPath(t *testing.T) {
+	assert.Equal(t, []string{"v1", "users", ":arg3"}, postmanPath("/v1/users/{arg3}"))
+	assert.Equal(t, []string{}, postmanPath("/"))
+}
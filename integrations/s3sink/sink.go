@@ -0,0 +1,318 @@
+package s3sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akid"
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/akitasoftware/akita-libs/spec_util/ir_hash"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+const (
+	// Number of witness reports that may be waiting for upload. Reports
+	// arriving while the queue is full are dropped.
+	reportQueueSize = 4096
+
+	// Maximum size of the reports in a single object, mirroring the batch size
+	// used for uploads to the back end.
+	maxObjectSize_bytes = 5 * 1024 * 1024
+
+	// How often to write a partial batch.
+	batchFlushInterval = 30 * time.Second
+
+	// Timeout for a single PUT request.
+	putTimeout = 30 * time.Second
+
+	// Number of times to attempt each PUT request.
+	putAttempts = 3
+
+	// Bounds on the delay between attempts.
+	minRetryBackoff = 1 * time.Second
+	maxRetryBackoff = 10 * time.Second
+
+	// Hash of the payload placed in the signature. S3 requires it as a header
+	// as well.
+	contentSHA256Header = "X-Amz-Content-Sha256"
+)
+
+// Configuration for a Sink.
+type Config struct {
+	// Name of the bucket to write to.
+	Bucket string
+
+	// Base URL of the S3-compatible endpoint, e.g. http://localhost:9000 for a
+	// local MinIO server. If empty, the AWS S3 endpoint for Region is used.
+	// Objects are addressed path-style, which every S3-compatible store
+	// supports.
+	Endpoint string
+
+	// Region used to sign requests.
+	Region string
+
+	// Prefix for the keys of written objects. May be empty.
+	Prefix string
+
+	// Provides the credentials used to sign requests.
+	Credentials aws.CredentialsProvider
+}
+
+// Writes witnesses to an S3-compatible object store. Each object holds a
+// batch of witness reports, encoded as the JSON body of an upload to the
+// Postman back end.
+//
+// Writes are non-blocking: reports are queued and written in batches by a
+// background goroutine, and reports are dropped if the queue is full or if a
+// batch can't be written after several attempts.
+type Sink struct {
+	bucketURL   string
+	prefix      string
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+
+	reports chan *kgxapi.WitnessReport
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+
+	// Bounds on the delay between attempts. Overridden in tests.
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	numDropped uint64
+	numWritten uint64
+}
+
+var _ trace.WitnessSink = (*Sink)(nil)
+
+// Creates a sink that writes to the given bucket.
+func NewSink(cfg Config) (*Sink, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("no S3 bucket specified")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("no S3 region specified")
+	}
+	if cfg.Credentials == nil {
+		return nil, errors.New("no S3 credentials specified")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse S3 endpoint %q", endpoint)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("S3 endpoint %q must be an http or https URL", endpoint)
+	}
+	u.Path = path.Join("/", u.Path, cfg.Bucket)
+
+	s := &Sink{
+		bucketURL:   u.String(),
+		prefix:      strings.Trim(cfg.Prefix, "/"),
+		region:      cfg.Region,
+		credentials: cfg.Credentials,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: putTimeout},
+		reports:     make(chan *kgxapi.WitnessReport, reportQueueSize),
+		done:        make(chan struct{}),
+		minBackoff:  minRetryBackoff,
+		maxBackoff:  maxRetryBackoff,
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+// Queues a report for the given witness. The witness is expected to have been
+// obfuscated already.
+//
+// Never blocks; if the queue is full, the report is dropped.
+func (s *Sink) ExportWitness(w *pb.Witness, observationTime time.Time, _ trace.WitnessInfo) {
+	report, err := witnessReport(w, observationTime)
+	if err != nil {
+		printer.Debugf("Failed to convert witness to report: %v\n", err)
+		atomic.AddUint64(&s.numDropped, 1)
+		return
+	}
+
+	select {
+	case s.reports <- report:
+	default:
+		atomic.AddUint64(&s.numDropped, 1)
+	}
+}
+
+// Writes any queued reports and stops the sink. ExportWitness must not be
+// called after Close.
+func (s *Sink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		written := atomic.LoadUint64(&s.numWritten)
+		dropped := atomic.LoadUint64(&s.numDropped)
+		printer.Debugf("S3 sink wrote %d witnesses and dropped %d\n", written, dropped)
+		if dropped > 0 {
+			printer.Stderr.Warningf("Dropped %d witnesses that could not be written to S3.\n", dropped)
+		}
+	})
+	return nil
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(batchFlushInterval)
+	defer ticker.Stop()
+
+	var batch kgxapi.UploadReportsRequest
+	flush := func() {
+		if batch.IsEmpty() {
+			return
+		}
+		n := uint64(len(batch.Witnesses))
+		if err := s.write(&batch); err != nil {
+			atomic.AddUint64(&s.numDropped, n)
+			printer.Warningf("Failed to write %d witnesses to S3: %v\n", n, err)
+		} else {
+			atomic.AddUint64(&s.numWritten, n)
+		}
+		batch.Clear()
+	}
+	add := func(r *kgxapi.WitnessReport) {
+		batch.AddWitnessReport(r)
+		if batch.SizeInBytes() >= maxObjectSize_bytes {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case r := <-s.reports:
+			add(r)
+		case <-ticker.C:
+			flush()
+		case <-s.done:
+			// Drain whatever is left in the queue.
+			for {
+				select {
+				case r := <-s.reports:
+					add(r)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Writes a batch as a new object, retrying with backoff on failure.
+func (s *Sink) write(batch *kgxapi.UploadReportsRequest) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal witness reports")
+	}
+	key := s.objectKey(time.Now())
+
+	b := &backoff.Backoff{Min: s.minBackoff, Max: s.maxBackoff, Factor: 2, Jitter: true}
+	for attempt := 1; ; attempt++ {
+		err = s.put(key, body)
+		if err == nil {
+			printer.Debugf("Wrote %d witnesses to S3 object %s\n", len(batch.Witnesses), key)
+			return nil
+		}
+		if attempt >= putAttempts {
+			return err
+		}
+		printer.Debugf("Failed to write S3 object %s, retrying: %v\n", key, err)
+		time.Sleep(b.Duration())
+	}
+}
+
+// Returns a unique key for an object written at the given time. Keys are
+// grouped by day so that objects are easy to find and expire.
+func (s *Sink) objectKey(t time.Time) string {
+	t = t.UTC()
+	name := fmt.Sprintf("%s-%s.json", t.Format("20060102T150405Z"), uuid.New())
+	return path.Join(s.prefix, t.Format("2006/01/02"), name)
+}
+
+func (s *Sink) put(key string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), putTimeout)
+	defer cancel()
+
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve S3 credentials")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.bucketURL+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create S3 request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set(contentSHA256Header, payloadHash)
+	if err := s.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to sign S3 request")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send S3 request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("S3 endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func witnessReport(w *pb.Witness, observationTime time.Time) (*kgxapi.WitnessReport, error) {
+	b, err := proto.Marshal(w)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal witness proto")
+	}
+
+	return &kgxapi.WitnessReport{
+		Direction:         kgxapi.Inbound,
+		WitnessProto:      base64.URLEncoding.EncodeToString(b),
+		ClientWitnessTime: observationTime,
+		Hash:              ir_hash.HashWitnessToString(w),
+		ID:                akid.GenerateWitnessID(),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package s3sink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/protobuf/proto"
+	"github.com/postmanlabs/postman-insights-agent/integrations/internal/witnesstest"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCredentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+})
+
+func newTestWitness(t *testing.T, path string) *pb.Witness {
+	return witnesstest.New(t, witnesstest.Exchange{
+		Method:     "GET",
+		Host:       "example.com",
+		Path:       path,
+		StatusCode: 200,
+	})
+}
+
+// A mock S3 server that records the objects written to it. Fails the given
+// number of requests before accepting any.
+type mockS3 struct {
+	mutex    sync.Mutex
+	failures int
+	objects  map[string][]byte
+}
+
+func (m *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if m.failures > 0 {
+		m.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	m.objects[r.URL.Path] = body
+}
+
+func TestSinkWritesObjects(t *testing.T) {
+	mock := &mockS3{failures: 1, objects: make(map[string][]byte)}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	s, err := NewSink(Config{
+		Bucket:      "witnesses",
+		Endpoint:    server.URL,
+		Region:      "us-east-1",
+		Prefix:      "/agent/",
+		Credentials: testCredentials,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.minBackoff = time.Millisecond
+	s.maxBackoff = time.Millisecond
+
+	observed := time.Unix(1000, 0).UTC()
+	s.ExportWitness(newTestWitness(t, "/v1/doggos"), observed, trace.WitnessInfo{})
+	s.ExportWitness(newTestWitness(t, "/v1/kitties"), observed, trace.WitnessInfo{})
+	assert.NoError(t, s.Close())
+
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	// Both witnesses are written in a single object, after a retry.
+	if !assert.Len(t, mock.objects, 1) {
+		return
+	}
+	for key, body := range mock.objects {
+		assert.True(t, strings.HasPrefix(key, "/witnesses/agent/"), key)
+		assert.True(t, strings.HasSuffix(key, ".json"), key)
+
+		var req kgxapi.UploadReportsRequest
+		if !assert.NoError(t, json.Unmarshal(body, &req)) {
+			return
+		}
+		if !assert.Len(t, req.Witnesses, 2) {
+			return
+		}
+
+		var paths []string
+		for _, r := range req.Witnesses {
+			assert.Equal(t, kgxapi.Inbound, r.Direction)
+			assert.True(t, observed.Equal(r.ClientWitnessTime))
+
+			b, err := base64.URLEncoding.DecodeString(r.WitnessProto)
+			assert.NoError(t, err)
+			var w pb.Witness
+			assert.NoError(t, proto.Unmarshal(b, &w))
+			paths = append(paths, w.GetMethod().GetMeta().GetHttp().GetPathTemplate())
+		}
+		assert.ElementsMatch(t, []string{"/v1/doggos", "/v1/kitties"}, paths)
+	}
+	assert.Equal(t, uint64(2), s.numWritten)
+	assert.Equal(t, uint64(0), s.numDropped)
+}
+
+func TestSinkDropsAfterRetries(t *testing.T) {
+	mock := &mockS3{failures: putAttempts, objects: make(map[string][]byte)}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	s, err := NewSink(Config{
+		Bucket:      "witnesses",
+		Endpoint:    server.URL,
+		Region:      "us-east-1",
+		Credentials: testCredentials,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.minBackoff = time.Millisecond
+	s.maxBackoff = time.Millisecond
+
+	s.ExportWitness(newTestWitness(t, "/v1/doggos"), time.Now(), trace.WitnessInfo{})
+	assert.NoError(t, s.Close())
+
+	assert.Empty(t, mock.objects)
+	assert.Equal(t, uint64(1), s.numDropped)
+}
+
+func TestNewSinkValidatesConfig(t *testing.T) {
+	_, err := NewSink(Config{Region: "us-east-1", Credentials: testCredentials})
+	assert.Error(t, err)
+
+	_, err = NewSink(Config{Bucket: "b", Region: "us-east-1", Endpoint: "ftp://example.com", Credentials: testCredentials})
+	assert.Error(t, err)
+}
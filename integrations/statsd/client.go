@@ -0,0 +1,171 @@
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+const (
+	// Maximum size of a UDP packet sent to the StatsD server, small enough to
+	// avoid fragmentation on a typical network.
+	maxPacketSize_bytes = 1432
+
+	// Timeout for sending a single packet.
+	writeTimeout = 100 * time.Millisecond
+)
+
+// Sends agent metrics to a StatsD server, such as the Datadog agent's
+// DogStatsD listener, over UDP. Metrics recorded with Gauge and Count are
+// buffered and sent by Flush, with tags in DogStatsD format.
+//
+// Sending never blocks capture for long: each packet is sent with a short
+// timeout, and metrics that can't be sent are discarded. Also counts the
+// witnesses exported to it. Implements trace.WitnessSink.
+type Client struct {
+	conn   net.Conn
+	prefix string
+
+	// Tags appended to each metric, in the form "|#key:value,...", or empty.
+	tags string
+
+	mutex sync.Mutex
+	lines []string
+
+	// Totals reported for each counter at the last flush, so that only the
+	// change is sent.
+	counterTotals map[string]int64
+
+	// Whether a failure to send has been reported.
+	warned bool
+
+	numWitnesses int64
+}
+
+var _ trace.WitnessSink = (*Client)(nil)
+
+// Creates a client that sends metrics to the StatsD server at the given
+// "host:port" address. Metric names are qualified with the prefix, if any.
+// Tags are "key:value" pairs or bare keys.
+//
+// No connection is established, so an unreachable server is not an error.
+func NewClient(address string, prefix string, tags []string) (*Client, error) {
+	for _, t := range tags {
+		if t == "" || strings.ContainsAny(t, "|,#") {
+			return nil, errors.Errorf("invalid StatsD tag %q", t)
+		}
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve StatsD address %s", address)
+	}
+
+	c := &Client{
+		conn:          conn,
+		prefix:        strings.TrimSuffix(prefix, "."),
+		counterTotals: map[string]int64{},
+	}
+	if len(tags) > 0 {
+		c.tags = "|#" + strings.Join(tags, ",")
+	}
+	return c, nil
+}
+
+func (c *Client) ExportWitness(_ *pb.Witness, _ time.Time, _ trace.WitnessInfo) {
+	atomic.AddInt64(&c.numWitnesses, 1)
+}
+
+// Records the current value of a gauge.
+func (c *Client) Gauge(name string, value float64) {
+	c.add(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// Records the running total of a counter. The change since the last flush is
+// sent as a StatsD count.
+func (c *Client) Count(name string, total int64) {
+	c.mutex.Lock()
+	delta := total - c.counterTotals[name]
+	c.counterTotals[name] = total
+	c.mutex.Unlock()
+
+	c.add(name, strconv.FormatInt(delta, 10), "c")
+}
+
+func (c *Client) add(name string, value string, metricType string) {
+	if c.prefix != "" {
+		name = c.prefix + "." + name
+	}
+	line := name + ":" + value + "|" + metricType + c.tags
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lines = append(c.lines, line)
+}
+
+// Sends the metrics recorded since the last flush, along with the number of
+// witnesses exported.
+func (c *Client) Flush() {
+	c.Count("witnesses", atomic.LoadInt64(&c.numWitnesses))
+
+	c.mutex.Lock()
+	lines := c.lines
+	c.lines = nil
+	c.mutex.Unlock()
+
+	for _, packet := range packets(lines) {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := c.conn.Write(packet); err != nil {
+			c.reportFailure(err)
+			return
+		}
+	}
+}
+
+// Warns about the first failure to send metrics. Later failures are only
+// logged at debug level, since the server is likely still unreachable.
+func (c *Client) reportFailure(err error) {
+	c.mutex.Lock()
+	warned := c.warned
+	c.warned = true
+	c.mutex.Unlock()
+
+	if warned {
+		printer.Debugf("Failed to send metrics to StatsD: %v\n", err)
+	} else {
+		printer.Warningf("Failed to send metrics to StatsD; metrics will be dropped until it is reachable: %v\n", err)
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Joins metric lines into packets of at most maxPacketSize_bytes, separated
+// by newlines. A line that is too long is sent in a packet of its own.
+func packets(lines []string) [][]byte {
+	var result [][]byte
+	var current []byte
+	for _, line := range lines {
+		if len(current) > 0 && len(current)+1+len(line) > maxPacketSize_bytes {
+			result = append(result, current)
+			current = nil
+		}
+		if len(current) > 0 {
+			current = append(current, '\n')
+		}
+		current = append(current, line...)
+	}
+	if len(current) > 0 {
+		result = append(result, current)
+	}
+	return result
+}
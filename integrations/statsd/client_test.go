@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+// Listens for StatsD packets on a local UDP port.
+func newTestListener(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// Returns the metric lines received in the next packet.
+func receiveLines(t *testing.T, conn *net.UDPConn) []string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestFlush(t *testing.T) {
+	listener := newTestListener(t)
+	defer listener.Close()
+
+	c, err := NewClient(listener.LocalAddr().String(), "postman_insights_agent", []string{"env:prod", "canary"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	c.ExportWitness(&pb.Witness{}, time.Now(), trace.WitnessInfo{})
+	c.ExportWitness(&pb.Witness{}, time.Now(), trace.WitnessInfo{})
+	c.Count("uploads", 3)
+	c.Gauge("pair_cache_size", 12)
+	c.Flush()
+
+	assert.ElementsMatch(t, []string{
+		"postman_insights_agent.uploads:3|c|#env:prod,canary",
+		"postman_insights_agent.pair_cache_size:12|g|#env:prod,canary",
+		"postman_insights_agent.witnesses:2|c|#env:prod,canary",
+	}, receiveLines(t, listener))
+
+	// Counters report the change since the last flush.
+	c.ExportWitness(&pb.Witness{}, time.Now(), trace.WitnessInfo{})
+	c.Count("uploads", 7)
+	c.Flush()
+
+	assert.ElementsMatch(t, []string{
+		"postman_insights_agent.uploads:4|c|#env:prod,canary",
+		"postman_insights_agent.witnesses:1|c|#env:prod,canary",
+	}, receiveLines(t, listener))
+}
+
+func TestFlushUnreachable(t *testing.T) {
+	// Nothing is listening on the port once the listener is closed.
+	listener := newTestListener(t)
+	address := listener.LocalAddr().String()
+	listener.Close()
+
+	c, err := NewClient(address, "", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	// Flushing returns promptly even though metrics can't be delivered.
+	for i := 0; i < 3; i++ {
+		c.Gauge("goroutines", 10)
+		c.Flush()
+	}
+}
+
+func TestInvalidTag(t *testing.T) {
+	_, err := NewClient("127.0.0.1:8125", "", []string{"env:prod|c"})
+	assert.Error(t, err)
+}
+
+func TestPackets(t *testing.T) {
+	line := strings.Repeat("x", 1000)
+	result := packets([]string{line, line, "a:1|c", "b:2|c"})
+	if assert.Equal(t, 2, len(result)) {
+		assert.Equal(t, line, string(result[0]))
+		assert.Equal(t, line+"\na:1|c\nb:2|c", string(result[1]))
+	}
+}
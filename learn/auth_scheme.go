@@ -0,0 +1,60 @@
+package learn
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+)
+
+// Replaces the credential in an Authorization or Proxy-Authorization header
+// whose scheme is kept.
+const RedactedCredential = "*REDACTED*"
+
+// Nonzero if the scheme of Authorization and Proxy-Authorization headers in
+// requests is kept.
+var keepAuthScheme int32
+
+// Sets whether the scheme of Authorization and Proxy-Authorization headers in
+// requests is kept, so that witnesses record "Bearer *REDACTED*" rather than
+// an empty value. The credential is always redacted.
+func KeepAuthScheme(keep bool) {
+	var v int32
+	if keep {
+		v = 1
+	}
+	atomic.StoreInt32(&keepAuthScheme, v)
+}
+
+func keepingAuthScheme() bool {
+	return atomic.LoadInt32(&keepAuthScheme) != 0
+}
+
+// Returns the scheme of the given Authorization header value, followed by
+// RedactedCredential. A value with no credential is taken to be a bare
+// credential, and is redacted entirely.
+func redactCredential(v string) string {
+	fields := strings.Fields(v)
+	if len(fields) < 2 {
+		return RedactedCredential
+	}
+	return fields[0] + " " + RedactedCredential
+}
+
+// Determines whether the given datum is an Authorization or
+// Proxy-Authorization header whose credential has been redacted by
+// redactCredential. Such values hold no secret, so they needn't be obfuscated.
+func IsRedactedCredential(d *pb.Data) bool {
+	meta := d.GetMeta().GetHttp()
+	if meta.GetAuth() == nil && http.CanonicalHeaderKey(meta.GetHeader().GetKey()) != "Proxy-Authorization" {
+		return false
+	}
+
+	v := d.GetPrimitive().GetStringValue().GetValue()
+	if v == RedactedCredential {
+		return true
+	}
+	scheme := strings.TrimSuffix(v, " "+RedactedCredential)
+	return scheme != v && scheme != "" && !strings.ContainsAny(scheme, " \t")
+}
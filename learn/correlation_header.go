@@ -0,0 +1,54 @@
+package learn
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+)
+
+// Canonical name of the request header whose value correlates witnesses with
+// other telemetry, or empty if there is none.
+var correlationHeader atomic.Value
+
+// Sets the request header, e.g. X-Request-Id, whose value identifies a
+// request in other telemetry. The header's value is kept verbatim on
+// witnesses, rather than being obfuscated, so that they can be looked up by
+// it. An empty name disables this.
+func SetCorrelationHeader(name string) {
+	correlationHeader.Store(http.CanonicalHeaderKey(strings.TrimSpace(name)))
+}
+
+func getCorrelationHeader() string {
+	name, _ := correlationHeader.Load().(string)
+	return name
+}
+
+// Determines whether the given datum holds the value of the correlation
+// header in a request.
+func IsCorrelationID(d *pb.Data) bool {
+	name := getCorrelationHeader()
+	if name == "" {
+		return false
+	}
+	meta := d.GetMeta().GetHttp()
+	if meta.GetResponseCode() != 0 {
+		return false
+	}
+	return http.CanonicalHeaderKey(meta.GetHeader().GetKey()) == name
+}
+
+// Returns the value of the correlation header in the given method's request,
+// or the empty string if there is none.
+func CorrelationID(m *pb.Method) string {
+	if getCorrelationHeader() == "" {
+		return ""
+	}
+	for _, d := range m.GetArgs() {
+		if IsCorrelationID(d) {
+			return d.GetPrimitive().GetStringValue().GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package learn
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Maximum number of distinct values of each grouping header that distinguish
+// endpoints. Values seen after the limit is reached are grouped together as
+// OtherHeaderValue.
+const maxGroupByHeaderValues = 20
+
+// Stands in for the values of a grouping header beyond the first
+// maxGroupByHeaderValues.
+const OtherHeaderValue = "other"
+
+// Request headers whose values distinguish otherwise identical endpoints.
+var groupByHeaders = struct {
+	sync.Mutex
+
+	// Canonical names of the headers, in the order given.
+	names []string
+
+	// For each header, the values that distinguish endpoints.
+	values map[string]map[string]struct{}
+}{}
+
+// Sets the request headers whose values distinguish endpoints, for APIs that
+// route by header, e.g. on an API version. A request's values for these
+// headers are added to the path template in its method metadata, as in
+// "/users;X-Api-Version=v2", leaving the path itself unchanged. Requests
+// without a header are grouped as before.
+//
+// Only the first few distinct values of each header are kept apart; later
+// values are grouped together, so that a header carrying arbitrary values
+// can't inflate the number of endpoints. Values are recorded verbatim, so
+// headers carrying secrets should not be used.
+func GroupByHeaders(names []string) {
+	groupByHeaders.Lock()
+	defer groupByHeaders.Unlock()
+
+	groupByHeaders.names = nil
+	groupByHeaders.values = map[string]map[string]struct{}{}
+	for _, n := range names {
+		n = http.CanonicalHeaderKey(strings.TrimSpace(n))
+		if n == "" {
+			continue
+		}
+		if _, ok := groupByHeaders.values[n]; ok {
+			continue
+		}
+		groupByHeaders.names = append(groupByHeaders.names, n)
+		groupByHeaders.values[n] = map[string]struct{}{}
+	}
+}
+
+// Returns the path template for a request with the given path and headers,
+// with the values of any grouping headers appended.
+func groupedPathTemplate(path string, header http.Header) string {
+	groupByHeaders.Lock()
+	defer groupByHeaders.Unlock()
+
+	if len(groupByHeaders.names) == 0 {
+		return path
+	}
+
+	var b strings.Builder
+	b.WriteString(path)
+	for _, n := range groupByHeaders.names {
+		v := strings.TrimSpace(header.Get(n))
+		if v == "" {
+			continue
+		}
+
+		seen := groupByHeaders.values[n]
+		if _, ok := seen[v]; !ok {
+			if len(seen) >= maxGroupByHeaderValues {
+				v = OtherHeaderValue
+			} else {
+				seen[v] = struct{}{}
+			}
+		}
+
+		b.WriteString(";")
+		b.WriteString(n)
+		b.WriteString("=")
+		b.WriteString(url.PathEscape(v))
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package learn
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func groupedTemplate(t *testing.T, headers map[string][]string) string {
+	req := newTestHTTPRequest(
+		"GET",
+		"https://www.akitasoftware.com/users",
+		nil,
+		applicationJSON,
+		headers,
+		[]*http.Cookie{},
+	)
+	result, err := ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	meta := spec_util.HTTPMetaFromMethod(result.Witness.GetMethod())
+	if !assert.NotNil(t, meta) {
+		return ""
+	}
+	return meta.PathTemplate
+}
+
+func TestGroupByHeaders(t *testing.T) {
+	GroupByHeaders([]string{"x-api-version"})
+	defer GroupByHeaders(nil)
+
+	v1 := groupedTemplate(t, map[string][]string{"X-Api-Version": {"v1"}})
+	v2 := groupedTemplate(t, map[string][]string{"X-Api-Version": {"v2"}})
+	assert.Equal(t, "/users;X-Api-Version=v1", v1)
+	assert.Equal(t, "/users;X-Api-Version=v2", v2)
+
+	// Requests without the header are grouped by path alone.
+	assert.Equal(t, "/users", groupedTemplate(t, map[string][]string{}))
+}
+
+func TestGroupByHeadersCardinality(t *testing.T) {
+	GroupByHeaders([]string{"X-Tenant"})
+	defer GroupByHeaders(nil)
+
+	for i := 0; i < maxGroupByHeaderValues; i++ {
+		v := fmt.Sprintf("tenant-%d", i)
+		assert.Equal(t, "/users;X-Tenant="+v, groupedTemplate(t, map[string][]string{"X-Tenant": {v}}))
+	}
+
+	// Values beyond the limit are grouped together, while values already seen
+	// are still kept apart.
+	assert.Equal(t, "/users;X-Tenant="+OtherHeaderValue, groupedTemplate(t, map[string][]string{"X-Tenant": {"tenant-new"}}))
+	assert.Equal(t, "/users;X-Tenant=tenant-0", groupedTemplate(t, map[string][]string{"X-Tenant": {"tenant-0"}}))
+}
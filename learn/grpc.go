@@ -0,0 +1,47 @@
+package learn
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// The gRPC method called by a request, which gRPC sends as a POST to the path
+// "/package.Service/Method".
+type GRPCMethod struct {
+	// The fully qualified service name, as in "package.Service".
+	Service string
+
+	Method string
+}
+
+// Returns the method's path, as in "package.Service/Method".
+func (m GRPCMethod) String() string {
+	return m.Service + "/" + m.Method
+}
+
+// Determines whether the given request is a gRPC call, and returns the method
+// called if so. A request is a gRPC call if it is a POST with a gRPC content
+// type, as in "application/grpc" or "application/grpc+proto", to a path of
+// the form "/package.Service/Method".
+func GRPCMethodOfRequest(r akinet.HTTPRequest) (GRPCMethod, bool) {
+	if r.Method != http.MethodPost || r.URL == nil || !isGRPCContentType(r.Header.Get("Content-Type")) {
+		return GRPCMethod{}, false
+	}
+
+	service, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return GRPCMethod{}, false
+	}
+	return GRPCMethod{Service: service, Method: method}, true
+}
+
+func isGRPCContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/grpc" || strings.HasPrefix(mediaType, "application/grpc+")
+}
@@ -0,0 +1,45 @@
+package learn
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCMethodOfRequest(t *testing.T) {
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		expected    GRPCMethod
+		isGRPC      bool
+	}{
+		{"grpc", "POST", "/helloworld.Greeter/SayHello", "application/grpc", GRPCMethod{"helloworld.Greeter", "SayHello"}, true},
+		{"grpc+proto", "POST", "/pets.v1.PetService/ListPets", "application/grpc+proto", GRPCMethod{"pets.v1.PetService", "ListPets"}, true},
+		{"parameters", "POST", "/a.B/C", "application/grpc; charset=utf-8", GRPCMethod{"a.B", "C"}, true},
+		{"grpc-web", "POST", "/a.B/C", "application/grpc-web", GRPCMethod{}, false},
+		{"json", "POST", "/a.B/C", "application/json", GRPCMethod{}, false},
+		{"GET", "GET", "/a.B/C", "application/grpc", GRPCMethod{}, false},
+		{"no method", "POST", "/a.B", "application/grpc", GRPCMethod{}, false},
+		{"empty method", "POST", "/a.B/", "application/grpc", GRPCMethod{}, false},
+		{"too deep", "POST", "/v1/a.B/C", "application/grpc", GRPCMethod{}, false},
+	}
+
+	for _, tc := range testCases {
+		req := newTestHTTPRequest(tc.method, "http://example.com"+tc.path, nil, tc.contentType, map[string][]string{}, []*http.Cookie{})
+		m, ok := GRPCMethodOfRequest(req)
+		assert.Equal(t, tc.isGRPC, ok, tc.name)
+		assert.Equal(t, tc.expected, m, tc.name)
+	}
+}
+
+func TestParseHTTPGRPCMethod(t *testing.T) {
+	req := newTestHTTPRequest("POST", "http://example.com/helloworld.Greeter/SayHello", []byte{0, 0, 0, 0, 0}, "application/grpc", map[string][]string{}, []*http.Cookie{})
+	partial, err := ParseHTTP(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, GRPCMethod{"helloworld.Greeter", "SayHello"}, partial.GRPCMethod)
+		assert.Equal(t, "helloworld.Greeter/SayHello", partial.GRPCMethod.String())
+	}
+}
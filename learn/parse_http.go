@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 
 	pb "github.com/akitasoftware/akita-ir/go/api_spec"
@@ -57,8 +58,17 @@ const (
 	// sense to pull in a lot of data, just to hash it anyway.  The only reason to have more than
 	// a few bytes is so we can more reliably distinguish whether responses are identical.
 	SmallBodySample = 10 * 1024
+
+	// The maximum number of values parsed from a newline-delimited JSON body.
+	// Any further values are dropped.
+	MaxNDJSONValues = 100
 )
 
+// Header added by the capture layer to a response that was emitted while its
+// body was still streaming, so that only part of the body was seen. It is
+// removed before the response is parsed.
+const BodyOpenHeader = "X-Postman-Insights-Body-Open"
+
 // These need to be constructors, rather than a global var that's reused, so
 // that there is not a race condition when marshaling to protobufs that share
 // them. (The race condition actually manifested in obfuscate().)
@@ -98,6 +108,9 @@ func ParseHTTP(elem akinet.ParsedNetworkContent) (*PartialWitness, error) {
 
 	var streamID uuid.UUID
 	var seq int
+	bodyOpen := false
+	var grpcMethod GRPCMethod
+	var webSocketSender string
 
 	switch t := elem.(type) {
 	case akinet.HTTPRequest:
@@ -105,7 +118,18 @@ func ParseHTTP(elem akinet.ParsedNetworkContent) (*PartialWitness, error) {
 		seq = t.Seq
 
 		isRequest = true
-		methodMeta, datas = parseRequest(&t)
+		if webSocketSender = WebSocketMessageSender(t); webSocketSender != "" {
+			// Only the message itself is recorded, with the endpoint of the
+			// upgrade request.
+			methodMeta = parseMethodMeta(&t)
+			if webSocketSender == WebSocketFromServer {
+				isRequest = false
+				statusCode = http.StatusSwitchingProtocols
+			}
+		} else {
+			methodMeta, datas = parseRequest(&t)
+			grpcMethod, _ = GRPCMethodOfRequest(t)
+		}
 		rawBody = t.Body
 		bodyDecompressed = t.BodyDecompressed
 		headers = t.Header
@@ -113,6 +137,12 @@ func ParseHTTP(elem akinet.ParsedNetworkContent) (*PartialWitness, error) {
 		streamID = t.StreamID
 		seq = t.Seq
 
+		if _, ok := t.Header[BodyOpenHeader]; ok {
+			bodyOpen = true
+			t.Header = t.Header.Clone()
+			t.Header.Del(BodyOpenHeader)
+		}
+
 		datas = parseResponse(&t)
 		rawBody = t.Body
 		bodyDecompressed = t.BodyDecompressed
@@ -184,11 +214,26 @@ func ParseHTTP(elem akinet.ParsedNetworkContent) (*PartialWitness, error) {
 	}
 
 	return &PartialWitness{
-		Witness: &pb.Witness{Method: method},
-		PairKey: toWitnessID(streamID, seq),
+		Witness:         &pb.Witness{Method: method},
+		PairKey:         toWitnessID(streamID, seq),
+		BodySize_bytes:  bodySize(headers, rawBody),
+		BodyOpen:        bodyOpen,
+		GRPCMethod:      grpcMethod,
+		WebSocketSender: webSocketSender,
 	}, nil
 }
 
+// Returns the size of an HTTP body, preferring the size declared in the
+// Content-Length header, since the captured body may have been truncated.
+func bodySize(headers http.Header, body memview.MemView) int64 {
+	if declared := headers.Get("Content-Length"); declared != "" {
+		if n, err := strconv.ParseInt(declared, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return body.Len()
+}
+
 // Today body has been completely assembled, but we accept a Reader to allow us to
 // stream throught he decompression later, if it becomes feasible.
 //
@@ -312,9 +357,18 @@ func parseBody(contentType string, bodyStream io.Reader, statusCode int) (*pb.Da
 	// TODO: application/json-seq (RFC 7466)?
 	// TODO: more text/* types
 	var parseBodyDataAs pb.HTTPBody_ContentType
+	isNDJSON := false
+	isProtobuf := false
 	switch mediaType {
 	case "application/json":
 		parseBodyDataAs = pb.HTTPBody_JSON
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		parseBodyDataAs = pb.HTTPBody_JSON
+		isNDJSON = true
+	case "application/protobuf", "application/x-protobuf", "application/x-google-protobuf", "application/vnd.google.protobuf":
+		// Decoded into the same form as JSON.
+		parseBodyDataAs = pb.HTTPBody_JSON
+		isProtobuf = true
 	case "application/x-www-form-urlencoded":
 		parseBodyDataAs = pb.HTTPBody_FORM_URL_ENCODED
 	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
@@ -364,7 +418,18 @@ func parseBody(contentType string, bodyStream io.Reader, statusCode int) (*pb.Da
 	// Parse body.
 	switch parseBodyDataAs {
 	case pb.HTTPBody_JSON:
-		bodyData, err = parseHTTPBodyJSON(bodyStream)
+		if isProtobuf {
+			bodyData, err = parseHTTPBodyProtobuf(bodyStream, mediaParams)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if isNDJSON {
+			bodyData, err = parseHTTPBodyNDJSON(bodyStream)
+		} else {
+			bodyData, err = parseHTTPBodyJSON(bodyStream)
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "could not parse JSON body")
 		}
@@ -573,8 +638,13 @@ func parseHeader(header http.Header, responseCodeOpt optionals.Optional[int]) []
 					token = v
 				}
 
+				value := spec_util.CategorizeString(token).Obfuscate().ToProto()
+				if keepingAuthScheme() {
+					value = spec_util.NewPrimitiveString(redactCredential(v))
+				}
+
 				authData := &pb.Data{
-					Value: &pb.Data_Primitive{spec_util.CategorizeString(token).Obfuscate().ToProto()},
+					Value: &pb.Data_Primitive{value},
 					Meta: &pb.DataMeta{
 						Meta: &pb.DataMeta_Http{
 							Http: &pb.HTTPMeta{
@@ -586,6 +656,14 @@ func parseHeader(header http.Header, responseCodeOpt optionals.Optional[int]) []
 				}
 				datas = append(datas, authData)
 
+				continue
+			}
+		case "proxy-authorization":
+			if isRequest && keepingAuthScheme() {
+				datas = append(datas, &pb.Data{
+					Value: newDataPrimitive(spec_util.NewPrimitiveString(redactCredential(v))),
+					Meta:  newDataMetaHeader(&pb.HTTPHeader{Key: k}, responseCode),
+				})
 				continue
 			}
 		}
@@ -641,27 +719,62 @@ func parseMethodMeta(req *akinet.HTTPRequest) *pb.MethodMeta {
 		Meta: &pb.MethodMeta_Http{
 			Http: &pb.HTTPMethodMeta{
 				Method:       req.Method,
-				PathTemplate: path,
+				PathTemplate: groupedPathTemplate(path, req.Header),
 				Host:         req.Host,
 			},
 		},
 	}
 }
 
+// Parses a JSON body. If the body turns out to contain a sequence of JSON
+// values, such as newline-delimited JSON, it is parsed as a list of those
+// values.
 func parseHTTPBodyJSON(stream io.Reader) (*pb.Data, error) {
-	var top interface{}
-	decoder := json.NewDecoder(newStripControlCharactersReader(stream))
-	decoder.UseNumber()
-
-	err := decoder.Decode(&top)
-
+	values, err := decodeJSONValues(stream)
 	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse JSON")
+		return nil, err
 	}
 
 	// JSON already distingishes string values from non-string values, so don't
 	// interpret strings.
-	return parseElem(top, spec_util.NO_INTERPRET_STRINGS), nil
+	if len(values) == 1 {
+		return parseElem(values[0], spec_util.NO_INTERPRET_STRINGS), nil
+	}
+	return parseElem(values, spec_util.NO_INTERPRET_STRINGS), nil
+}
+
+// Parses a newline-delimited JSON (JSON Lines) body as a list of its values,
+// so that each value is handled separately, e.g. when redacting.
+func parseHTTPBodyNDJSON(stream io.Reader) (*pb.Data, error) {
+	values, err := decodeJSONValues(stream)
+	if err != nil {
+		return nil, err
+	}
+	return parseElem(values, spec_util.NO_INTERPRET_STRINGS), nil
+}
+
+// Decodes up to MaxNDJSONValues JSON values from the stream. Fails only if the
+// first value can't be decoded; decoding stops at the first value after that
+// which can't be decoded.
+func decodeJSONValues(stream io.Reader) ([]interface{}, error) {
+	decoder := json.NewDecoder(newStripControlCharactersReader(stream))
+	decoder.UseNumber()
+
+	var values []interface{}
+	for len(values) < MaxNDJSONValues {
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			if len(values) == 0 {
+				return nil, errors.Wrapf(err, "couldn't parse JSON")
+			}
+			if err != io.EOF {
+				printer.Debugf("Ignoring the rest of a JSON body after %d values: %v\n", len(values), err)
+			}
+			break
+		}
+		values = append(values, value)
+	}
+	return values, nil
 }
 
 func parseHTTPBodyYAML(stream io.Reader) (*pb.Data, error) {
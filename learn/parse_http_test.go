@@ -46,6 +46,10 @@ var testBodyDict = `
 }
 `
 
+var testBodyNDJSON = `{"name": "prince", "dog": true}
+{"name": "bubbles", "dog": false}
+`
+
 var testMultipartFormData = strings.Join([]string{
 	"--b9580db\r\n",
 	"Content-Disposition: form-data; name=\"field1\"\r\n",
@@ -83,6 +87,19 @@ func newTestBodySpecContentType(contentType string, statusCode int) *as.Data {
 	})
 }
 
+func newTestNDJSONBodySpec(contentType string, statusCode int) *as.Data {
+	return newTestBodySpecFromData(statusCode, as.HTTPBody_JSON, contentType, dataFromList(
+		dataFromStruct(map[string]*as.Data{
+			"name": dataFromPrimitive(spec_util.NewPrimitiveString("prince")),
+			"dog":  dataFromPrimitive(spec_util.NewPrimitiveBool(true)),
+		}),
+		dataFromStruct(map[string]*as.Data{
+			"name": dataFromPrimitive(spec_util.NewPrimitiveString("bubbles")),
+			"dog":  dataFromPrimitive(spec_util.NewPrimitiveBool(false)),
+		}),
+	))
+}
+
 func newTestBodySpecFromStruct(statusCode int, contentType as.HTTPBody_ContentType, originalContentType string, s map[string]*as.Data) *as.Data {
 	return newTestBodySpecFromData(statusCode, contentType, originalContentType, dataFromStruct(s))
 }
@@ -173,6 +190,30 @@ func TestParseHTTPRequest(t *testing.T) {
 			),
 			expectedMethod: newMethod([]*as.Data{newTestBodySpecContentType("application/custom+json", 0)}, nil, standardMethodPostMeta),
 		},
+		&parseTest{
+			name: "NDJSON body test",
+			testContent: newTestHTTPRequest(
+				"POST",
+				"https://www.akitasoftware.com",
+				[]byte(testBodyNDJSON),
+				"application/x-ndjson",
+				map[string][]string{},
+				[]*http.Cookie{},
+			),
+			expectedMethod: newMethod([]*as.Data{newTestNDJSONBodySpec("application/x-ndjson", 0)}, nil, standardMethodPostMeta),
+		},
+		&parseTest{
+			name: "JSON body with multiple values test",
+			testContent: newTestHTTPRequest(
+				"POST",
+				"https://www.akitasoftware.com",
+				[]byte(testBodyNDJSON),
+				applicationJSON,
+				map[string][]string{},
+				[]*http.Cookie{},
+			),
+			expectedMethod: newMethod([]*as.Data{newTestNDJSONBodySpec(applicationJSON, 0)}, nil, standardMethodPostMeta),
+		},
 		&parseTest{
 			name: "query test 1",
 			testContent: newTestHTTPRequest(
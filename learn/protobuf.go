@@ -0,0 +1,180 @@
+package learn
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Content-Type parameters that name the message type of a Protocol Buffers
+// body, as in `application/x-protobuf; messageType="acme.v1.Order"`. Parameter
+// names are lower-cased by mime.ParseMediaType.
+var protobufMessageTypeParams = []string{"messagetype", "proto"}
+
+// Message descriptors used to decode Protocol Buffers bodies. Holds a
+// *protoregistry.Files, or nothing if no descriptors were loaded.
+var protoDescriptors atomic.Value
+
+// Loads the serialized FileDescriptorSet at the given path, as produced by
+// `protoc --descriptor_set_out --include_imports`, and uses it to decode
+// Protocol Buffers bodies whose message type is named in their Content-Type.
+func LoadProtoDescriptors(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read protobuf descriptors from %s", path)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return errors.Wrapf(err, "failed to parse protobuf descriptors from %s", path)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return errors.Wrapf(err, "invalid protobuf descriptors in %s", path)
+	}
+	protoDescriptors.Store(files)
+	return nil
+}
+
+// Forgets the descriptors loaded by LoadProtoDescriptors, so that Protocol
+// Buffers bodies are no longer decoded.
+func UnloadProtoDescriptors() {
+	protoDescriptors.Store((*protoregistry.Files)(nil))
+}
+
+// Returns the descriptor of the message type named in the Content-Type
+// parameters, or nil if there is none.
+func protoMessageDescriptor(mediaParams map[string]string) protoreflect.MessageDescriptor {
+	files, _ := protoDescriptors.Load().(*protoregistry.Files)
+	if files == nil {
+		return nil
+	}
+
+	for _, param := range protobufMessageTypeParams {
+		name := protoreflect.FullName(mediaParams[param])
+		if !name.IsValid() {
+			continue
+		}
+		if d, err := files.FindDescriptorByName(name); err == nil {
+			if md, ok := d.(protoreflect.MessageDescriptor); ok {
+				return md
+			}
+		}
+	}
+	return nil
+}
+
+// Parses a Protocol Buffers body into the same form as a JSON body. If the
+// message type is known, the message is decoded with its field names and
+// values. Otherwise, only the field numbers and wire types are recorded, as a
+// struct from field number to wire type.
+func parseHTTPBodyProtobuf(stream io.Reader, mediaParams map[string]string) (*pb.Data, error) {
+	body, err := limitedBufferBody(stream, MaxBufferedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if md := protoMessageDescriptor(mediaParams); md != nil {
+		msg := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return nil, errors.Wrapf(err, "could not decode protobuf body as %s", md.FullName())
+		}
+		return parseElem(protoMessageValue(msg), spec_util.NO_INTERPRET_STRINGS), nil
+	}
+
+	fields, err := protoWireTypes(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse protobuf body")
+	}
+	return parseElem(fields, spec_util.NO_INTERPRET_STRINGS), nil
+}
+
+// Converts a message to the form produced by decoding JSON, keyed by field
+// name. Fields that aren't set are omitted.
+func protoMessageValue(m protoreflect.Message) map[string]interface{} {
+	result := map[string]interface{}{}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := v.List()
+			elems := make([]interface{}, 0, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				elems = append(elems, protoSingularValue(fd, list.Get(i)))
+			}
+			result[string(fd.Name())] = elems
+		case fd.IsMap():
+			entries := map[string]interface{}{}
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				entries[k.String()] = protoSingularValue(fd.MapValue(), v)
+				return true
+			})
+			result[string(fd.Name())] = entries
+		default:
+			result[string(fd.Name())] = protoSingularValue(fd, v)
+		}
+		return true
+	})
+	return result
+}
+
+func protoSingularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageValue(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+// Returns the wire type of each field in an encoded message, keyed by field
+// number. Stops at the first field that can't be parsed, such as at the end
+// of a truncated body, and fails only if no fields were parsed.
+func protoWireTypes(body []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeField(body)
+		if n < 0 {
+			if len(result) == 0 {
+				return nil, protowire.ParseError(n)
+			}
+			break
+		}
+		result[strconv.Itoa(int(num))] = protoWireTypeName(typ)
+		body = body[n:]
+	}
+	return result, nil
+}
+
+func protoWireTypeName(typ protowire.Type) string {
+	switch typ {
+	case protowire.VarintType:
+		return "varint"
+	case protowire.Fixed32Type:
+		return "fixed32"
+	case protowire.Fixed64Type:
+		return "fixed64"
+	case protowire.BytesType:
+		return "bytes"
+	case protowire.StartGroupType:
+		return "group"
+	}
+	return fmt.Sprintf("wire type %d", typ)
+}
@@ -0,0 +1,188 @@
+package learn
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	as "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Describes
+//
+//	package acme.v1;
+//	message Login {
+//	  enum Kind { USER = 0; ADMIN = 1; }
+//	  message Device { string name = 1; }
+//	  string username = 1;
+//	  string password = 2;
+//	  int32 attempts = 3;
+//	  repeated string roles = 4;
+//	  Kind kind = 5;
+//	  Device device = 6;
+//	}
+func testLoginDescriptorSet() *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	return &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("acme/v1/login.proto"),
+			Package: proto.String("acme.v1"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Login"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("username", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("password", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("attempts", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+					field("roles", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, ""),
+					field("kind", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".acme.v1.Login.Kind"),
+					field("device", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".acme.v1.Login.Device"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Device"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					},
+				}},
+				EnumType: []*descriptorpb.EnumDescriptorProto{{
+					Name: proto.String("Kind"),
+					Value: []*descriptorpb.EnumValueDescriptorProto{
+						{Name: proto.String("USER"), Number: proto.Int32(0)},
+						{Name: proto.String("ADMIN"), Number: proto.Int32(1)},
+					},
+				}},
+			}},
+		}},
+	}
+}
+
+// Writes the Login descriptor set to a file, and returns the file's path and
+// an encoded Login message.
+func writeTestLoginDescriptors(t *testing.T) (string, []byte) {
+	set := testLoginDescriptorSet()
+	b, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "login.pb")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := files.FindDescriptorByName("acme.v1.Login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := d.(protoreflect.MessageDescriptor)
+
+	msg := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+	msg.Set(fields.ByName("username"), protoreflect.ValueOfString("prince"))
+	msg.Set(fields.ByName("password"), protoreflect.ValueOfString(fakePassword))
+	msg.Set(fields.ByName("attempts"), protoreflect.ValueOfInt32(3))
+	roles := msg.Mutable(fields.ByName("roles")).List()
+	roles.Append(protoreflect.ValueOfString("reader"))
+	roles.Append(protoreflect.ValueOfString("writer"))
+	msg.Set(fields.ByName("kind"), protoreflect.ValueOfEnum(1))
+	device := msg.Mutable(fields.ByName("device")).Message()
+	device.Set(md.Messages().ByName("Device").Fields().ByName("name"), protoreflect.ValueOfString("laptop"))
+
+	encoded, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, encoded
+}
+
+func TestParseProtobufBody(t *testing.T) {
+	path, encoded := writeTestLoginDescriptors(t)
+
+	// Without descriptors, only field numbers and wire types are recorded.
+	protoDescriptors.Store((*protoregistry.Files)(nil))
+	data, err := parseBody(`application/x-protobuf; messageType="acme.v1.Login"`, bytes.NewReader(encoded), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, newTestBodySpecFromStruct(0, as.HTTPBody_JSON, "application/x-protobuf", map[string]*as.Data{
+		"1": dataFromPrimitive(spec_util.NewPrimitiveString("bytes")),
+		"2": dataFromPrimitive(spec_util.NewPrimitiveString("bytes")),
+		"3": dataFromPrimitive(spec_util.NewPrimitiveString("varint")),
+		"4": dataFromPrimitive(spec_util.NewPrimitiveString("bytes")),
+		"5": dataFromPrimitive(spec_util.NewPrimitiveString("varint")),
+		"6": dataFromPrimitive(spec_util.NewPrimitiveString("bytes")),
+	}).String(), data.String())
+	assert.NotContains(t, data.String(), fakePassword)
+
+	// With descriptors, the message is decoded with its field names.
+	assert.NoError(t, LoadProtoDescriptors(path))
+	defer protoDescriptors.Store((*protoregistry.Files)(nil))
+
+	for _, contentType := range []string{
+		`application/x-protobuf; messageType="acme.v1.Login"`,
+		`application/protobuf; proto=acme.v1.Login`,
+	} {
+		data, err := parseBody(contentType, bytes.NewReader(encoded), 0)
+		if !assert.NoError(t, err, contentType) {
+			continue
+		}
+		fields := data.GetStruct().GetFields()
+		assert.Equal(t, "prince", fields["username"].GetPrimitive().GetStringValue().GetValue(), contentType)
+		assert.Equal(t, fakePassword, fields["password"].GetPrimitive().GetStringValue().GetValue(), contentType)
+		assert.Equal(t, int32(3), fields["attempts"].GetPrimitive().GetInt32Value().GetValue(), contentType)
+		assert.Equal(t, 2, len(fields["roles"].GetList().GetElems()), contentType)
+		assert.Equal(t, "ADMIN", fields["kind"].GetPrimitive().GetStringValue().GetValue(), contentType)
+		assert.Equal(t, "laptop", fields["device"].GetStruct().GetFields()["name"].GetPrimitive().GetStringValue().GetValue(), contentType)
+		assert.Equal(t, as.HTTPBody_JSON, data.GetMeta().GetHttp().GetBody().GetContentType(), contentType)
+	}
+
+	// Unknown message types fall back to wire types.
+	data, err = parseBody(`application/x-protobuf; messageType="acme.v1.Unknown"`, bytes.NewReader(encoded), 0)
+	assert.NoError(t, err)
+	assert.Contains(t, data.GetStruct().GetFields(), "2")
+	assert.NotContains(t, data.String(), fakePassword)
+}
+
+func TestProtoWireTypesTruncated(t *testing.T) {
+	var encoded []byte
+	encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, "prince")
+	encoded = protowire.AppendTag(encoded, 3, protowire.Fixed32Type)
+	encoded = protowire.AppendFixed32(encoded, 3)
+	encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, fakePassword)
+
+	// A truncated body keeps the fields before the truncation.
+	fields, err := protoWireTypes(encoded[:len(encoded)-1])
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1": "bytes", "3": "fixed32"}, fields)
+
+	_, err = protoWireTypes([]byte{0xff})
+	assert.Error(t, err)
+}
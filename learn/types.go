@@ -22,6 +22,24 @@ type PartialWitness struct {
 
 	// Key used to pair this PartialWitness up with its counterpart.
 	PairKey akid.WitnessID
+
+	// Size of the HTTP body in bytes before any truncation. This is the size
+	// declared in the Content-Length header, if present, and the captured size
+	// otherwise.
+	BodySize_bytes int64
+
+	// True if this is a response that was captured while its body was still
+	// streaming, such as a long poll, so only part of the body was seen.
+	BodyOpen bool
+
+	// The method called, if this is a gRPC request. Zero otherwise.
+	GRPCMethod GRPCMethod
+
+	// If this is a WebSocket message, the side that sent it:
+	// WebSocketFromClient or WebSocketFromServer. Empty otherwise. A WebSocket
+	// message has no counterpart to pair with; messages from the client are
+	// recorded as requests, and messages from the server as responses.
+	WebSocketSender string
 }
 
 // Generates a v5 UUID as witness ID based on stream ID and seq.
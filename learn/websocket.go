@@ -0,0 +1,23 @@
+package learn
+
+import (
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Header added by the capture layer to a WebSocket message. Each message is
+// emitted as an HTTP request to the endpoint whose connection was upgraded,
+// with the message as its body, and this header set to the side that sent
+// it. The header is removed before the message is parsed.
+const WebSocketMessageHeader = "X-Postman-Insights-WebSocket-Message"
+
+// Values of WebSocketMessageHeader.
+const (
+	WebSocketFromClient = "client"
+	WebSocketFromServer = "server"
+)
+
+// Returns the side that sent the given request, if it is a WebSocket message
+// emitted by the capture layer, or the empty string otherwise.
+func WebSocketMessageSender(r akinet.HTTPRequest) string {
+	return r.Header.Get(WebSocketMessageHeader)
+}
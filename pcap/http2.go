@@ -0,0 +1,605 @@
+package pcap
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp2 "github.com/akitasoftware/akita-libs/akinet/http2"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	http2FrameHeaderLength = 9
+
+	// Largest frame that we parse. Peers may allow frames of up to 16 MiB, but
+	// in practice frames are at most the default of 16 KiB. This bounds how
+	// much is buffered for data that only looks like an HTTP/2 frame.
+	maxHTTP2FrameSize_bytes = 1 << 20
+
+	// Largest header block that we decode.
+	maxHTTP2HeaderBlockSize_bytes = 1 << 20
+
+	// Maximum number of messages being received on each side of a connection.
+	// Streams opened beyond this are ignored.
+	maxHTTP2OpenStreams = 1000
+
+	// Connections with no frames parsed for this long are forgotten.
+	http2ConnectionTimeout = 5 * time.Minute
+
+	// Maximum distance between the TCP sequence number at which a parser
+	// starts and the position reached on a side of a connection for the parser
+	// to be taken as continuing that side.
+	maxHTTP2SeqDistance = 1 << 20
+)
+
+var http2ClientPreface = []byte(http2.ClientPreface)
+
+var errUntrackedHTTP2Connection = errors.New("HTTP/2 frames on a connection whose start was not seen")
+
+// Tracks the cleartext HTTP/2 (h2c) connections being parsed, and is shared
+// by the HTTP/2 request and response parser factories.
+//
+// HTTP/2 frames can only be decoded in the context of their connection:
+// header blocks are compressed with HPACK, whose state spans the connection,
+// and requests and responses are split across frames that are interleaved
+// with those of other streams. The parsers created by the factories are
+// single-use, so the state of each connection is kept here instead. Because
+// Accepts and CreateParser aren't told which direction of the connection
+// they're parsing, it's inferred from TCP sequence numbers.
+type HTTP2Connections struct {
+	pool buffer_pool.BufferPool
+
+	mutex sync.Mutex
+	conns map[akinet.TCPBidiID]*http2Connection
+
+	// Number of connections tracked, readable without the lock.
+	numConns int32
+}
+
+// Creates a tracker whose request and response bodies will be allocated from
+// the given buffer pool.
+func NewHTTP2Connections(pool buffer_pool.BufferPool) *HTTP2Connections {
+	return &HTTP2Connections{
+		pool:  pool,
+		conns: map[akinet.TCPBidiID]*http2Connection{},
+	}
+}
+
+func (cs *HTTP2Connections) tracking() bool {
+	return atomic.LoadInt32(&cs.numConns) > 0
+}
+
+// Returns a factory for parsing HTTP/2 requests. It recognizes the client
+// connection preface, which starts the tracking of a connection, and emits
+// an akinet.HTTP2ConnectionPreface for it, followed by an akinet.HTTPRequest
+// for each request sent on the connection.
+//
+// Once a connection is tracked, its frames in either direction may be
+// accepted by either HTTP/2 factory; the parser works out the direction.
+func NewHTTP2RequestParserFactory(conns *HTTP2Connections) akinet.TCPParserFactory {
+	return http2RequestParserFactory{
+		conns:   conns,
+		preface: akihttp2.NewHTTP2PrefaceParserFactory(),
+	}
+}
+
+type http2RequestParserFactory struct {
+	conns   *HTTP2Connections
+	preface akinet.TCPParserFactory
+}
+
+func (http2RequestParserFactory) Name() string {
+	return "HTTP/2 Request Parser Factory"
+}
+
+func (f http2RequestParserFactory) Accepts(input memview.MemView, isEnd bool) (decision akinet.AcceptDecision, discardFront int64) {
+	decision, discardFront = f.preface.Accepts(input, isEnd)
+	if decision == akinet.Accept || !f.conns.tracking() {
+		return decision, discardFront
+	}
+	if frameDecision := acceptHTTP2Frame(input, isEnd, false); frameDecision != akinet.Reject {
+		return frameDecision, 0
+	}
+	return decision, discardFront
+}
+
+func (f http2RequestParserFactory) CreateParser(id akinet.TCPBidiID, seq, _ reassembly.Sequence) akinet.TCPParser {
+	return &http2Parser{conns: f.conns, bidiID: id, seq: seq}
+}
+
+// Returns a factory for parsing HTTP/2 responses. It recognizes the SETTINGS
+// frame that servers start connections with, so that connections are
+// tracked even if the server's side is seen first, and emits an
+// akinet.HTTPResponse for each response sent on the connection.
+func NewHTTP2ResponseParserFactory(conns *HTTP2Connections) akinet.TCPParserFactory {
+	return http2ResponseParserFactory{conns: conns}
+}
+
+type http2ResponseParserFactory struct {
+	conns *HTTP2Connections
+}
+
+func (http2ResponseParserFactory) Name() string {
+	return "HTTP/2 Response Parser Factory"
+}
+
+func (f http2ResponseParserFactory) Accepts(input memview.MemView, isEnd bool) (decision akinet.AcceptDecision, discardFront int64) {
+	decision = acceptHTTP2Frame(input, isEnd, !f.conns.tracking())
+	if decision == akinet.Reject {
+		return akinet.Reject, input.Len()
+	}
+	return decision, 0
+}
+
+func (f http2ResponseParserFactory) CreateParser(id akinet.TCPBidiID, seq, _ reassembly.Sequence) akinet.TCPParser {
+	return &http2Parser{conns: f.conns, bidiID: id, seq: seq}
+}
+
+// Checks whether the input starts with a plausible HTTP/2 frame header. If
+// settingsOnly is true, only a SETTINGS frame that isn't an acknowledgement,
+// which is what a server starts a connection with, is accepted.
+func acceptHTTP2Frame(input memview.MemView, isEnd bool, settingsOnly bool) akinet.AcceptDecision {
+	if input.Len() < http2FrameHeaderLength {
+		if isEnd {
+			return akinet.Reject
+		}
+		return akinet.NeedMoreData
+	}
+
+	length := input.GetUint24(0)
+	frameType := http2.FrameType(input.GetByte(3))
+	flags := http2.Flags(input.GetByte(4))
+	streamID := input.GetUint32(5)
+
+	if length > maxHTTP2FrameSize_bytes || streamID&(1<<31) != 0 {
+		return akinet.Reject
+	}
+
+	switch frameType {
+	case http2.FrameSettings:
+		if streamID != 0 || length%6 != 0 {
+			return akinet.Reject
+		}
+		if settingsOnly && flags != 0 {
+			return akinet.Reject
+		}
+		return akinet.Accept
+	case http2.FramePing, http2.FrameGoAway:
+		if streamID != 0 {
+			return akinet.Reject
+		}
+	case http2.FrameData, http2.FrameHeaders, http2.FramePriority, http2.FrameRSTStream, http2.FramePushPromise, http2.FrameContinuation:
+		if streamID == 0 {
+			return akinet.Reject
+		}
+	case http2.FrameWindowUpdate:
+	default:
+		return akinet.Reject
+	}
+
+	if settingsOnly {
+		return akinet.Reject
+	}
+	return akinet.Accept
+}
+
+// Parses HTTP/2 frames until a request or response is complete, updating the
+// state of the connection as it goes. Frames that don't complete a message,
+// such as SETTINGS and WINDOW_UPDATE, are consumed without a result.
+type http2Parser struct {
+	conns  *HTTP2Connections
+	bidiID akinet.TCPBidiID
+
+	// TCP sequence number of the first packet given to this parser.
+	seq reassembly.Sequence
+
+	// Side of the connection being parsed, once known.
+	side *http2Side
+
+	// Part of a frame or of the connection preface carried over from earlier
+	// input.
+	pending []byte
+
+	// Bytes in complete frames processed so far.
+	processed int
+
+	totalBytesConsumed int64
+}
+
+func (*http2Parser) Name() string {
+	return "HTTP/2 Parser"
+}
+
+func (p *http2Parser) Parse(input memview.MemView, isEnd bool) (result akinet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	p.totalBytesConsumed += input.Len()
+
+	data := append(p.pending, input.String()...)
+	consumed, result, err := p.conns.parse(p, data)
+	if err != nil {
+		return nil, memview.Empty(), p.totalBytesConsumed, err
+	}
+
+	if result != nil {
+		// Earlier input didn't complete a message, so the frame that did ends
+		// in the latest input.
+		unused = input.SubView(int64(consumed-len(p.pending)), input.Len())
+		return result, unused, p.totalBytesConsumed - unused.Len(), nil
+	}
+
+	// Like akinet's HTTP/2 preface parser, this may return a nil result at the
+	// end of the flow; a frame cut off by the end of capture is dropped.
+	p.pending = append([]byte(nil), data[consumed:]...)
+	return nil, memview.Empty(), p.totalBytesConsumed, nil
+}
+
+// State of a connection being parsed.
+type http2Connection struct {
+	bidiID akinet.TCPBidiID
+
+	// Indexed by http2Role.
+	sides [2]*http2Side
+
+	lastUsed time.Time
+}
+
+type http2Role int
+
+const (
+	http2Client http2Role = iota
+	http2Server
+)
+
+// State of one direction of a connection.
+type http2Side struct {
+	role http2Role
+
+	// Whether a parser has been seen for this side, and the TCP sequence
+	// number of the data it has parsed up to.
+	seen    bool
+	nextSeq reassembly.Sequence
+
+	// The framer reads from reader, which is reset to hold one frame at a time.
+	reader  *bytes.Reader
+	framer  *http2.Framer
+	decoder *hpack.Decoder
+
+	// Header block being received in a HEADERS frame and any CONTINUATION
+	// frames that follow it.
+	headerBlock           []byte
+	headerBlockEndsStream bool
+
+	// Messages being received, by stream ID.
+	messages map[uint32]*http2Message
+}
+
+// A request or response being received.
+type http2Message struct {
+	fields []hpack.HeaderField
+	body   buffer_pool.Buffer
+}
+
+func newHTTP2Connection(bidiID akinet.TCPBidiID) *http2Connection {
+	c := &http2Connection{bidiID: bidiID}
+	for _, role := range []http2Role{http2Client, http2Server} {
+		s := &http2Side{
+			role:     role,
+			reader:   bytes.NewReader(nil),
+			decoder:  hpack.NewDecoder(4096, nil),
+			messages: map[uint32]*http2Message{},
+		}
+		s.framer = http2.NewFramer(nil, s.reader)
+		s.framer.SetMaxReadFrameSize(maxHTTP2FrameSize_bytes)
+		c.sides[role] = s
+	}
+	return c
+}
+
+// Releases the bodies of messages still being received.
+func (c *http2Connection) release() {
+	for _, s := range c.sides {
+		for _, m := range s.messages {
+			m.body.Release()
+		}
+		s.messages = nil
+	}
+}
+
+// Returns the side that a parser starting at the given sequence number is
+// continuing, or the side not seen yet if neither is close.
+func (c *http2Connection) sideAt(seq reassembly.Sequence) *http2Side {
+	var closest, unseen *http2Side
+	closestDistance := 0
+	for _, s := range c.sides {
+		if !s.seen {
+			unseen = s
+			continue
+		}
+		distance := s.nextSeq.Difference(seq)
+		if distance < 0 {
+			distance = -distance
+		}
+		if closest == nil || distance < closestDistance {
+			closest, closestDistance = s, distance
+		}
+	}
+
+	if unseen != nil && (closest == nil || closestDistance > maxHTTP2SeqDistance) {
+		unseen.seen = true
+		return unseen
+	}
+	return closest
+}
+
+// Parses data for the given parser, which is the parser's pending data
+// followed by its latest input. Returns the number of bytes of data that
+// were processed, and the content of the first message completed.
+func (cs *HTTP2Connections) parse(p *http2Parser, data []byte) (int, akinet.ParsedNetworkContent, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	now := time.Now()
+	c := cs.conns[p.bidiID]
+
+	if p.side == nil {
+		if len(data) < len(http2ClientPreface) && bytes.HasPrefix(http2ClientPreface, data) {
+			return 0, nil, nil
+		}
+
+		if bytes.HasPrefix(data, http2ClientPreface) {
+			if c == nil {
+				c = cs.add(p.bidiID, now)
+			}
+			p.side = c.sides[http2Client]
+			p.side.seen = true
+			p.side.nextSeq = p.seq.Add(len(http2ClientPreface))
+			c.lastUsed = now
+			return len(http2ClientPreface), akinet.HTTP2ConnectionPreface{}, nil
+		}
+
+		if c == nil {
+			// A server starts its side of a connection with SETTINGS.
+			if len(data) < http2FrameHeaderLength {
+				return 0, nil, nil
+			}
+			if http2.FrameType(data[3]) != http2.FrameSettings || data[4] != 0 {
+				return 0, nil, errUntrackedHTTP2Connection
+			}
+			c = cs.add(p.bidiID, now)
+			p.side = c.sides[http2Server]
+			p.side.seen = true
+		} else {
+			p.side = c.sideAt(p.seq)
+		}
+	} else if c == nil {
+		// The connection timed out while this parser was waiting for data.
+		return 0, nil, errUntrackedHTTP2Connection
+	}
+	c.lastUsed = now
+
+	offset := 0
+	for len(data)-offset >= http2FrameHeaderLength {
+		length := int(data[offset])<<16 | int(data[offset+1])<<8 | int(data[offset+2])
+		if length > maxHTTP2FrameSize_bytes {
+			cs.remove(c)
+			return offset, nil, http2.ErrFrameTooLarge
+		}
+		end := offset + http2FrameHeaderLength + length
+		if end > len(data) {
+			break
+		}
+
+		result, err := cs.processFrame(c, p.side, data[offset:end])
+		p.processed += end - offset
+		p.side.nextSeq = p.seq.Add(p.processed)
+		offset = end
+		if err != nil {
+			return offset, nil, err
+		}
+		if result != nil {
+			return offset, result, nil
+		}
+	}
+	return offset, nil, nil
+}
+
+// Starts tracking a connection, forgetting any that have been idle too long.
+func (cs *HTTP2Connections) add(bidiID akinet.TCPBidiID, now time.Time) *http2Connection {
+	for _, c := range cs.conns {
+		if now.Sub(c.lastUsed) > http2ConnectionTimeout {
+			cs.remove(c)
+		}
+	}
+
+	c := newHTTP2Connection(bidiID)
+	c.lastUsed = now
+	cs.conns[bidiID] = c
+	atomic.StoreInt32(&cs.numConns, int32(len(cs.conns)))
+	return c
+}
+
+func (cs *HTTP2Connections) remove(c *http2Connection) {
+	c.release()
+	delete(cs.conns, c.bidiID)
+	atomic.StoreInt32(&cs.numConns, int32(len(cs.conns)))
+}
+
+// Processes a single frame sent by the given side of a connection. Returns
+// the content of the message it completes, if any. Errors that leave the
+// connection's state unusable stop its tracking.
+func (cs *HTTP2Connections) processFrame(c *http2Connection, s *http2Side, frame []byte) (akinet.ParsedNetworkContent, error) {
+	s.reader.Reset(frame)
+	f, err := s.framer.ReadFrame()
+	if err != nil {
+		cs.remove(c)
+		return nil, errors.Wrap(err, "malformed HTTP/2 frame")
+	}
+
+	switch f := f.(type) {
+	case *http2.SettingsFrame:
+		// Limits the size of the table used to compress the headers that the
+		// other side sends.
+		if v, ok := f.Value(http2.SettingHeaderTableSize); ok && !f.IsAck() {
+			c.sides[1-s.role].decoder.SetAllowedMaxDynamicTableSize(v)
+		}
+
+	case *http2.HeadersFrame:
+		s.headerBlockEndsStream = f.StreamEnded()
+		return cs.headerBlockFragment(c, s, f.StreamID, f.HeaderBlockFragment(), f.HeadersEnded())
+
+	case *http2.ContinuationFrame:
+		return cs.headerBlockFragment(c, s, f.StreamID, f.HeaderBlockFragment(), f.HeadersEnded())
+
+	case *http2.DataFrame:
+		m, ok := s.messages[f.StreamID]
+		if !ok {
+			// The headers weren't seen.
+			return nil, nil
+		}
+		// A body that doesn't fit in the buffer pool is truncated, as for
+		// HTTP/1.
+		m.body.Write(f.Data())
+		if f.StreamEnded() {
+			return c.complete(s, f.StreamID)
+		}
+
+	case *http2.RSTStreamFrame:
+		for _, side := range c.sides {
+			if m, ok := side.messages[f.StreamID]; ok {
+				m.body.Release()
+				delete(side.messages, f.StreamID)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (cs *HTTP2Connections) headerBlockFragment(c *http2Connection, s *http2Side, streamID uint32, fragment []byte, ended bool) (akinet.ParsedNetworkContent, error) {
+	if len(s.headerBlock)+len(fragment) > maxHTTP2HeaderBlockSize_bytes {
+		cs.remove(c)
+		return nil, errors.Errorf("HTTP/2 header block exceeds %d bytes", maxHTTP2HeaderBlockSize_bytes)
+	}
+	s.headerBlock = append(s.headerBlock, fragment...)
+	if !ended {
+		return nil, nil
+	}
+
+	// Every header block is decoded, even if the message is then ignored, to
+	// keep the decoder in step with the other side's encoder.
+	fields, err := s.decoder.DecodeFull(s.headerBlock)
+	s.headerBlock = s.headerBlock[:0]
+	if err != nil {
+		cs.remove(c)
+		return nil, errors.Wrap(err, "failed to decode HTTP/2 header block")
+	}
+
+	if _, ok := s.messages[streamID]; !ok {
+		if s.role == http2Server && isInformationalHTTP2Response(fields) {
+			// The final response follows.
+			return nil, nil
+		}
+		if len(s.messages) >= maxHTTP2OpenStreams {
+			return nil, nil
+		}
+		s.messages[streamID] = &http2Message{
+			fields: fields,
+			body:   cs.pool.NewBuffer(),
+		}
+	}
+	// Otherwise, these are trailers, which are ignored.
+
+	if s.headerBlockEndsStream {
+		return c.complete(s, streamID)
+	}
+	return nil, nil
+}
+
+func isInformationalHTTP2Response(fields []hpack.HeaderField) bool {
+	for _, f := range fields {
+		if f.Name == ":status" {
+			return strings.HasPrefix(f.Value, "1")
+		}
+	}
+	return false
+}
+
+// Returns the content of a message that has been received in full. The
+// stream ID distinguishes the pairs of requests and responses sent on the
+// connection.
+func (c *http2Connection) complete(s *http2Side, streamID uint32) (akinet.ParsedNetworkContent, error) {
+	m, ok := s.messages[streamID]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.messages, streamID)
+
+	header := make(http.Header, len(m.fields))
+	pseudo := map[string]string{}
+	for _, f := range m.fields {
+		if strings.HasPrefix(f.Name, ":") {
+			pseudo[f.Name] = f.Value
+		} else {
+			header.Add(f.Name, f.Value)
+		}
+	}
+
+	if s.role == http2Client {
+		method := pseudo[":method"]
+		if method == "" {
+			m.body.Release()
+			return nil, errors.Errorf("HTTP/2 request on stream %d has no method", streamID)
+		}
+
+		// CONNECT requests have no path.
+		u := &url.URL{}
+		if path := pseudo[":path"]; path != "" {
+			var err error
+			u, err = url.ParseRequestURI(path)
+			if err != nil {
+				m.body.Release()
+				return nil, errors.Wrapf(err, "invalid path in HTTP/2 request on stream %d", streamID)
+			}
+		}
+
+		host := pseudo[":authority"]
+		if host == "" {
+			host = header.Get("Host")
+		}
+
+		req := &http.Request{
+			Method:     method,
+			URL:        u,
+			Proto:      "HTTP/2.0",
+			ProtoMajor: 2,
+			Header:     header,
+			Host:       host,
+		}
+		return akinet.FromStdRequest(uuid.UUID(c.bidiID), int(streamID), req, m.body), nil
+	}
+
+	status, err := strconv.Atoi(pseudo[":status"])
+	if err != nil {
+		m.body.Release()
+		return nil, errors.Errorf("invalid status in HTTP/2 response on stream %d", streamID)
+	}
+	resp := &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     header,
+	}
+	return akinet.FromStdResponse(uuid.UUID(c.bidiID), int(streamID), resp, m.body), nil
+}
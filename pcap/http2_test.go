@@ -0,0 +1,253 @@
+package pcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Writes the frames sent by one side of an HTTP/2 connection.
+type http2TestWriter struct {
+	t       *testing.T
+	buf     bytes.Buffer
+	framer  *http2.Framer
+	headers bytes.Buffer
+	encoder *hpack.Encoder
+}
+
+func newHTTP2TestWriter(t *testing.T, preface bool) *http2TestWriter {
+	w := &http2TestWriter{t: t}
+	w.framer = http2.NewFramer(&w.buf, nil)
+	w.encoder = hpack.NewEncoder(&w.headers)
+	if preface {
+		w.buf.WriteString(http2.ClientPreface)
+	}
+	assert.NoError(t, w.framer.WriteSettings())
+	return w
+}
+
+// Encodes header fields given as name, value pairs. If split is true, the
+// header block is sent in a HEADERS frame and a CONTINUATION frame.
+func (w *http2TestWriter) writeHeaders(streamID uint32, endStream bool, split bool, fields ...string) {
+	w.headers.Reset()
+	for i := 0; i < len(fields); i += 2 {
+		assert.NoError(w.t, w.encoder.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]}))
+	}
+	block := w.headers.Bytes()
+
+	if !split {
+		assert.NoError(w.t, w.framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      streamID,
+			BlockFragment: block,
+			EndStream:     endStream,
+			EndHeaders:    true,
+		}))
+		return
+	}
+	assert.NoError(w.t, w.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: block[:len(block)/2],
+		EndStream:     endStream,
+	}))
+	assert.NoError(w.t, w.framer.WriteContinuation(streamID, true, block[len(block)/2:]))
+}
+
+func (w *http2TestWriter) writeData(streamID uint32, endStream bool, data string) {
+	assert.NoError(w.t, w.framer.WriteData(streamID, endStream, []byte(data)))
+}
+
+func newHTTP2TestFactories(t *testing.T) akinet.TCPParserFactorySelector {
+	pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := NewHTTP2Connections(pool)
+	return akinet.TCPParserFactorySelector{
+		NewHTTP2RequestParserFactory(conns),
+		NewHTTP2ResponseParserFactory(conns),
+	}
+}
+
+// Parses the data sent in one direction of a connection, as tcpFlow does
+// when it all arrives at once, starting at the given sequence number.
+func parseHTTP2Flow(t *testing.T, facts akinet.TCPParserFactorySelector, bidiID akinet.TCPBidiID, seq reassembly.Sequence, data []byte) []akinet.ParsedNetworkContent {
+	var results []akinet.ParsedNetworkContent
+	input := memview.New(data)
+	for input.Len() > 0 {
+		fact, decision, discardFront := facts.Select(input, true)
+		if !assert.Equal(t, akinet.Accept, decision) {
+			return results
+		}
+		assert.Zero(t, discardFront)
+
+		result, unused, _, err := fact.CreateParser(bidiID, seq, 0).Parse(input, true)
+		if !assert.NoError(t, err) || result == nil {
+			return results
+		}
+		results = append(results, result)
+		seq = seq.Add(int(input.Len() - unused.Len()))
+		input = unused
+	}
+	return results
+}
+
+func TestHTTP2RequestAndResponse(t *testing.T) {
+	facts := newHTTP2TestFactories(t)
+	bidiID := akinet.TCPBidiID(uuid.New())
+
+	client := newHTTP2TestWriter(t, true)
+	client.writeHeaders(1, false, false,
+		":method", "POST",
+		":scheme", "http",
+		":authority", "pets.example.com",
+		":path", "/v1/pets?kind=cat",
+		"content-type", "application/json",
+		"cookie", "a=1",
+		"cookie", "b=2",
+	)
+	client.writeData(1, false, `{"name":`)
+	client.writeData(1, true, `"Tom"}`)
+
+	server := newHTTP2TestWriter(t, false)
+	server.writeHeaders(1, false, false, ":status", "100")
+	server.writeHeaders(1, false, false,
+		":status", "201",
+		"content-type", "application/json",
+	)
+	server.writeData(1, true, `{"id":1}`)
+
+	requests := parseHTTP2Flow(t, facts, bidiID, 1000, client.buf.Bytes())
+	responses := parseHTTP2Flow(t, facts, bidiID, 5000000, server.buf.Bytes())
+	if !assert.Len(t, requests, 2) || !assert.Len(t, responses, 1) {
+		return
+	}
+	assert.Equal(t, akinet.HTTP2ConnectionPreface{}, requests[0])
+
+	req, ok := requests[1].(akinet.HTTPRequest)
+	if assert.True(t, ok) {
+		defer req.ReleaseBuffers()
+		assert.Equal(t, uuid.UUID(bidiID), req.StreamID)
+		assert.Equal(t, 1, req.Seq)
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, 2, req.ProtoMajor)
+		assert.Equal(t, "/v1/pets", req.URL.Path)
+		assert.Equal(t, "kind=cat", req.URL.RawQuery)
+		assert.Equal(t, "pets.example.com", req.Host)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Len(t, req.Cookies, 2)
+		assert.Equal(t, `{"name":"Tom"}`, req.Body.String())
+	}
+
+	resp, ok := responses[0].(akinet.HTTPResponse)
+	if assert.True(t, ok) {
+		defer resp.ReleaseBuffers()
+		assert.Equal(t, req.GetStreamKey(), resp.GetStreamKey())
+		assert.Equal(t, 201, resp.StatusCode)
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `{"id":1}`, resp.Body.String())
+	}
+}
+
+func TestHTTP2MultiplexedStreams(t *testing.T) {
+	facts := newHTTP2TestFactories(t)
+	bidiID := akinet.TCPBidiID(uuid.New())
+
+	// Stream 3 completes before stream 1. The second header block refers to
+	// fields indexed by the first, and is split across frames.
+	client := newHTTP2TestWriter(t, true)
+	client.writeHeaders(1, false, false,
+		":method", "POST",
+		":scheme", "http",
+		":authority", "pets.example.com",
+		":path", "/v1/pets",
+		"x-request-id", "one",
+	)
+	client.writeHeaders(3, true, true,
+		":method", "GET",
+		":scheme", "http",
+		":authority", "pets.example.com",
+		":path", "/v1/pets/1",
+		"x-request-id", "three",
+	)
+	assert.NoError(t, client.framer.WriteWindowUpdate(0, 1024))
+	client.writeData(1, true, "{}")
+
+	// Parse the server's side first.
+	server := newHTTP2TestWriter(t, false)
+	server.writeHeaders(3, true, false, ":status", "200")
+	server.writeHeaders(1, true, false, ":status", "204")
+
+	responses := parseHTTP2Flow(t, facts, bidiID, 5000000, server.buf.Bytes())
+	requests := parseHTTP2Flow(t, facts, bidiID, 1000, client.buf.Bytes())
+	if !assert.Len(t, requests, 3) || !assert.Len(t, responses, 2) {
+		return
+	}
+
+	keys := map[string]string{}
+	for _, r := range requests[1:] {
+		req := r.(akinet.HTTPRequest)
+		keys[req.GetStreamKey()] = req.Header.Get("X-Request-Id")
+		req.ReleaseBuffers()
+	}
+	assert.Equal(t, "three", requests[1].(akinet.HTTPRequest).Header.Get("X-Request-Id"))
+	assert.Equal(t, "/v1/pets/1", requests[1].(akinet.HTTPRequest).URL.Path)
+	assert.Equal(t, "one", requests[2].(akinet.HTTPRequest).Header.Get("X-Request-Id"))
+
+	for _, r := range responses {
+		resp := r.(akinet.HTTPResponse)
+		resp.ReleaseBuffers()
+		switch resp.StatusCode {
+		case 200:
+			assert.Equal(t, "three", keys[resp.GetStreamKey()])
+		case 204:
+			assert.Equal(t, "one", keys[resp.GetStreamKey()])
+		default:
+			t.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTP2Accepts(t *testing.T) {
+	facts := newHTTP2TestFactories(t)
+	requestFactory, responseFactory := facts[0], facts[1]
+
+	var settings, headers bytes.Buffer
+	assert.NoError(t, http2.NewFramer(&settings, nil).WriteSettings())
+	assert.NoError(t, http2.NewFramer(&headers, nil).WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: []byte{0x82},
+		EndHeaders:    true,
+	}))
+
+	// Short inputs could still be the start of a client preface.
+	testCases := []struct {
+		name             string
+		input            []byte
+		request          akinet.AcceptDecision
+		response         akinet.AcceptDecision
+		responseDiscards int64
+	}{
+		{"preface", []byte(http2.ClientPreface), akinet.Accept, akinet.Reject, 24},
+		{"server settings", settings.Bytes(), akinet.NeedMoreData, akinet.Accept, 0},
+		{"untracked headers", headers.Bytes(), akinet.NeedMoreData, akinet.Reject, int64(headers.Len())},
+		{"TLS", bytes.Repeat([]byte{0x16, 0x03, 0x01}, 11), akinet.Reject, akinet.Reject, 33},
+		{"partial frame", settings.Bytes()[:4], akinet.NeedMoreData, akinet.NeedMoreData, 0},
+	}
+	for _, c := range testCases {
+		decision, _ := requestFactory.Accepts(memview.New(c.input), false)
+		assert.Equal(t, c.request, decision, c.name)
+
+		decision, discardFront := responseFactory.Accepts(memview.New(c.input), false)
+		assert.Equal(t, c.response, decision, c.name)
+		assert.Equal(t, c.responseDiscards, discardFront, c.name)
+	}
+}
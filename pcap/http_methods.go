@@ -0,0 +1,132 @@
+package pcap
+
+import (
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/gopacket/reassembly"
+)
+
+const (
+	// Bounds on the length of an HTTP method that we recognize. The shortest
+	// standard method is GET; the upper bound leaves room for extension methods
+	// such as VERSION-CONTROL (RFC 3253).
+	minHTTPMethodLength = 3
+	maxHTTPMethodLength = 20
+
+	// Maximum request URI length that we accept, matching the HTTP/1 parser in
+	// akinet.
+	maxHTTPRequestURILength = 4000
+)
+
+// Returns a factory for parsing HTTP/1.x requests whose bodies will be
+// allocated from the given buffer pool.
+//
+// Unlike akinet's request parser factory, which only recognizes the standard
+// methods, this accepts any method made of uppercase letters, digits, and
+// hyphens, so that requests using extension methods, such as PURGE or MKCOL,
+// are parsed into witnesses too. Parsing is delegated to akinet.
+func NewHTTPRequestParserFactory(pool buffer_pool.BufferPool) akinet.TCPParserFactory {
+	return httpRequestParserFactory{
+		parserFactory: akihttp.NewHTTPRequestParserFactory(pool),
+	}
+}
+
+type httpRequestParserFactory struct {
+	parserFactory akinet.TCPParserFactory
+}
+
+func (f httpRequestParserFactory) Name() string {
+	return f.parserFactory.Name()
+}
+
+func (httpRequestParserFactory) Accepts(input memview.MemView, isEnd bool) (decision akinet.AcceptDecision, discardFront int64) {
+	defer func() {
+		if decision == akinet.NeedMoreData && isEnd {
+			decision = akinet.Reject
+			discardFront = input.Len()
+		}
+	}()
+
+	// Look for a method at the start of each run of method characters.
+	for start := int64(0); start < input.Len(); {
+		if !isHTTPMethodStart(input.GetByte(start)) {
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < input.Len() && isHTTPMethodByte(input.GetByte(end)) {
+			end++
+		}
+
+		if end == input.Len() {
+			// The method may continue in data yet to come.
+			if end-start <= maxHTTPMethodLength {
+				return akinet.NeedMoreData, start
+			}
+			break
+		}
+
+		if length := end - start; minHTTPMethodLength <= length && length <= maxHTTPMethodLength {
+			switch hasValidHTTPRequestLine(input.SubView(end, input.Len())) {
+			case akinet.Accept:
+				return akinet.Accept, start
+			case akinet.NeedMoreData:
+				return akinet.NeedMoreData, start
+			}
+		}
+		start = end
+	}
+
+	return akinet.Reject, input.Len()
+}
+
+func (f httpRequestParserFactory) CreateParser(id akinet.TCPBidiID, seq, ack reassembly.Sequence) akinet.TCPParser {
+	return f.parserFactory.CreateParser(id, seq, ack)
+}
+
+// Methods start with a letter.
+func isHTTPMethodStart(b byte) bool {
+	return 'A' <= b && b <= 'Z'
+}
+
+func isHTTPMethodByte(b byte) bool {
+	return isHTTPMethodStart(b) || ('0' <= b && b <= '9') || b == '-'
+}
+
+// Checks whether there is a valid HTTP request line as defined in RFC 2616
+// Section 5. The input should start right after the HTTP method.
+func hasValidHTTPRequestLine(input memview.MemView) akinet.AcceptDecision {
+	if input.Len() == 0 {
+		return akinet.NeedMoreData
+	}
+
+	// A space separates the HTTP method from Request-URI.
+	if input.GetByte(0) != ' ' {
+		return akinet.Reject
+	}
+
+	nextSP := input.Index(1, []byte(" "))
+	if nextSP < 0 {
+		// Could be dealing with a very long request URI.
+		if input.Len()-1 > maxHTTPRequestURILength {
+			return akinet.Reject
+		}
+		return akinet.NeedMoreData
+	} else if nextSP == 1 {
+		return akinet.Reject
+	}
+
+	// Need at least 10 bytes to get the HTTP version on tail of the request line,
+	// for example `HTTP/1.x\r\n`
+	tail := input.SubView(nextSP+1, input.Len())
+	if tail.Len() < 10 {
+		return akinet.NeedMoreData
+	}
+	if tail.Index(0, []byte("HTTP/1.1\r\n")) == 0 || tail.Index(0, []byte("HTTP/1.0\r\n")) == 0 {
+		return akinet.Accept
+	}
+	return akinet.Reject
+}
@@ -0,0 +1,87 @@
+package pcap
+
+import (
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/google/gopacket"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRequestParserFactoryAccepts(t *testing.T) {
+	testCases := []struct {
+		input            string
+		isEnd            bool
+		expectedDecision akinet.AcceptDecision
+		expectedDiscard  int64
+	}{
+		{"GET / HTTP/1.1\r\n", false, akinet.Accept, 0},
+		{"PURGE /cache/doggos HTTP/1.1\r\n", false, akinet.Accept, 0},
+		{"VERSION-CONTROL /doc HTTP/1.0\r\n", false, akinet.Accept, 0},
+		{"garbage\r\nMKCOL /dir/ HTTP/1.1\r\n", false, akinet.Accept, 9},
+
+		// The method or request line may be incomplete.
+		{"PUR", false, akinet.NeedMoreData, 0},
+		{"xyzLOCK /doc", false, akinet.NeedMoreData, 3},
+		{"LOCK /doc", true, akinet.Reject, 9},
+
+		// Not request lines.
+		{"purge / HTTP/1.1\r\n", false, akinet.Reject, 18},
+		{"GO / HTTP/1.1\r\n", false, akinet.Reject, 15},
+		{"PURGE / HTTP/2.0\r\n", false, akinet.Reject, 18},
+		{"HTTP/1.1 200 OK\r\n", false, akinet.Reject, 17},
+	}
+
+	f := NewHTTPRequestParserFactory(nil)
+	for _, tc := range testCases {
+		decision, discard := f.Accepts(memview.New([]byte(tc.input)), tc.isEnd)
+		assert.Equal(t, tc.expectedDecision, decision, tc.input)
+		assert.Equal(t, tc.expectedDiscard, discard, tc.input)
+	}
+}
+
+func TestHTTPExtensionMethod(t *testing.T) {
+	pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "PURGE /cache/doggos HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	pkts := []gopacket.Packet{CreatePacket(ip1, ip2, port1, port2, []byte(input))}
+
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	out, err := setupParseFromInterface(fakePcap(pkts), closeChan, NewHTTPRequestParserFactory(pool))
+	if err != nil {
+		t.Fatalf("unexpected error setting up listener: %v", err)
+	}
+
+	var actual []akinet.ParsedNetworkTraffic
+	for pnt := range out {
+		actual = append(actual, pnt)
+	}
+	if !assert.Len(t, actual, 1) {
+		return
+	}
+	defer actual[0].Content.ReleaseBuffers()
+
+	req, ok := actual[0].Content.(akinet.HTTPRequest)
+	if !assert.True(t, ok, "expected an HTTP request, got %T", actual[0].Content) {
+		return
+	}
+	assert.Equal(t, "PURGE", req.Method)
+
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	meta := spec_util.HTTPMetaFromMethod(partial.Witness.GetMethod())
+	if assert.NotNil(t, meta) {
+		assert.Equal(t, "PURGE", meta.GetMethod())
+		assert.Equal(t, "/cache/doggos", meta.GetPathTemplate())
+	}
+}
@@ -59,6 +59,10 @@ type tcpStreamFactory struct {
 	clock   clockWrapper
 	fs      akinet.TCPParserFactorySelector
 	outChan chan<- akinet.ParsedNetworkTraffic
+
+	// Streams whose reassembly is not yet complete. Only accessed from the
+	// goroutine that drives the assembler.
+	streams map[*tcpStream]struct{}
 }
 
 func newTCPStreamFactory(clock clockWrapper, outChan chan<- akinet.ParsedNetworkTraffic, fs akinet.TCPParserFactorySelector) *tcpStreamFactory {
@@ -66,11 +70,15 @@ func newTCPStreamFactory(clock clockWrapper, outChan chan<- akinet.ParsedNetwork
 		clock:   clock,
 		fs:      fs,
 		outChan: outChan,
+		streams: make(map[*tcpStream]struct{}),
 	}
 }
 
 func (fact *tcpStreamFactory) New(netFlow, tcpFlow gopacket.Flow, _ *layers.TCP, _ reassembly.AssemblerContext) reassembly.Stream {
-	return newTCPStream(fact.clock, netFlow, fact.outChan, fact.fs)
+	s := newTCPStream(fact.clock, netFlow, fact.outChan, fact.fs)
+	fact.streams[s] = struct{}{}
+	s.onComplete = func() { delete(fact.streams, s) }
+	return s
 }
 
 // NetworkTrafficObserver is the callback function type for observing
@@ -82,6 +90,11 @@ type NetworkTrafficParser struct {
 	clock       clockWrapper
 	observer    NetworkTrafficObserver // This function is called for every packet.
 	bufferShare float32
+
+	// The maximum time an HTTP response may stay open after its headers arrive
+	// before it is emitted with the part of its body seen so far. Zero disables
+	// the timeout.
+	streamingResponseTimeout time.Duration
 }
 
 func NewNetworkTrafficParser(bufferShare float32) *NetworkTrafficParser {
@@ -99,6 +112,17 @@ func (p *NetworkTrafficParser) InstallObserver(observer NetworkTrafficObserver)
 	p.observer = observer
 }
 
+// Sets the maximum time an HTTP response may stay open after its headers
+// arrive before it is emitted with the part of its body seen so far. This
+// keeps streaming and long-poll responses, whose bodies may never end, from
+// leaving their requests unpaired. Zero, the default, disables the timeout.
+//
+// This should be well under the time the upper layers wait to pair a request
+// with its response. Should be called before starting ParseFromInterface.
+func (p *NetworkTrafficParser) SetStreamingResponseTimeout(timeout time.Duration) {
+	p.streamingResponseTimeout = timeout
+}
+
 // Parses network traffic from an interface.
 // This function will attempt to parse the traffic with the highest level of
 // protocol details as possible. For instance, it will try to piece together
@@ -182,6 +206,14 @@ func (p *NetworkTrafficParser) ParseFromInterface(interfaceName, bpfFilter strin
 				if flushed != 0 || closed != 0 {
 					printer.Debugf("%d flushed, %d closed\n", flushed, closed)
 				}
+
+				// Emit responses that have been streaming for too long, so they can
+				// be paired with their requests before the requests are flushed.
+				if p.streamingResponseTimeout > 0 {
+					if n := streamFactory.finishOpenResponses(now.Add(-p.streamingResponseTimeout)); n > 0 {
+						printer.Debugf("%d streaming responses emitted with their bodies open\n", n)
+					}
+				}
 			}
 		}
 	}()
@@ -171,6 +171,34 @@ func TestTCPBidiStream(t *testing.T) {
 	}
 }
 
+func TestTCPBidiStreamIPv6(t *testing.T) {
+	client := &testEndpoint{net.ParseIP("2001:db8::1"), port1}
+	server := &testEndpoint{net.ParseIP("2001:db8::2"), port2}
+	msg := &testMessage{client, server, []byte("prince|hello over ipv6|")}
+	msgResp := &testMessage{server, client, []byte("prince|goodbye over ipv6|")}
+
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	out, err := setupParseFromInterface(fakePcap(makeTCPPackets(2, msg, msgResp)), closeChan, princeParserFactory{})
+	if err != nil {
+		t.Fatalf("unexpected error setting up listener: %v", err)
+	}
+
+	actual := map[string][]akinet.ParsedNetworkContent{}
+	for nt := range out {
+		e := &testEndpoint{ip: nt.SrcIP, port: nt.SrcPort}
+		actual[e.String()] = append(actual[e.String()], nt.Content)
+	}
+
+	expected := map[string][]akinet.ParsedNetworkContent{
+		client.String(): {akinet.AkitaPrince("hello over ipv6")},
+		server.String(): {akinet.AkitaPrince("goodbye over ipv6")},
+	}
+	if diff := netParseCmp(expected, actual); diff != "" {
+		t.Errorf("reassembled data mismatch: %s", diff)
+	}
+}
+
 // If we can't parse any higher level protocol out of a TCP flow, we should
 // automatically fallback to output raw bytes.
 func TestTCPFallbackToRaw(t *testing.T) {
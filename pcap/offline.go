@@ -0,0 +1,149 @@
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+)
+
+// Magic number at the start of a pcapng file.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// Reads all packets from a pcap or pcapng file into memory.
+func ReadPacketFile(path string) ([]gopacket.Packet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(pcapngMagic))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	var source *gopacket.PacketSource
+	if bytes.Equal(magic, pcapngMagic) {
+		ngReader, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read pcapng file %s", path)
+		}
+		source = gopacket.NewPacketSource(ngReader, ngReader.LinkType())
+	} else {
+		reader, err := pcapgo.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read pcap file %s", path)
+		}
+		source = gopacket.NewPacketSource(reader, reader.LinkType())
+	}
+
+	var packets []gopacket.Packet
+	for {
+		packet, err := source.NextPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read packet %d from %s", len(packets)+1, path)
+		}
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+// Parses the given packets in the same way as Collect, and sends the results
+// to proc. Packets are processed as quickly as possible, and timeouts are
+// measured against the times at which packets were captured. Returns once
+// all packets have been processed.
+func Replay(packets []gopacket.Packet, parseTCPAndTLS bool, captureWebSocket bool, proc trace.Collector, pool buffer_pool.BufferPool) error {
+	defer proc.Close()
+
+	clock := &replayClock{}
+	parser := NewNetworkTrafficParser(1.0)
+	parser.pcap = packetReplay{packets: packets, clock: clock}
+	parser.clock = clock
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	parsedChan, err := parser.ParseFromInterface("replay", "", stop, newParserFactories(pool, parseTCPAndTLS, captureWebSocket)...)
+	if err != nil {
+		return errors.Wrap(err, "couldn't start parsing packets")
+	}
+
+	for t := range parsedChan {
+		err := proc.Process(t)
+		t.Content.ReleaseBuffers()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implements pcapWrapper by replaying packets held in memory.
+type packetReplay struct {
+	packets []gopacket.Packet
+
+	// Advanced to the capture time of each packet as it is replayed.
+	clock *replayClock
+}
+
+func (r packetReplay) capturePackets(done <-chan struct{}, _, _ string) (<-chan gopacket.Packet, error) {
+	out := make(chan gopacket.Packet, 10)
+	go func() {
+		defer close(out)
+		for _, p := range r.packets {
+			if md := p.Metadata(); md != nil {
+				r.clock.advance(md.Timestamp)
+			}
+			select {
+			case <-done:
+				return
+			case out <- p:
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (packetReplay) getInterfaceAddrs(string) ([]net.IP, error) {
+	return nil, nil
+}
+
+// A clock that reports the capture time of the latest packet replayed, so
+// that replaying old captures doesn't time out every stream. Safe for
+// concurrent use.
+type replayClock struct {
+	latest_ns int64
+}
+
+func (c *replayClock) advance(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	ns := t.UnixNano()
+	for {
+		old := atomic.LoadInt64(&c.latest_ns)
+		if ns <= old || atomic.CompareAndSwapInt64(&c.latest_ns, old, ns) {
+			return
+		}
+	}
+}
+
+func (c *replayClock) Now() time.Time {
+	if ns := atomic.LoadInt64(&c.latest_ns); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Now()
+}
@@ -11,17 +11,33 @@ func CreatePacket(src, dst net.IP, srcPort, dstPort int, payload []byte) gopacke
 	return CreatePacketWithSeq(src, dst, srcPort, dstPort, payload, 0)
 }
 
-func createPacketLayers(src, dst net.IP, srcPort, dstPort int, seq uint32) (*layers.Ethernet, *layers.IPv4, *layers.TCP) {
+// Returns the Ethernet and IP layers of a packet between the given addresses,
+// using IPv6 if the source address is not an IPv4 address.
+func createNetworkLayers(src, dst net.IP, protocol layers.IPProtocol) (*layers.Ethernet, gopacket.SerializableLayer) {
 	ethernetLayer := &layers.Ethernet{
 		EthernetType: layers.EthernetTypeIPv4,
 		SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
 		DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
 	}
-	ipLayer := &layers.IPv4{
-		Protocol: layers.IPProtocolTCP,
+	if src.To4() == nil {
+		ethernetLayer.EthernetType = layers.EthernetTypeIPv6
+		return ethernetLayer, &layers.IPv6{
+			Version:    6,
+			NextHeader: protocol,
+			HopLimit:   64,
+			SrcIP:      src,
+			DstIP:      dst,
+		}
+	}
+	return ethernetLayer, &layers.IPv4{
+		Protocol: protocol,
 		SrcIP:    src,
 		DstIP:    dst,
 	}
+}
+
+func createPacketLayers(src, dst net.IP, srcPort, dstPort int, seq uint32) (*layers.Ethernet, gopacket.SerializableLayer, *layers.TCP) {
+	ethernetLayer, ipLayer := createNetworkLayers(src, dst, layers.IPProtocolTCP)
 	tcpLayer := &layers.TCP{
 		SrcPort: layers.TCPPort(srcPort),
 		DstPort: layers.TCPPort(dstPort),
@@ -63,16 +79,7 @@ func CreatePacketWithSeq(src, dst net.IP, srcPort, dstPort int, payload []byte,
 }
 
 func CreateUDPPacket(src, dst net.IP, srcPort, dstPort int, payload []byte) gopacket.Packet {
-	ethernetLayer := &layers.Ethernet{
-		EthernetType: layers.EthernetTypeIPv4,
-		SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
-		DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
-	}
-	ipLayer := &layers.IPv4{
-		Protocol: layers.IPProtocolUDP,
-		SrcIP:    src,
-		DstIP:    dst,
-	}
+	ethernetLayer, ipLayer := createNetworkLayers(src, dst, layers.IPProtocolUDP)
 	udpLayer := &layers.UDP{
 		SrcPort: layers.UDPPort(srcPort),
 		DstPort: layers.UDPPort(dstPort),
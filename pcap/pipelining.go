@@ -0,0 +1,81 @@
+package pcap
+
+import (
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Maximum number of ack numbers tracked per connection. Requests whose
+// responses are never seen would otherwise accumulate on long-lived
+// connections.
+const maxPipelineBatches = 64
+
+// Pairs pipelined HTTP/1.x requests with their responses.
+//
+// Requests and responses on a connection are paired by a key derived from TCP
+// sequence numbers: a request is keyed by the ack number on its first
+// segment, which equals the seq number of its response when the client waits
+// for each response before sending another request. Pipelined requests are
+// sent before the earlier responses arrive, so they all carry the same ack
+// number and would be paired with one another. HTTP/1.1 requires responses to
+// be sent in the order the requests were received, so the nth request sharing
+// an ack number is paired with the nth response from that seq number on.
+//
+// Shared by the two flows of a connection, which are reassembled on the same
+// goroutine, so requests are seen before their responses.
+type httpPipeline struct {
+	// For each ack number, the number of requests seen with it.
+	requests map[int]int
+
+	// The ack number of the requests whose responses are being seen, and the
+	// number of those responses seen so far. Zero responses if there is no
+	// such batch.
+	batch     int
+	responses int
+}
+
+// Returns the given content, with the key of a pipelined HTTP/1.x request or
+// response rewritten so that it pairs with its counterpart.
+func (p *httpPipeline) rekey(c akinet.ParsedNetworkContent) akinet.ParsedNetworkContent {
+	switch m := c.(type) {
+	case akinet.HTTPRequest:
+		if m.ProtoMajor != 1 {
+			return c
+		}
+		if p.requests == nil || len(p.requests) >= maxPipelineBatches {
+			p.requests = map[int]int{}
+			p.responses = 0
+		}
+		n := p.requests[m.Seq]
+		p.requests[m.Seq] = n + 1
+		m.Seq = pipelinedSeq(m.Seq, n)
+		return m
+
+	case akinet.HTTPResponse:
+		if m.ProtoMajor != 1 {
+			return c
+		}
+		if _, ok := p.requests[m.Seq]; ok {
+			// The first response to a batch of requests.
+			if p.responses > 0 && p.batch != m.Seq {
+				delete(p.requests, p.batch)
+			}
+			p.batch = m.Seq
+			p.responses = 1
+			return m
+		}
+		if p.responses > 0 && p.responses < p.requests[p.batch] {
+			m.Seq = pipelinedSeq(p.batch, p.responses)
+			p.responses++
+			return m
+		}
+	}
+	return c
+}
+
+// Returns the key of the nth request, counting from zero, sent with the given
+// ack number. The first request keeps the ack number, so exchanges that
+// aren't pipelined are keyed as before. Later ones are offset beyond the
+// range of TCP sequence numbers, so they can't collide with other keys.
+func pipelinedSeq(ack int, n int) int {
+	return ack + n<<32
+}
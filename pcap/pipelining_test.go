@@ -0,0 +1,137 @@
+package pcap
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func createPacketWithSeqAndAck(src, dst net.IP, srcPort, dstPort int, payload []byte, seq, ack uint32) gopacket.Packet {
+	ethernetLayer, ipLayer, tcpLayer := createPacketLayers(src, dst, srcPort, dstPort, seq)
+	tcpLayer.Ack = ack
+	tcpLayer.ACK = true
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	gopacket.SerializeLayers(buffer, opts, ethernetLayer, ipLayer, tcpLayer, gopacket.Payload(payload))
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func pipelinedRequest(path string) string {
+	return fmt.Sprintf("GET %s HTTP/1.1\r\nHost: example.com\r\n\r\n", path)
+}
+
+func pipelinedResponse(path string) string {
+	return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(path), path)
+}
+
+// Builds a connection on which each batch of requests is sent before any of
+// their responses, and the responses then arrive in order.
+func makePipelinedPackets(batches [][]string) []gopacket.Packet {
+	pkts := []gopacket.Packet{
+		CreateTCPSYN(ip1, ip2, port1, port2, 0),
+		CreateTCPSYNAndACK(ip2, ip1, port2, port1, 0),
+	}
+	clientSeq, serverSeq := uint32(1), uint32(1)
+	for _, paths := range batches {
+		for _, path := range paths {
+			req := []byte(pipelinedRequest(path))
+			pkts = append(pkts, createPacketWithSeqAndAck(ip1, ip2, port1, port2, req, clientSeq, serverSeq))
+			clientSeq += uint32(len(req))
+		}
+		for _, path := range paths {
+			resp := []byte(pipelinedResponse(path))
+			pkts = append(pkts, createPacketWithSeqAndAck(ip2, ip1, port2, port1, resp, serverSeq, clientSeq))
+			serverSeq += uint32(len(resp))
+		}
+	}
+	return pkts
+}
+
+func TestHTTPPipelining(t *testing.T) {
+	testCases := []struct {
+		name    string
+		batches [][]string
+	}{
+		{
+			name:    "not pipelined",
+			batches: [][]string{{"/a"}, {"/b"}, {"/c"}},
+		},
+		{
+			name:    "two pipelined",
+			batches: [][]string{{"/a", "/b"}},
+		},
+		{
+			name:    "three pipelined",
+			batches: [][]string{{"/a", "/b", "/c"}},
+		},
+		{
+			name:    "pipelined then not",
+			batches: [][]string{{"/a", "/b"}, {"/c"}, {"/d", "/e", "/f"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			closeChan := make(chan struct{})
+			defer close(closeChan)
+			out, err := setupParseFromInterface(
+				fakePcap(makePipelinedPackets(tc.batches)),
+				closeChan,
+				akihttp.NewHTTPRequestParserFactory(pool),
+				akihttp.NewHTTPResponseParserFactory(pool),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error setting up listener: %v", err)
+			}
+
+			// Pair requests and responses by their keys, as the backend collector
+			// does.
+			requests := map[akinet.TCPBidiID]map[int]string{}
+			responses := map[akinet.TCPBidiID]map[int]string{}
+			for pnt := range out {
+				switch c := pnt.Content.(type) {
+				case akinet.HTTPRequest:
+					id := akinet.TCPBidiID(c.StreamID)
+					if requests[id] == nil {
+						requests[id] = map[int]string{}
+					}
+					assert.NotContains(t, requests[id], c.Seq, "duplicate request key")
+					requests[id][c.Seq] = c.URL.Path
+				case akinet.HTTPResponse:
+					id := akinet.TCPBidiID(c.StreamID)
+					if responses[id] == nil {
+						responses[id] = map[int]string{}
+					}
+					assert.NotContains(t, responses[id], c.Seq, "duplicate response key")
+					responses[id][c.Seq] = c.Body.String()
+				}
+				pnt.Content.ReleaseBuffers()
+			}
+
+			count := 0
+			for id, reqs := range requests {
+				for seq, path := range reqs {
+					assert.Equal(t, path, responses[id][seq], "response paired with request for %s", path)
+					count++
+				}
+			}
+			expected := 0
+			for _, paths := range tc.batches {
+				expected += len(paths)
+			}
+			assert.Equal(t, expected, count)
+		})
+	}
+}
@@ -1,9 +1,10 @@
 package pcap
 
 import (
+	"time"
+
 	"github.com/akitasoftware/akita-libs/akinet"
 	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
-	akihttp2 "github.com/akitasoftware/akita-libs/akinet/http2"
 	"github.com/akitasoftware/akita-libs/akinet/tls"
 	"github.com/akitasoftware/akita-libs/buffer_pool"
 	. "github.com/akitasoftware/akita-libs/client_telemetry"
@@ -19,31 +20,34 @@ func Collect(
 	bpfFilter string,
 	bufferShare float32,
 	parseTCPAndTLS bool,
+	captureWebSocket bool,
+	streamingResponseTimeout time.Duration,
 	proc trace.Collector,
 	packetCount trace.PacketCountConsumer,
 	pool buffer_pool.BufferPool,
+	sentinel *Sentinel,
+	tcpHealth *TCPHealth,
 ) error {
 	defer proc.Close()
 
-	facts := []akinet.TCPParserFactory{
-		akihttp.NewHTTPRequestParserFactory(pool),
-		akihttp.NewHTTPResponseParserFactory(pool),
-		akihttp2.NewHTTP2PrefaceParserFactory(),
-	}
-	if parseTCPAndTLS {
-		facts = append(facts,
-			tls.NewTLSClientParserFactory(),
-			tls.NewTLSServerParserFactory(),
-		)
-	}
-
 	parser := NewNetworkTrafficParser(bufferShare)
+	parser.SetStreamingResponseTimeout(streamingResponseTimeout)
 
+	var observer NetworkTrafficObserver
 	if packetCount != nil {
-		parser.InstallObserver(CountTcpPackets(intf, packetCount))
+		observer = CountTcpPackets(intf, packetCount)
+	}
+	if tcpHealth != nil {
+		observer = tcpHealth.Observer(observer)
+	}
+	if sentinel != nil {
+		observer = sentinel.Observer(observer)
+	}
+	if observer != nil {
+		parser.InstallObserver(observer)
 	}
 
-	parsedChan, err := parser.ParseFromInterface(intf, bpfFilter, stop, facts...)
+	parsedChan, err := parser.ParseFromInterface(intf, bpfFilter, stop, newParserFactories(pool, parseTCPAndTLS, captureWebSocket)...)
 	if err != nil {
 		return errors.Wrap(err, "couldn't start parsing from interface")
 	}
@@ -60,6 +64,32 @@ func Collect(
 	return nil
 }
 
+// Returns the parsers for the protocols that are captured, in the order they
+// are tried. If captureWebSocket is true, messages on WebSocket connections
+// are captured after the upgrade.
+func newParserFactories(pool buffer_pool.BufferPool, parseTCPAndTLS bool, captureWebSocket bool) []akinet.TCPParserFactory {
+	http2Conns := NewHTTP2Connections(pool)
+	facts := []akinet.TCPParserFactory{
+		NewHTTPRequestParserFactory(pool),
+		akihttp.NewHTTPResponseParserFactory(pool),
+		NewHTTP2RequestParserFactory(http2Conns),
+		NewHTTP2ResponseParserFactory(http2Conns),
+	}
+	if captureWebSocket {
+		webSocketConns := NewWebSocketConnections(pool)
+		facts[0] = newWebSocketUpgradeParserFactory(facts[0], webSocketConns)
+		facts[1] = newWebSocketUpgradeParserFactory(facts[1], webSocketConns)
+		facts = append(facts, NewWebSocketParserFactory(webSocketConns))
+	}
+	if parseTCPAndTLS {
+		facts = append(facts,
+			tls.NewTLSClientParserFactory(),
+			tls.NewTLSServerParserFactory(),
+		)
+	}
+	return facts
+}
+
 // Observe every captured TCP segment here
 func CountTcpPackets(ifc string, packetCount trace.PacketCountConsumer) NetworkTrafficObserver {
 	observer := func(p gopacket.Packet) {
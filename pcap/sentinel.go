@@ -0,0 +1,177 @@
+package pcap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+// The loopback port to which sentinel packets are sent. This is the discard
+// port, so nothing should be listening on it.
+const sentinelPort = 9
+
+// How often to resend a sentinel packet while waiting for it to be captured.
+const sentinelResendInterval = 100 * time.Millisecond
+
+// Identifies the beginning of every sentinel packet payload.
+var sentinelMagic = []byte("postman-insights-sentinel:")
+
+type SentinelKind int
+
+const (
+	// Marks the point at which packet capture is known to be running.
+	StartSentinel SentinelKind = iota
+
+	// Marks the point up to which all packets sent have been captured.
+	StopSentinel
+)
+
+func (k SentinelKind) String() string {
+	switch k {
+	case StartSentinel:
+		return "start"
+	case StopSentinel:
+		return "stop"
+	}
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+// Uses uniquely identifiable UDP packets, sent over the loopback interface, to
+// mark the start and end of a packet capture. This lets us tell when pcap is
+// ready, or has caught up, without waiting for a fixed amount of time.
+//
+// Sentinels are only observed when the loopback interface is being captured
+// and the BPF filter admits the sentinel packets. Callers should therefore
+// treat a sentinel that is never observed as a signal to fall back to a fixed
+// wait.
+type Sentinel struct {
+	// Distinguishes this agent's sentinels from those of any other agent
+	// capturing on the same host.
+	id uuid.UUID
+
+	// Sends a sentinel payload. Replaced in tests.
+	send func(payload []byte) error
+
+	mu       sync.Mutex
+	observed map[SentinelKind]chan struct{}
+}
+
+func NewSentinel() *Sentinel {
+	return &Sentinel{
+		id:   uuid.New(),
+		send: sendToLoopback,
+		observed: map[SentinelKind]chan struct{}{
+			StartSentinel: make(chan struct{}),
+			StopSentinel:  make(chan struct{}),
+		},
+	}
+}
+
+// Loopback addresses to which sentinel packets are sent, in order of
+// preference. IPv6-only hosts may have no IPv4 loopback address.
+var loopbackAddrs = []string{"127.0.0.1", "::1"}
+
+func sendToLoopback(payload []byte) error {
+	var err error
+	for _, addr := range loopbackAddrs {
+		if err = sendToAddr(net.JoinHostPort(addr, strconv.Itoa(sentinelPort)), payload); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func sendToAddr(addr string, payload []byte) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to open sentinel connection")
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(payload); err != nil {
+		return errors.Wrap(err, "failed to send sentinel packet")
+	}
+	return nil
+}
+
+func (s *Sentinel) payload(kind SentinelKind) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", sentinelMagic, s.id, kind))
+}
+
+// Wraps the given observer so that sentinel packets are recognized before
+// each packet is passed along. The given observer may be nil.
+func (s *Sentinel) Observer(next NetworkTrafficObserver) NetworkTrafficObserver {
+	return func(p gopacket.Packet) {
+		s.observe(p)
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+func (s *Sentinel) observe(p gopacket.Packet) {
+	udpLayer := p.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return
+	}
+	udp, _ := udpLayer.(*layers.UDP)
+	if int(udp.DstPort) != sentinelPort || !bytes.HasPrefix(udp.Payload, sentinelMagic) {
+		return
+	}
+
+	for kind := range s.observed {
+		if bytes.Equal(udp.Payload, s.payload(kind)) {
+			s.markObserved(kind)
+			return
+		}
+	}
+}
+
+func (s *Sentinel) markObserved(kind SentinelKind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.observed[kind]:
+		// Already observed on another interface.
+	default:
+		printer.Debugf("Observed %s sentinel packet\n", kind)
+		close(s.observed[kind])
+	}
+}
+
+// Repeatedly sends a sentinel of the given kind until it has been observed by
+// packet capture or the timeout elapses. Returns true if the sentinel was
+// observed. If it wasn't, the full timeout will have elapsed, so the caller
+// has waited at least as long as it would have without a sentinel.
+func (s *Sentinel) Await(kind SentinelKind, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	resend := time.NewTicker(sentinelResendInterval)
+	defer resend.Stop()
+
+	for {
+		if err := s.send(s.payload(kind)); err != nil {
+			printer.Debugf("Unable to send %s sentinel packet: %v\n", kind, err)
+		}
+
+		select {
+		case <-s.observed[kind]:
+			return true
+		case <-deadline.C:
+			printer.Debugf("Did not observe %s sentinel packet after %v\n", kind, timeout)
+			return false
+		case <-resend.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pcap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinel(t *testing.T) {
+	loopback := net.IP{127, 0, 0, 1}
+
+	testCases := []struct {
+		name string
+
+		// Converts a sent payload into the packet that is captured, or nil if
+		// nothing is captured.
+		capture func(payload []byte) gopacket.Packet
+
+		expectObserved bool
+	}{
+		{
+			name: "sentinel captured",
+			capture: func(payload []byte) gopacket.Packet {
+				return CreateUDPPacket(loopback, loopback, 40000, sentinelPort, payload)
+			},
+			expectObserved: true,
+		},
+		{
+			name:           "sentinel not captured",
+			capture:        func([]byte) gopacket.Packet { return nil },
+			expectObserved: false,
+		},
+		{
+			name: "wrong port",
+			capture: func(payload []byte) gopacket.Packet {
+				return CreateUDPPacket(loopback, loopback, 40000, sentinelPort+1, payload)
+			},
+			expectObserved: false,
+		},
+		{
+			name: "sentinel from another agent",
+			capture: func([]byte) gopacket.Packet {
+				return CreateUDPPacket(loopback, loopback, 40000, sentinelPort, NewSentinel().payload(StartSentinel))
+			},
+			expectObserved: false,
+		},
+		{
+			name: "TCP packet with sentinel payload",
+			capture: func(payload []byte) gopacket.Packet {
+				return CreatePacket(loopback, loopback, 40000, sentinelPort, payload)
+			},
+			expectObserved: false,
+		},
+	}
+
+	timeout := 500 * time.Millisecond
+	for _, tc := range testCases {
+		s := NewSentinel()
+		observer := s.Observer(nil)
+		s.send = func(payload []byte) error {
+			if p := tc.capture(payload); p != nil {
+				observer(p)
+			}
+			return nil
+		}
+
+		start := time.Now()
+		observed := s.Await(StartSentinel, timeout)
+		elapsed := time.Since(start)
+
+		assert.Equal(t, tc.expectObserved, observed, "["+tc.name+"]")
+		if tc.expectObserved {
+			assert.Less(t, elapsed, timeout, "["+tc.name+"] sentinel should shorten the wait")
+		} else {
+			assert.GreaterOrEqual(t, elapsed, timeout, "["+tc.name+"] should fall back to the full wait")
+		}
+	}
+}
+
+func TestSentinelKindsAreDistinct(t *testing.T) {
+	s := NewSentinel()
+	observer := s.Observer(nil)
+	observer(CreateUDPPacket(net.IP{127, 0, 0, 1}, net.IP{127, 0, 0, 1}, 40000, sentinelPort, s.payload(StopSentinel)))
+
+	s.send = func([]byte) error { return nil }
+	assert.True(t, s.Await(StopSentinel, time.Second))
+	assert.False(t, s.Await(StartSentinel, 200*time.Millisecond))
+}
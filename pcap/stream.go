@@ -54,6 +54,15 @@ type tcpFlow struct {
 	// Context for the FIRST packet that currentParser is processing.
 	currentParserCtx *assemblerCtxWithSeq
 
+	// Tracks whether currentParser is parsing an HTTP response that has
+	// received all its headers. Nil if currentParser is not an HTTP response
+	// parser.
+	responseHeaders *responseHeaderScanner
+
+	// Pairs pipelined HTTP requests with their responses. Shared with the
+	// tcpFlow in the opposite direction. May be nil.
+	pipeline *httpPipeline
+
 	// Data that was left unused when determining parser, awaiting for more data.
 	// This is a hack to flush data when the flow terminates before a parser has
 	// been selected since reassembled does not get invoked on stream end even if
@@ -98,6 +107,7 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 		fact, decision, discardFront := f.factorySelector.Select(pktData, isEnd)
 		if discardFront > 0 {
 			printer.V(6).Infof("discarding %d bytes discarded by all parsers\n", discardFront)
+			recordUnparsed(pktData.SubView(0, discardFront))
 			f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, discardFront)
 			pktData = pktData.SubView(discardFront, pktData.Len())
 		}
@@ -131,13 +141,18 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 				} else {
 					atomic.AddUint64(&CountBadAssemblerContextType, 1)
 				}
+				recordUnparsed(pktData)
 				f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, pktData.Len())
 				return
 			}
 			f.currentParser = fact.CreateParser(f.bidiID, ctx.seq, ctx.ack)
 			f.currentParserCtx = ctx
+			if fact.Name() == httpResponseParserFactoryName {
+				f.responseHeaders = &responseHeaderScanner{}
+			}
 		default:
 			printer.Errorf("unsupported decision type %s, treating data as raw bytes\n", decision)
+			recordUnparsed(pktData)
 			f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, pktData.Len())
 			return
 		}
@@ -150,8 +165,7 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 		t := f.currentParserCtx.GetCaptureInfo().Timestamp
 		f.handleUnparseable(t, numBytesConsumed)
 
-		f.currentParser = nil
-		f.currentParserCtx = nil
+		f.clearParser()
 
 		telemetry.RateLimitError("parser", err)
 	} else if pnc != nil {
@@ -171,8 +185,7 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 		}
 		f.outChan <- f.toPNT(parseStart, parseEnd, pnc)
 
-		f.currentParser = nil
-		f.currentParserCtx = nil
+		f.clearParser()
 
 		if unused.Len() > 0 {
 			// Any unused bytes must be from the latest call to Parse, or else Parse
@@ -191,9 +204,18 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 		// Parsing not done, resume after new reassembled data becomes available.
 		// No need to call sg.KeepFrom because all the bytes are held by the parser
 		// and returned to us later if the parser runs into an error.
+		if f.responseHeaders != nil {
+			f.responseHeaders.scan(pktData)
+		}
 	}
 }
 
+func (f *tcpFlow) clearParser() {
+	f.currentParser = nil
+	f.currentParserCtx = nil
+	f.responseHeaders = nil
+}
+
 // Marks this flow as finished.
 func (f *tcpFlow) reassemblyComplete() {
 	if f.currentParser != nil {
@@ -206,14 +228,14 @@ func (f *tcpFlow) reassemblyComplete() {
 			f.outChan <- f.toPNT(t, t, pnc)
 			f.handleUnparseable(t, unused.Len())
 		}
-		f.currentParser = nil
-		f.currentParserCtx = nil
+		f.clearParser()
 	} else if f.unusedAcceptBuf.Len() > 0 {
 		// The flow terminated before a parser has been selected, flush any bytes
 		// that were buffered waiting for more data to determine parse.
 		// We estimate the time with current time instead of tracking a separate
 		// context since unusedAcceptBuf is unlikely to be used and is almost
 		// certainly very small in size.
+		recordUnparsed(f.unusedAcceptBuf)
 		f.outChan <- f.toPNT(f.clock.Now(), f.clock.Now(), akinet.DroppedBytes(f.unusedAcceptBuf.Len()))
 	}
 }
@@ -226,6 +248,9 @@ func (f *tcpFlow) toPNT(firstPacketTime time.Time, lastPacketTime time.Time,
 	if lastPacketTime.IsZero() {
 		lastPacketTime = firstPacketTime
 	}
+	if f.pipeline != nil {
+		c = f.pipeline.rekey(c)
+	}
 
 	// Endpoint interpretation logic from
 	// https://github.com/google/gopacket/blob/0ad7f2610e344e58c1c95e2adda5c3258da8e97b/layers/endpoints.go#L30
@@ -257,6 +282,12 @@ type tcpStream struct {
 
 	factorySelector akinet.TCPParserFactorySelector
 	outChan         chan<- akinet.ParsedNetworkTraffic
+
+	// Called when reassembly of the stream is complete. May be nil.
+	onComplete func()
+
+	// Shared by both flows.
+	pipeline httpPipeline
 }
 
 func newTCPStream(clock clockWrapper, netFlow gopacket.Flow, outChan chan<- akinet.ParsedNetworkTraffic, fs akinet.TCPParserFactorySelector) *tcpStream {
@@ -287,6 +318,8 @@ func (c *tcpStream) Accept(tcp *layers.TCP, _ gopacket.CaptureInfo, dir reassemb
 		tf, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(tcp.SrcPort), layers.NewTCPPortEndpoint(tcp.DstPort))
 		s1 := newTCPFlow(c.clock, c.bidiID, c.netFlow, tf, c.outChan, c.factorySelector)
 		s2 := newTCPFlow(c.clock, c.bidiID, c.netFlow.Reverse(), tf.Reverse(), c.outChan, c.factorySelector)
+		s1.pipeline = &c.pipeline
+		s2.pipeline = &c.pipeline
 		c.flows = map[reassembly.TCPFlowDirection]*tcpFlow{
 			dir:           s1,
 			dir.Reverse(): s2,
@@ -336,6 +369,9 @@ func (c *tcpStream) ReassemblyComplete(_ reassembly.AssemblerContext) bool {
 	for _, s := range c.flows {
 		s.reassemblyComplete()
 	}
+	if c.onComplete != nil {
+		c.onComplete()
+	}
 
 	// Remove connection from the pool
 	return true
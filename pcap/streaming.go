@@ -0,0 +1,102 @@
+package pcap
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+var httpResponseParserFactoryName = akihttp.NewHTTPResponseParserFactory(nil).Name()
+
+// The end of the headers in an HTTP/1.x message.
+var httpHeaderEnd = []byte("\r\n\r\n")
+
+// Looks for the end of the headers in the data fed to an HTTP response
+// parser, which may arrive over several segments.
+type responseHeaderScanner struct {
+	done bool
+
+	// The last few bytes scanned, in case the end of the headers straddles two
+	// segments.
+	tail []byte
+}
+
+func (s *responseHeaderScanner) scan(data memview.MemView) {
+	if s.done {
+		return
+	}
+
+	buf := append(s.tail, data.String()...)
+	if bytes.Contains(buf, httpHeaderEnd) {
+		s.done = true
+		s.tail = nil
+		return
+	}
+
+	keep := len(httpHeaderEnd) - 1
+	if len(buf) < keep {
+		keep = len(buf)
+	}
+	s.tail = append([]byte(nil), buf[len(buf)-keep:]...)
+}
+
+// Emits any response being parsed on this flow whose headers arrived before
+// the given time and whose body has not ended. The response is emitted with
+// the part of its body seen so far, marked as having its body open. Returns
+// true if a response was emitted.
+//
+// Any remainder of the body that arrives later is treated as unparseable.
+func (f *tcpFlow) finishOpenResponse(threshold time.Time) bool {
+	if f.currentParser == nil || f.responseHeaders == nil || !f.responseHeaders.done {
+		return false
+	}
+
+	start := f.currentParserCtx.GetCaptureInfo().Timestamp
+	if !start.Before(threshold) {
+		return false
+	}
+
+	emitted := false
+	pnc, unused, numBytesConsumed, err := f.currentParser.Parse(memview.New(nil), true)
+	if err != nil {
+		f.handleUnparseable(start, numBytesConsumed)
+	} else if pnc != nil {
+		if resp, ok := pnc.(akinet.HTTPResponse); ok {
+			if resp.Header == nil {
+				resp.Header = make(http.Header)
+			}
+			resp.Header.Set(learn.BodyOpenHeader, "true")
+			pnc = resp
+		}
+		f.outChan <- f.toPNT(start, f.clock.Now(), pnc)
+		f.handleUnparseable(start, unused.Len())
+		emitted = true
+	}
+	f.clearParser()
+	return emitted
+}
+
+func (c *tcpStream) finishOpenResponses(threshold time.Time) int {
+	n := 0
+	for _, f := range c.flows {
+		if f.finishOpenResponse(threshold) {
+			n++
+		}
+	}
+	return n
+}
+
+// Emits the open responses on all streams whose headers arrived before the
+// given time. Returns the number of responses emitted.
+func (fact *tcpStreamFactory) finishOpenResponses(threshold time.Time) int {
+	n := 0
+	for s := range fact.streams {
+		n += s.finishOpenResponses(threshold)
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package pcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/gopacket"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseHeaderScanner(t *testing.T) {
+	var s responseHeaderScanner
+	s.scan(memview.New([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r")))
+	assert.False(t, s.done)
+
+	// The end of the headers straddles two segments.
+	s.scan(memview.New([]byte("\n\r")))
+	assert.False(t, s.done)
+	s.scan(memview.New([]byte("\ndata: hello\n")))
+	assert.True(t, s.done)
+}
+
+// A response whose body never ends is emitted with its body open once the
+// streaming response timeout passes, without waiting for the stream to close.
+func TestStreamingResponse(t *testing.T) {
+	defer func(flush int64) {
+		StreamTimeoutSeconds = flush
+	}(StreamTimeoutSeconds)
+	StreamTimeoutSeconds = 1
+
+	pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	input := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"10\r\n{\"name\":\"prince\"\r\n"
+	pkt := CreatePacket(ip2, ip1, port2, port1, []byte(input))
+	pkt.Metadata().Timestamp = start
+
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+
+	p := NewNetworkTrafficParser(1.0)
+	p.pcap = forceCancelPcap([]gopacket.Packet{pkt})
+	p.SetStreamingResponseTimeout(time.Second)
+	out, err := p.ParseFromInterface("dummy0", "", closeChan, akihttp.NewHTTPResponseParserFactory(pool))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pnt := <-out:
+			resp, ok := pnt.Content.(akinet.HTTPResponse)
+			if !ok {
+				continue
+			}
+			defer resp.ReleaseBuffers()
+
+			assert.GreaterOrEqual(t, time.Since(start), time.Second)
+			assert.Equal(t, 200, resp.StatusCode)
+			assert.Equal(t, "true", resp.Header.Get(learn.BodyOpenHeader))
+			assert.Equal(t, `{"name":"prince"`, resp.Body.String())
+
+			partial, err := learn.ParseHTTP(resp)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, partial.BodyOpen)
+
+			// The marker is not captured as a response header.
+			for _, d := range partial.Witness.GetMethod().GetResponses() {
+				assert.NotEqual(t, learn.BodyOpenHeader, d.GetMeta().GetHttp().GetHeader().GetKey())
+			}
+			return
+		case <-timeout:
+			t.Fatal("streaming response was not emitted")
+		}
+	}
+}
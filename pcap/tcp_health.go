@@ -0,0 +1,166 @@
+package pcap
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Bounds the number of TCP flows whose sequence numbers are tracked. When the
+// bound is reached, tracking starts over, so a retransmission that straddles
+// the reset is missed.
+const maxTCPHealthFlows = 100_000
+
+// Counts of TCP events that indicate network trouble, rather than slowness in
+// the application.
+type TCPHealthCounts struct {
+	// Packets whose payload had already been seen on the same flow.
+	Retransmissions int
+
+	// Packets advertising a zero receive window, meaning the receiver could not
+	// keep up.
+	ZeroWindows int
+}
+
+// TCP health counts for a single port.
+type PortTCPHealth struct {
+	Port int
+	TCPHealthCounts
+}
+
+// Detects TCP retransmissions and zero-window advertisements in captured
+// packets, and counts them by port. Each event is attributed to the lower of
+// the two ports in the packet, which is usually the service's port.
+//
+// A retransmission is a packet carrying a payload that ends at or before the
+// highest sequence number already seen in the same direction of the same
+// connection.
+type TCPHealth struct {
+	mu sync.Mutex
+
+	// Maps each flow to the sequence number that follows the highest payload
+	// byte seen on it.
+	nextSeq map[tcpHealthFlow]uint32
+
+	counts map[int]*TCPHealthCounts
+}
+
+// One direction of a TCP connection.
+type tcpHealthFlow struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+}
+
+func NewTCPHealth() *TCPHealth {
+	return &TCPHealth{
+		nextSeq: map[tcpHealthFlow]uint32{},
+		counts:  map[int]*TCPHealthCounts{},
+	}
+}
+
+// Wraps the given observer so that each packet is checked before it is
+// passed along. The given observer may be nil.
+func (h *TCPHealth) Observer(next NetworkTrafficObserver) NetworkTrafficObserver {
+	return func(p gopacket.Packet) {
+		h.observe(p)
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+func (h *TCPHealth) observe(p gopacket.Packet) {
+	netLayer := p.NetworkLayer()
+	tcpLayer := p.Layer(layers.LayerTypeTCP)
+	if netLayer == nil || tcpLayer == nil {
+		return
+	}
+	tcp, _ := tcpLayer.(*layers.TCP)
+	h.observeTCP(netLayer.NetworkFlow(), tcp)
+}
+
+func (h *TCPHealth) observeTCP(network gopacket.Flow, tcp *layers.TCP) {
+	flow := tcpHealthFlow{network: network, transport: tcp.TransportFlow()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if tcp.SYN || tcp.FIN || tcp.RST {
+		// Sequence numbers start over on a new connection, and there is nothing
+		// more to track once a connection ends.
+		delete(h.nextSeq, flow)
+		if tcp.SYN || tcp.RST {
+			return
+		}
+	}
+
+	if tcp.Window == 0 {
+		h.countsFor(tcp).ZeroWindows++
+	}
+
+	if len(tcp.Payload) == 0 || tcp.FIN {
+		return
+	}
+
+	end := tcp.Seq + uint32(len(tcp.Payload))
+	if next, ok := h.nextSeq[flow]; ok {
+		// Compare modulo 2^32, since sequence numbers wrap around.
+		if int32(end-next) <= 0 {
+			h.countsFor(tcp).Retransmissions++
+			return
+		}
+	} else if len(h.nextSeq) >= maxTCPHealthFlows {
+		h.nextSeq = map[tcpHealthFlow]uint32{}
+	}
+	h.nextSeq[flow] = end
+}
+
+func (h *TCPHealth) countsFor(tcp *layers.TCP) *TCPHealthCounts {
+	port := int(tcp.SrcPort)
+	if int(tcp.DstPort) < port {
+		port = int(tcp.DstPort)
+	}
+
+	c, ok := h.counts[port]
+	if !ok {
+		c = &TCPHealthCounts{}
+		h.counts[port] = c
+	}
+	return c
+}
+
+// Returns the counts for each port with at least one event, in order of
+// decreasing total events.
+func (h *TCPHealth) ByPort() []PortTCPHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]PortTCPHealth, 0, len(h.counts))
+	for port, c := range h.counts {
+		result = append(result, PortTCPHealth{Port: port, TCPHealthCounts: *c})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ti := result[i].Retransmissions + result[i].ZeroWindows
+		tj := result[j].Retransmissions + result[j].ZeroWindows
+		if ti != tj {
+			return ti > tj
+		}
+		return result[i].Port < result[j].Port
+	})
+	return result
+}
+
+// Returns the counts summed over all ports.
+func (h *TCPHealth) Total() TCPHealthCounts {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var total TCPHealthCounts
+	for _, c := range h.counts {
+		total.Retransmissions += c.Retransmissions
+		total.ZeroWindows += c.ZeroWindows
+	}
+	return total
+}
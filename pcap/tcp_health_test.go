@@ -0,0 +1,63 @@
+package pcap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func createPacketWithWindow(src, dst net.IP, srcPort, dstPort int, payload []byte, seq uint32, window uint16) gopacket.Packet {
+	ethernetLayer, ipLayer, tcpLayer := createPacketLayers(src, dst, srcPort, dstPort, seq)
+	tcpLayer.ACK = true
+	tcpLayer.Window = window
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	gopacket.SerializeLayers(buffer, opts, ethernetLayer, ipLayer, tcpLayer, gopacket.Payload(payload))
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestTCPHealth(t *testing.T) {
+	client := net.IP{10, 0, 0, 1}
+	server := net.IP{10, 0, 0, 2}
+	payload := []byte("0123456789")
+
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 50000, 8080, 99),
+
+		// New data from the client, then a retransmission of it.
+		createPacketWithWindow(client, server, 50000, 8080, payload, 100, 1024),
+		createPacketWithWindow(client, server, 50000, 8080, payload, 110, 1024),
+		createPacketWithWindow(client, server, 50000, 8080, payload, 110, 1024),
+
+		// The server sends the same sequence numbers in the other direction,
+		// which is not a retransmission.
+		createPacketWithWindow(server, client, 8080, 50000, payload, 100, 1024),
+
+		// The server's receive window fills up.
+		createPacketWithWindow(server, client, 8080, 50000, nil, 110, 0),
+
+		// A partial retransmission from the server, then new data.
+		createPacketWithWindow(server, client, 8080, 50000, payload[:5], 105, 1024),
+		createPacketWithWindow(server, client, 8080, 50000, payload, 110, 1024),
+
+		// Sequence numbers that wrap around are new data.
+		createPacketWithWindow(client, server, 50001, 9090, payload, 0xfffffffa, 1024),
+		createPacketWithWindow(client, server, 50001, 9090, payload, 4, 1024),
+		createPacketWithWindow(client, server, 50001, 9090, payload, 0xfffffffa, 1024),
+	}
+
+	h := NewTCPHealth()
+	observer := h.Observer(nil)
+	for _, p := range packets {
+		observer(p)
+	}
+
+	assert.Equal(t, []PortTCPHealth{
+		{Port: 8080, TCPHealthCounts: TCPHealthCounts{Retransmissions: 2, ZeroWindows: 1}},
+		{Port: 9090, TCPHealthCounts: TCPHealthCounts{Retransmissions: 1}},
+	}, h.ByPort())
+	assert.Equal(t, TCPHealthCounts{Retransmissions: 3, ZeroWindows: 1}, h.Total())
+}
@@ -0,0 +1,137 @@
+package pcap
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/memview"
+)
+
+// Kinds of TCP data that no parser accepted, as guessed from a sample of the
+// data.
+type UnparsedKind int
+
+const (
+	// Starts with a TLS record header, so is probably part of a TLS connection
+	// whose handshake wasn't seen.
+	UnparsedEncrypted UnparsedKind = iota
+
+	// Starts with the magic bytes of a compression format, so is probably the
+	// body of an HTTP message whose headers weren't seen.
+	UnparsedCompressed
+
+	// Looks random but has no recognizable header. This is typical of the middle
+	// of an encrypted or compressed stream.
+	UnparsedHighEntropy
+
+	// None of the above, such as a plaintext protocol the agent doesn't support.
+	UnparsedUnknown
+)
+
+const (
+	// Number of leading bytes of unparsed data that are classified.
+	unparsedSampleSize_bytes = 1024
+
+	// Samples shorter than this are too short for entropy to be meaningful.
+	minEntropySample_bytes = 32
+
+	// Fraction of the maximum possible entropy for a sample of a given length
+	// above which the sample is considered random.
+	highEntropyFraction = 0.85
+)
+
+// Number of times unparsed data of each kind was seen, indexed by UnparsedKind.
+var countUnparsed [UnparsedUnknown + 1]uint64
+
+// Returns the number of times unparsed data of the given kind was seen.
+func CountUnparsed(kind UnparsedKind) uint64 {
+	return atomic.LoadUint64(&countUnparsed[kind])
+}
+
+// Classifies and counts a sample of unparsed data.
+func recordUnparsed(data memview.MemView) {
+	n := data.Len()
+	if n == 0 {
+		return
+	}
+	if n > unparsedSampleSize_bytes {
+		n = unparsedSampleSize_bytes
+	}
+
+	sample := make([]byte, n)
+	head := data.SubView(0, n)
+	if _, err := io.ReadFull(head.CreateReader(), sample); err != nil {
+		return
+	}
+	atomic.AddUint64(&countUnparsed[classifyUnparsed(sample)], 1)
+}
+
+// Guesses what kind of data the given sample is from.
+func classifyUnparsed(sample []byte) UnparsedKind {
+	switch {
+	case hasTLSRecordHeader(sample):
+		return UnparsedEncrypted
+	case hasCompressionMagic(sample):
+		return UnparsedCompressed
+	case isHighEntropy(sample):
+		return UnparsedHighEntropy
+	}
+	return UnparsedUnknown
+}
+
+// Determines whether the sample starts with a TLS record header: a content
+// type (change_cipher_spec, alert, handshake, or application_data), followed
+// by a version from SSL 3.0 through TLS 1.3.
+func hasTLSRecordHeader(sample []byte) bool {
+	if len(sample) < 5 {
+		return false
+	}
+	contentType, major, minor := sample[0], sample[1], sample[2]
+	return contentType >= 0x14 && contentType <= 0x17 && major == 0x03 && minor <= 0x04
+}
+
+// Determines whether the sample starts with the magic bytes of gzip, zlib, or
+// zstd. Brotli has no magic bytes.
+func hasCompressionMagic(sample []byte) bool {
+	switch {
+	case len(sample) >= 2 && sample[0] == 0x1f && sample[1] == 0x8b:
+		// gzip
+		return true
+	case len(sample) >= 2 && sample[0] == 0x78:
+		// zlib, with a 32K window. The second byte depends on the compression
+		// level.
+		switch sample[1] {
+		case 0x01, 0x5e, 0x9c, 0xda:
+			return true
+		}
+	case len(sample) >= 4 && sample[0] == 0x28 && sample[1] == 0xb5 && sample[2] == 0x2f && sample[3] == 0xfd:
+		// zstd
+		return true
+	}
+	return false
+}
+
+// Determines whether the sample's Shannon entropy is close to the maximum
+// possible for its length.
+func isHighEntropy(sample []byte) bool {
+	if len(sample) < minEntropySample_bytes {
+		return false
+	}
+
+	var counts [256]int
+	for _, b := range sample {
+		counts[b] += 1
+	}
+
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(sample))
+			entropy -= p * math.Log2(p)
+		}
+	}
+
+	maxEntropy := math.Log2(math.Min(float64(len(sample)), 256))
+	return entropy >= highEntropyFraction*maxEntropy
+}
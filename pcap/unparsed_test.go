@@ -0,0 +1,35 @@
+package pcap
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyUnparsed(t *testing.T) {
+	random := make([]byte, unparsedSampleSize_bytes)
+	rand.New(rand.NewSource(0)).Read(random)
+
+	testCases := []struct {
+		name     string
+		sample   []byte
+		expected UnparsedKind
+	}{
+		{"TLS application data", append([]byte{0x17, 0x03, 0x03, 0x00, 0x40}, random[:64]...), UnparsedEncrypted},
+		{"TLS handshake", append([]byte{0x16, 0x03, 0x01, 0x02, 0x00}, random[:64]...), UnparsedEncrypted},
+		{"gzip", append([]byte{0x1f, 0x8b, 0x08, 0x00}, random[:64]...), UnparsedCompressed},
+		{"zlib", append([]byte{0x78, 0x9c}, random[:64]...), UnparsedCompressed},
+		{"zstd", append([]byte{0x28, 0xb5, 0x2f, 0xfd}, random[:64]...), UnparsedCompressed},
+		{"random bytes", random, UnparsedHighEntropy},
+		{"short random bytes", random[:minEntropySample_bytes], UnparsedHighEntropy},
+		{"plaintext protocol", []byte("*3\r\n$3\r\nSET\r\n$5\r\nmykey\r\n$7\r\nmyvalue\r\n*2\r\n$3\r\nGET\r\n$5\r\nmykey\r\n"), UnparsedUnknown},
+		{"repeated bytes", bytes.Repeat([]byte{0x00}, 512), UnparsedUnknown},
+		{"too short", random[:8], UnparsedUnknown},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, classifyUnparsed(tc.sample), tc.name)
+	}
+}
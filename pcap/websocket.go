@@ -0,0 +1,545 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+const (
+	// Maximum number of messages captured on each WebSocket connection, in
+	// both directions together. Later messages are parsed but not captured.
+	maxWebSocketMessagesPerConnection = 100
+
+	// Largest text message whose content is captured. Larger messages, like
+	// binary ones, are captured with only their size.
+	maxWebSocketMessageSize_bytes = 64 * 1024
+
+	// Maximum number of WebSocket connections tracked at once. Upgrades beyond
+	// this are ignored.
+	maxWebSocketConnections = 1000
+
+	// Connections with no messages parsed for this long are forgotten.
+	webSocketConnectionTimeout = 5 * time.Minute
+
+	// Largest payload of a control frame.
+	maxWebSocketControlPayload = 125
+)
+
+// Frame opcodes, from RFC 6455.
+const (
+	webSocketContinuation = 0x0
+	webSocketText         = 0x1
+	webSocketBinary       = 0x2
+	webSocketClose        = 0x8
+	webSocketPing         = 0x9
+	webSocketPong         = 0xA
+)
+
+var errUntrackedWebSocketConnection = errors.New("WebSocket frames on a connection whose upgrade was not seen")
+
+// Tracks the connections upgraded to WebSocket, and is shared by the parser
+// factories that detect upgrades and the one that parses WebSocket frames.
+//
+// Frames are only parsed on connections whose upgrade request and response
+// were seen, which gives the endpoint that the messages are recorded
+// against. As with HTTP/2, the parsers are single-use, so the state of each
+// connection is kept here.
+type WebSocketConnections struct {
+	pool buffer_pool.BufferPool
+
+	mutex sync.Mutex
+	conns map[akinet.TCPBidiID]*webSocketConnection
+
+	// Number of connections tracked, and of those that have been upgraded,
+	// readable without the lock.
+	numConns    int32
+	numUpgraded int32
+}
+
+// State of a connection being upgraded to WebSocket, or that has been.
+type webSocketConnection struct {
+	bidiID akinet.TCPBidiID
+
+	// The endpoint of the upgrade request.
+	method string
+	host   string
+	path   string
+
+	// Whether the server accepted the upgrade.
+	upgraded bool
+
+	// Number of messages captured.
+	messages int
+
+	lastUsed time.Time
+}
+
+// Creates a tracker whose message bodies will be allocated from the given
+// buffer pool.
+func NewWebSocketConnections(pool buffer_pool.BufferPool) *WebSocketConnections {
+	return &WebSocketConnections{
+		pool:  pool,
+		conns: map[akinet.TCPBidiID]*webSocketConnection{},
+	}
+}
+
+func (cs *WebSocketConnections) tracking() bool {
+	return atomic.LoadInt32(&cs.numUpgraded) > 0
+}
+
+// Notes WebSocket upgrade requests, and the responses that accept or refuse
+// them.
+func (cs *WebSocketConnections) observe(bidiID akinet.TCPBidiID, c akinet.ParsedNetworkContent) {
+	switch m := c.(type) {
+	case akinet.HTTPRequest:
+		if m.URL == nil || !isWebSocketUpgrade(m.Header) {
+			return
+		}
+		cs.mutex.Lock()
+		defer cs.mutex.Unlock()
+		cs.add(&webSocketConnection{
+			bidiID: bidiID,
+			method: m.Method,
+			host:   m.Host,
+			path:   m.URL.Path,
+		})
+
+	case akinet.HTTPResponse:
+		if atomic.LoadInt32(&cs.numConns) == 0 {
+			return
+		}
+		cs.mutex.Lock()
+		defer cs.mutex.Unlock()
+		conn, ok := cs.conns[bidiID]
+		if !ok || conn.upgraded {
+			return
+		}
+		if m.StatusCode == http.StatusSwitchingProtocols && isWebSocketUpgrade(m.Header) {
+			conn.upgraded = true
+			conn.lastUsed = time.Now()
+			atomic.AddInt32(&cs.numUpgraded, 1)
+		} else {
+			cs.remove(conn)
+		}
+	}
+}
+
+// Starts tracking a connection, forgetting any that have been idle too long.
+// Assumes the mutex is held.
+func (cs *WebSocketConnections) add(conn *webSocketConnection) {
+	now := time.Now()
+	for _, c := range cs.conns {
+		if now.Sub(c.lastUsed) > webSocketConnectionTimeout {
+			cs.remove(c)
+		}
+	}
+	if old, ok := cs.conns[conn.bidiID]; ok {
+		cs.remove(old)
+	}
+	if len(cs.conns) >= maxWebSocketConnections {
+		return
+	}
+
+	conn.lastUsed = now
+	cs.conns[conn.bidiID] = conn
+	atomic.StoreInt32(&cs.numConns, int32(len(cs.conns)))
+}
+
+// Assumes the mutex is held.
+func (cs *WebSocketConnections) remove(conn *webSocketConnection) {
+	if conn.upgraded {
+		atomic.AddInt32(&cs.numUpgraded, -1)
+	}
+	delete(cs.conns, conn.bidiID)
+	atomic.StoreInt32(&cs.numConns, int32(len(cs.conns)))
+}
+
+// Returns the upgraded connection with the given ID, or nil if there is none.
+func (cs *WebSocketConnections) lookup(bidiID akinet.TCPBidiID) *webSocketConnection {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	conn, ok := cs.conns[bidiID]
+	if !ok || !conn.upgraded {
+		return nil
+	}
+	conn.lastUsed = time.Now()
+	return conn
+}
+
+// Returns the content for a message received in full on the given connection,
+// or nil if the connection's limit on captured messages has been reached.
+func (cs *WebSocketConnections) message(conn *webSocketConnection, m *webSocketMessage) akinet.ParsedNetworkContent {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	conn.lastUsed = time.Now()
+	if conn.messages >= maxWebSocketMessagesPerConnection {
+		return nil
+	}
+	conn.messages++
+
+	sender := learn.WebSocketFromServer
+	if m.fromClient {
+		sender = learn.WebSocketFromClient
+	}
+	header := http.Header{}
+	header.Set(learn.WebSocketMessageHeader, sender)
+
+	body := cs.pool.NewBuffer()
+	if m.payload != nil {
+		if json.Valid(m.payload) {
+			header.Set("Content-Type", "application/json")
+		} else {
+			header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		body.Write(m.payload)
+	} else {
+		// Only the size is captured.
+		header.Set("Content-Length", strconv.FormatInt(m.size, 10))
+	}
+
+	req := &http.Request{
+		Method: conn.method,
+		URL:    &url.URL{Path: conn.path},
+		Host:   conn.host,
+		Header: header,
+	}
+	return akinet.FromStdRequest(uuid.UUID(conn.bidiID), conn.messages, req, body)
+}
+
+// Determines whether the given headers of an HTTP/1.1 request or response
+// ask for or agree to an upgrade to WebSocket.
+func isWebSocketUpgrade(h http.Header) bool {
+	for _, v := range h.Values("Upgrade") {
+		for _, protocol := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(protocol), "websocket") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Wraps a factory for parsing HTTP/1.x requests or responses, so that the
+// WebSocket upgrades among them are tracked.
+func newWebSocketUpgradeParserFactory(f akinet.TCPParserFactory, conns *WebSocketConnections) akinet.TCPParserFactory {
+	return webSocketUpgradeParserFactory{
+		TCPParserFactory: f,
+		conns:            conns,
+	}
+}
+
+type webSocketUpgradeParserFactory struct {
+	akinet.TCPParserFactory
+	conns *WebSocketConnections
+}
+
+func (f webSocketUpgradeParserFactory) CreateParser(id akinet.TCPBidiID, seq, ack reassembly.Sequence) akinet.TCPParser {
+	return &webSocketUpgradeParser{
+		TCPParser: f.TCPParserFactory.CreateParser(id, seq, ack),
+		conns:     f.conns,
+		bidiID:    id,
+	}
+}
+
+type webSocketUpgradeParser struct {
+	akinet.TCPParser
+	conns  *WebSocketConnections
+	bidiID akinet.TCPBidiID
+}
+
+func (p *webSocketUpgradeParser) Parse(input memview.MemView, isEnd bool) (result akinet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	result, unused, totalBytesConsumed, err = p.TCPParser.Parse(input, isEnd)
+	if err == nil && result != nil {
+		p.conns.observe(p.bidiID, result)
+	}
+	return result, unused, totalBytesConsumed, err
+}
+
+// Returns a factory for parsing the messages on connections upgraded to
+// WebSocket. Each text message is emitted as an akinet.HTTPRequest to the
+// endpoint of the upgrade request, with the message as its body and
+// learn.WebSocketMessageHeader set to the side that sent it. Binary messages,
+// compressed messages and large text messages are emitted with only their
+// size, as the Content-Length header. Control frames are consumed without a
+// result.
+func NewWebSocketParserFactory(conns *WebSocketConnections) akinet.TCPParserFactory {
+	return webSocketParserFactory{conns: conns}
+}
+
+type webSocketParserFactory struct {
+	conns *WebSocketConnections
+}
+
+func (webSocketParserFactory) Name() string {
+	return "WebSocket Parser Factory"
+}
+
+func (f webSocketParserFactory) Accepts(input memview.MemView, isEnd bool) (decision akinet.AcceptDecision, discardFront int64) {
+	if !f.conns.tracking() {
+		return akinet.Reject, 0
+	}
+	if input.Len() < 2 {
+		if isEnd {
+			return akinet.Reject, 0
+		}
+		return akinet.NeedMoreData, 0
+	}
+
+	b0, b1 := input.GetByte(0), input.GetByte(1)
+	fin := b0&0x80 != 0
+	opcode := b0 & 0x0f
+	length := b1 & 0x7f
+
+	// Only the RSV1 bit, used for compression, is expected.
+	if b0&0x30 != 0 {
+		return akinet.Reject, 0
+	}
+	switch opcode {
+	case webSocketText, webSocketBinary:
+	case webSocketClose, webSocketPing, webSocketPong:
+		if !fin || length > maxWebSocketControlPayload {
+			return akinet.Reject, 0
+		}
+	default:
+		// A continuation frame can't start a message.
+		return akinet.Reject, 0
+	}
+	return akinet.Accept, 0
+}
+
+func (f webSocketParserFactory) CreateParser(id akinet.TCPBidiID, _, _ reassembly.Sequence) akinet.TCPParser {
+	return &webSocketParser{conns: f.conns, bidiID: id}
+}
+
+// Parses WebSocket frames until a message is complete. Frames are parsed as
+// they arrive, and only the payloads of messages being captured are kept.
+type webSocketParser struct {
+	conns  *WebSocketConnections
+	bidiID akinet.TCPBidiID
+
+	// The connection being parsed, once looked up.
+	conn *webSocketConnection
+
+	// Header of the frame being parsed, while incomplete.
+	header []byte
+
+	// The frame whose payload is being parsed, if any.
+	frame *webSocketFrame
+
+	// The message being received, if any.
+	message *webSocketMessage
+
+	totalBytesConsumed int64
+}
+
+type webSocketFrame struct {
+	fin    bool
+	opcode byte
+
+	masked  bool
+	maskKey [4]byte
+
+	// Payload bytes parsed so far, and remaining.
+	offset    int64
+	remaining int64
+}
+
+type webSocketMessage struct {
+	// Whether the message is sent by the client, whose frames are masked.
+	fromClient bool
+
+	// Size of the payload so far.
+	size int64
+
+	// The payload so far, or nil if only the size is captured.
+	payload []byte
+}
+
+func (*webSocketParser) Name() string {
+	return "WebSocket Parser"
+}
+
+func (p *webSocketParser) Parse(input memview.MemView, isEnd bool) (result akinet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	p.totalBytesConsumed += input.Len()
+
+	if p.conn == nil {
+		if p.conn = p.conns.lookup(p.bidiID); p.conn == nil {
+			return nil, memview.Empty(), p.totalBytesConsumed, errUntrackedWebSocketConnection
+		}
+	}
+
+	pos := int64(0)
+	for pos < input.Len() {
+		if p.frame == nil {
+			for pos < input.Len() && len(p.header) < webSocketHeaderLength(p.header) {
+				p.header = append(p.header, input.GetByte(pos))
+				pos++
+			}
+			if len(p.header) < webSocketHeaderLength(p.header) {
+				break
+			}
+			if err := p.startFrame(); err != nil {
+				return nil, memview.Empty(), p.totalBytesConsumed, err
+			}
+		}
+
+		n := input.Len() - pos
+		if n > p.frame.remaining {
+			n = p.frame.remaining
+		}
+		p.payload(input.SubView(pos, pos+n))
+		pos += n
+		if p.frame.remaining > 0 {
+			break
+		}
+
+		if result := p.endFrame(); result != nil {
+			unused = input.SubView(pos, input.Len())
+			return result, unused, p.totalBytesConsumed - unused.Len(), nil
+		}
+	}
+
+	// As with HTTP/2, a message cut off by the end of capture is dropped.
+	return nil, memview.Empty(), p.totalBytesConsumed, nil
+}
+
+// Returns the length of the frame header that starts with the given bytes,
+// or the number of bytes needed to tell.
+func webSocketHeaderLength(header []byte) int {
+	if len(header) < 2 {
+		return 2
+	}
+	n := 2
+	switch header[1] & 0x7f {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+	if header[1]&0x80 != 0 {
+		n += 4
+	}
+	return n
+}
+
+// Starts parsing the payload of the frame whose header has been read.
+func (p *webSocketParser) startFrame() error {
+	h := p.header
+	p.header = p.header[:0]
+
+	f := &webSocketFrame{
+		fin:    h[0]&0x80 != 0,
+		opcode: h[0] & 0x0f,
+		masked: h[1]&0x80 != 0,
+	}
+	rest := h[2:]
+	switch length := int64(h[1] & 0x7f); length {
+	case 126:
+		f.remaining = int64(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+	case 127:
+		l := binary.BigEndian.Uint64(rest)
+		if l>>63 != 0 {
+			return errors.New("malformed WebSocket frame: invalid payload length")
+		}
+		f.remaining = int64(l)
+		rest = rest[8:]
+	default:
+		f.remaining = length
+	}
+	if f.masked {
+		copy(f.maskKey[:], rest)
+	}
+
+	if h[0]&0x30 != 0 {
+		return errors.New("malformed WebSocket frame: reserved bits set")
+	}
+	switch f.opcode {
+	case webSocketText, webSocketBinary:
+		if p.message != nil {
+			return errors.New("malformed WebSocket frame: new message before the previous one ended")
+		}
+		p.message = &webSocketMessage{fromClient: f.masked}
+		// Compressed messages, marked by the RSV1 bit, are captured with only
+		// their size.
+		if f.opcode == webSocketText && h[0]&0x40 == 0 {
+			p.message.payload = []byte{}
+		}
+	case webSocketContinuation:
+		if p.message == nil {
+			return errors.New("malformed WebSocket frame: continuation without a message")
+		}
+	case webSocketClose, webSocketPing, webSocketPong:
+		if !f.fin || f.remaining > maxWebSocketControlPayload {
+			return errors.New("malformed WebSocket control frame")
+		}
+	default:
+		return errors.Errorf("malformed WebSocket frame: unknown opcode %d", f.opcode)
+	}
+
+	p.frame = f
+	return nil
+}
+
+// Adds part of the payload of the current frame to the message being
+// received.
+func (p *webSocketParser) payload(data memview.MemView) {
+	f := p.frame
+	defer func() {
+		f.offset += data.Len()
+		f.remaining -= data.Len()
+	}()
+
+	if f.opcode >= webSocketClose {
+		// Control frames aren't captured.
+		return
+	}
+
+	m := p.message
+	m.size += data.Len()
+	if m.payload == nil {
+		return
+	}
+	if m.size > maxWebSocketMessageSize_bytes {
+		m.payload = nil
+		return
+	}
+
+	b := []byte(data.String())
+	if f.masked {
+		for i := range b {
+			b[i] ^= f.maskKey[(f.offset+int64(i))%4]
+		}
+	}
+	m.payload = append(m.payload, b...)
+}
+
+// Finishes the current frame. Returns the content of the message it
+// completes, if it is captured.
+func (p *webSocketParser) endFrame() akinet.ParsedNetworkContent {
+	f := p.frame
+	p.frame = nil
+	if f.opcode >= webSocketClose || !f.fin {
+		return nil
+	}
+
+	m := p.message
+	p.message = nil
+	return p.conns.message(p.conn, m)
+}
@@ -0,0 +1,257 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	akihttp "github.com/akitasoftware/akita-libs/akinet/http"
+	"github.com/akitasoftware/akita-libs/buffer_pool"
+	"github.com/google/gopacket"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	webSocketUpgradeRequest = "GET /chat?token=abc HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+
+	webSocketUpgradeResponse = "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n"
+
+	webSocketRefusedResponse = "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"
+)
+
+// Encodes a WebSocket frame. Frames sent by the client are masked.
+func makeWebSocketFrame(fin bool, opcode byte, masked bool, payload []byte) []byte {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+
+	if !masked {
+		return append(frame, payload...)
+	}
+	key := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, key...)
+	for i, b := range payload {
+		frame = append(frame, b^key[i%4])
+	}
+	return frame
+}
+
+// Builds a connection on which the client and server exchange the given
+// segments, in order.
+func makeWebSocketPackets(segments []struct {
+	fromClient bool
+	data       []byte
+}) []gopacket.Packet {
+	pkts := []gopacket.Packet{
+		CreateTCPSYN(ip1, ip2, port1, port2, 0),
+		CreateTCPSYNAndACK(ip2, ip1, port2, port1, 0),
+	}
+	clientSeq, serverSeq := uint32(1), uint32(1)
+	for _, s := range segments {
+		if s.fromClient {
+			pkts = append(pkts, createPacketWithSeqAndAck(ip1, ip2, port1, port2, s.data, clientSeq, serverSeq))
+			clientSeq += uint32(len(s.data))
+		} else {
+			pkts = append(pkts, createPacketWithSeqAndAck(ip2, ip1, port2, port1, s.data, serverSeq, clientSeq))
+			serverSeq += uint32(len(s.data))
+		}
+	}
+	return pkts
+}
+
+// Parses the given packets with WebSocket messages captured, and returns the
+// WebSocket messages emitted.
+func parseWebSocketPackets(t *testing.T, pkts []gopacket.Packet) []akinet.HTTPRequest {
+	pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := NewWebSocketConnections(pool)
+
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	out, err := setupParseFromInterface(
+		fakePcap(pkts),
+		closeChan,
+		newWebSocketUpgradeParserFactory(NewHTTPRequestParserFactory(pool), conns),
+		newWebSocketUpgradeParserFactory(akihttp.NewHTTPResponseParserFactory(pool), conns),
+		NewWebSocketParserFactory(conns),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error setting up listener: %v", err)
+	}
+
+	var messages []akinet.HTTPRequest
+	for pnt := range out {
+		if req, ok := pnt.Content.(akinet.HTTPRequest); ok && learn.WebSocketMessageSender(req) != "" {
+			// Copy the body before its buffer is released.
+			req.Body = req.Body.DeepCopy()
+			messages = append(messages, req)
+		}
+		pnt.Content.ReleaseBuffers()
+	}
+	return messages
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	type segment = struct {
+		fromClient bool
+		data       []byte
+	}
+
+	// The server's first message arrives in the same segment as the upgrade
+	// response. The client's message is split across two frames, with a ping
+	// between them.
+	serverFirst := append([]byte(webSocketUpgradeResponse), makeWebSocketFrame(true, webSocketText, false, []byte("welcome"))...)
+	clientMessage := append(makeWebSocketFrame(false, webSocketText, true, []byte(`{"user": "alice", `)),
+		makeWebSocketFrame(true, webSocketPing, true, nil)...)
+	clientMessage = append(clientMessage, makeWebSocketFrame(true, webSocketContinuation, true, []byte(`"password": "hunter2"}`))...)
+
+	messages := parseWebSocketPackets(t, makeWebSocketPackets([]segment{
+		{true, []byte(webSocketUpgradeRequest)},
+		{false, serverFirst},
+		{true, clientMessage},
+		{false, makeWebSocketFrame(true, webSocketBinary, false, []byte{1, 2, 3, 4, 5})},
+		{true, makeWebSocketFrame(true, webSocketClose, true, []byte{0x03, 0xe8})},
+		{false, makeWebSocketFrame(true, webSocketClose, false, []byte{0x03, 0xe8})},
+	}))
+	if !assert.Len(t, messages, 3) {
+		return
+	}
+
+	// The two sides are reassembled separately, so messages from the client
+	// and the server may be interleaved in either order.
+	var fromClient, fromServer []akinet.HTTPRequest
+	for _, m := range messages {
+		assert.Equal(t, "GET", m.Method)
+		assert.Equal(t, "example.com", m.Host)
+		assert.Equal(t, "/chat", m.URL.String(), "query parameters of the upgrade request are dropped")
+		if learn.WebSocketMessageSender(m) == learn.WebSocketFromClient {
+			fromClient = append(fromClient, m)
+		} else {
+			fromServer = append(fromServer, m)
+		}
+	}
+	if !assert.Len(t, fromClient, 1) || !assert.Len(t, fromServer, 2) {
+		return
+	}
+
+	// Text messages are captured in full.
+	assert.Equal(t, "text/plain; charset=utf-8", fromServer[0].Header.Get("Content-Type"))
+	assert.Equal(t, "welcome", fromServer[0].Body.String())
+
+	assert.Equal(t, "application/json", fromClient[0].Header.Get("Content-Type"))
+	assert.Equal(t, `{"user": "alice", "password": "hunter2"}`, fromClient[0].Body.String())
+
+	// Binary messages are captured with only their size.
+	assert.Equal(t, int64(0), fromServer[1].Body.Len())
+	assert.Equal(t, "5", fromServer[1].Header.Get("Content-Length"))
+
+	assert.NotEqual(t, fromServer[0].Seq, fromServer[1].Seq)
+	assert.NotEqual(t, fromClient[0].Seq, fromServer[1].Seq)
+}
+
+func TestWebSocketMessageLimits(t *testing.T) {
+	type segment = struct {
+		fromClient bool
+		data       []byte
+	}
+
+	large := make([]byte, maxWebSocketMessageSize_bytes+1)
+	for i := range large {
+		large[i] = 'a'
+	}
+	segments := []segment{
+		{true, []byte(webSocketUpgradeRequest)},
+		{false, []byte(webSocketUpgradeResponse)},
+	}
+	// The large message is split across segments.
+	frame := makeWebSocketFrame(true, webSocketText, false, large)
+	for len(frame) > 0 {
+		n := 8 * 1024
+		if n > len(frame) {
+			n = len(frame)
+		}
+		segments = append(segments, segment{false, frame[:n]})
+		frame = frame[n:]
+	}
+	// Only some of these are captured.
+	for i := 0; i < maxWebSocketMessagesPerConnection; i++ {
+		segments = append(segments, segment{true, makeWebSocketFrame(true, webSocketText, true, []byte("hi"))})
+	}
+	segments = append(segments,
+		segment{true, makeWebSocketFrame(true, webSocketClose, true, nil)},
+		segment{false, makeWebSocketFrame(true, webSocketClose, false, nil)},
+	)
+
+	messages := parseWebSocketPackets(t, makeWebSocketPackets(segments))
+	if !assert.Len(t, messages, maxWebSocketMessagesPerConnection) {
+		return
+	}
+
+	fromServer := 0
+	for _, m := range messages {
+		if learn.WebSocketMessageSender(m) == learn.WebSocketFromServer {
+			// Large text messages are captured with only their size.
+			fromServer++
+			assert.Equal(t, int64(0), m.Body.Len())
+			assert.Equal(t, "65537", m.Header.Get("Content-Length"))
+		} else {
+			assert.Equal(t, "hi", m.Body.String())
+		}
+	}
+	assert.Equal(t, 1, fromServer)
+}
+
+func TestWebSocketMessagesRequireUpgrade(t *testing.T) {
+	type segment = struct {
+		fromClient bool
+		data       []byte
+	}
+
+	messages := parseWebSocketPackets(t, makeWebSocketPackets([]segment{
+		{true, []byte(webSocketUpgradeRequest)},
+		{false, []byte(webSocketRefusedResponse)},
+		{true, makeWebSocketFrame(true, webSocketText, true, []byte("hello"))},
+	}))
+	assert.Empty(t, messages)
+}
+
+func TestWebSocketParsersOnlyWhenCaptured(t *testing.T) {
+	pool, err := buffer_pool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	names := func(facts []akinet.TCPParserFactory) []string {
+		var result []string
+		for _, f := range facts {
+			result = append(result, f.Name())
+		}
+		return result
+	}
+
+	without := newParserFactories(pool, false, false)
+	with := newParserFactories(pool, false, true)
+	assert.Equal(t, len(without)+1, len(with))
+	assert.NotContains(t, names(without), NewWebSocketParserFactory(nil).Name())
+	assert.Contains(t, names(with), NewWebSocketParserFactory(nil).Name())
+}
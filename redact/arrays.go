@@ -0,0 +1,88 @@
+package redact
+
+import (
+	"sync/atomic"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Limits the number of elements recorded in each array in request and
+// response bodies, so that list-heavy APIs don't bloat witnesses. The first
+// elements of each array are kept, and the witnesses truncated and elements
+// omitted are counted for the capture summary. Implements plugin.AkitaPlugin.
+type ArrayLimiter struct {
+	max int
+
+	// Accessed atomically, since plugins are shared by the collectors for all
+	// interfaces.
+	truncated int64
+	omitted   int64
+}
+
+var _ plugin.AkitaPlugin = (*ArrayLimiter)(nil)
+
+// Creates a limiter that keeps at most max elements of each array.
+func NewArrayLimiter(max int) *ArrayLimiter {
+	return &ArrayLimiter{max: max}
+}
+
+func (l *ArrayLimiter) Name() string {
+	return "array limiter"
+}
+
+func (l *ArrayLimiter) Transform(m *pb.Method) error {
+	var omitted int64
+	for _, datas := range []map[string]*pb.Data{m.Args, m.Responses} {
+		for _, datum := range datas {
+			if isBody(datum) {
+				omitted += l.truncate(datum)
+			}
+		}
+	}
+	if omitted > 0 {
+		atomic.AddInt64(&l.truncated, 1)
+		atomic.AddInt64(&l.omitted, omitted)
+	}
+	return nil
+}
+
+// Returns the number of witnesses whose arrays were truncated.
+func (l *ArrayLimiter) Truncated() int64 {
+	return atomic.LoadInt64(&l.truncated)
+}
+
+// Returns the number of array elements omitted from all witnesses.
+func (l *ArrayLimiter) Omitted() int64 {
+	return atomic.LoadInt64(&l.omitted)
+}
+
+// Truncates the arrays in the given datum. Returns the number of elements
+// omitted.
+func (l *ArrayLimiter) truncate(datum *pb.Data) int64 {
+	var omitted int64
+	switch v := datum.GetValue().(type) {
+	case *pb.Data_Struct:
+		for _, field := range v.Struct.GetFields() {
+			omitted += l.truncate(field)
+		}
+
+	case *pb.Data_List:
+		if elems := v.List.GetElems(); len(elems) > l.max {
+			omitted += int64(len(elems) - l.max)
+			v.List.Elems = elems[:l.max]
+		}
+		for _, elem := range v.List.GetElems() {
+			omitted += l.truncate(elem)
+		}
+
+	case *pb.Data_Optional:
+		omitted += l.truncate(v.Optional.GetData())
+
+	case *pb.Data_Oneof:
+		for _, option := range v.Oneof.GetOptions() {
+			omitted += l.truncate(option)
+		}
+	}
+	return omitted
+}
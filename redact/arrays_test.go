@@ -0,0 +1,96 @@
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrayLimiter(t *testing.T) {
+	// 100 users, each with 3 tags.
+	users := make([]string, 100)
+	for i := range users {
+		users[i] = fmt.Sprintf(`{"name": "user%d", "api_secret": "secret%d", "tags": ["a", "b", "c"]}`, i, i)
+	}
+	resp := akinet.HTTPResponse{
+		StreamID:   uuid.New(),
+		Seq:        1,
+		StatusCode: 200,
+		Header: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+		Body: memview.New([]byte(`{"users": [` + strings.Join(users, ",") + `]}`)),
+	}
+	partial, err := learn.ParseHTTP(resp)
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := &pb.Method{
+		Meta:      &pb.MethodMeta{Meta: &pb.MethodMeta_Http{Http: &pb.HTTPMethodMeta{Method: "GET", PathTemplate: "/users"}}},
+		Args:      map[string]*pb.Data{},
+		Responses: partial.Witness.GetMethod().GetResponses(),
+	}
+
+	// Limit arrays, then redact, as the plugins are ordered in apidump.
+	redactor, err := NewKeyPatternRedactor([]string{"*secret*"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	limiter := NewArrayLimiter(2)
+	assert.NoError(t, limiter.Transform(m))
+	assert.NoError(t, redactor.Transform(m))
+
+	text := proto.MarshalTextString(m)
+	assert.Contains(t, text, "user0")
+	assert.Contains(t, text, "user1")
+	assert.NotContains(t, text, "user2")
+
+	// Each kept user keeps only its first two tags.
+	assert.Equal(t, 4, strings.Count(text, `value: "a"`)+strings.Count(text, `value: "b"`))
+	assert.NotContains(t, text, `value: "c"`)
+
+	// Redaction applies to the kept elements.
+	assert.NotContains(t, text, "secret0")
+	assert.Equal(t, 2, strings.Count(text, RedactedValue))
+
+	// 98 users and one tag from each of the 2 kept users were omitted, and
+	// counted without adding anything to the witness.
+	assert.Equal(t, 1, len(m.Responses))
+	assert.Equal(t, int64(1), limiter.Truncated())
+	assert.Equal(t, int64(100), limiter.Omitted())
+}
+
+func TestArrayLimiterSmallArrays(t *testing.T) {
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/doggos"},
+		Host:     "example.com",
+		Header: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+		Body: memview.New([]byte(`{"toys": ["ball", "rope"]}`)),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := partial.Witness.GetMethod()
+	before := proto.MarshalTextString(m)
+
+	limiter := NewArrayLimiter(2)
+	assert.NoError(t, limiter.Transform(m))
+	assert.Equal(t, before, proto.MarshalTextString(m))
+	assert.Equal(t, int64(0), limiter.Truncated())
+	assert.Equal(t, int64(0), limiter.Omitted())
+}
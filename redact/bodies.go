@@ -0,0 +1,175 @@
+package redact
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util/ir_hash"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Determines which HTTP bodies are kept in witnesses.
+type BodyCaptureMode string
+
+const (
+	CaptureRequestBodies  BodyCaptureMode = "request"
+	CaptureResponseBodies BodyCaptureMode = "response"
+	CaptureAllBodies      BodyCaptureMode = "both"
+	CaptureNoBodies       BodyCaptureMode = "none"
+)
+
+var bodyCaptureModes = []BodyCaptureMode{
+	CaptureRequestBodies,
+	CaptureResponseBodies,
+	CaptureAllBodies,
+	CaptureNoBodies,
+}
+
+func ParseBodyCaptureMode(s string) (BodyCaptureMode, error) {
+	for _, m := range bodyCaptureModes {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+	return "", errors.Errorf("invalid body capture mode %q; must be one of request, response, both, or none", s)
+}
+
+func (m BodyCaptureMode) keepsRequestBodies() bool {
+	return m == CaptureRequestBodies || m == CaptureAllBodies
+}
+
+func (m BodyCaptureMode) keepsResponseBodies() bool {
+	return m == CaptureResponseBodies || m == CaptureAllBodies
+}
+
+// Drops request or response bodies from witnesses, according to a
+// BodyCaptureMode. Headers, cookies, query parameters, path parameters, and
+// response codes are kept. Implements plugin.AkitaPlugin.
+type BodyFilter struct {
+	mode BodyCaptureMode
+}
+
+var _ plugin.AkitaPlugin = (*BodyFilter)(nil)
+
+func NewBodyFilter(mode BodyCaptureMode) *BodyFilter {
+	return &BodyFilter{mode: mode}
+}
+
+func (f *BodyFilter) Name() string {
+	return "body filter"
+}
+
+func (f *BodyFilter) Transform(m *pb.Method) error {
+	if !f.mode.keepsRequestBodies() {
+		removeBodies(m.Args)
+	}
+
+	if !f.mode.keepsResponseBodies() {
+		removeResponseBodies(m)
+	}
+
+	return nil
+}
+
+// Keeps the bodies of only a sampled fraction of witnesses, dropping the
+// bodies of the rest. The decision is made independently for each witness.
+// Witnesses without bodies keep their headers, cookies, query parameters,
+// path parameters, and response codes, so every witness still contributes to
+// the endpoint's metadata. Implements plugin.AkitaPlugin.
+type BodySampler struct {
+	rate float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+var _ plugin.AkitaPlugin = (*BodySampler)(nil)
+
+// Keeps bodies in the given fraction of witnesses, between 0.0 and 1.0.
+func NewBodySampler(rate float64) *BodySampler {
+	return newBodySamplerWithSource(rate, rand.NewSource(time.Now().UnixNano()))
+}
+
+func newBodySamplerWithSource(rate float64, src rand.Source) *BodySampler {
+	return &BodySampler{
+		rate: rate,
+		rng:  rand.New(src),
+	}
+}
+
+func (s *BodySampler) Name() string {
+	return "body sampler"
+}
+
+func (s *BodySampler) Transform(m *pb.Method) error {
+	if s.keepBodies() {
+		return nil
+	}
+
+	removeBodies(m.Args)
+	removeResponseBodies(m)
+	return nil
+}
+
+func (s *BodySampler) keepBodies() bool {
+	if s.rate >= 1.0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.rate
+}
+
+// Removes all response bodies from the given method, keeping its response
+// code.
+func removeResponseBodies(m *pb.Method) {
+	responseCodes := removeBodies(m.Responses)
+
+	// The response code is recorded in the metadata of each response datum.
+	// If removing the body left nothing to carry the response code, record it
+	// with an empty response instead.
+	if len(m.Responses) == 0 {
+		for _, code := range responseCodes {
+			d := &pb.Data{
+				Meta: &pb.DataMeta{
+					Meta: &pb.DataMeta_Http{
+						Http: &pb.HTTPMeta{
+							Location:     &pb.HTTPMeta_Empty{Empty: &pb.HTTPEmpty{}},
+							ResponseCode: code,
+						},
+					},
+				},
+			}
+			m.Responses[ir_hash.HashDataToString(d)] = d
+		}
+	}
+}
+
+// Removes all body data from the given map, returning the response codes of
+// the removed data.
+func removeBodies(datas map[string]*pb.Data) []int32 {
+	var responseCodes []int32
+	for k, d := range datas {
+		if !isBody(d) {
+			continue
+		}
+		responseCodes = append(responseCodes, d.GetMeta().GetHttp().GetResponseCode())
+		delete(datas, k)
+	}
+	return responseCodes
+}
+
+// Returns true if the given datum came from an HTTP body, including multipart
+// bodies.
+func isBody(d *pb.Data) bool {
+	switch d.GetMeta().GetHttp().GetLocation().(type) {
+	case *pb.HTTPMeta_Body, *pb.HTTPMeta_Multipart:
+		return true
+	}
+	return false
+}
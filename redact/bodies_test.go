@@ -0,0 +1,150 @@
+package redact
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"testing"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a witness for a JSON request and response. If responseHeaders is
+// false, the response's only datum is its body. (Content-Type is recorded as
+// part of the body.)
+func makeBodyTestWitness(t *testing.T, responseHeaders bool) *pb.Method {
+	streamID := uuid.New()
+	req := akinet.HTTPRequest{
+		StreamID: streamID,
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/doggos"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"X-Request-Id": {"abc"},
+		},
+		Body: memview.New([]byte(`{"name": "prince"}`)),
+	}
+	resp := akinet.HTTPResponse{
+		StreamID:   streamID,
+		Seq:        1,
+		StatusCode: 201,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       memview.New([]byte(`{"id": 123}`)),
+	}
+	if responseHeaders {
+		resp.Header.Set("X-Response-Id", "def")
+	}
+
+	reqPartial, err := learn.ParseHTTP(req)
+	assert.NoError(t, err)
+	respPartial, err := learn.ParseHTTP(resp)
+	assert.NoError(t, err)
+	learn.MergeWitness(reqPartial.Witness, respPartial.Witness)
+	return reqPartial.Witness.Method
+}
+
+func countBodies(datas map[string]*pb.Data) int {
+	n := 0
+	for _, d := range datas {
+		if spec_util.HTTPBodyFromData(d) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func responseCodes(datas map[string]*pb.Data) map[int32]struct{} {
+	codes := map[int32]struct{}{}
+	for _, d := range datas {
+		codes[d.GetMeta().GetHttp().GetResponseCode()] = struct{}{}
+	}
+	return codes
+}
+
+func TestBodyFilter(t *testing.T) {
+	testCases := []struct {
+		mode            BodyCaptureMode
+		responseHeaders bool
+
+		expectRequestBodies  int
+		expectResponseBodies int
+	}{
+		{CaptureAllBodies, true, 1, 1},
+		{CaptureRequestBodies, true, 1, 0},
+		{CaptureResponseBodies, true, 0, 1},
+		{CaptureNoBodies, true, 0, 0},
+		{CaptureRequestBodies, false, 1, 0},
+		{CaptureNoBodies, false, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		name := string(tc.mode)
+		if !tc.responseHeaders {
+			name += " without response headers"
+		}
+
+		m := makeBodyTestWitness(t, tc.responseHeaders)
+		assert.NoError(t, NewBodyFilter(tc.mode).Transform(m), "["+name+"]")
+
+		assert.Equal(t, tc.expectRequestBodies, countBodies(m.Args), "["+name+"] request bodies")
+		assert.Equal(t, tc.expectResponseBodies, countBodies(m.Responses), "["+name+"] response bodies")
+
+		// Request headers and the response code are always kept.
+		assert.Equal(t, 1, len(m.Args)-tc.expectRequestBodies, "["+name+"] request headers")
+		assert.Equal(t, map[int32]struct{}{201: {}}, responseCodes(m.Responses), "["+name+"] response code")
+	}
+}
+
+func TestBodySampler(t *testing.T) {
+	const numWitnesses = 1000
+	sampler := newBodySamplerWithSource(0.5, rand.NewSource(1))
+
+	withBodies := 0
+	for i := 0; i < numWitnesses; i++ {
+		m := makeBodyTestWitness(t, true)
+		assert.NoError(t, sampler.Transform(m))
+
+		requestBodies, responseBodies := countBodies(m.Args), countBodies(m.Responses)
+		assert.Equal(t, requestBodies, responseBodies, "request and response bodies are sampled together")
+		if requestBodies > 0 {
+			withBodies++
+		}
+
+		// Metadata is always kept.
+		assert.Equal(t, "POST", m.GetMeta().GetHttp().GetMethod())
+		assert.Equal(t, "/v1/doggos", m.GetMeta().GetHttp().GetPathTemplate())
+		assert.Equal(t, 1, len(m.Args)-requestBodies, "request headers")
+		assert.Equal(t, 1, len(m.Responses)-responseBodies, "response headers")
+		assert.Equal(t, map[int32]struct{}{201: {}}, responseCodes(m.Responses), "response code")
+	}
+
+	// Roughly half of the witnesses keep their bodies.
+	assert.InDelta(t, numWitnesses/2, withBodies, numWitnesses/10)
+}
+
+func TestBodySamplerKeepsResponseCodeWithoutHeaders(t *testing.T) {
+	m := makeBodyTestWitness(t, false)
+	assert.NoError(t, NewBodySampler(0.0).Transform(m))
+
+	assert.Equal(t, 0, countBodies(m.Args))
+	assert.Equal(t, 0, countBodies(m.Responses))
+	assert.Equal(t, map[int32]struct{}{201: {}}, responseCodes(m.Responses))
+}
+
+func TestParseBodyCaptureMode(t *testing.T) {
+	for _, s := range []string{"request", "response", "both", "none", "NONE"} {
+		_, err := ParseBodyCaptureMode(s)
+		assert.NoError(t, err, "["+s+"]")
+	}
+
+	_, err := ParseBodyCaptureMode("headers")
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package redact
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	"sigs.k8s.io/yaml"
+)
+
+// Redaction rules read from a local file, for deployments that configure
+// redaction alongside the agent rather than on the command line. The file is
+// YAML or JSON, as in:
+//
+//	key_patterns:
+//	  - "x-internal-token"
+//	  - "/_secret$/"
+//	value_patterns:
+//	  - "^sk_live_"
+type Config struct {
+	// Patterns for the names of fields, headers, query parameters, and cookies
+	// whose values are redacted; see parseKeyPattern for their syntax.
+	KeyPatterns []string `json:"key_patterns"`
+
+	// Regular expressions for string values that are redacted wherever they
+	// appear.
+	ValuePatterns []string `json:"value_patterns"`
+}
+
+// Reads redaction rules from a YAML or JSON file. Unknown keys are rejected,
+// so that a misspelled rule isn't silently ignored.
+func LoadConfig(filename string) (*Config, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read redaction config %s", filename)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(bs, &c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse redaction config %s", filename)
+	}
+	return &c, nil
+}
+
+// Returns the plugins that apply the config's rules, after checking that
+// they are valid. The given key patterns, e.g. from the command line, are
+// combined with the config's; a value matched by either is redacted.
+func (c *Config) Plugins(keyPatterns []string) ([]plugin.AkitaPlugin, error) {
+	var plugins []plugin.AkitaPlugin
+
+	patterns := append(append([]string{}, c.KeyPatterns...), keyPatterns...)
+	if len(patterns) > 0 {
+		r, err := NewKeyPatternRedactor(patterns)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, r)
+	}
+
+	if len(c.ValuePatterns) > 0 {
+		r, err := NewValuePatternRedactor(c.ValuePatterns)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, r)
+	}
+
+	return plugins, nil
+}
@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, name, contents string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadConfig(t *testing.T) {
+	expected := &Config{
+		KeyPatterns:   []string{"x-internal-token", "/_secret$/"},
+		ValuePatterns: []string{"^sk_live_"},
+	}
+
+	yamlFile := writeConfig(t, "redaction.yaml", `
+key_patterns:
+  - x-internal-token
+  - "/_secret$/"
+value_patterns:
+  - "^sk_live_"
+`)
+	c, err := LoadConfig(yamlFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, c)
+	}
+
+	jsonFile := writeConfig(t, "redaction.json", `{"key_patterns": ["x-internal-token", "/_secret$/"], "value_patterns": ["^sk_live_"]}`)
+	c, err = LoadConfig(jsonFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, c)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+
+	// Misspelled keys are rejected.
+	_, err = LoadConfig(writeConfig(t, "typo.yaml", "key_pattern:\n  - secret\n"))
+	assert.Error(t, err)
+}
+
+func TestConfigPlugins(t *testing.T) {
+	c := &Config{
+		KeyPatterns:   []string{"x-internal-token"},
+		ValuePatterns: []string{"^sk_live_"},
+	}
+	plugins, err := c.Plugins([]string{"*secret*"})
+	if !assert.NoError(t, err) || !assert.Len(t, plugins, 2) {
+		return
+	}
+	keys, ok := plugins[0].(*KeyPatternRedactor)
+	if assert.True(t, ok) {
+		assert.True(t, keys.matches("X-Internal-Token"))
+		assert.True(t, keys.matches("client_secret"))
+	}
+	_, ok = plugins[1].(*ValuePatternRedactor)
+	assert.True(t, ok)
+
+	// Invalid patterns are reported.
+	_, err = (&Config{ValuePatterns: []string{"(unclosed"}}).Plugins(nil)
+	assert.Error(t, err)
+
+	// An empty config has no plugins.
+	plugins, err = (&Config{}).Plugins(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, plugins)
+}
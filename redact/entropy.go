@@ -0,0 +1,148 @@
+package redact
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	. "github.com/akitasoftware/akita-libs/visitors"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+const (
+	// Replaces string values that are redacted.
+	RedactedValue = "*REDACTED*"
+
+	// Strings shorter than this are not considered for entropy-based redaction.
+	DefaultMinEntropyLength = 20
+
+	// Strings whose Shannon entropy is at least this many bits per character
+	// are redacted. Random alphanumeric tokens are typically above 4.5, while
+	// most identifiers fall below 4. UUIDs are close to 4, so fields containing
+	// them may need to be allowlisted.
+	DefaultMinEntropy_bits = 4.0
+)
+
+// Configuration for redacting string values that look like randomly generated
+// secrets, such as API keys, based on their length and Shannon entropy.
+type EntropyConfig struct {
+	// Only strings of at least this many characters are redacted.
+	MinLength int
+
+	// Only strings with at least this much entropy, in bits per character, are
+	// redacted.
+	MinEntropy_bits float64
+
+	// Names of fields, headers, query parameters, and cookies whose values are
+	// never redacted. Matching is case-insensitive.
+	AllowedNames []string
+}
+
+// Redacts high-entropy string values from witnesses. Implements
+// plugin.AkitaPlugin so it can run alongside other witness transformations.
+type EntropyRedactor struct {
+	minLength       int
+	minEntropy_bits float64
+	allowedNames    map[string]struct{}
+}
+
+var _ plugin.AkitaPlugin = (*EntropyRedactor)(nil)
+
+func NewEntropyRedactor(cfg EntropyConfig) *EntropyRedactor {
+	allowed := make(map[string]struct{}, len(cfg.AllowedNames))
+	for _, n := range cfg.AllowedNames {
+		allowed[strings.ToLower(n)] = struct{}{}
+	}
+	return &EntropyRedactor{
+		minLength:       cfg.MinLength,
+		minEntropy_bits: cfg.MinEntropy_bits,
+		allowedNames:    allowed,
+	}
+}
+
+func (r *EntropyRedactor) Name() string {
+	return "high-entropy redactor"
+}
+
+func (r *EntropyRedactor) Transform(m *pb.Method) error {
+	v := entropyRedactionVisitor{redactor: r}
+	vis.Apply(&v, m)
+	return nil
+}
+
+// Returns true if the given value, found in a field with the given name,
+// should be redacted.
+func (r *EntropyRedactor) shouldRedact(name string, value string) bool {
+	if len(value) < r.minLength {
+		return false
+	}
+	// Secrets don't contain whitespace, but natural-language text, which can
+	// have high entropy, does.
+	if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return false
+	}
+	if _, allowed := r.allowedNames[strings.ToLower(name)]; allowed {
+		return false
+	}
+	return ShannonEntropy(value) >= r.minEntropy_bits
+}
+
+// Returns the Shannon entropy of the given string, in bits per character.
+func ShannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, c := range s {
+		counts[c] += 1
+		total += 1
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+type entropyRedactionVisitor struct {
+	vis.DefaultSpecVisitorImpl
+
+	redactor *EntropyRedactor
+}
+
+var _ vis.DefaultSpecVisitor = (*entropyRedactionVisitor)(nil)
+
+func (v *entropyRedactionVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	dp, isPrimitive := d.GetValue().(*pb.Data_Primitive)
+	if !isPrimitive {
+		return Continue
+	}
+
+	sv, isString := dp.Primitive.GetValue().(*pb.Primitive_StringValue)
+	if !isString || sv.StringValue == nil {
+		return Continue
+	}
+
+	if v.redactor.shouldRedact(innermostFieldName(ctx), sv.StringValue.Value) {
+		sv.StringValue.Value = RedactedValue
+	}
+	return Continue
+}
+
+// Returns the name of the innermost named field enclosing the value being
+// visited, or the empty string if there is none.
+func innermostFieldName(ctx vis.SpecVisitorContext) string {
+	path := ctx.GetFieldPath()
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].IsFieldName() {
+			return path[i].String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package redact
+
+import (
+	"strings"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// A step in a path through a body: either a named field or any element of a
+// list.
+type pathSegment struct {
+	// Field name, or "*" in a pattern to match any field. Unused for list
+	// elements.
+	field string
+
+	listElem bool
+}
+
+func (s pathSegment) matches(actual pathSegment) bool {
+	if s.listElem || actual.listElem {
+		return s.listElem && actual.listElem
+	}
+	return s.field == "*" || s.field == actual.field
+}
+
+var listElemSegment = pathSegment{listElem: true}
+
+// Parses a JSONPath expression identifying body fields to drop. Only a subset
+// of JSONPath is supported: the root "$", followed by field names (".name"),
+// wildcard fields (".*"), and wildcard list elements ("[*]"). The path must
+// end with a field.
+func parseFieldPath(s string) ([]pathSegment, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.Errorf("JSONPath %q must start with $", s)
+	}
+
+	var path []pathSegment
+	rest := s[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			path = append(path, listElemSegment)
+			rest = rest[len("[*]"):]
+
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, errors.Errorf("JSONPath %q has an empty field name", s)
+			}
+			path = append(path, pathSegment{field: rest[:end]})
+			rest = rest[end:]
+
+		default:
+			return nil, errors.Errorf("unsupported JSONPath %q; only .name, .*, and [*] are supported", s)
+		}
+	}
+
+	if len(path) == 0 || path[len(path)-1].listElem {
+		return nil, errors.Errorf("JSONPath %q must end with a field name", s)
+	}
+	return path, nil
+}
+
+// Removes fields from request and response bodies before witnesses are
+// uploaded, so they never contribute to the inferred schema. Unlike redaction,
+// which replaces values, the dropped fields are absent from the witness
+// entirely. Implements plugin.AkitaPlugin.
+type FieldDropper struct {
+	// Lower-cased names of fields dropped wherever they occur.
+	names map[string]struct{}
+
+	// Paths, from the root of the body, of fields to drop.
+	paths [][]pathSegment
+}
+
+var _ plugin.AkitaPlugin = (*FieldDropper)(nil)
+
+// Creates a FieldDropper from a list of patterns. A pattern starting with "$"
+// is a JSONPath expression (see parseFieldPath); any other pattern is a field
+// name, matched case-insensitively at any depth.
+func NewFieldDropper(patterns []string) (*FieldDropper, error) {
+	d := &FieldDropper{names: map[string]struct{}{}}
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "$") {
+			path, err := parseFieldPath(p)
+			if err != nil {
+				return nil, err
+			}
+			d.paths = append(d.paths, path)
+		} else if p != "" {
+			d.names[strings.ToLower(p)] = struct{}{}
+		}
+	}
+	return d, nil
+}
+
+func (d *FieldDropper) Name() string {
+	return "field dropper"
+}
+
+func (d *FieldDropper) Transform(m *pb.Method) error {
+	for _, datas := range []map[string]*pb.Data{m.Args, m.Responses} {
+		for _, datum := range datas {
+			if isBody(datum) {
+				d.dropFields(datum, nil)
+			}
+		}
+	}
+	return nil
+}
+
+// Removes matching fields from the given datum, which is found at the given
+// path from the root of the body.
+func (d *FieldDropper) dropFields(datum *pb.Data, path []pathSegment) {
+	switch v := datum.GetValue().(type) {
+	case *pb.Data_Struct:
+		for name, field := range v.Struct.GetFields() {
+			fieldPath := append(path[:len(path):len(path)], pathSegment{field: name})
+			if d.shouldDrop(fieldPath) {
+				delete(v.Struct.Fields, name)
+				continue
+			}
+			d.dropFields(field, fieldPath)
+		}
+
+	case *pb.Data_List:
+		elemPath := append(path[:len(path):len(path)], listElemSegment)
+		for _, elem := range v.List.GetElems() {
+			d.dropFields(elem, elemPath)
+		}
+
+	case *pb.Data_Optional:
+		d.dropFields(v.Optional.GetData(), path)
+	}
+}
+
+// Determines whether the field at the given path should be dropped.
+func (d *FieldDropper) shouldDrop(path []pathSegment) bool {
+	if _, ok := d.names[strings.ToLower(path[len(path)-1].field)]; ok {
+		return true
+	}
+
+	for _, p := range d.paths {
+		if len(p) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range p {
+			if !p[i].matches(path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
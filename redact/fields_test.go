@@ -0,0 +1,166 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const testFieldsBody = `{
+	"name": "prince",
+	"description": "a very good boy",
+	"photo": {"thumbnail": "dGh1bWJuYWls", "blob": "aGlnaHJlcw=="},
+	"toys": [{"name": "ball", "blob": "dG95"}],
+	"owner": {"name": "alice", "description": "human"}
+}`
+
+func TestFieldDropper(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		dropped  []string
+		kept     []string
+	}{
+		{
+			name:     "field name at any depth",
+			patterns: []string{"Description"},
+			dropped:  []string{"a very good boy", "human"},
+			kept:     []string{"prince", "alice", "dGh1bWJuYWls"},
+		},
+		{
+			name:     "JSONPath",
+			patterns: []string{"$.photo.blob", "$.owner"},
+			dropped:  []string{"aGlnaHJlcw==", "alice", "human"},
+			kept:     []string{"prince", "a very good boy", "dGh1bWJuYWls", "dG95"},
+		},
+		{
+			name:     "JSONPath with wildcards",
+			patterns: []string{"$.toys[*].blob", "$.*.name"},
+			dropped:  []string{"dG95", "alice"},
+			kept:     []string{"prince", "ball", "aGlnaHJlcw==", "human"},
+		},
+	}
+
+	for _, tc := range testCases {
+		req := akinet.HTTPRequest{
+			StreamID: uuid.New(),
+			Seq:      1,
+			Method:   "POST",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "example.com",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+				"Description":  {"not-a-body-field"},
+			},
+			Body: memview.New([]byte(testFieldsBody)),
+		}
+		partial, err := learn.ParseHTTP(req)
+		if !assert.NoError(t, err, "["+tc.name+"]") {
+			continue
+		}
+
+		dropper, err := NewFieldDropper(tc.patterns)
+		if !assert.NoError(t, err, "["+tc.name+"]") {
+			continue
+		}
+		m := partial.Witness.Method
+		assert.NoError(t, dropper.Transform(m), "["+tc.name+"]")
+
+		text := proto.MarshalTextString(m)
+		for _, v := range tc.dropped {
+			assert.NotContains(t, text, v, "["+tc.name+"]")
+		}
+		for _, v := range tc.kept {
+			assert.Contains(t, text, v, "["+tc.name+"]")
+		}
+
+		// Only bodies are affected.
+		assert.Contains(t, text, "not-a-body-field", "["+tc.name+"]")
+	}
+}
+
+func TestFieldDropperProtobuf(t *testing.T) {
+	// message acme.v1.Login { string username = 1; string password = 2; }
+	stringField := func(name string, number int32) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   protov2.String(name),
+			Number: protov2.Int32(number),
+			Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+	descriptors, err := protov2.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    protov2.String("acme/v1/login.proto"),
+			Package: protov2.String("acme.v1"),
+			Syntax:  protov2.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name:  protov2.String("Login"),
+				Field: []*descriptorpb.FieldDescriptorProto{stringField("username", 1), stringField("password", 2)},
+			}},
+		}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "login.pb")
+	assert.NoError(t, os.WriteFile(path, descriptors, 0644))
+	assert.NoError(t, learn.LoadProtoDescriptors(path))
+
+	var body []byte
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendString(body, "prince")
+	body = protowire.AppendTag(body, 2, protowire.BytesType)
+	body = protowire.AppendString(body, "hunter2")
+
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/login"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {`application/x-protobuf; messageType="acme.v1.Login"`},
+		},
+		Body: memview.New(body),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Field names come from the descriptor, so fields can be dropped by name.
+	dropper, err := NewFieldDropper([]string{"password"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := partial.Witness.Method
+	assert.NoError(t, dropper.Transform(m))
+
+	text := proto.MarshalTextString(m)
+	assert.Contains(t, text, "prince")
+	assert.NotContains(t, text, "hunter2")
+}
+
+func TestParseFieldPath(t *testing.T) {
+	path, err := parseFieldPath("$.items[*].blob")
+	assert.NoError(t, err)
+	assert.Equal(t, []pathSegment{{field: "items"}, listElemSegment, {field: "blob"}}, path)
+
+	for _, invalid := range []string{"$", "$.items[*]", "$..name", "$.items[0].blob", "$name"} {
+		_, err := parseFieldPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,183 @@
+package redact
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	. "github.com/akitasoftware/akita-libs/visitors"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Matches the name of a field, header, query parameter, or cookie.
+type keyPattern interface {
+	matches(name string) bool
+}
+
+// A glob, as in "*secret*" or "x-*-key", matched case-insensitively against
+// the whole name.
+type globKeyPattern string
+
+func (p globKeyPattern) matches(name string) bool {
+	ok, _ := path.Match(string(p), strings.ToLower(name))
+	return ok
+}
+
+type regexpKeyPattern struct {
+	re *regexp.Regexp
+}
+
+func (p regexpKeyPattern) matches(name string) bool {
+	return p.re.MatchString(name)
+}
+
+// Parses a key pattern. A pattern between slashes, as in "/_token_secret$/",
+// is a regular expression, which may match any part of the name; add "(?i)"
+// to match case-insensitively. Any other pattern is a glob, in which "*"
+// matches any sequence of characters, "?" matches a single character, and
+// "[...]" matches a character class.
+func parseKeyPattern(s string) (keyPattern, error) {
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regular expression in key pattern %q", s)
+		}
+		return regexpKeyPattern{re: re}, nil
+	}
+
+	glob := strings.ToLower(s)
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid glob in key pattern %q", s)
+	}
+	return globKeyPattern(glob), nil
+}
+
+// Reads key patterns from a file, one per line. Blank lines and lines
+// starting with "#" are ignored.
+func LoadKeyPatterns(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open key patterns file %s", filename)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read key patterns file %s", filename)
+	}
+	return patterns, nil
+}
+
+// Redacts the string values of fields, headers, query parameters, and cookies
+// whose names match any of a set of patterns. When an object or list field
+// matches, every string nested within it is redacted. Names in bracket
+// notation, as in "user[token]", match if any of their parts does.
+type KeyPatternRedactor struct {
+	patterns []keyPattern
+}
+
+var _ plugin.AkitaPlugin = (*KeyPatternRedactor)(nil)
+
+// Creates a redactor for the given patterns; see parseKeyPattern for their
+// syntax.
+func NewKeyPatternRedactor(patterns []string) (*KeyPatternRedactor, error) {
+	r := &KeyPatternRedactor{}
+	for _, s := range patterns {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := parseKeyPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, p)
+	}
+	if len(r.patterns) == 0 {
+		return nil, errors.New("no key patterns specified")
+	}
+	return r, nil
+}
+
+func (r *KeyPatternRedactor) Name() string {
+	return "key pattern redactor"
+}
+
+func (r *KeyPatternRedactor) Transform(m *pb.Method) error {
+	v := keyPatternRedactionVisitor{redactor: r}
+	vis.Apply(&v, m)
+	return nil
+}
+
+// Returns true if the given name, or any part of it in bracket notation,
+// matches any of the redactor's patterns.
+func (r *KeyPatternRedactor) matches(name string) bool {
+	for _, n := range keyNameParts(name) {
+		for _, p := range r.patterns {
+			if p.matches(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the given name, followed by its parts if it uses the bracket
+// notation for nested keys common in URL-encoded forms. For example,
+// "user[auth][token]" yields itself, "user", "auth", and "token".
+func keyNameParts(name string) []string {
+	i := strings.IndexByte(name, '[')
+	if i <= 0 || !strings.HasSuffix(name, "]") {
+		return []string{name}
+	}
+
+	parts := []string{name, name[:i]}
+	for _, p := range strings.Split(name[i+1:len(name)-1], "][") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+type keyPatternRedactionVisitor struct {
+	vis.DefaultSpecVisitorImpl
+
+	redactor *KeyPatternRedactor
+}
+
+var _ vis.DefaultSpecVisitor = (*keyPatternRedactionVisitor)(nil)
+
+func (v *keyPatternRedactionVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	dp, isPrimitive := d.GetValue().(*pb.Data_Primitive)
+	if !isPrimitive {
+		return Continue
+	}
+
+	sv, isString := dp.Primitive.GetValue().(*pb.Primitive_StringValue)
+	if !isString || sv.StringValue == nil {
+		return Continue
+	}
+
+	// Redact the value if it is nested anywhere within a matching field.
+	for _, elem := range ctx.GetFieldPath() {
+		if elem.IsFieldName() && v.redactor.matches(elem.String()) {
+			sv.StringValue.Value = RedactedValue
+			break
+		}
+	}
+	return Continue
+}
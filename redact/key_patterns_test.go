@@ -0,0 +1,159 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPatternMatching(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		matched []string
+		missed  []string
+	}{
+		{"*secret*", []string{"secret", "client_secret", "SECRET_KEY", "db_token_secret"}, []string{"name", "sekret"}},
+		{"*_token_secret", []string{"oauth_token_secret", "API_TOKEN_SECRET"}, []string{"token_secret", "oauth_token_secrets"}},
+		{"x-*-key", []string{"X-Api-Key", "x-partner-key"}, []string{"x-key", "X-Api-Key-Id"}},
+		{"pin?", []string{"pin1", "PIN2"}, []string{"pin", "pin12"}},
+		{"/^(access|refresh)_token$/", []string{"access_token", "refresh_token"}, []string{"Access_Token", "access_tokens", "id_token"}},
+		{"/(?i)passw(or)?d/", []string{"userPassword", "db_passwd", "PASSWORD_HASH"}, []string{"pass", "username"}},
+		{"token", []string{"token", "user[token]", "user[auth][token]", "token[]"}, []string{"user_token", "user[token", "[token]", "user[tokens]"}},
+	}
+
+	for _, tc := range testCases {
+		r, err := NewKeyPatternRedactor([]string{tc.pattern})
+		if !assert.NoError(t, err, tc.pattern) {
+			continue
+		}
+		for _, name := range tc.matched {
+			assert.True(t, r.matches(name), "%s should match %s", tc.pattern, name)
+		}
+		for _, name := range tc.missed {
+			assert.False(t, r.matches(name), "%s should not match %s", tc.pattern, name)
+		}
+	}
+}
+
+func TestInvalidKeyPatterns(t *testing.T) {
+	for _, p := range []string{"/(unclosed/", "[a-", ""} {
+		_, err := NewKeyPatternRedactor([]string{p})
+		assert.Error(t, err, p)
+	}
+}
+
+func TestKeyPatternRedactor(t *testing.T) {
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/login", RawQuery: "refresh_token=tok-query"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type":  {"application/json"},
+			"X-Partner-Key": {"tok-header"},
+		},
+		Body: memview.New([]byte(`{"user": "prince", "oauth_token_secret": "tok-body", "credentials": {"client_id": "tok-nested", "scopes": ["tok-list"]}}`)),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := NewKeyPatternRedactor([]string{"x-*-key", "*_token_secret", "/^refresh_token$/", "credential?"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := partial.Witness.Method
+	assert.NoError(t, r.Transform(m))
+
+	text := proto.MarshalTextString(m)
+	assert.NotContains(t, text, "tok-")
+	assert.Contains(t, text, "prince")
+	assert.Equal(t, 5, strings.Count(text, RedactedValue))
+}
+
+func TestKeyPatternRedactorForm(t *testing.T) {
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/login"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {"application/x-www-form-urlencoded"},
+		},
+		Body: memview.New([]byte("user=prince&api_key=tok-key&user%5Btoken%5D=tok-nested&session[auth][token]=tok-deep")),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := NewKeyPatternRedactor([]string{"api_key", "token"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := partial.Witness.Method
+	assert.NoError(t, r.Transform(m))
+
+	text := proto.MarshalTextString(m)
+	assert.NotContains(t, text, "tok-")
+	assert.Contains(t, text, "prince")
+	assert.Equal(t, 3, strings.Count(text, RedactedValue))
+}
+
+func TestLoadKeyPatterns(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "patterns")
+	contents := "# Secrets\n*secret*\n\n  x-*-key  \n/_pin$/\n"
+	if !assert.NoError(t, os.WriteFile(filename, []byte(contents), 0600)) {
+		return
+	}
+
+	patterns, err := LoadKeyPatterns(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*secret*", "x-*-key", "/_pin$/"}, patterns)
+}
+
+func TestKeyPatternRedactorWebSocketMessages(t *testing.T) {
+	redactor, err := NewKeyPatternRedactor([]string{"password"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, sender := range []string{learn.WebSocketFromClient, learn.WebSocketFromServer} {
+		msg := akinet.HTTPRequest{
+			StreamID: uuid.New(),
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/chat"},
+			Host:     "example.com",
+			Header: http.Header{
+				"Content-Type":               {"application/json"},
+				learn.WebSocketMessageHeader: {sender},
+			},
+			Body: memview.New([]byte(`{"user": "alice", "password": "hunter2"}`)),
+		}
+		partial, err := learn.ParseHTTP(msg)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		m := partial.Witness.GetMethod()
+		assert.NoError(t, redactor.Transform(m))
+		text := proto.MarshalTextString(m)
+		assert.Contains(t, text, "alice", sender)
+		assert.NotContains(t, text, "hunter2", sender)
+		assert.Equal(t, 1, strings.Count(text, RedactedValue), sender)
+	}
+}
@@ -0,0 +1,72 @@
+package redact
+
+import (
+	"sort"
+	"sync/atomic"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Limits the number of query parameters recorded in each witness, so that
+// endpoints receiving many tracking parameters don't bloat the schema.
+// Parameters are kept in order of their names, and the witnesses limited and
+// parameters omitted are counted for the capture summary. Implements
+// plugin.AkitaPlugin.
+type QueryParamLimiter struct {
+	max int
+
+	// Accessed atomically, since plugins are shared by the collectors for all
+	// interfaces.
+	limited int64
+	omitted int64
+}
+
+var _ plugin.AkitaPlugin = (*QueryParamLimiter)(nil)
+
+// Creates a limiter that keeps at most max query parameters per witness.
+func NewQueryParamLimiter(max int) *QueryParamLimiter {
+	return &QueryParamLimiter{max: max}
+}
+
+func (l *QueryParamLimiter) Name() string {
+	return "query parameter limiter"
+}
+
+func (l *QueryParamLimiter) Transform(m *pb.Method) error {
+	var keys []string
+	for k, d := range m.Args {
+		if d.GetMeta().GetHttp().GetQuery() != nil {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) <= l.max {
+		return nil
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return queryParamName(m.Args[keys[i]]) < queryParamName(m.Args[keys[j]])
+	})
+	omitted := keys[l.max:]
+	for _, k := range omitted {
+		delete(m.Args, k)
+	}
+
+	atomic.AddInt64(&l.limited, 1)
+	atomic.AddInt64(&l.omitted, int64(len(omitted)))
+	return nil
+}
+
+// Returns the number of witnesses whose query parameters were limited.
+func (l *QueryParamLimiter) Limited() int64 {
+	return atomic.LoadInt64(&l.limited)
+}
+
+// Returns the number of query parameters omitted from all witnesses.
+func (l *QueryParamLimiter) Omitted() int64 {
+	return atomic.LoadInt64(&l.omitted)
+}
+
+func queryParamName(d *pb.Data) string {
+	return d.GetMeta().GetHttp().GetQuery().GetKey()
+}
@@ -0,0 +1,67 @@
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryParamLimiter(t *testing.T) {
+	query := url.Values{"api_key": {testToken}}
+	for i := 0; i < 9; i++ {
+		query.Set(fmt.Sprintf("utm_%d", i), testShortName)
+	}
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "GET",
+		URL:      &url.URL{Path: "/v1/doggos", RawQuery: query.Encode()},
+		Host:     "example.com",
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Redaction runs before the limit is applied.
+	m := partial.Witness.Method
+	assert.NoError(t, NewEntropyRedactor(EntropyConfig{
+		MinLength:       DefaultMinEntropyLength,
+		MinEntropy_bits: DefaultMinEntropy_bits,
+	}).Transform(m))
+	limiter := NewQueryParamLimiter(3)
+	assert.NoError(t, limiter.Transform(m))
+
+	params := map[string]*pb.Data{}
+	for _, d := range m.Args {
+		params[queryParamName(d)] = d
+	}
+	assert.Equal(t, 3, len(params))
+
+	// The first parameters by name are kept, and the sensitive one among them
+	// is still redacted.
+	assert.Contains(t, params, "api_key")
+	assert.Contains(t, params, "utm_0")
+	assert.Contains(t, params, "utm_1")
+	text := proto.MarshalTextString(m)
+	assert.NotContains(t, text, testToken)
+	assert.Equal(t, 1, strings.Count(text, RedactedValue))
+
+	// The rest are counted without adding anything to the witness.
+	assert.Equal(t, int64(1), limiter.Limited())
+	assert.Equal(t, int64(7), limiter.Omitted())
+
+	// Witnesses within the limit are unchanged.
+	before := proto.MarshalTextString(m)
+	assert.NoError(t, limiter.Transform(m))
+	assert.Equal(t, before, proto.MarshalTextString(m))
+	assert.Equal(t, int64(1), limiter.Limited())
+}
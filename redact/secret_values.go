@@ -0,0 +1,76 @@
+package redact
+
+import (
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	. "github.com/akitasoftware/akita-libs/visitors"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Secrets shorter than this are ignored, since short values such as "true" or
+// "1" would match too many innocent values.
+const MinSecretValueLength = 8
+
+// Redacts string values that exactly match a known secret, such as the value
+// of an environment variable holding an API key, regardless of the name of the
+// field, header, query parameter, or cookie in which they appear. Implements
+// plugin.AkitaPlugin.
+type SecretValueRedactor struct {
+	secrets map[string]struct{}
+}
+
+var _ plugin.AkitaPlugin = (*SecretValueRedactor)(nil)
+
+// Secrets shorter than MinSecretValueLength are ignored.
+func NewSecretValueRedactor(secrets []string) *SecretValueRedactor {
+	m := make(map[string]struct{}, len(secrets))
+	for _, s := range secrets {
+		if len(s) >= MinSecretValueLength {
+			m[s] = struct{}{}
+		}
+	}
+	return &SecretValueRedactor{secrets: m}
+}
+
+// Returns the number of secrets that will be redacted.
+func (r *SecretValueRedactor) Len() int {
+	return len(r.secrets)
+}
+
+func (r *SecretValueRedactor) Name() string {
+	return "secret value redactor"
+}
+
+func (r *SecretValueRedactor) Transform(m *pb.Method) error {
+	if len(r.secrets) == 0 {
+		return nil
+	}
+	v := secretValueRedactionVisitor{redactor: r}
+	vis.Apply(&v, m)
+	return nil
+}
+
+type secretValueRedactionVisitor struct {
+	vis.DefaultSpecVisitorImpl
+
+	redactor *SecretValueRedactor
+}
+
+var _ vis.DefaultSpecVisitor = (*secretValueRedactionVisitor)(nil)
+
+func (v *secretValueRedactionVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	dp, isPrimitive := d.GetValue().(*pb.Data_Primitive)
+	if !isPrimitive {
+		return Continue
+	}
+
+	sv, isString := dp.Primitive.GetValue().(*pb.Primitive_StringValue)
+	if !isString || sv.StringValue == nil {
+		return Continue
+	}
+
+	if _, isSecret := v.redactor.secrets[sv.StringValue.Value]; isSecret {
+		sv.StringValue.Value = RedactedValue
+	}
+	return Continue
+}
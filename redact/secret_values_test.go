@@ -0,0 +1,49 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretValueRedactor(t *testing.T) {
+	// A low-entropy secret that the entropy redactor would miss, in fields
+	// whose names look innocent.
+	const secret = "password1password1"
+
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/doggos"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"X-Trace":      {secret},
+		},
+		Body: memview.New([]byte(`{"note": "` + secret + `", "other": "` + secret + `!", "name": "` + testShortName + `"}`)),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	m := partial.Witness.Method
+	r := NewSecretValueRedactor([]string{secret, "", "short"})
+	assert.Equal(t, 1, r.Len())
+	assert.NoError(t, r.Transform(m))
+
+	// Only exact matches are redacted.
+	text := proto.MarshalTextString(m)
+	assert.Contains(t, text, secret+"!")
+	assert.Contains(t, text, testShortName)
+	assert.Equal(t, 2, strings.Count(text, RedactedValue)) // Body field and header.
+}
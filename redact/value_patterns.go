@@ -0,0 +1,86 @@
+package redact
+
+import (
+	"regexp"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	. "github.com/akitasoftware/akita-libs/visitors"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+)
+
+// Redacts string values matching any of a set of regular expressions, such as
+// tokens with a recognizable prefix, regardless of the name of the field,
+// header, query parameter, or cookie in which they appear. Implements
+// plugin.AkitaPlugin.
+type ValuePatternRedactor struct {
+	patterns []*regexp.Regexp
+}
+
+var _ plugin.AkitaPlugin = (*ValuePatternRedactor)(nil)
+
+// Creates a redactor for the given regular expressions. A value is redacted
+// in full if any part of it matches.
+func NewValuePatternRedactor(patterns []string) (*ValuePatternRedactor, error) {
+	r := &ValuePatternRedactor{}
+	for _, s := range patterns {
+		if s == "" {
+			continue
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value pattern %q", s)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if len(r.patterns) == 0 {
+		return nil, errors.New("no value patterns specified")
+	}
+	return r, nil
+}
+
+func (r *ValuePatternRedactor) Name() string {
+	return "value pattern redactor"
+}
+
+func (r *ValuePatternRedactor) Transform(m *pb.Method) error {
+	v := valuePatternRedactionVisitor{redactor: r}
+	vis.Apply(&v, m)
+	return nil
+}
+
+// Returns true if the given value matches any of the redactor's patterns.
+func (r *ValuePatternRedactor) matches(value string) bool {
+	for _, re := range r.patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+type valuePatternRedactionVisitor struct {
+	vis.DefaultSpecVisitorImpl
+
+	redactor *ValuePatternRedactor
+}
+
+var _ vis.DefaultSpecVisitor = (*valuePatternRedactionVisitor)(nil)
+
+func (v *valuePatternRedactionVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	dp, isPrimitive := d.GetValue().(*pb.Data_Primitive)
+	if !isPrimitive {
+		return Continue
+	}
+
+	sv, isString := dp.Primitive.GetValue().(*pb.Primitive_StringValue)
+	if !isString || sv.StringValue == nil {
+		return Continue
+	}
+
+	if v.redactor.matches(sv.StringValue.Value) {
+		sv.StringValue.Value = RedactedValue
+	}
+	return Continue
+}
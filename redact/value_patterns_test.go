@@ -0,0 +1,55 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuePatternRedactor(t *testing.T) {
+	req := akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/charges", RawQuery: "key=sk_live_query"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"X-Trace":      {"sk_live_header"},
+		},
+		Body: memview.New([]byte(`{"user": "prince", "note": "sk_live_body", "ssn": "123-45-6789", "other": "not sk_live"}`)),
+	}
+	partial, err := learn.ParseHTTP(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := NewValuePatternRedactor([]string{`^sk_live_`, `\d{3}-\d{2}-\d{4}`})
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := partial.Witness.Method
+	assert.NoError(t, r.Transform(m))
+
+	text := proto.MarshalTextString(m)
+	assert.NotContains(t, text, "sk_live_")
+	assert.NotContains(t, text, "6789")
+	assert.Contains(t, text, "prince")
+	assert.Contains(t, text, "not sk_live")
+	assert.Equal(t, 4, strings.Count(text, RedactedValue))
+}
+
+func TestInvalidValuePatterns(t *testing.T) {
+	for _, patterns := range [][]string{{"(unclosed"}, {""}, nil} {
+		_, err := NewValuePatternRedactor(patterns)
+		assert.Error(t, err, patterns)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,6 +39,10 @@ var (
 type HTTPError struct {
 	StatusCode int
 	Body       []byte
+
+	// How long the server asked us to wait before retrying, from the
+	// Retry-After header. Zero if the header was absent or invalid.
+	RetryAfter time.Duration
 }
 
 func (he HTTPError) Error() string {
@@ -171,8 +177,34 @@ func sendRequest(ctx context.Context, req *http.Request) ([]byte, error) {
 	if respBody, err := ioutil.ReadAll(resp.Body); err != nil {
 		return nil, errors.Wrap(err, "failed to read response body")
 	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, HTTPError{StatusCode: resp.StatusCode, Body: respBody}
+		return nil, HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       respBody,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	} else {
 		return respBody, nil
 	}
 }
+
+// Parses the value of a Retry-After header, which is either a number of
+// seconds or an HTTP date. Returns zero if the value is empty, invalid, or in
+// the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
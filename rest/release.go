@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+	ver "github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+)
+
+// Describes a release, in the format of GitHub's "latest release" API.
+type releaseInfo struct {
+	TagName string `json:"tag_name"`
+}
+
+// Fetches the version of the latest release of the agent from the given
+// endpoint, which is expected to respond like GitHub's "latest release" API.
+//
+// Unlike requests to the Postman back end, this sends no credentials and
+// nothing that identifies the user or their environment.
+func GetLatestReleaseVersion(ctx context.Context, endpoint string) (*ver.Version, error) {
+	initHTTPClientOnce.Do(initHTTPClient)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create HTTP GET request")
+	}
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("user-agent", "postman-insights-agent")
+
+	retryableReq, err := retryablehttp.FromRequest(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert HTTP request into retryable request")
+	}
+	resp, err := HTTPClient.Do(retryableReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, HTTPError{StatusCode: resp.StatusCode, Body: body}
+	}
+
+	var release releaseInfo
+	if err := json.Unmarshal(body, &release); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal response body as JSON")
+	}
+	v, err := ver.NewSemver(release.TagName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid release version %q", release.TagName)
+	}
+	return v, nil
+}
@@ -1,6 +1,7 @@
 package tcp_conn_tracker
 
 import (
+	"container/list"
 	"net"
 	"sync"
 	"time"
@@ -9,35 +10,54 @@ import (
 	"github.com/akitasoftware/akita-libs/akinet"
 	"github.com/akitasoftware/akita-libs/sampled_err"
 	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/postmanlabs/postman-insights-agent/usage"
 )
 
 // Collects akinet.TCPPacketMetadata and processes them into summaries. The
 // downstream collector will receive one akinet.TCPConnectionMetadata per TCP
 // connection, summarizing what was observed about the connection.
-func NewCollector(next trace.Collector) trace.Collector {
-	return &collector{
+//
+// If a connection has no activity for limits.IdleTimeout, or must be evicted to
+// stay within limits.MaxConnections, the connection's state is flushed to the
+// downstream collector and is removed from the set of active connections. An
+// idle connection that was not seen to close is reported as still open. A
+// connection that is reset is flushed as soon as the reset is seen.
+func NewCollector(next trace.Collector, limits trace.ConnectionTrackerLimits, evictions *trace.ConnectionEvictions) trace.Collector {
+	c := &collector{
 		collector: next,
 
+		idleTimeout:    limits.IdleTimeout,
+		maxConnections: limits.MaxConnections,
+		evictions:      evictions,
+
 		closed:            false,
 		activeConnections: make(map[akid.ConnectionID]*connectionInfo),
+		lru:               list.New(),
 
 		mutex: sync.Mutex{},
 	}
+	c.unregisterSize = usage.RegisterSize("tcp_connections", c.size)
+	return c
 }
 
-// If a connection has no activity after this period of time, the connection's
-// state is flushed to the downstream collector and is removed from the set of
-// active connections.
-const connectionTimeout = 30 * time.Second
-
 type collector struct {
 	collector trace.Collector
 
+	idleTimeout    time.Duration
+	maxConnections int
+	evictions      *trace.ConnectionEvictions
+
 	closed            bool
 	activeConnections map[akid.ConnectionID]*connectionInfo
 
+	// Active connections, from least to most recently active.
+	lru *list.List
+
 	// Protects this whole object.
 	mutex sync.Mutex
+
+	// Stops reporting the number of active connections in runtime stats.
+	unregisterSize func()
 }
 
 var _ trace.Collector = (*collector)(nil)
@@ -79,7 +99,17 @@ func (c *collector) Process(packet akinet.ParsedNetworkTraffic) error {
 			return nil
 		}
 
-		info.augmentWith(packet, &tcp)
+		info.augmentWith(packet, &tcp, c.idleTimeout)
+		c.lru.MoveToBack(info.lruElement)
+
+		// A reset connection carries no further traffic, so report it now rather
+		// than when it goes idle. This lets the backend collector handle requests
+		// that will never see a response without waiting for them to expire.
+		if tcp.RST {
+			if _, err := c.flushConnection(tcp.ConnectionID); err != nil {
+				return err
+			}
+		}
 	}
 
 	return c.collector.Process(packet)
@@ -104,6 +134,7 @@ func (c *collector) close() sampled_err.Errors {
 	defer c.mutex.Unlock()
 
 	c.closed = true
+	c.unregisterSize()
 
 	err := sampled_err.Errors{SampleCount: 5}
 
@@ -128,16 +159,32 @@ func (c *collector) close() sampled_err.Errors {
 		}
 	}
 	c.activeConnections = map[akid.ConnectionID]*connectionInfo{}
+	c.lru.Init()
 
 	return err
 }
 
-// Flushes a connection if it exists. Caller must not hold c.mutex. Returns true
-// if the connection exists, false otherwise.
-func (c *collector) flushConnection(connectionID akid.ConnectionID) (bool, error) {
+// Flushes a connection that has been idle for the idle timeout, if it still
+// exists. Caller must not hold c.mutex.
+func (c *collector) expireConnection(connectionID akid.ConnectionID) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	info, exists := c.activeConnections[connectionID]
+	if !exists {
+		return
+	}
+
+	// Connections that were closed or reset are expected to go idle.
+	if info.tcpMetadata.EndState == akinet.ConnectionOpen {
+		c.evictions.RecordIdle()
+	}
+	c.flushConnection(connectionID)
+}
+
+// Flushes a connection if it exists. Caller must hold c.mutex. Returns true if
+// the connection exists, false otherwise.
+func (c *collector) flushConnection(connectionID akid.ConnectionID) (bool, error) {
 	info, exists := c.activeConnections[connectionID]
 	if !exists {
 		return false, nil
@@ -154,12 +201,22 @@ func (c *collector) flushConnection(connectionID akid.ConnectionID) (bool, error
 		FinalPacketTime: info.lastObservationTime,
 	})
 
+	info.timeout.Stop()
+	c.lru.Remove(info.lruElement)
 	delete(c.activeConnections, connectionID)
 	return true, err
 }
 
-// Adds a new connection to the collector. Caller must hold c.mutex.
+// Adds a new connection to the collector, first evicting the least recently
+// active connection if the collector is at capacity. Caller must hold c.mutex.
 func (c *collector) addConnection(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, observationTime time.Time, metadata akinet.TCPPacketMetadata) {
+	if c.maxConnections > 0 && len(c.activeConnections) >= c.maxConnections {
+		if oldest := c.lru.Front(); oldest != nil {
+			c.evictions.RecordOverflow()
+			c.flushConnection(oldest.Value.(akid.ConnectionID))
+		}
+	}
+
 	info := connectionInfo{
 		srcIP:   srcIP,
 		srcPort: srcPort,
@@ -175,10 +232,11 @@ func (c *collector) addConnection(srcIP net.IP, srcPort int, dstIP net.IP, dstPo
 			EndState:     akinet.ConnectionOpen,
 		},
 
-		timeout: time.AfterFunc(connectionTimeout, func() {
-			c.flushConnection(metadata.ConnectionID)
+		timeout: time.AfterFunc(c.idleTimeout, func() {
+			c.expireConnection(metadata.ConnectionID)
 		}),
 	}
+	info.lruElement = c.lru.PushBack(metadata.ConnectionID)
 
 	c.activeConnections[metadata.ConnectionID] = &info
 }
@@ -198,9 +256,12 @@ type connectionInfo struct {
 	// Flushes this connectionInfo to the downstream collector and removes this
 	// connectionInfo from its parent collector.
 	timeout *time.Timer
+
+	// This connection's position in the parent collector's LRU list.
+	lruElement *list.Element
 }
 
-func (info *connectionInfo) augmentWith(packet akinet.ParsedNetworkTraffic, metadata *akinet.TCPPacketMetadata) {
+func (info *connectionInfo) augmentWith(packet akinet.ParsedNetworkTraffic, metadata *akinet.TCPPacketMetadata, idleTimeout time.Duration) {
 	if packet.ObservationTime.Before(info.firstObservationTime) {
 		info.firstObservationTime = packet.ObservationTime
 	}
@@ -238,5 +299,12 @@ func (info *connectionInfo) augmentWith(packet akinet.ParsedNetworkTraffic, meta
 		info.tcpMetadata.EndState = akinet.ConnectionReset
 	}
 
-	info.timeout.Reset(connectionTimeout)
+	info.timeout.Reset(idleTimeout)
+}
+
+// Returns the number of active connections.
+func (c *collector) size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.activeConnections)
 }
@@ -0,0 +1,131 @@
+package tcp_conn_tracker
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the TCP-connection metadata that reaches it.
+type connectionRecorder struct {
+	mutex       sync.Mutex
+	connections []akinet.TCPConnectionMetadata
+}
+
+func (r *connectionRecorder) Process(t akinet.ParsedNetworkTraffic) error {
+	if c, ok := t.Content.(akinet.TCPConnectionMetadata); ok {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.connections = append(r.connections, c)
+	}
+	return nil
+}
+
+func (r *connectionRecorder) Close() error {
+	return nil
+}
+
+func (r *connectionRecorder) get() []akinet.TCPConnectionMetadata {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]akinet.TCPConnectionMetadata{}, r.connections...)
+}
+
+func makeSYN(id akid.ConnectionID, srcPort int) akinet.ParsedNetworkTraffic {
+	return akinet.ParsedNetworkTraffic{
+		SrcIP:   net.IP{10, 0, 0, 1},
+		SrcPort: srcPort,
+		DstIP:   net.IP{10, 0, 0, 2},
+		DstPort: 80,
+		Content: akinet.TCPPacketMetadata{
+			ConnectionID: id,
+			SYN:          true,
+		},
+		ObservationTime: time.Now(),
+	}
+}
+
+func TestIdleConnectionEvicted(t *testing.T) {
+	rec := &connectionRecorder{}
+	evictions := trace.NewConnectionEvictions()
+	limits := trace.ConnectionTrackerLimits{IdleTimeout: 50 * time.Millisecond}
+	col := NewCollector(rec, limits, evictions)
+
+	id := akid.NewConnectionID(uuid.New())
+	assert.NoError(t, col.Process(makeSYN(id, 50000)))
+	assert.Empty(t, rec.get())
+
+	time.Sleep(200 * time.Millisecond)
+
+	// The idle connection is reported as still open.
+	if assert.Equal(t, 1, len(rec.get())) {
+		assert.Equal(t, id, rec.get()[0].ConnectionID)
+		assert.Equal(t, akinet.ConnectionOpen, rec.get()[0].EndState)
+	}
+	assert.Equal(t, int64(1), evictions.Idle())
+	assert.Equal(t, int64(0), evictions.Overflow())
+
+	assert.NoError(t, col.Close())
+	assert.Equal(t, 1, len(rec.get()))
+}
+
+func TestOldestConnectionEvictedAtLimit(t *testing.T) {
+	rec := &connectionRecorder{}
+	evictions := trace.NewConnectionEvictions()
+	limits := trace.ConnectionTrackerLimits{IdleTimeout: time.Minute, MaxConnections: 2}
+	col := NewCollector(rec, limits, evictions)
+
+	ids := []akid.ConnectionID{
+		akid.NewConnectionID(uuid.New()),
+		akid.NewConnectionID(uuid.New()),
+		akid.NewConnectionID(uuid.New()),
+	}
+	assert.NoError(t, col.Process(makeSYN(ids[0], 50000)))
+	assert.NoError(t, col.Process(makeSYN(ids[1], 50001)))
+
+	// Activity on the first connection makes the second the least recently
+	// active.
+	assert.NoError(t, col.Process(makeSYN(ids[0], 50000)))
+
+	assert.NoError(t, col.Process(makeSYN(ids[2], 50002)))
+	if assert.Equal(t, 1, len(rec.get())) {
+		assert.Equal(t, ids[1], rec.get()[0].ConnectionID)
+	}
+	assert.Equal(t, int64(0), evictions.Idle())
+	assert.Equal(t, int64(1), evictions.Overflow())
+
+	// The remaining connections are flushed on close.
+	assert.NoError(t, col.Close())
+	assert.Equal(t, 3, len(rec.get()))
+}
+
+func TestResetConnectionFlushed(t *testing.T) {
+	rec := &connectionRecorder{}
+	evictions := trace.NewConnectionEvictions()
+	limits := trace.ConnectionTrackerLimits{IdleTimeout: time.Minute}
+	col := NewCollector(rec, limits, evictions)
+
+	id := akid.NewConnectionID(uuid.New())
+	assert.NoError(t, col.Process(makeSYN(id, 50000)))
+
+	rst := makeSYN(id, 50000)
+	rst.Content = akinet.TCPPacketMetadata{ConnectionID: id, RST: true}
+	assert.NoError(t, col.Process(rst))
+
+	// The reset connection is reported without waiting for it to go idle.
+	if assert.Equal(t, 1, len(rec.get())) {
+		assert.Equal(t, id, rec.get()[0].ConnectionID)
+		assert.Equal(t, akinet.ConnectionReset, rec.get()[0].EndState)
+	}
+	assert.Equal(t, int64(0), evictions.Idle())
+
+	assert.NoError(t, col.Close())
+	assert.Equal(t, 1, len(rec.get()))
+}
@@ -310,6 +310,75 @@ func CommandLine(command string, commandLine []string) {
 	)
 }
 
+// Report request and response body sizes aggregated across endpoints. No
+// endpoint is identified.
+func EndpointSizes(stats map[string]any) {
+	tryTrackingEvent(
+		"Endpoint Sizes - Observed",
+		stats,
+	)
+}
+
+// Report body shapes aggregated across endpoints. No endpoint is identified.
+func EndpointShapes(stats map[string]any) {
+	tryTrackingEvent(
+		"Endpoint Shapes - Observed",
+		stats,
+	)
+}
+
+// Report request rates aggregated across endpoints. No endpoint is
+// identified.
+func EndpointRates(stats map[string]any) {
+	tryTrackingEvent(
+		"Endpoint Rates - Observed",
+		stats,
+	)
+}
+
+// Report how much witnesses waited to be redacted.
+func RedactionQueue(stats map[string]any) {
+	tryTrackingEvent(
+		"Redaction Queue - Observed",
+		stats,
+	)
+}
+
+// Report Go runtime statistics and the sizes of internal data structures.
+func RuntimeStats(stats map[string]any) {
+	tryTrackingEvent(
+		"Runtime Stats - Observed",
+		stats,
+	)
+}
+
+// Report TCP retransmissions and zero-window advertisements, in total and for
+// the ports with the most of them.
+func TCPHealth(retransmissions, zeroWindows int, ports []map[string]any) {
+	tryTrackingEvent(
+		"TCP Health - Observed",
+		map[string]any{
+			"retransmissions": retransmissions,
+			"zero_windows":    zeroWindows,
+			"ports":           ports,
+		},
+	)
+}
+
+// Report that capture was paused or resumed.
+func CapturePaused(paused bool, droppedWhilePaused int64) {
+	event := "Capture - Resumed"
+	if paused {
+		event = "Capture - Paused"
+	}
+	tryTrackingEvent(
+		event,
+		map[string]any{
+			"dropped_while_paused": droppedWhilePaused,
+		},
+	)
+}
+
 // Report the platform and version of an attempted integration
 func InstallIntegrationVersion(integration, arch, platform, version string) {
 	tryTrackingEvent(
@@ -1,6 +1,7 @@
 package tls_conn_tracker
 
 import (
+	"container/list"
 	"net"
 	"sync"
 	"time"
@@ -8,36 +9,54 @@ import (
 	"github.com/akitasoftware/akita-libs/akid"
 	"github.com/akitasoftware/akita-libs/akinet"
 	"github.com/postmanlabs/postman-insights-agent/trace"
+	"github.com/postmanlabs/postman-insights-agent/usage"
 )
 
 // Collects akinet.TLSClientHello and akinet.TLSServerHello messages and
 // processes them into TLS-connection metadata. The downstream collector will
 // receive one akinet.TLSConnectionMetadata per completed TLS handshake,
 // summarizing what was observed about the handshake.
-func NewCollector(next trace.Collector) trace.Collector {
-	return &collector{
+//
+// If a connection with a partial handshake has no activity for
+// limits.IdleTimeout, the connection is assumed to have died, and its state is
+// garbage-collected. The least recently active partial handshake is likewise
+// discarded to stay within limits.MaxConnections.
+func NewCollector(next trace.Collector, limits trace.ConnectionTrackerLimits, evictions *trace.ConnectionEvictions) trace.Collector {
+	c := &collector{
 		collector: next,
 
+		idleTimeout:    limits.IdleTimeout,
+		maxConnections: limits.MaxConnections,
+		evictions:      evictions,
+
 		closed:            false,
 		activeConnections: make(map[akid.ConnectionID]*connectionInfo),
+		lru:               list.New(),
 
 		mutex: sync.Mutex{},
 	}
+	c.unregisterSize = usage.RegisterSize("tls_connections", c.size)
+	return c
 }
 
-// If a connection with a partial handshake has no activity after this period of
-// time, the connection is assumed to have died, and its state is
-// garbage-collected.
-const connectionTimeout = 30 * time.Second
-
 type collector struct {
 	collector trace.Collector
 
+	idleTimeout    time.Duration
+	maxConnections int
+	evictions      *trace.ConnectionEvictions
+
 	closed            bool
 	activeConnections map[akid.ConnectionID]*connectionInfo
 
+	// Active connections, from least to most recently active.
+	lru *list.List
+
 	// Protects this whole object.
 	mutex sync.Mutex
+
+	// Stops reporting the number of active connections in runtime stats.
+	unregisterSize func()
 }
 
 var _ trace.Collector = (*collector)(nil)
@@ -100,6 +119,7 @@ func (c *collector) Close() error {
 	defer c.mutex.Unlock()
 
 	c.closed = true
+	c.unregisterSize()
 
 	// Cancel the timeouts of all active connections and clear out those
 	// connections.
@@ -107,6 +127,7 @@ func (c *collector) Close() error {
 		info.timeout.Stop()
 	}
 	c.activeConnections = map[akid.ConnectionID]*connectionInfo{}
+	c.lru.Init()
 
 	return c.collector.Close()
 }
@@ -119,12 +140,26 @@ func (c *collector) ensureConnection(id akid.ConnectionID, packet akinet.ParsedN
 		// This is either a connection that we have timed out and flushed, or one
 		// that the TCP-assembly layer thinks it hasn't seen before.
 		info = c.addConnection(id, packet.SrcIP, packet.SrcPort, packet.DstIP, packet.DstPort, packet.ObservationTime)
+	} else {
+		if packet.ObservationTime.After(info.lastObservationTime) {
+			info.lastObservationTime = packet.ObservationTime
+		}
+		info.timeout.Reset(c.idleTimeout)
+		c.lru.MoveToBack(info.lruElement)
 	}
 	return info
 }
 
-// Adds a new connection to the collector. Caller must hold c.mutex.
+// Adds a new connection to the collector, first discarding the least recently
+// active connection if the collector is at capacity. Caller must hold c.mutex.
 func (c *collector) addConnection(id akid.ConnectionID, srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, observationTime time.Time) *connectionInfo {
+	if c.maxConnections > 0 && len(c.activeConnections) >= c.maxConnections {
+		if oldest := c.lru.Front(); oldest != nil {
+			c.evictions.RecordOverflow()
+			c.removeConnection(oldest.Value.(akid.ConnectionID))
+		}
+	}
+
 	info := connectionInfo{
 		srcIP:   srcIP,
 		srcPort: srcPort,
@@ -138,17 +173,32 @@ func (c *collector) addConnection(id akid.ConnectionID, srcIP net.IP, srcPort in
 			ConnectionID: id,
 		},
 
-		timeout: time.AfterFunc(connectionTimeout, func() {
+		timeout: time.AfterFunc(c.idleTimeout, func() {
 			c.mutex.Lock()
 			defer c.mutex.Unlock()
-			delete(c.activeConnections, id)
+			if _, exists := c.activeConnections[id]; exists {
+				c.evictions.RecordIdle()
+				c.removeConnection(id)
+			}
 		}),
 	}
+	info.lruElement = c.lru.PushBack(id)
 
 	c.activeConnections[id] = &info
 	return &info
 }
 
+// Discards a connection without flushing it. Caller must hold c.mutex.
+func (c *collector) removeConnection(id akid.ConnectionID) {
+	info, exists := c.activeConnections[id]
+	if !exists {
+		return
+	}
+	info.timeout.Stop()
+	c.lru.Remove(info.lruElement)
+	delete(c.activeConnections, id)
+}
+
 // Flushes a connection, if it exists, to the downstream collector. Caller must
 // hold c.mutex. Returns true if the connection exists, false otherwise.
 func (c *collector) flushConnection(id akid.ConnectionID) (bool, error) {
@@ -168,7 +218,7 @@ func (c *collector) flushConnection(id akid.ConnectionID) (bool, error) {
 		FinalPacketTime: info.lastObservationTime,
 	})
 
-	delete(c.activeConnections, id)
+	c.removeConnection(id)
 	return true, err
 }
 
@@ -187,4 +237,14 @@ type connectionInfo struct {
 	// Removes this connectionInfo from its parent collector, under the assumption
 	// that the connection has died..
 	timeout *time.Timer
+
+	// This connection's position in the parent collector's LRU list.
+	lruElement *list.Element
+}
+
+// Returns the number of active connections.
+func (c *collector) size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.activeConnections)
 }
@@ -0,0 +1,285 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/pkg/errors"
+)
+
+// An endpoint in an API surface, identified by its method and path template.
+// Path segments that might hold values, such as IDs, are replaced with
+// parameters, as in schema-only mode.
+// The host is not part of the identity, so that a baseline captured in one
+// environment can be compared against traffic in another.
+type SurfaceEndpoint struct {
+	Method       string `json:"method"`
+	PathTemplate string `json:"path_template"`
+
+	// Names of the request parameters seen for this endpoint, in sorted order,
+	// prefixed with their location, as in "path:id", "query:limit", or
+	// "body:name". Only top-level body fields are included. Headers and
+	// cookies are omitted, since they tend to vary with the client rather than
+	// the API.
+	ParamKeys []string `json:"param_keys"`
+}
+
+func (e SurfaceEndpoint) String() string {
+	return e.Method + " " + e.PathTemplate
+}
+
+type surfaceKey struct {
+	Method       string
+	PathTemplate string
+}
+
+func (e SurfaceEndpoint) key() surfaceKey {
+	return surfaceKey{Method: e.Method, PathTemplate: e.PathTemplate}
+}
+
+// The on-disk form of an API surface, as read by --baseline and written by
+// --baseline-output.
+type apiSurfaceFile struct {
+	Endpoints []SurfaceEndpoint `json:"endpoints"`
+}
+
+// Collects the endpoints observed in witnesses, along with their parameter
+// names. Safe for concurrent use. Implements WitnessSink so it can be attached
+// to a BackendCollector.
+type APISurface struct {
+	mutex sync.Mutex
+
+	endpoints map[surfaceKey]map[string]struct{}
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	overflow int64
+}
+
+var _ WitnessSink = (*APISurface)(nil)
+
+func NewAPISurface() *APISurface {
+	return &APISurface{
+		endpoints: make(map[surfaceKey]map[string]struct{}),
+	}
+}
+
+func (s *APISurface) ExportWitness(w *pb.Witness, _ time.Time, _ WitnessInfo) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return
+	}
+	// At capture time, the path template is the request's concrete path.
+	// Template it so that requests for different IDs are the same endpoint.
+	key := surfaceKey{
+		Method:       meta.GetMethod(),
+		PathTemplate: schemaOnlyPath(meta.GetPathTemplate()),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	params, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= maxKeys {
+			s.overflow += 1
+			return
+		}
+		params = make(map[string]struct{})
+		s.endpoints[key] = params
+	}
+	for _, k := range surfacePathParamKeys(key.PathTemplate) {
+		params[k] = struct{}{}
+	}
+	for _, arg := range w.GetMethod().GetArgs() {
+		for _, k := range surfaceParamKeys(arg) {
+			params[k] = struct{}{}
+		}
+	}
+}
+
+// Returns the names of the parameters in a path template.
+func surfacePathParamKeys(pathTemplate string) []string {
+	var keys []string
+	for _, s := range strings.Split(pathTemplate, "/") {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			keys = append(keys, "path:"+strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}"))
+		}
+	}
+	return keys
+}
+
+// Returns the names of the parameters described by a request argument.
+func surfaceParamKeys(arg *pb.Data) []string {
+	meta := arg.GetMeta().GetHttp()
+	switch {
+	case meta.GetPath() != nil:
+		return []string{"path:" + meta.GetPath().GetKey()}
+	case meta.GetQuery() != nil:
+		return []string{"query:" + meta.GetQuery().GetKey()}
+	case meta.GetBody() != nil:
+		fields := arg.GetStruct().GetFields()
+		keys := make([]string, 0, len(fields))
+		for name := range fields {
+			keys = append(keys, "body:"+name)
+		}
+		return keys
+	}
+	return nil
+}
+
+// Returns the observed endpoints, sorted by path template and method.
+func (s *APISurface) Endpoints() []SurfaceEndpoint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]SurfaceEndpoint, 0, len(s.endpoints))
+	for k, params := range s.endpoints {
+		e := SurfaceEndpoint{
+			Method:       k.Method,
+			PathTemplate: k.PathTemplate,
+			ParamKeys:    make([]string, 0, len(params)),
+		}
+		for p := range params {
+			e.ParamKeys = append(e.ParamKeys, p)
+		}
+		sort.Strings(e.ParamKeys)
+		result = append(result, e)
+	}
+	sortSurfaceEndpoints(result)
+	return result
+}
+
+// Returns the number of witnesses that were not tracked because the endpoint
+// limit was reached.
+func (s *APISurface) Overflow() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflow
+}
+
+func sortSurfaceEndpoints(endpoints []SurfaceEndpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].PathTemplate != endpoints[j].PathTemplate {
+			return endpoints[i].PathTemplate < endpoints[j].PathTemplate
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+}
+
+// Reads an API surface written by WriteAPISurface.
+func ReadAPISurface(path string) ([]SurfaceEndpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read API baseline from %s", path)
+	}
+	var f apiSurfaceFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse API baseline from %s", path)
+	}
+	return f.Endpoints, nil
+}
+
+// Writes an API surface as JSON, so that it can be used as the baseline for a
+// later capture.
+func WriteAPISurface(path string, endpoints []SurfaceEndpoint) error {
+	b, err := json.MarshalIndent(apiSurfaceFile{Endpoints: endpoints}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal API surface")
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write API surface to %s", path)
+	}
+	return nil
+}
+
+// An endpoint whose parameters differ from the baseline.
+type SurfaceEndpointChange struct {
+	Baseline SurfaceEndpoint
+	Observed SurfaceEndpoint
+}
+
+// Differences between a baseline API surface and an observed one. Each list
+// is sorted by path template and method.
+type APISurfaceDiff struct {
+	Added   []SurfaceEndpoint
+	Removed []SurfaceEndpoint
+	Changed []SurfaceEndpointChange
+}
+
+func (d APISurfaceDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compares the observed endpoints against the baseline. Endpoints in the
+// baseline that weren't observed are reported as removed, so the comparison
+// is only meaningful if the capture exercised the whole API.
+func DiffAPISurface(baseline, observed []SurfaceEndpoint) APISurfaceDiff {
+	var diff APISurfaceDiff
+
+	baselineByKey := make(map[surfaceKey]SurfaceEndpoint, len(baseline))
+	for _, e := range baseline {
+		baselineByKey[e.key()] = e
+	}
+
+	observedKeys := make(map[surfaceKey]struct{}, len(observed))
+	for _, e := range observed {
+		observedKeys[e.key()] = struct{}{}
+		b, ok := baselineByKey[e.key()]
+		if !ok {
+			diff.Added = append(diff.Added, e)
+		} else if c := (SurfaceEndpointChange{Baseline: b, Observed: e}); c.isChanged() {
+			diff.Changed = append(diff.Changed, c)
+		}
+	}
+	for _, e := range baseline {
+		if _, ok := observedKeys[e.key()]; !ok {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+
+	sortSurfaceEndpoints(diff.Added)
+	sortSurfaceEndpoints(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		a, b := diff.Changed[i].Observed, diff.Changed[j].Observed
+		if a.PathTemplate != b.PathTemplate {
+			return a.PathTemplate < b.PathTemplate
+		}
+		return a.Method < b.Method
+	})
+	return diff
+}
+
+// Returns the parameters added and removed between the baseline and the
+// observed endpoint.
+func (c SurfaceEndpointChange) ParamDiff() (added, removed []string) {
+	baseline := make(map[string]struct{}, len(c.Baseline.ParamKeys))
+	for _, k := range c.Baseline.ParamKeys {
+		baseline[k] = struct{}{}
+	}
+	observed := make(map[string]struct{}, len(c.Observed.ParamKeys))
+	for _, k := range c.Observed.ParamKeys {
+		observed[k] = struct{}{}
+		if _, ok := baseline[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	for _, k := range c.Baseline.ParamKeys {
+		if _, ok := observed[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func (c SurfaceEndpointChange) isChanged() bool {
+	added, removed := c.ParamDiff()
+	return len(added) > 0 || len(removed) > 0
+}
@@ -0,0 +1,124 @@
+package trace
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a witness for the given endpoint with the given query parameters and
+// top-level body fields.
+func newSurfaceTestWitness(method, path string, query []string, bodyFields []string) *pb.Witness {
+	args := map[string]*pb.Data{}
+	for _, q := range query {
+		d := dataFromPrimitive(spec_util.NewPrimitiveString(""))
+		d.Meta = newDataMeta(&pb.HTTPMeta{
+			Location: &pb.HTTPMeta_Query{Query: &pb.HTTPQuery{Key: q}},
+		})
+		args["query-"+q] = d
+	}
+	if len(bodyFields) > 0 {
+		fields := map[string]*pb.Data{}
+		for _, f := range bodyFields {
+			fields[f] = dataFromPrimitive(spec_util.NewPrimitiveString(""))
+		}
+		args["body"] = newTestBodySpecFromStruct(0, pb.HTTPBody_JSON, "application/json", fields)
+	}
+	return &pb.Witness{
+		Method: &pb.Method{
+			Args: args,
+			Meta: &pb.MethodMeta{
+				Meta: &pb.MethodMeta_Http{
+					Http: &pb.HTTPMethodMeta{
+						Method:       method,
+						PathTemplate: path,
+						Host:         "example.com",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestAPISurfaceEndpoints(t *testing.T) {
+	s := NewAPISurface()
+	s.ExportWitness(newSurfaceTestWitness("GET", "/v1/orders", []string{"limit"}, nil), time.Now(), WitnessInfo{})
+	s.ExportWitness(newSurfaceTestWitness("GET", "/v1/orders", []string{"cursor"}, nil), time.Now(), WitnessInfo{})
+	s.ExportWitness(newSurfaceTestWitness("POST", "/v1/orders", nil, []string{"sku", "quantity"}), time.Now(), WitnessInfo{})
+
+	// Parameters are merged across witnesses of the same endpoint.
+	assert.Equal(t, []SurfaceEndpoint{
+		{Method: "GET", PathTemplate: "/v1/orders", ParamKeys: []string{"query:cursor", "query:limit"}},
+		{Method: "POST", PathTemplate: "/v1/orders", ParamKeys: []string{"body:quantity", "body:sku"}},
+	}, s.Endpoints())
+}
+
+func TestAPISurfaceTemplatesPaths(t *testing.T) {
+	baseline := NewAPISurface()
+	baseline.ExportWitness(newSurfaceTestWitness("GET", "/v1/users/123", nil, nil), time.Now(), WitnessInfo{})
+	baseline.ExportWitness(newSurfaceTestWitness("PATCH", "/v1/users/123", nil, []string{"name"}), time.Now(), WitnessInfo{})
+
+	// The same endpoints, called with different IDs.
+	observed := NewAPISurface()
+	observed.ExportWitness(newSurfaceTestWitness("GET", "/v1/users/456", nil, nil), time.Now(), WitnessInfo{})
+	observed.ExportWitness(newSurfaceTestWitness("GET", "/v1/users/789", nil, nil), time.Now(), WitnessInfo{})
+	observed.ExportWitness(newSurfaceTestWitness("PATCH", "/v1/users/456", nil, []string{"name"}), time.Now(), WitnessInfo{})
+
+	assert.Equal(t, []SurfaceEndpoint{
+		{Method: "GET", PathTemplate: "/v1/users/{arg3}", ParamKeys: []string{"path:arg3"}},
+		{Method: "PATCH", PathTemplate: "/v1/users/{arg3}", ParamKeys: []string{"body:name", "path:arg3"}},
+	}, observed.Endpoints())
+	assert.True(t, DiffAPISurface(baseline.Endpoints(), observed.Endpoints()).IsEmpty())
+}
+
+func TestDiffAPISurface(t *testing.T) {
+	baseline := []SurfaceEndpoint{
+		{Method: "GET", PathTemplate: "/v1/orders", ParamKeys: []string{"query:limit"}},
+		{Method: "GET", PathTemplate: "/v1/orders/{arg2}", ParamKeys: []string{}},
+		{Method: "POST", PathTemplate: "/v1/orders", ParamKeys: []string{"body:quantity", "body:sku"}},
+		{Method: "DELETE", PathTemplate: "/v1/orders/{arg2}", ParamKeys: []string{}},
+	}
+
+	// Unchanged.
+	diff := DiffAPISurface(baseline, baseline)
+	assert.True(t, diff.IsEmpty())
+
+	observed := []SurfaceEndpoint{
+		// Unchanged, with parameters in a different order.
+		{Method: "POST", PathTemplate: "/v1/orders", ParamKeys: []string{"body:sku", "body:quantity"}},
+		// Changed.
+		{Method: "GET", PathTemplate: "/v1/orders", ParamKeys: []string{"query:cursor"}},
+		// Added.
+		{Method: "PATCH", PathTemplate: "/v1/orders/{arg2}", ParamKeys: []string{"body:status"}},
+		{Method: "GET", PathTemplate: "/v1/orders/{arg2}", ParamKeys: []string{}},
+	}
+	diff = DiffAPISurface(baseline, observed)
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, []SurfaceEndpoint{observed[2]}, diff.Added)
+	assert.Equal(t, []SurfaceEndpoint{baseline[3]}, diff.Removed)
+	if assert.Equal(t, 1, len(diff.Changed)) {
+		assert.Equal(t, "GET /v1/orders", diff.Changed[0].Observed.String())
+		added, removed := diff.Changed[0].ParamDiff()
+		assert.Equal(t, []string{"query:cursor"}, added)
+		assert.Equal(t, []string{"query:limit"}, removed)
+	}
+}
+
+func TestAPISurfaceFile(t *testing.T) {
+	endpoints := []SurfaceEndpoint{
+		{Method: "GET", PathTemplate: "/v1/orders", ParamKeys: []string{"query:limit"}},
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	assert.NoError(t, WriteAPISurface(path, endpoints))
+
+	read, err := ReadAPISurface(path)
+	assert.NoError(t, err)
+	assert.Equal(t, endpoints, read)
+
+	_, err = ReadAPISurface(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+// How long to remember a partial witness that was flushed without being
+// paired, while waiting for its counterpart to be flushed by the collector
+// for another interface. Each collector flushes its pair cache on its own
+// schedule, so this must be longer than pairCacheCleanupInterval.
+const unpairedHalfRetention = 3 * pairCacheCleanupInterval
+
+// Identifies a TCP connection, independently of the interface on which it was
+// captured. (Witness IDs can't be used for this, since they are derived from
+// per-interface stream IDs.)
+type connectionKey struct {
+	clientIP   string
+	clientPort uint16
+	serverIP   string
+	serverPort uint16
+}
+
+type unpairedHalf struct {
+	netInterface string
+	isRequest    bool
+	flushedAt    time.Time
+}
+
+// A pair of interfaces on which the requests and responses of the same
+// connections were captured.
+type InterfacePair struct {
+	RequestInterface  string
+	ResponseInterface string
+}
+
+func (p InterfacePair) Warning() string {
+	return fmt.Sprintf("Requests and responses are on different interfaces (%s vs %s); capture both or they won't pair.",
+		p.RequestInterface, p.ResponseInterface)
+}
+
+// Detects asymmetric routing, where the requests on a connection are captured
+// on one interface and the responses on another. Each interface has its own
+// collector, so such requests and responses never pair. The detector is shared
+// by the backend collectors for all interfaces, and is given each partial
+// witness that they flush without having paired it.
+type AsymmetricRoutingDetector struct {
+	mu sync.Mutex
+
+	// Unpaired partial witnesses flushed within the last
+	// unpairedHalfRetention.
+	halves map[connectionKey][]unpairedHalf
+
+	// When halves was last pruned.
+	lastPruned time.Time
+
+	// Number of request-response pairs seen split across each pair of
+	// interfaces.
+	mismatches map[InterfacePair]int
+}
+
+func NewAsymmetricRoutingDetector() *AsymmetricRoutingDetector {
+	return &AsymmetricRoutingDetector{
+		halves:     map[connectionKey][]unpairedHalf{},
+		mismatches: map[InterfacePair]int{},
+	}
+}
+
+// Records a partial witness that was flushed without being paired. If the
+// other half of the same connection was flushed from a different interface,
+// records a mismatch and warns the first time each pair of interfaces is seen.
+func (d *AsymmetricRoutingDetector) observeUnpaired(w *witnessWithInfo, now time.Time) {
+	isRequest := w.info.Request_bytes >= 0
+	if isRequest == (w.info.Response_bytes >= 0) {
+		// Either a complete witness or one we know nothing about.
+		return
+	}
+
+	// Partial witnesses are stored with the source and destination of the
+	// packets that carried them, so a response's source is the server.
+	key := connectionKey{
+		clientIP:   w.srcIP.String(),
+		clientPort: w.srcPort,
+		serverIP:   w.dstIP.String(),
+		serverPort: w.dstPort,
+	}
+	if !isRequest {
+		key = connectionKey{
+			clientIP:   w.dstIP.String(),
+			clientPort: w.dstPort,
+			serverIP:   w.srcIP.String(),
+			serverPort: w.srcPort,
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.prune(now)
+
+	halves := d.halves[key]
+	for i, h := range halves {
+		if h.isRequest == isRequest || h.netInterface == w.netInterface {
+			continue
+		}
+
+		pair := InterfacePair{RequestInterface: h.netInterface, ResponseInterface: w.netInterface}
+		if isRequest {
+			pair = InterfacePair{RequestInterface: w.netInterface, ResponseInterface: h.netInterface}
+		}
+		if d.mismatches[pair] == 0 {
+			printer.Warningf("%s\n", pair.Warning())
+		}
+		d.mismatches[pair] += 1
+
+		d.halves[key] = append(halves[:i], halves[i+1:]...)
+		if len(d.halves[key]) == 0 {
+			delete(d.halves, key)
+		}
+		return
+	}
+
+	d.halves[key] = append(halves, unpairedHalf{
+		netInterface: w.netInterface,
+		isRequest:    isRequest,
+		flushedAt:    now,
+	})
+}
+
+// Forgets partial witnesses flushed more than unpairedHalfRetention ago.
+// Assumes d.mu is held.
+func (d *AsymmetricRoutingDetector) prune(now time.Time) {
+	if now.Sub(d.lastPruned) < pairCacheCleanupInterval {
+		return
+	}
+	d.lastPruned = now
+
+	cutoff := now.Add(-unpairedHalfRetention)
+	for key, halves := range d.halves {
+		kept := halves[:0]
+		for _, h := range halves {
+			if h.flushedAt.After(cutoff) {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(d.halves, key)
+		} else {
+			d.halves[key] = kept
+		}
+	}
+}
+
+// Returns the number of request-response pairs seen split across each pair of
+// interfaces.
+func (d *AsymmetricRoutingDetector) Mismatches() map[InterfacePair]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make(map[InterfacePair]int, len(d.mismatches))
+	for k, v := range d.mismatches {
+		result[k] = v
+	}
+	return result
+}
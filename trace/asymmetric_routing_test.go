@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsymmetricRouting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	clientIP, clientPort := net.IP{10, 0, 0, 1}, 50000
+	serverIP, serverPort := net.IP{10, 0, 0, 2}, 80
+
+	// Each interface has its own stream reassembly, and therefore its own
+	// stream IDs.
+	req := akinet.ParsedNetworkTraffic{
+		Interface: "eth0",
+		SrcIP:     clientIP,
+		SrcPort:   clientPort,
+		DstIP:     serverIP,
+		DstPort:   serverPort,
+		Content: akinet.HTTPRequest{
+			StreamID: uuid.New(),
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "example.com",
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		Interface: "eth1",
+		SrcIP:     serverIP,
+		SrcPort:   serverPort,
+		DstIP:     clientIP,
+		DstPort:   clientPort,
+		Content: akinet.HTTPResponse{
+			StreamID:   uuid.New(),
+			Seq:        1,
+			StatusCode: 200,
+		},
+	}
+
+	// An unrelated request with no response, on a different connection.
+	unanswered := req
+	unanswered.SrcPort = clientPort + 1
+	unanswered.Content = akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "GET",
+		URL:      &url.URL{Path: "/v1/doggos"},
+		Host:     "example.com",
+	}
+
+	detector := NewAsymmetricRoutingDetector()
+	eth0 := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	eth0.(*BackendCollector).SetAsymmetricRoutingDetector(detector)
+	eth1 := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	eth1.(*BackendCollector).SetAsymmetricRoutingDetector(detector)
+
+	assert.NoError(t, eth0.Process(req))
+	assert.NoError(t, eth0.Process(unanswered))
+	assert.NoError(t, eth1.Process(resp))
+	assert.NoError(t, eth0.Close())
+	assert.NoError(t, eth1.Close())
+
+	assert.Equal(t, map[InterfacePair]int{
+		{RequestInterface: "eth0", ResponseInterface: "eth1"}: 1,
+	}, detector.Mismatches())
+}
+
+func TestSymmetricRouting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	streamID := uuid.New()
+	req := akinet.ParsedNetworkTraffic{
+		Interface: "eth0",
+		SrcIP:     net.IP{10, 0, 0, 1},
+		SrcPort:   50000,
+		DstIP:     net.IP{10, 0, 0, 2},
+		DstPort:   80,
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "example.com",
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		Interface: "eth0",
+		SrcIP:     net.IP{10, 0, 0, 2},
+		SrcPort:   80,
+		DstIP:     net.IP{10, 0, 0, 1},
+		DstPort:   50000,
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1,
+			StatusCode: 200,
+		},
+	}
+
+	detector := NewAsymmetricRoutingDetector()
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetAsymmetricRoutingDetector(detector)
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(resp))
+	assert.NoError(t, col.Close())
+
+	assert.Empty(t, detector.Mismatches())
+}
@@ -15,12 +15,14 @@ import (
 	"github.com/akitasoftware/akita-libs/spec_util/ir_hash"
 	"github.com/akitasoftware/go-utils/optionals"
 	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/postmanlabs/postman-insights-agent/learn"
 	"github.com/postmanlabs/postman-insights-agent/plugin"
 	"github.com/postmanlabs/postman-insights-agent/printer"
 	"github.com/postmanlabs/postman-insights-agent/rest"
 	"github.com/postmanlabs/postman-insights-agent/telemetry"
+	"github.com/postmanlabs/postman-insights-agent/usage"
 )
 
 const (
@@ -47,9 +49,14 @@ type witnessWithInfo struct {
 	dstPort         uint16 // The HTTP server's port number.
 	observationTime time.Time
 	id              akid.WitnessID
+	connectionID    akid.ConnectionID
 	requestEnd      time.Time
 	responseStart   time.Time
 
+	// Information about the witness that is passed to witness sinks, but not
+	// uploaded.
+	info WitnessInfo
+
 	witness *pb.Witness
 }
 
@@ -86,6 +93,25 @@ func (w *witnessWithInfo) recordTimestamp(isRequest bool, t akinet.ParsedNetwork
 
 }
 
+func (w *witnessWithInfo) recordBodySize(isRequest bool, size_bytes int64) {
+	if isRequest {
+		w.info.Request_bytes = size_bytes
+	} else {
+		w.info.Response_bytes = size_bytes
+	}
+}
+
+// Records the body size, and whether the body was still open, of a partial
+// witness, along with the gRPC method of a request.
+func (w *witnessWithInfo) recordBody(isRequest bool, partial *learn.PartialWitness) {
+	w.recordBodySize(isRequest, partial.BodySize_bytes)
+	if isRequest {
+		w.info.GRPCMethod = partial.GRPCMethod
+	} else {
+		w.info.ResponseOpen = partial.BodyOpen
+	}
+}
+
 func (w witnessWithInfo) computeProcessingLatency(isRequest bool, t akinet.ParsedNetworkTraffic) {
 	// Processing latency is the time from the last packet of the request,
 	// to the first packet of the response.
@@ -118,6 +144,60 @@ type LearnSessionCollector interface {
 	SwitchLearnSession(akid.LearnSessionID)
 }
 
+// Information about a witness, gathered while it was captured, that is not
+// part of the uploaded witness. Passed to each WitnessSink.
+type WitnessInfo struct {
+	// Sizes of the request and response bodies, before truncation. A size is
+	// negative if the corresponding half of the witness was not seen.
+	Request_bytes  int64
+	Response_bytes int64
+
+	// Shapes of the bodies, as captured. Zero if the corresponding body was not
+	// seen.
+	RequestShape  BodyShape
+	ResponseShape BodyShape
+
+	// True if the response was still streaming when it was captured, so only
+	// part of its body was seen.
+	ResponseOpen bool
+
+	// True if the connection was reset before the response was seen.
+	ConnectionReset bool
+
+	// Value of the request's correlation header, or empty if there is none.
+	// See learn.SetCorrelationHeader.
+	CorrelationID string
+
+	// The method called, if the request is a gRPC call. Zero otherwise.
+	GRPCMethod learn.GRPCMethod
+
+	// If the witness is of a WebSocket message, the side that sent it.
+	// Empty otherwise. See learn.WebSocketMessageSender.
+	WebSocketSender string
+
+	// If the request is at the end of a collapsed redirect chain, the
+	// locations of the earlier requests in the chain, as host and path, in the
+	// order they were requested. Nil otherwise. See RedirectCollapse.
+	RedirectedFrom []string
+
+	// If the request repeated the Idempotency-Key of an earlier request, the
+	// number of earlier requests with that key. Zero otherwise. See
+	// IdempotencyTracker.
+	RetryAttempt int
+
+	// The request's raw query string, if raw query strings are captured, with
+	// its values obfuscated or redacted as for the parsed query parameters,
+	// except for allowed parameters. See RawQueryPolicy.
+	RawQuery string
+}
+
+// Receives each witness after plugins and obfuscation have been applied, in
+// addition to the witness being uploaded to the backend. Implementations must
+// not block and must not modify the witness.
+type WitnessSink interface {
+	ExportWitness(w *pb.Witness, observationTime time.Time, info WitnessInfo)
+}
+
 // Sends witnesses up to akita cloud.
 type BackendCollector struct {
 	serviceID      akid.ServiceID
@@ -131,6 +211,9 @@ type BackendCollector struct {
 	// Batch of reports (witnesses, TCP-connection reports, etc.) pending upload.
 	uploadReportBatch *batcher.InMemory[rawReport]
 
+	// The buffer underlying uploadReportBatch.
+	reports *reportBuffer
+
 	// Channel controlling periodic cache flush
 	flushDone chan struct{}
 
@@ -138,6 +221,49 @@ type BackendCollector struct {
 	learnSessionMutex sync.Mutex
 
 	plugins []plugin.AkitaPlugin
+
+	// Additional destinations for completed witnesses.
+	sinks []WitnessSink
+
+	// Receives partial witnesses that are flushed without being paired. May be
+	// nil.
+	routing *AsymmetricRoutingDetector
+
+	// Pauses uploads after repeated failures. May be nil.
+	breaker *UploadCircuitBreaker
+
+	// Reduces witnesses to endpoint shapes, with no values. May be nil, in
+	// which case witnesses are uploaded with their obfuscated values.
+	schemaOnly *SchemaOnlyPolicy
+
+	// Bounds the number of witnesses redacted at once. May be nil, in which
+	// case redaction is unbounded.
+	redaction *RedactionLimiter
+
+	// How to handle requests whose connection was reset before the response
+	// was seen. Treated as WaitOnConnectionReset if empty.
+	onConnectionReset ConnectionResetHandling
+
+	// Counts uploaded witnesses to rotate learn sessions by size. May be nil.
+	rotation *WitnessCountRotation
+
+	// If true, witnesses are passed to the sinks but nothing is uploaded. See
+	// NewSinkCollector.
+	sinkOnly bool
+
+	// Redirect chains that led to requests, recorded by a redirect collector.
+	// May be nil.
+	redirects *RedirectChains
+
+	// Records raw query strings in WitnessInfo. May be nil, in which case they
+	// are not recorded.
+	rawQuery *RawQueryPolicy
+
+	// Retries detected by an idempotency collector. May be nil.
+	idempotency *IdempotencyTracker
+
+	// Stops reporting the size of pairCache in runtime stats.
+	unregisterSize func()
 }
 
 var _ LearnSessionCollector = (*BackendCollector)(nil)
@@ -158,25 +284,43 @@ func NewBackendCollector(
 		plugins:        plugins,
 	}
 
-	col.uploadReportBatch = batcher.NewInMemory[rawReport](
-		newReportBuffer(col, packetCounts, uploadBatchMaxSize_bytes, maxWitnessSize_bytes),
-		uploadBatchFlushDuration,
-	)
+	col.reports = newReportBuffer(col, packetCounts, uploadBatchMaxSize_bytes, maxWitnessSize_bytes)
+	col.uploadReportBatch = batcher.NewInMemory[rawReport](col.reports, uploadBatchFlushDuration)
+
+	col.unregisterSize = usage.RegisterSize("pair_cache", col.pairCacheSize)
 
 	go col.periodicFlush()
 
 	return col
 }
 
+// Returns a collector that processes witnesses as a BackendCollector does,
+// applying plugins and obfuscation, and passes them to the given sinks without
+// uploading anything. Feeds local outputs, such as a Postman Collection, when
+// witnesses are not sent to the backend.
+func NewSinkCollector(plugins []plugin.AkitaPlugin, sinks []WitnessSink) *BackendCollector {
+	col := NewBackendCollector(akid.ServiceID{}, akid.LearnSessionID{}, nil, optionals.None[int](), nil, plugins).(*BackendCollector)
+	col.SetWitnessSinks(sinks)
+	col.sinkOnly = true
+	return col
+}
+
 func (c *BackendCollector) Process(t akinet.ParsedNetworkTraffic) error {
 	var isRequest bool
 	var partial *learn.PartialWitness
 	var parseHTTPErr error
+	var streamID uuid.UUID
+	var rawQuery string
 	switch content := t.Content.(type) {
 	case akinet.HTTPRequest:
 		isRequest = true
+		streamID = content.StreamID
+		if c.rawQuery != nil && content.URL != nil {
+			rawQuery = content.URL.RawQuery
+		}
 		partial, parseHTTPErr = learn.ParseHTTP(content)
 	case akinet.HTTPResponse:
+		streamID = content.StreamID
 		partial, parseHTTPErr = learn.ParseHTTP(content)
 	case akinet.TCPConnectionMetadata:
 		return c.processTCPConnection(t, content)
@@ -193,6 +337,11 @@ func (c *BackendCollector) Process(t akinet.ParsedNetworkTraffic) error {
 		return nil
 	}
 
+	if partial.WebSocketSender != "" {
+		c.queueUpload(newWebSocketWitness(t, partial, streamID))
+		return nil
+	}
+
 	if val, ok := c.pairCache.LoadAndDelete(partial.PairKey); ok {
 		pair := val.(*witnessWithInfo)
 
@@ -200,6 +349,12 @@ func (c *BackendCollector) Process(t akinet.ParsedNetworkTraffic) error {
 		// rather than the new partial.
 		learn.MergeWitness(pair.witness, partial.Witness)
 		pair.computeProcessingLatency(isRequest, t)
+		pair.recordBody(isRequest, partial)
+		if isRequest {
+			pair.info.RedirectedFrom = c.redirects.take(partial.PairKey)
+			pair.info.RetryAttempt = c.idempotency.takeRetry(partial.PairKey)
+			pair.info.RawQuery = rawQuery
+		}
 
 		// If partial is the request, flip the src/dst in the pair before
 		// reporting.
@@ -224,9 +379,17 @@ func (c *BackendCollector) Process(t akinet.ParsedNetworkTraffic) error {
 			witness:         partial.Witness,
 			observationTime: t.ObservationTime,
 			id:              partial.PairKey,
+			connectionID:    akid.NewConnectionID(streamID),
+			info:            WitnessInfo{Request_bytes: -1, Response_bytes: -1},
 		}
 		// Store whichever timestamp brackets the processing interval.
 		w.recordTimestamp(isRequest, t)
+		w.recordBody(isRequest, partial)
+		if isRequest {
+			w.info.RedirectedFrom = c.redirects.take(partial.PairKey)
+			w.info.RetryAttempt = c.idempotency.takeRetry(partial.PairKey)
+			w.info.RawQuery = rawQuery
+		}
 		c.pairCache.Store(partial.PairKey, w)
 		printer.Debugf("Partial witness %v request=%v at %v -- %v\n",
 			partial.PairKey, isRequest, t.ObservationTime, t.FinalPacketTime)
@@ -235,7 +398,39 @@ func (c *BackendCollector) Process(t akinet.ParsedNetworkTraffic) error {
 	return nil
 }
 
+// Returns the witness of a WebSocket message, which is complete without a
+// counterpart. As for other witnesses, the source is the client.
+func newWebSocketWitness(t akinet.ParsedNetworkTraffic, partial *learn.PartialWitness, streamID uuid.UUID) *witnessWithInfo {
+	w := &witnessWithInfo{
+		netInterface:    t.Interface,
+		srcIP:           t.SrcIP,
+		srcPort:         uint16(t.SrcPort),
+		dstIP:           t.DstIP,
+		dstPort:         uint16(t.DstPort),
+		witness:         partial.Witness,
+		observationTime: t.ObservationTime,
+		id:              partial.PairKey,
+		connectionID:    akid.NewConnectionID(streamID),
+		info:            WitnessInfo{Request_bytes: -1, Response_bytes: -1, WebSocketSender: partial.WebSocketSender},
+	}
+
+	fromClient := partial.WebSocketSender == learn.WebSocketFromClient
+	if !fromClient {
+		w.srcIP, w.dstIP = w.dstIP, w.srcIP
+		w.srcPort, w.dstPort = w.dstPort, w.srcPort
+	}
+	w.recordBody(fromClient, partial)
+	return w
+}
+
 func (c *BackendCollector) processTCPConnection(packet akinet.ParsedNetworkTraffic, tcp akinet.TCPConnectionMetadata) error {
+	if c.sinkOnly {
+		if tcp.EndState == akinet.ConnectionReset {
+			c.processConnectionReset(tcp.ConnectionID)
+		}
+		return nil
+	}
+
 	srcAddr, srcPort, dstAddr, dstPort := packet.SrcIP, packet.SrcPort, packet.DstIP, packet.DstPort
 	if tcp.Initiator == akinet.DestInitiator {
 		srcAddr, srcPort, dstAddr, dstPort = dstAddr, dstPort, srcAddr, srcPort
@@ -254,10 +449,112 @@ func (c *BackendCollector) processTCPConnection(packet akinet.ParsedNetworkTraff
 			EndState:       tcp.EndState,
 		},
 	})
+
+	if tcp.EndState == akinet.ConnectionReset {
+		c.processConnectionReset(tcp.ConnectionID)
+	}
 	return nil
 }
 
+// Sets additional destinations for completed witnesses. Must be called before
+// any traffic is processed.
+func (c *BackendCollector) SetWitnessSinks(sinks []WitnessSink) {
+	c.sinks = sinks
+}
+
+// Sets the detector that receives partial witnesses flushed without being
+// paired. Must be called before any traffic is processed.
+func (c *BackendCollector) SetAsymmetricRoutingDetector(d *AsymmetricRoutingDetector) {
+	c.routing = d
+}
+
+// Sets the breaker that pauses uploads after repeated failures. Must be called
+// before any traffic is processed.
+func (c *BackendCollector) SetUploadCircuitBreaker(b *UploadCircuitBreaker) {
+	c.breaker = b
+}
+
+// Sets the policy that reduces witnesses to endpoint shapes before they are
+// uploaded. Must be called before any traffic is processed.
+func (c *BackendCollector) SetSchemaOnlyPolicy(p *SchemaOnlyPolicy) {
+	c.schemaOnly = p
+}
+
+// Sets the limiter that bounds the number of witnesses redacted at once. Must
+// be called before any traffic is processed.
+func (c *BackendCollector) SetRedactionLimiter(l *RedactionLimiter) {
+	c.redaction = l
+}
+
+// Sets the size above which a batch of reports is uploaded in several
+// requests. Must be called before any traffic is processed.
+func (c *BackendCollector) SetMaxUploadRequestSize(size_bytes int) {
+	c.reports.maxRequestSize_bytes = optionals.Some(size_bytes)
+}
+
+// Sets how requests are handled when their connection is reset before the
+// response is seen. Must be called before any traffic is processed.
+func (c *BackendCollector) SetConnectionResetHandling(h ConnectionResetHandling) {
+	c.onConnectionReset = h
+}
+
+// Sets the rotation that counts the witnesses uploaded by this collector. Must
+// be called before any traffic is processed.
+func (c *BackendCollector) SetWitnessCountRotation(r *WitnessCountRotation) {
+	c.rotation = r
+}
+
+// Sets the redirect chains that this collector reports in WitnessInfo. Must be
+// called before any traffic is processed.
+func (c *BackendCollector) SetRedirectChains(r *RedirectChains) {
+	c.redirects = r
+}
+
+// Sets the policy for recording raw query strings in WitnessInfo. Must be
+// called before any traffic is processed.
+func (c *BackendCollector) SetRawQueryPolicy(p *RawQueryPolicy) {
+	c.rawQuery = p
+}
+
+// Sets the tracker whose retries this collector reports in WitnessInfo. Must be
+// called before any traffic is processed.
+func (c *BackendCollector) SetIdempotencyTracker(t *IdempotencyTracker) {
+	c.idempotency = t
+}
+
+// Handles the requests on a reset connection that are still waiting for their
+// response, which will never arrive.
+func (c *BackendCollector) processConnectionReset(id akid.ConnectionID) {
+	if c.onConnectionReset != EmitOnConnectionReset && c.onConnectionReset != DropOnConnectionReset {
+		return
+	}
+
+	c.pairCache.Range(func(k, v interface{}) bool {
+		e := v.(*witnessWithInfo)
+
+		// Skip responses waiting for their request, which may still be parsed.
+		if e.connectionID != id || e.info.Request_bytes < 0 {
+			return true
+		}
+
+		// The request may have been paired in the meantime.
+		if _, loaded := c.pairCache.LoadAndDelete(k); !loaded {
+			return true
+		}
+
+		if c.onConnectionReset == EmitOnConnectionReset {
+			e.info.ConnectionReset = true
+			c.queueUpload(e)
+		}
+		printer.Debugf("Connection reset before response to %v, handled with %q\n", k, c.onConnectionReset)
+		return true
+	})
+}
+
 func (c *BackendCollector) processTLSHandshake(tls akinet.TLSHandshakeMetadata) error {
+	if c.sinkOnly {
+		return nil
+	}
 	c.uploadReportBatch.Add(rawReport{
 		TLSHandshakeReport: &kgxapi.TLSHandshakeReport{
 			ID:                      tls.ConnectionID,
@@ -272,26 +569,63 @@ func (c *BackendCollector) processTLSHandshake(tls akinet.TLSHandshakeMetadata)
 }
 
 func (c *BackendCollector) queueUpload(w *witnessWithInfo) {
+	var redacted bool
+	c.redaction.Do(func() { redacted = c.redact(w) })
+	if !redacted {
+		return
+	}
+
+	for _, s := range c.sinks {
+		s.ExportWitness(w.witness, w.observationTime, w.info)
+	}
+	if c.sinkOnly {
+		return
+	}
+	c.uploadReportBatch.Add(rawReport{
+		Witness: w,
+	})
+}
+
+// Applies plugins, obfuscation, and the schema-only policy to the witness.
+// Returns false if a plugin failed, in which case the witness should not be
+// uploaded.
+func (c *BackendCollector) redact(w *witnessWithInfo) bool {
 	for _, p := range c.plugins {
 		if err := p.Transform(w.witness.GetMethod()); err != nil {
 			// Only upload if plugins did not return error.
 			printer.Errorf("plugin %q returned error, skipping: %v", p.Name(), err)
-			return
+			return false
 		}
 	}
 
+	// Redact the raw query string to match its parsed parameters, now that
+	// plugins are done with them.
+	if c.rawQuery != nil {
+		w.info.RawQuery = c.rawQuery.redact(w.info.RawQuery, w.witness.GetMethod())
+	}
+
 	// Obfuscate the original value so type inference engine can use it on the
 	// backend without revealing the actual value.
-	obfuscate(w.witness.GetMethod())
-	c.uploadReportBatch.Add(rawReport{
-		Witness: w,
-	})
+	w.info.RequestShape, w.info.ResponseShape = obfuscate(w.witness.GetMethod())
+	w.info.CorrelationID = learn.CorrelationID(w.witness.GetMethod())
+
+	// In schema-only mode, strip everything but the endpoint's shape. This
+	// happens after all plugins, so none of them can put values back.
+	if c.schemaOnly != nil && c.schemaOnly.apply(w.witness.GetMethod()) {
+		w.info.RawQuery = ""
+	}
+	return true
 }
 
 func (c *BackendCollector) Close() error {
+	c.unregisterSize()
 	close(c.flushDone)
 	c.flushPairCache(time.Now())
 	c.uploadReportBatch.Close()
+
+	// Reports still held because uploads are paused can no longer be
+	// uploaded.
+	c.reports.dropHeld()
 	return nil
 }
 
@@ -321,10 +655,24 @@ func (c *BackendCollector) periodicFlush() {
 	}
 }
 
+// Returns the number of partial witnesses waiting for their pair.
+func (c *BackendCollector) pairCacheSize() int {
+	size := 0
+	c.pairCache.Range(func(_, _ interface{}) bool {
+		size += 1
+		return true
+	})
+	return size
+}
+
 func (c *BackendCollector) flushPairCache(cutoffTime time.Time) {
+	now := time.Now()
 	c.pairCache.Range(func(k, v interface{}) bool {
 		e := v.(*witnessWithInfo)
 		if e.observationTime.Before(cutoffTime) {
+			if c.routing != nil {
+				c.routing.observeUnpaired(e, now)
+			}
 			c.queueUpload(e)
 			c.pairCache.Delete(k)
 		}
@@ -2,6 +2,7 @@ package trace
 
 import (
 	"encoding/base64"
+	"net/http"
 	"net/url"
 	"sync"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
 	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
 	"github.com/stretchr/testify/assert"
 )
@@ -299,3 +301,212 @@ func TestFlushExit(t *testing.T) {
 	b.periodicFlush()
 	// Test should exit immediately
 }
+
+// Make sure no original values survive in schema-only mode.
+func TestSchemaOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var rec witnessRecorder
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(rec.recordAsyncReportsUpload).
+		AnyTimes().
+		Return(nil)
+
+	streamID := uuid.New()
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1203,
+			Method:   "POST",
+			URL: &url.URL{
+				Path:     "/v1/owners/8675309/doggos/prince-42",
+				RawQuery: "breed=corgi",
+			},
+			Host: "example.com",
+			Header: map[string][]string{
+				"Content-Type":  {"application/json"},
+				"X-Secret-Word": {"xylophone"},
+				"Authorization": {"Bearer sk_live_abc123"},
+			},
+			Body: memview.New([]byte(`{"name": "bartholomew", "age": 7, "weight": 12.5, "good": true, "tags": ["fluffy"], "vet": {"phone": "555-0199"}}`)),
+		},
+	}
+
+	resp := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1203,
+			StatusCode: 201,
+			Header: map[string][]string{
+				"Content-Type": {"text/plain"},
+				"X-Request-Id": {"quokka"},
+			},
+			Body: memview.New([]byte(`created bartholomew`)),
+		},
+	}
+
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetSchemaOnlyPolicy(NewSchemaOnlyPolicy(0))
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(resp))
+	assert.NoError(t, col.Close())
+
+	if !assert.Equal(t, 1, len(rec.witnesses)) {
+		return
+	}
+	text := proto.MarshalTextString(rec.witnesses[0])
+	for _, v := range []string{"8675309", "prince-42", "corgi", "xylophone", "sk_live_abc123", "bartholomew", "12.5", "fluffy", "555-0199", "quokka"} {
+		assert.NotContains(t, text, v)
+	}
+	assert.NotContains(t, text, "int64_value: 7")
+	assert.NotContains(t, text, "bool_value: true")
+
+	// The shape of the endpoint is kept.
+	meta := spec_util.HTTPMetaFromMethod(rec.witnesses[0].Method)
+	assert.Equal(t, "/v1/owners/{arg3}/doggos/{arg5}", meta.PathTemplate)
+	assert.Equal(t, "example.com", meta.Host)
+	for _, v := range []string{"breed", "X-Secret-Word", "name", "age", "weight", "good", "tags", "phone", "X-Request-Id"} {
+		assert.Contains(t, text, v)
+	}
+}
+
+func TestSchemaOnlyPath(t *testing.T) {
+	testCases := map[string]string{
+		"":                          "",
+		"/":                         "/",
+		"/v1/doggos":                "/v1/doggos",
+		"/v1/doggos/":               "/v1/doggos/",
+		"/v2/users/123/posts":       "/v2/users/{arg3}/posts",
+		"/files/report.pdf":         "/files/report.pdf",
+		"/files/report-2024.pdf":    "/files/{arg2}",
+		"/users/{arg2}/a%20b/x@y.z": "/users/{arg2}/{arg3}/{arg4}",
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, schemaOnlyPath(input), input)
+	}
+}
+
+// The first N witnesses of each endpoint and status are kept as examples, and
+// the rest are schema-only.
+func TestSchemaOnlyExamples(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var rec witnessRecorder
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(rec.recordAsyncReportsUpload).
+		AnyTimes().
+		Return(nil)
+
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetSchemaOnlyPolicy(NewSchemaOnlyPolicy(2))
+
+	exchanges := []struct {
+		path       string
+		statusCode int
+	}{
+		{"/v1/doggos/1", 200},
+		{"/v1/doggos/2", 200},
+		{"/v1/doggos/3", 200},
+		{"/v1/doggos/4", 404},
+	}
+	for i, e := range exchanges {
+		streamID := uuid.New()
+		assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPRequest{
+				StreamID: streamID,
+				Seq:      i,
+				Method:   "GET",
+				URL:      &url.URL{Path: e.path},
+				Host:     "example.com",
+			},
+		}))
+		assert.NoError(t, col.Process(akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPResponse{
+				StreamID:   streamID,
+				Seq:        i,
+				StatusCode: e.statusCode,
+				Header: map[string][]string{
+					"X-Request-Id": {"abc"},
+				},
+			},
+		}))
+	}
+	assert.NoError(t, col.Close())
+
+	var paths []string
+	for _, w := range rec.witnesses {
+		paths = append(paths, spec_util.HTTPMetaFromMethod(w.Method).PathTemplate)
+	}
+	assert.Equal(t, []string{"/v1/doggos/1", "/v1/doggos/2", "/v1/doggos/{arg3}", "/v1/doggos/4"}, paths)
+}
+
+func TestWebSocketMessageWitnesses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var rec witnessRecorder
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(rec.recordAsyncReportsUpload).
+		AnyTimes().
+		Return(nil)
+
+	streamID := uuid.New()
+	message := func(seq int, sender string, header http.Header, body string) akinet.ParsedNetworkTraffic {
+		header.Set(learn.WebSocketMessageHeader, sender)
+		return akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPRequest{
+				StreamID: streamID,
+				Seq:      seq,
+				Method:   "GET",
+				URL:      &url.URL{Path: "/chat"},
+				Host:     "example.com",
+				Header:   header,
+				Body:     memview.New([]byte(body)),
+			},
+		}
+	}
+
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+
+	// Messages are exported without waiting for a counterpart.
+	assert.NoError(t, col.Process(message(1, learn.WebSocketFromClient, http.Header{"Content-Type": {"application/json"}}, `{"user": "alice"}`)))
+	assert.Equal(t, 1, sink.count())
+
+	// A binary message from the server, captured with only its size.
+	assert.NoError(t, col.Process(message(2, learn.WebSocketFromServer, http.Header{"Content-Length": {"5"}}, "")))
+	assert.Equal(t, 2, sink.count())
+	assert.NoError(t, col.Close())
+
+	assert.Equal(t, learn.WebSocketFromClient, sink.infos[0].WebSocketSender)
+	assert.Equal(t, int64(17), sink.infos[0].Request_bytes)
+	assert.Equal(t, int64(-1), sink.infos[0].Response_bytes)
+
+	assert.Equal(t, learn.WebSocketFromServer, sink.infos[1].WebSocketSender)
+	assert.Equal(t, int64(-1), sink.infos[1].Request_bytes)
+	assert.Equal(t, int64(5), sink.infos[1].Response_bytes)
+
+	if assert.Len(t, rec.witnesses, 2) {
+		for _, w := range rec.witnesses {
+			assert.Equal(t, "/chat", w.GetMethod().GetMeta().GetHttp().GetPathTemplate())
+		}
+
+		// Only the message is recorded, without the marker header.
+		assert.Len(t, rec.witnesses[0].GetMethod().GetArgs(), 1)
+		assert.Empty(t, rec.witnesses[0].GetMethod().GetResponses())
+		assert.Empty(t, rec.witnesses[1].GetMethod().GetArgs())
+		assert.Empty(t, rec.witnesses[1].GetMethod().GetResponses())
+	}
+}
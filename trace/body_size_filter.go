@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+)
+
+// Returns a collector that strips request and response bodies whose size, as
+// captured, is outside the range [min_bytes, max_bytes], so that only their
+// metadata is captured. A max_bytes of 0 means there is no upper bound. Empty
+// bodies are left alone.
+func NewBodySizeFilterCollector(min_bytes, max_bytes int, col Collector) Collector {
+	if min_bytes <= 0 && max_bytes <= 0 {
+		return col
+	}
+	return &bodySizeFilterCollector{
+		min_bytes: int64(min_bytes),
+		max_bytes: int64(max_bytes),
+		collector: col,
+	}
+}
+
+type bodySizeFilterCollector struct {
+	min_bytes int64
+	max_bytes int64
+	collector Collector
+}
+
+func (c *bodySizeFilterCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if !c.inRange(content.Body) {
+			content.Body = memview.MemView{}
+			t.Content = content
+		}
+	case akinet.HTTPResponse:
+		if !c.inRange(content.Body) {
+			content.Body = memview.MemView{}
+			t.Content = content
+		}
+	}
+	return c.collector.Process(t)
+}
+
+// Determines whether the body should be kept.
+func (c *bodySizeFilterCollector) inRange(body memview.MemView) bool {
+	size := body.Len()
+	if size == 0 {
+		return true
+	}
+	if size < c.min_bytes {
+		return false
+	}
+	return c.max_bytes <= 0 || size <= c.max_bytes
+}
+
+func (c *bodySizeFilterCollector) Close() error {
+	return c.collector.Close()
+}
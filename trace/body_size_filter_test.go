@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodySizeFilterCollector(t *testing.T) {
+	sizes := []int{0, 10, 100, 1000}
+
+	testCases := []struct {
+		name      string
+		min_bytes int
+		max_bytes int
+		kept      []int
+	}{
+		{name: "min only", min_bytes: 100, kept: []int{0, 100, 1000}},
+		{name: "max only", max_bytes: 100, kept: []int{0, 10, 100}},
+		{name: "range", min_bytes: 50, max_bytes: 500, kept: []int{0, 100}},
+		{name: "unbounded", kept: sizes},
+	}
+
+	for _, tc := range testCases {
+		rec := &trafficRecorder{}
+		c := NewBodySizeFilterCollector(tc.min_bytes, tc.max_bytes, rec)
+		for i, size := range sizes {
+			body := memview.New([]byte(strings.Repeat("a", size)))
+			assert.NoError(t, c.Process(akinet.ParsedNetworkTraffic{
+				Content: akinet.HTTPRequest{StreamID: uuid.New(), Seq: i, Method: "POST", Body: body},
+			}), tc.name)
+			assert.NoError(t, c.Process(akinet.ParsedNetworkTraffic{
+				Content: akinet.HTTPResponse{StreamID: uuid.New(), Seq: i, StatusCode: 200, Body: body},
+			}), tc.name)
+		}
+		assert.NoError(t, c.Close(), tc.name)
+
+		// Metadata is kept even when the body is dropped.
+		var keptRequests, keptResponses []int
+		for _, p := range rec.traffic {
+			switch content := p.Content.(type) {
+			case akinet.HTTPRequest:
+				assert.Equal(t, "POST", content.Method, tc.name)
+				if size := sizes[content.Seq]; content.Body.Len() == int64(size) {
+					keptRequests = append(keptRequests, size)
+				}
+			case akinet.HTTPResponse:
+				assert.Equal(t, 200, content.StatusCode, tc.name)
+				if size := sizes[content.Seq]; content.Body.Len() == int64(size) {
+					keptResponses = append(keptResponses, size)
+				}
+			}
+		}
+		assert.Equal(t, 2*len(sizes), len(rec.traffic), tc.name)
+		assert.Equal(t, tc.kept, keptRequests, tc.name)
+		assert.Equal(t, tc.kept, keptResponses, tc.name)
+	}
+}
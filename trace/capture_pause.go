@@ -0,0 +1,70 @@
+package trace
+
+import (
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Pauses and resumes the capture of HTTP traffic without stopping packet
+// capture or ending the learn session. While paused, HTTP requests and
+// responses are dropped; TCP and TLS connection metadata still flow. Shared by
+// the collectors for all interfaces. Safe for concurrent use.
+type CapturePause struct {
+	paused int32
+
+	// Number of HTTP requests and responses dropped while paused.
+	dropped int64
+}
+
+func NewCapturePause() *CapturePause {
+	return &CapturePause{}
+}
+
+// Pauses capture. Returns false if capture was already paused.
+func (p *CapturePause) Pause() bool {
+	return atomic.CompareAndSwapInt32(&p.paused, 0, 1)
+}
+
+// Resumes capture. Returns false if capture wasn't paused.
+func (p *CapturePause) Resume() bool {
+	return atomic.CompareAndSwapInt32(&p.paused, 1, 0)
+}
+
+func (p *CapturePause) Paused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
+
+// Returns the number of HTTP requests and responses dropped while paused.
+func (p *CapturePause) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+// Returns a collector that drops HTTP requests and responses while capture is
+// paused, and passes all other traffic to the given collector.
+func (p *CapturePause) NewCollector(col Collector) Collector {
+	return &capturePauseCollector{
+		pause:     p,
+		collector: col,
+	}
+}
+
+type capturePauseCollector struct {
+	pause     *CapturePause
+	collector Collector
+}
+
+func (c *capturePauseCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	switch t.Content.(type) {
+	case akinet.HTTPRequest, akinet.HTTPResponse:
+		if c.pause.Paused() {
+			atomic.AddInt64(&c.pause.dropped, 1)
+			return nil
+		}
+	}
+	return c.collector.Process(t)
+}
+
+func (c *capturePauseCollector) Close() error {
+	return c.collector.Close()
+}
@@ -0,0 +1,49 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapturePause(t *testing.T) {
+	pause := NewCapturePause()
+	rec := &trafficRecorder{}
+	c := pause.NewCollector(rec)
+
+	now := time.Now()
+	beforeReq, beforeResp := makeBodyExchange(uuid.New(), 1, now)
+	pausedReq, pausedResp := makeBodyExchange(uuid.New(), 1, now.Add(time.Second))
+	afterReq, afterResp := makeBodyExchange(uuid.New(), 1, now.Add(2*time.Second))
+	tcp := akinet.ParsedNetworkTraffic{
+		ObservationTime: now.Add(time.Second),
+		Content:         akinet.TCPConnectionMetadata{},
+	}
+
+	assert.NoError(t, c.Process(beforeReq))
+	assert.NoError(t, c.Process(beforeResp))
+
+	// Witnesses are dropped while paused, but connection metadata isn't.
+	assert.True(t, pause.Pause())
+	assert.False(t, pause.Pause())
+	assert.True(t, pause.Paused())
+	assert.NoError(t, c.Process(pausedReq))
+	assert.NoError(t, c.Process(tcp))
+	assert.NoError(t, c.Process(pausedResp))
+
+	// Witnesses flow again after resume.
+	assert.True(t, pause.Resume())
+	assert.False(t, pause.Resume())
+	assert.False(t, pause.Paused())
+	assert.NoError(t, c.Process(afterReq))
+	assert.NoError(t, c.Process(afterResp))
+
+	assert.NoError(t, c.Close())
+	assert.True(t, rec.closed)
+
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{beforeReq, beforeResp, tcp, afterReq, afterResp}, rec.traffic)
+	assert.Equal(t, int64(2), pause.Dropped())
+}
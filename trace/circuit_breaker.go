@@ -0,0 +1,185 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/telemetry"
+)
+
+type CircuitState int
+
+const (
+	// Uploads proceed normally.
+	CircuitClosed CircuitState = iota
+
+	// Uploads are paused until the cooldown expires.
+	CircuitOpen
+
+	// The cooldown has expired, and a single upload is allowed through to test
+	// whether the backend has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// Summary of an UploadCircuitBreaker's activity.
+type CircuitBreakerStats struct {
+	State CircuitState
+
+	// Number of times uploads were paused.
+	TimesOpened int
+
+	// Number of reports (witnesses, TCP-connection reports, etc.) dropped
+	// because they couldn't be held while uploads were paused.
+	DroppedReports int
+
+	// Number of upload requests that succeeded and failed.
+	Uploads       int
+	FailedUploads int
+}
+
+// Pauses uploads to the backend after repeated failures, so that an extended
+// backend outage doesn't cost an upload attempt (and a log message) on every
+// flush. The breaker is shared by the backend collectors for all interfaces.
+//
+// After failureThreshold consecutive failures, the breaker opens and uploads
+// are paused for the cooldown, or for longer if the backend sent a
+// Retry-After header. Once the pause expires, the breaker half-opens and lets
+// a single upload through: if it succeeds, the breaker closes; otherwise, it
+// opens again.
+type UploadCircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu sync.Mutex
+
+	state               CircuitState
+	consecutiveFailures int
+
+	// When an open breaker half-opens.
+	openUntil time.Time
+
+	// Whether the upload testing a half-open breaker is in flight.
+	probing bool
+
+	timesOpened    int
+	droppedReports int
+	uploads        int
+	failedUploads  int
+}
+
+// Creates a breaker that opens after failureThreshold consecutive failures,
+// pausing uploads for the given cooldown. If failureThreshold is not positive,
+// the breaker opens only when the backend sends a Retry-After header.
+func NewUploadCircuitBreaker(failureThreshold int, cooldown time.Duration) *UploadCircuitBreaker {
+	return &UploadCircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+	}
+}
+
+// Determines whether an upload may be attempted at the given time. If so, the
+// caller must report the outcome with recordSuccess or recordFailure.
+func (b *UploadCircuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		printer.Debugf("Testing whether uploads to Postman have recovered\n")
+		return true
+
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Records a successful upload, closing the breaker.
+func (b *UploadCircuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitClosed {
+		printer.Infof("Resuming uploads to Postman.\n")
+		telemetry.Success("upload circuit breaker closed")
+	}
+	b.state = CircuitClosed
+	b.consecutiveFailures = 0
+	b.probing = false
+	b.uploads += 1
+}
+
+// Records a failed upload at the given time. The breaker opens if the
+// failure threshold is reached, if the failed upload was testing a half-open
+// breaker, or if the backend asked us to wait by sending a Retry-After header.
+func (b *UploadCircuitBreaker) recordFailure(now time.Time, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures += 1
+	b.failedUploads += 1
+	b.probing = false
+
+	pause := retryAfter
+	reachedThreshold := b.failureThreshold > 0 && b.consecutiveFailures >= b.failureThreshold
+	if (b.state == CircuitHalfOpen || reachedThreshold) && pause < b.cooldown {
+		pause = b.cooldown
+	}
+	if pause <= 0 {
+		return
+	}
+
+	if b.state != CircuitOpen {
+		b.timesOpened += 1
+		printer.Warningf("Pausing uploads to Postman for %v (consecutive failures: %d).\n", pause, b.consecutiveFailures)
+		telemetry.Failure("upload circuit breaker opened")
+	}
+	b.state = CircuitOpen
+	if until := now.Add(pause); until.After(b.openUntil) {
+		b.openUntil = until
+	}
+}
+
+// Records reports that were dropped while uploads were paused.
+func (b *UploadCircuitBreaker) recordDropped(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.droppedReports += n
+}
+
+func (b *UploadCircuitBreaker) Stats() CircuitBreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return CircuitBreakerStats{
+		State:          b.state,
+		TimesOpened:    b.timesOpened,
+		DroppedReports: b.droppedReports,
+		Uploads:        b.uploads,
+		FailedUploads:  b.failedUploads,
+	}
+}
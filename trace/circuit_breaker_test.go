@@ -0,0 +1,73 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadCircuitBreakerTransitions(t *testing.T) {
+	start := time.Now()
+	b := NewUploadCircuitBreaker(3, time.Minute)
+
+	// Closed: failures below the threshold don't pause uploads.
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.allow(start))
+		b.recordFailure(start, 0)
+	}
+	assert.Equal(t, CircuitClosed, b.Stats().State)
+
+	// A success resets the failure count.
+	assert.True(t, b.allow(start))
+	b.recordSuccess()
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.allow(start))
+		b.recordFailure(start, 0)
+	}
+	assert.Equal(t, CircuitClosed, b.Stats().State)
+
+	// Open: the third consecutive failure pauses uploads for the cooldown.
+	assert.True(t, b.allow(start))
+	b.recordFailure(start, 0)
+	assert.Equal(t, CircuitOpen, b.Stats().State)
+	assert.False(t, b.allow(start.Add(59*time.Second)))
+
+	// Half-open: after the cooldown, exactly one upload is let through.
+	afterCooldown := start.Add(time.Minute)
+	assert.True(t, b.allow(afterCooldown))
+	assert.Equal(t, CircuitHalfOpen, b.Stats().State)
+	assert.False(t, b.allow(afterCooldown))
+
+	// A failure while half-open reopens the breaker immediately.
+	b.recordFailure(afterCooldown, 0)
+	assert.Equal(t, CircuitOpen, b.Stats().State)
+	assert.False(t, b.allow(afterCooldown.Add(59*time.Second)))
+
+	// A success while half-open closes the breaker.
+	afterSecondCooldown := afterCooldown.Add(time.Minute)
+	assert.True(t, b.allow(afterSecondCooldown))
+	b.recordSuccess()
+	assert.True(t, b.allow(afterSecondCooldown))
+
+	assert.Equal(t, CircuitBreakerStats{State: CircuitClosed, TimesOpened: 2, Uploads: 2, FailedUploads: 6}, b.Stats())
+}
+
+func TestUploadCircuitBreakerRetryAfter(t *testing.T) {
+	start := time.Now()
+	b := NewUploadCircuitBreaker(3, time.Minute)
+
+	// Retry-After pauses uploads even below the failure threshold.
+	b.recordFailure(start, 10*time.Second)
+	assert.Equal(t, CircuitOpen, b.Stats().State)
+	assert.False(t, b.allow(start.Add(9*time.Second)))
+	assert.True(t, b.allow(start.Add(10*time.Second)))
+
+	// Retry-After extends the cooldown once the threshold is reached.
+	b.recordSuccess()
+	b.recordFailure(start, 0)
+	b.recordFailure(start, 0)
+	b.recordFailure(start, 5*time.Minute)
+	assert.False(t, b.allow(start.Add(4*time.Minute)))
+	assert.True(t, b.allow(start.Add(5*time.Minute)))
+}
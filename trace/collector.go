@@ -32,6 +32,9 @@ type SamplingCollector struct {
 	// A sample is used if a coin flip is below this threshold.
 	sampleThreshold float64
 
+	// If set, samples are instead taken at the rate it currently gives.
+	pressure *MemoryPressureSampling
+
 	collector Collector
 }
 
@@ -51,26 +54,34 @@ func NewSamplingCollector(sampleRate float64, collector Collector) Collector {
 // Sample based on stream ID and seq so a pair of request and response are
 // either both selected or both excluded.
 func (sc *SamplingCollector) includeSample(key string) bool {
+	threshold := sc.sampleThreshold
+	if sc.pressure != nil {
+		threshold = float64(math.MaxUint32) * sc.pressure.SampleRate()
+	}
+
 	h := xxhash.New32()
 	h.WriteString(key)
-	return float64(h.Sum32()) < sc.sampleThreshold
+	return float64(h.Sum32()) < threshold
 }
 
-func (sc *SamplingCollector) Process(t akinet.ParsedNetworkTraffic) error {
-	var key string
+// Returns the key used to make sampling decisions for the given traffic.
+func samplingKey(t akinet.ParsedNetworkTraffic) string {
 	switch c := t.Content.(type) {
 	case akinet.HTTPRequest:
-		key = c.StreamID.String() + strconv.Itoa(c.Seq)
+		return c.StreamID.String() + strconv.Itoa(c.Seq)
 	case akinet.HTTPResponse:
-		key = c.StreamID.String() + strconv.Itoa(c.Seq)
+		return c.StreamID.String() + strconv.Itoa(c.Seq)
 	case akinet.TCPConnectionMetadata:
-		key = akid.String(c.ConnectionID)
+		return akid.String(c.ConnectionID)
 	case akinet.TLSHandshakeMetadata:
-		key = akid.String(c.ConnectionID)
+		return akid.String(c.ConnectionID)
 	default:
-		key = ""
+		return ""
 	}
-	if sc.includeSample(key) {
+}
+
+func (sc *SamplingCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if sc.includeSample(samplingKey(t)) {
 		return sc.collector.Process(t)
 	}
 	return nil
@@ -0,0 +1,49 @@
+package trace
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Bounds on the state kept by the TCP- and TLS-connection trackers.
+type ConnectionTrackerLimits struct {
+	// Connections with no activity for this long are evicted.
+	IdleTimeout time.Duration
+
+	// Maximum number of connections tracked at once. When a new connection
+	// would exceed this, the least recently active connection is evicted. Not
+	// enforced if non-positive.
+	MaxConnections int
+}
+
+// Counts connections evicted by the TCP- and TLS-connection trackers. Safe for
+// concurrent use.
+type ConnectionEvictions struct {
+	idle     int64
+	overflow int64
+}
+
+func NewConnectionEvictions() *ConnectionEvictions {
+	return &ConnectionEvictions{}
+}
+
+// Records a connection evicted for being idle without having been closed.
+func (e *ConnectionEvictions) RecordIdle() {
+	atomic.AddInt64(&e.idle, 1)
+}
+
+// Records a connection evicted to stay within the connection limit.
+func (e *ConnectionEvictions) RecordOverflow() {
+	atomic.AddInt64(&e.overflow, 1)
+}
+
+// Returns the number of connections evicted for being idle.
+func (e *ConnectionEvictions) Idle() int64 {
+	return atomic.LoadInt64(&e.idle)
+}
+
+// Returns the number of connections evicted to stay within the connection
+// limit.
+func (e *ConnectionEvictions) Overflow() int64 {
+	return atomic.LoadInt64(&e.overflow)
+}
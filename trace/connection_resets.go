@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// How the backend collector handles a request whose TCP connection was reset
+// before the response was seen.
+type ConnectionResetHandling string
+
+const (
+	// Keep the request until the pair cache expires it, as for any other
+	// request without a response. This is the default.
+	WaitOnConnectionReset ConnectionResetHandling = "wait"
+
+	// Upload the request as soon as the reset is seen, marked as reset in its
+	// WitnessInfo.
+	EmitOnConnectionReset ConnectionResetHandling = "emit"
+
+	// Discard the request as soon as the reset is seen.
+	DropOnConnectionReset ConnectionResetHandling = "drop"
+)
+
+var connectionResetHandlings = []ConnectionResetHandling{WaitOnConnectionReset, EmitOnConnectionReset, DropOnConnectionReset}
+
+func ParseConnectionResetHandling(s string) (ConnectionResetHandling, error) {
+	for _, h := range connectionResetHandlings {
+		if strings.EqualFold(s, string(h)) {
+			return h, nil
+		}
+	}
+	names := make([]string, 0, len(connectionResetHandlings))
+	for _, h := range connectionResetHandlings {
+		names = append(names, string(h))
+	}
+	return "", errors.Errorf("invalid connection reset handling %q; must be one of %s", s, strings.Join(names, ", "))
+}
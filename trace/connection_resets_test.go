@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the witnesses exported to it.
+type sinkRecorder struct {
+	mutex sync.Mutex
+	infos []WitnessInfo
+	args  []map[string]*pb.Data
+}
+
+func (r *sinkRecorder) ExportWitness(w *pb.Witness, _ time.Time, info WitnessInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.infos = append(r.infos, info)
+	r.args = append(r.args, w.GetMethod().GetArgs())
+}
+
+func (r *sinkRecorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.infos)
+}
+
+func newResetTestTraffic(streamID uuid.UUID, endState akinet.TCPConnectionEndState) (akinet.ParsedNetworkTraffic, akinet.ParsedNetworkTraffic) {
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "POST",
+			URL:      &url.URL{Path: "/v1/orders"},
+			Host:     "example.com",
+		},
+		ObservationTime: time.Now(),
+	}
+	tcp := akinet.ParsedNetworkTraffic{
+		Content: akinet.TCPConnectionMetadata{
+			ConnectionID: akid.NewConnectionID(streamID),
+			EndState:     endState,
+		},
+		ObservationTime: time.Now(),
+	}
+	return req, tcp
+}
+
+func TestConnectionResetEmitsWitness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	col.(*BackendCollector).SetConnectionResetHandling(EmitOnConnectionReset)
+
+	// A connection that closed normally leaves its request waiting.
+	req, fin := newResetTestTraffic(uuid.New(), akinet.ConnectionClosed)
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(fin))
+	assert.Equal(t, 0, sink.count())
+
+	// A reset connection's request is exported immediately, before the pair
+	// cache expires it.
+	req, rst := newResetTestTraffic(uuid.New(), akinet.ConnectionReset)
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(rst))
+	if assert.Equal(t, 1, sink.count()) {
+		assert.True(t, sink.infos[0].ConnectionReset)
+		assert.Equal(t, int64(-1), sink.infos[0].Response_bytes)
+
+		// Nothing is added to the witness to mark the reset.
+		assert.Empty(t, sink.args[0])
+	}
+
+	// Only the waiting request remains to be flushed on close.
+	assert.NoError(t, col.Close())
+	if assert.Equal(t, 2, sink.count()) {
+		assert.False(t, sink.infos[1].ConnectionReset)
+	}
+}
+
+func TestConnectionResetDropsWitness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	col.(*BackendCollector).SetConnectionResetHandling(DropOnConnectionReset)
+
+	req, rst := newResetTestTraffic(uuid.New(), akinet.ConnectionReset)
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(rst))
+	assert.NoError(t, col.Close())
+	assert.Equal(t, 0, sink.count())
+}
+
+func TestParseConnectionResetHandling(t *testing.T) {
+	h, err := ParseConnectionResetHandling("Emit")
+	assert.NoError(t, err)
+	assert.Equal(t, EmitOnConnectionReset, h)
+
+	_, err = ParseConnectionResetHandling("retry")
+	assert.Error(t, err)
+}
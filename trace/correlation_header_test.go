@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationHeaderSurvivesObfuscation(t *testing.T) {
+	learn.SetCorrelationHeader("x-correlation-id")
+	defer learn.SetCorrelationHeader("")
+
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var rec witnessRecorder
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(rec.recordAsyncReportsUpload).
+		AnyTimes().
+		Return(nil)
+
+	streamID := uuid.New()
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/pets"},
+			Host:     "example.com",
+			Header: map[string][]string{
+				"X-Correlation-Id": {"abc-123"},
+				"X-Other":          {"secret"},
+			},
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1,
+			StatusCode: 200,
+			Header: map[string][]string{
+				"X-Correlation-Id": {"def-456"},
+			},
+			Body: memview.New([]byte("ok")),
+		},
+	}
+
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(resp))
+	assert.NoError(t, col.Close())
+
+	if !assert.Len(t, rec.witnesses, 1) {
+		return
+	}
+	headers := map[string]string{}
+	for _, d := range rec.witnesses[0].GetMethod().GetArgs() {
+		if key := d.GetMeta().GetHttp().GetHeader().GetKey(); key != "" {
+			headers[key] = d.GetPrimitive().GetStringValue().GetValue()
+		}
+	}
+	assert.Equal(t, "abc-123", headers["X-Correlation-Id"])
+	assert.NotEqual(t, "secret", headers["X-Other"])
+
+	// The header in the response is obfuscated as usual.
+	for _, d := range rec.witnesses[0].GetMethod().GetResponses() {
+		assert.NotEqual(t, "def-456", d.GetPrimitive().GetStringValue().GetValue())
+	}
+
+	if assert.Equal(t, 1, sink.count()) {
+		assert.Equal(t, "abc-123", sink.infos[0].CorrelationID)
+	}
+}
@@ -0,0 +1,124 @@
+package trace
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Maximum number of endpoints tallied during a dry run.
+const maxDryRunEndpoints = 1000
+
+type dryRunKey struct {
+	method string
+	host   string
+	path   string
+}
+
+// Number of requests to a single endpoint that would have been captured.
+type DryRunEndpoint struct {
+	Method   string
+	Host     string
+	Path     string
+	Requests int64
+}
+
+// Tallies the requests that would have produced witnesses, in place of
+// uploading them. Shared by the collectors for all interfaces; create a
+// collector for each with NewCollector.
+type DryRunTally struct {
+	mutex sync.Mutex
+
+	endpoints map[dryRunKey]int64
+
+	// Number of requests not tallied because too many endpoints were seen.
+	overflow int64
+}
+
+func NewDryRunTally() *DryRunTally {
+	return &DryRunTally{
+		endpoints: make(map[dryRunKey]int64),
+	}
+}
+
+// Returns a collector that tallies requests and discards all traffic. It
+// stands in for the backend collector.
+func (t *DryRunTally) NewCollector() Collector {
+	return &dryRunCollector{tally: t}
+}
+
+func (t *DryRunTally) observe(r akinet.HTTPRequest) {
+	k := dryRunKey{
+		method: r.Method,
+		host:   r.Host,
+		path:   pathOf(r),
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, ok := t.endpoints[k]; !ok && len(t.endpoints) >= maxDryRunEndpoints {
+		t.overflow += 1
+		return
+	}
+	t.endpoints[k] += 1
+}
+
+// Returns the n endpoints with the most requests, most first.
+func (t *DryRunTally) TopN(n int) []DryRunEndpoint {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]DryRunEndpoint, 0, len(t.endpoints))
+	for k, c := range t.endpoints {
+		result = append(result, DryRunEndpoint{
+			Method:   k.method,
+			Host:     k.host,
+			Path:     k.path,
+			Requests: c,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Requests != result[j].Requests {
+			return result[i].Requests > result[j].Requests
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of requests that were not tallied because too many
+// endpoints were seen.
+func (t *DryRunTally) Overflow() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.overflow
+}
+
+type dryRunCollector struct {
+	tally *DryRunTally
+}
+
+func (c *dryRunCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if r, ok := t.Content.(akinet.HTTPRequest); ok {
+		c.tally.observe(r)
+	}
+	return nil
+}
+
+func (c *dryRunCollector) Close() error {
+	return nil
+}
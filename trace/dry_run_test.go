@@ -0,0 +1,41 @@
+package trace
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTally(t *testing.T) {
+	request := func(method, host, path string) akinet.ParsedNetworkTraffic {
+		return akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPRequest{
+				Method: method,
+				Host:   host,
+				URL:    &url.URL{Path: path},
+			},
+		}
+	}
+
+	tally := NewDryRunTally()
+	col := tally.NewCollector()
+	for _, tr := range []akinet.ParsedNetworkTraffic{
+		request("GET", "api.example.com", "/v1/users"),
+		request("GET", "api.example.com", "/v1/users"),
+		request("POST", "api.example.com", "/v1/users"),
+		request("GET", "other.example.com", "/v1/users"),
+		{Content: akinet.HTTPResponse{StatusCode: 200}},
+	} {
+		assert.NoError(t, col.Process(tr))
+	}
+	assert.NoError(t, col.Close())
+
+	assert.Equal(t, []DryRunEndpoint{
+		{Method: "GET", Host: "api.example.com", Path: "/v1/users", Requests: 2},
+		{Method: "POST", Host: "api.example.com", Path: "/v1/users", Requests: 1},
+	}, tally.TopN(2))
+	assert.Len(t, tally.TopN(10), 3)
+	assert.Equal(t, int64(0), tally.Overflow())
+}
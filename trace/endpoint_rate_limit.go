@@ -0,0 +1,221 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// How often buckets for idle endpoints are removed, measured in packet
+// observation time.
+const endpointBucketSweepInterval = time.Minute
+
+// Identifies the endpoint of a request before it is parsed into a witness.
+// The path template is derived from the request path in the same way as in
+// schema-only mode.
+func endpointKeyOfRequest(r akinet.HTTPRequest) endpointKey {
+	path := ""
+	if r.URL != nil {
+		path = r.URL.Path
+	}
+	return endpointKey{
+		Method:       r.Method,
+		Host:         r.Host,
+		PathTemplate: schemaOnlyPath(path),
+	}
+}
+
+// Identifies the endpoint of a witness. At capture time, the witness's path
+// template is the request's concrete path, so it is templated in the same way
+// as in schema-only mode. Otherwise, each ID in a path would count as a
+// different endpoint.
+func endpointKeyOfMeta(meta *pb.HTTPMethodMeta) endpointKey {
+	return endpointKey{
+		Method:       meta.GetMethod(),
+		Host:         meta.GetHost(),
+		PathTemplate: schemaOnlyPath(meta.GetPathTemplate()),
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+
+	// When tokens was last updated.
+	updated time.Time
+}
+
+// Token buckets that limit the rate at which witnesses are captured for each
+// key. Each bucket holds up to a minute's worth of witnesses.
+//
+// Imposes a hard limit on the number of keys that are individually limited;
+// requests with further keys are not limited.
+type keyedRateLimit[K comparable] struct {
+	witnessesPerMinute float64
+
+	mu sync.Mutex
+
+	buckets map[K]*tokenBucket
+
+	// When buckets for idle keys were last removed.
+	lastSweep time.Time
+}
+
+func newKeyedRateLimit[K comparable](witnessesPerMinute float64) keyedRateLimit[K] {
+	return keyedRateLimit[K]{
+		witnessesPerMinute: witnessesPerMinute,
+		buckets:            map[K]*tokenBucket{},
+	}
+}
+
+// The number of tokens in a full bucket.
+func (l *keyedRateLimit[K]) capacity() float64 {
+	if l.witnessesPerMinute < 1 {
+		return 1
+	}
+	return l.witnessesPerMinute
+}
+
+// Determines whether a request with the given key, observed at the given
+// time, may be captured, and takes a token if so.
+func (l *keyedRateLimit[K]) allow(key K, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.removeIdleBuckets(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxKeys {
+			return true
+		}
+		b = &tokenBucket{tokens: l.capacity(), updated: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += elapsed.Minutes() * l.witnessesPerMinute
+		if b.tokens > l.capacity() {
+			b.tokens = l.capacity()
+		}
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+// Removes buckets that would have refilled completely by the given time.
+// These are indistinguishable from new buckets. Must be called with the mutex
+// held.
+func (l *keyedRateLimit[K]) removeIdleBuckets(now time.Time) {
+	if now.Sub(l.lastSweep) < endpointBucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.updated).Minutes()*l.witnessesPerMinute
+		if refilled >= l.capacity() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limits the rate at which witnesses are captured for each endpoint, so that a
+// few busy endpoints don't use up the capture budget set by --rate-limit.
+// Shared by the collectors for all interfaces.
+type EndpointRateLimit struct {
+	keyedRateLimit[endpointKey]
+}
+
+// Creates a limit of the given number of witnesses per minute for each
+// endpoint.
+func NewEndpointRateLimit(witnessesPerMinute float64) *EndpointRateLimit {
+	return &EndpointRateLimit{
+		keyedRateLimit: newKeyedRateLimit[endpointKey](witnessesPerMinute),
+	}
+}
+
+// Returns a collector that passes to the given collector only the requests
+// allowed by the limit, along with their responses.
+func (l *EndpointRateLimit) NewCollector(next Collector) Collector {
+	return newRequestRateLimitCollector(func(r akinet.HTTPRequest, now time.Time) bool {
+		return l.allow(endpointKeyOfRequest(r), now)
+	}, next)
+}
+
+func newRequestRateLimitCollector(allow func(r akinet.HTTPRequest, now time.Time) bool, next Collector) Collector {
+	return &requestRateLimitCollector{
+		allow:     allow,
+		collector: next,
+		selected:  map[akid.WitnessID]time.Time{},
+	}
+}
+
+// Passes on the requests allowed by a keyed rate limit, along with their
+// responses.
+type requestRateLimitCollector struct {
+	// Determines whether a request, observed at the given time, may be
+	// captured.
+	allow     func(r akinet.HTTPRequest, now time.Time) bool
+	collector Collector
+
+	// Requests that were allowed and whose response hasn't been seen yet, with
+	// the time each request was observed.
+	selected map[akid.WitnessID]time.Time
+
+	// Observation time of the most recent packet, and the time at which
+	// selected requests were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+func (c *requestRateLimitCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if t.ObservationTime.After(c.latestObservation) {
+		c.latestObservation = t.ObservationTime
+	}
+	c.expireSelectedRequests()
+
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if !c.allow(content, c.latestObservation) {
+			return nil
+		}
+		c.selected[learn.ToWitnessID(content.StreamID, content.Seq)] = t.ObservationTime
+
+	case akinet.HTTPResponse:
+		// Responses follow the decision made for their request.
+		id := learn.ToWitnessID(content.StreamID, content.Seq)
+		if _, ok := c.selected[id]; !ok {
+			return nil
+		}
+		delete(c.selected, id)
+	}
+	return c.collector.Process(t)
+}
+
+// Forgets selected requests that have waited too long for their response.
+func (c *requestRateLimitCollector) expireSelectedRequests() {
+	if c.latestObservation.Sub(c.lastSweep) < pendingRequestSweepInterval {
+		return
+	}
+	c.lastSweep = c.latestObservation
+
+	cutoff := c.latestObservation.Add(-pendingRequestExpiration)
+	for id, observed := range c.selected {
+		if observed.Before(cutoff) {
+			delete(c.selected, id)
+		}
+	}
+}
+
+func (c *requestRateLimitCollector) Close() error {
+	return c.collector.Close()
+}
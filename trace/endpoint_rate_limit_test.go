@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointRateLimit(t *testing.T) {
+	rec := newPairRecorder()
+	limit := NewEndpointRateLimit(10)
+	c := limit.NewCollector(rec)
+
+	start := time.Now()
+	var hot, cold []string
+	for i := 0; i < 100; i++ {
+		now := start.Add(time.Duration(i) * 100 * time.Millisecond)
+
+		req, resp := makeExchange(i, 200, now)
+		r := req.Content.(akinet.HTTPRequest)
+		r.URL = &url.URL{Path: "/v1/doggos/" + strconv.Itoa(i)}
+		req.Content = r
+		hot = append(hot, samplingKey(req))
+		assert.NoError(t, c.Process(req))
+		assert.NoError(t, c.Process(resp))
+
+		if i%20 == 0 {
+			req, resp := makeExchange(1000+i, 200, now)
+			r := req.Content.(akinet.HTTPRequest)
+			r.URL = &url.URL{Path: "/v1/owners/123"}
+			req.Content = r
+			cold = append(cold, samplingKey(req))
+			assert.NoError(t, c.Process(req))
+			assert.NoError(t, c.Process(resp))
+		}
+	}
+	assert.NoError(t, c.Close())
+
+	// The hot endpoint gets its initial burst of 10, plus one more per 6
+	// seconds over the 10 seconds of traffic.
+	hotCaptured := 0
+	for _, k := range hot {
+		if _, ok := rec.requests[k]; ok {
+			hotCaptured++
+			_, hasResponse := rec.responses[k]
+			assert.True(t, hasResponse, "response should follow its request")
+		}
+	}
+	assert.Equal(t, 11, hotCaptured)
+
+	// Every request to the cold endpoint is captured.
+	for _, k := range cold {
+		assert.Contains(t, rec.requests, k)
+		assert.Contains(t, rec.responses, k)
+	}
+}
+
+func TestEndpointRateLimitRemovesIdleBuckets(t *testing.T) {
+	limit := NewEndpointRateLimit(60)
+	start := time.Now()
+	hot := endpointKey{Method: "GET", Host: "example.com", PathTemplate: "/v1/doggos"}
+	idle := endpointKey{Method: "GET", Host: "example.com", PathTemplate: "/v1/owners"}
+
+	assert.True(t, limit.allow(idle, start))
+	for i := 0; i < 60; i++ {
+		limit.allow(hot, start)
+	}
+	assert.False(t, limit.allow(hot, start))
+	assert.Len(t, limit.buckets, 2)
+
+	// After two minutes, both buckets would have refilled, so they're removed
+	// and recreated on demand.
+	later := start.Add(2 * time.Minute)
+	assert.True(t, limit.allow(hot, later))
+	assert.Len(t, limit.buckets, 1)
+}
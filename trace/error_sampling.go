@@ -0,0 +1,173 @@
+package trace
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+const (
+	// How long a request is held waiting for its response before a sampling
+	// decision is made without knowing the response status.
+	pendingRequestExpiration = time.Minute
+
+	// How often held requests are checked for expiration, measured in packet
+	// observation time.
+	pendingRequestSweepInterval = 10 * time.Second
+)
+
+// Wraps a Collector and samples successful HTTP exchanges, while always
+// forwarding exchanges whose response has an error status (4xx or 5xx).
+//
+// Requests are held until the corresponding response arrives, so the sampling
+// decision can be made when the status is known. Requests whose response does
+// not arrive within pendingRequestExpiration are sampled as if they were
+// successful. Non-HTTP traffic is sampled at the same rate as successes.
+type errorPreservingSamplingCollector struct {
+	sampler   *SamplingCollector
+	collector Collector
+
+	// Protects the fields below. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mutex sync.Mutex
+
+	// Requests waiting for their response.
+	pendingRequests map[akid.WitnessID]akinet.ParsedNetworkTraffic
+
+	// Observation time of the most recent packet, and the time at which held
+	// requests were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+// Wraps a collector and samples successful HTTP exchanges at the given rate,
+// forwarding all error responses. Returns the collector itself if the given
+// successSampleRate is 1.0.
+func NewErrorPreservingSamplingCollector(successSampleRate float64, collector Collector) Collector {
+	if successSampleRate == 1.0 {
+		return collector
+	}
+
+	return &errorPreservingSamplingCollector{
+		sampler: &SamplingCollector{
+			sampleThreshold: float64(math.MaxUint32) * successSampleRate,
+			collector:       collector,
+		},
+		collector:       collector,
+		pendingRequests: map[akid.WitnessID]akinet.ParsedNetworkTraffic{},
+	}
+}
+
+func (ec *errorPreservingSamplingCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	if t.ObservationTime.After(ec.latestObservation) {
+		ec.latestObservation = t.ObservationTime
+	}
+	if err := ec.expirePendingRequests(); err != nil {
+		return err
+	}
+
+	switch c := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if learn.WebSocketMessageSender(c) != "" {
+			// WebSocket messages have no response to wait for.
+			return ec.sampler.Process(t)
+		}
+
+		// The request's buffers are released once Process returns, so hold a
+		// copy of the request instead.
+		held := t
+		held.Content = copyHTTPRequest(c)
+		ec.pendingRequests[learn.ToWitnessID(c.StreamID, c.Seq)] = held
+		return nil
+
+	case akinet.HTTPResponse:
+		id := learn.ToWitnessID(c.StreamID, c.Seq)
+		req, hasRequest := ec.pendingRequests[id]
+		delete(ec.pendingRequests, id)
+
+		if isErrorStatus(c.StatusCode) {
+			if hasRequest {
+				if err := ec.collector.Process(req); err != nil {
+					return err
+				}
+			}
+			return ec.collector.Process(t)
+		}
+
+		// Requests and responses share a sampling key, so they are either both
+		// selected or both excluded.
+		if hasRequest {
+			if err := ec.sampler.Process(req); err != nil {
+				return err
+			}
+		}
+		return ec.sampler.Process(t)
+
+	default:
+		return ec.sampler.Process(t)
+	}
+}
+
+// Makes a sampling decision for requests that have waited too long for their
+// response. Must be called with the mutex held.
+func (ec *errorPreservingSamplingCollector) expirePendingRequests() error {
+	if ec.latestObservation.Sub(ec.lastSweep) < pendingRequestSweepInterval {
+		return nil
+	}
+	ec.lastSweep = ec.latestObservation
+
+	cutoff := ec.latestObservation.Add(-pendingRequestExpiration)
+	for id, req := range ec.pendingRequests {
+		if req.ObservationTime.Before(cutoff) {
+			delete(ec.pendingRequests, id)
+			if err := ec.sampler.Process(req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ec *errorPreservingSamplingCollector) Close() error {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	// Requests that never received a response are sampled as successes.
+	for id, req := range ec.pendingRequests {
+		delete(ec.pendingRequests, id)
+		if err := ec.sampler.Process(req); err != nil {
+			ec.collector.Close()
+			return err
+		}
+	}
+	return ec.collector.Close()
+}
+
+// Returns a copy of the request that does not share storage with the
+// original's buffers.
+func copyHTTPRequest(r akinet.HTTPRequest) akinet.HTTPRequest {
+	return akinet.HTTPRequest{
+		StreamID:         r.StreamID,
+		Seq:              r.Seq,
+		Method:           r.Method,
+		ProtoMajor:       r.ProtoMajor,
+		ProtoMinor:       r.ProtoMinor,
+		URL:              r.URL,
+		Host:             r.Host,
+		Header:           r.Header,
+		Body:             r.Body.DeepCopy(),
+		BodyDecompressed: r.BodyDecompressed,
+		Cookies:          r.Cookies,
+	}
+}
+
+func isErrorStatus(statusCode int) bool {
+	return statusCode >= 400
+}
@@ -0,0 +1,172 @@
+package trace
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the witness IDs of the requests and responses it receives.
+type pairRecorder struct {
+	requests  map[string]struct{}
+	responses map[string]struct{}
+}
+
+func newPairRecorder() *pairRecorder {
+	return &pairRecorder{
+		requests:  map[string]struct{}{},
+		responses: map[string]struct{}{},
+	}
+}
+
+func (r *pairRecorder) Process(t akinet.ParsedNetworkTraffic) error {
+	switch t.Content.(type) {
+	case akinet.HTTPRequest:
+		r.requests[samplingKey(t)] = struct{}{}
+	case akinet.HTTPResponse:
+		r.responses[samplingKey(t)] = struct{}{}
+	}
+	return nil
+}
+
+func (r *pairRecorder) Close() error {
+	return nil
+}
+
+func makeExchange(seq int, statusCode int, observationTime time.Time) (akinet.ParsedNetworkTraffic, akinet.ParsedNetworkTraffic) {
+	streamID := uuid.New()
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      seq,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "example.com",
+		},
+		ObservationTime: observationTime,
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        seq,
+			StatusCode: statusCode,
+		},
+		ObservationTime: observationTime,
+	}
+	return req, resp
+}
+
+// Passes each batch of traffic to the given collector on its own goroutine,
+// as the TCP and TLS connection trackers do when flushing reports from their
+// timers, and waits for all of them to finish.
+func processConcurrently(t *testing.T, c Collector, batches ...[]akinet.ParsedNetworkTraffic) {
+	var wg sync.WaitGroup
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch []akinet.ParsedNetworkTraffic) {
+			defer wg.Done()
+			for _, p := range batch {
+				assert.NoError(t, c.Process(p))
+			}
+		}(batch)
+	}
+	wg.Wait()
+}
+
+func TestErrorPreservingSampling(t *testing.T) {
+	testCases := []struct {
+		name        string
+		sampleRate  float64
+		statusCode  int
+		minExpected int
+		maxExpected int
+	}{
+		{"client errors at rate 0", 0.0, 404, 1000, 1000},
+		{"server errors at rate 0", 0.0, 503, 1000, 1000},
+		{"successes at rate 0", 0.0, 200, 0, 0},
+		{"successes at rate 0.5", 0.5, 200, 400, 600},
+		{"redirects at rate 0.1", 0.1, 302, 50, 150},
+	}
+
+	for _, tc := range testCases {
+		rec := newPairRecorder()
+		c := NewErrorPreservingSamplingCollector(tc.sampleRate, rec)
+
+		now := time.Now()
+		for i := 0; i < 1000; i++ {
+			req, resp := makeExchange(i, tc.statusCode, now)
+			assert.NoError(t, c.Process(req), "["+tc.name+"]")
+			assert.NoError(t, c.Process(resp), "["+tc.name+"]")
+		}
+		assert.NoError(t, c.Close(), "["+tc.name+"]")
+
+		assert.GreaterOrEqual(t, len(rec.responses), tc.minExpected, "["+tc.name+"]")
+		assert.LessOrEqual(t, len(rec.responses), tc.maxExpected, "["+tc.name+"]")
+
+		// Requests and responses are sampled as pairs.
+		assert.Equal(t, rec.responses, rec.requests, "["+tc.name+"]")
+	}
+}
+
+func TestErrorPreservingSamplingHoldsRequests(t *testing.T) {
+	rec := newPairRecorder()
+	c := NewErrorPreservingSamplingCollector(0.0, rec)
+
+	now := time.Now()
+	req, resp := makeExchange(1, 500, now)
+
+	// The request is held until its response is seen.
+	assert.NoError(t, c.Process(req))
+	assert.Equal(t, 0, len(rec.requests))
+
+	assert.NoError(t, c.Process(resp))
+	assert.Equal(t, 1, len(rec.requests))
+	assert.Equal(t, 1, len(rec.responses))
+
+	// Error responses without a request are still forwarded.
+	_, orphan := makeExchange(2, 500, now)
+	assert.NoError(t, c.Process(orphan))
+	assert.Equal(t, 2, len(rec.responses))
+}
+
+func TestErrorPreservingSamplingExpiresRequests(t *testing.T) {
+	rec := newPairRecorder()
+	ec := NewErrorPreservingSamplingCollector(0.0, rec).(*errorPreservingSamplingCollector)
+
+	start := time.Now()
+	req, _ := makeExchange(1, 200, start)
+	assert.NoError(t, ec.Process(req))
+	assert.Equal(t, 1, len(ec.pendingRequests))
+
+	// Traffic observed after the expiration causes the held request to be
+	// sampled (and, at rate 0, dropped).
+	later, _ := makeExchange(2, 200, start.Add(pendingRequestExpiration+pendingRequestSweepInterval))
+	assert.NoError(t, ec.Process(later))
+	assert.Equal(t, 1, len(ec.pendingRequests))
+	assert.Equal(t, 0, len(rec.requests))
+
+	assert.NoError(t, ec.Close())
+	assert.Equal(t, 0, len(ec.pendingRequests))
+}
+
+func TestErrorPreservingSamplingConcurrentProcess(t *testing.T) {
+	rec := newPairRecorder()
+	c := NewErrorPreservingSamplingCollector(0.0, rec)
+
+	now := time.Now()
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 400; i++ {
+		req, resp := makeExchange(i, 500, now)
+		batches[i%len(batches)] = append(batches[i%len(batches)], req, resp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, 400, len(rec.responses))
+	assert.Equal(t, rec.responses, rec.requests)
+}
@@ -1,7 +1,10 @@
 package trace
 
 import (
+	"net/url"
+	"path"
 	"regexp"
+	"strings"
 
 	"github.com/akitasoftware/akita-libs/akid"
 	"github.com/akitasoftware/akita-libs/akinet"
@@ -17,7 +20,7 @@ func NewHTTPPathFilterCollector(matchers []*regexp.Regexp, col Collector) Collec
 		filterFunc: func(r akinet.HTTPRequest) bool {
 			if r.URL != nil {
 				for _, m := range matchers {
-					if m.MatchString(r.URL.Path) {
+					if m.MatchString(normalizedPath(r.URL)) {
 						return false
 					}
 				}
@@ -27,6 +30,25 @@ func NewHTTPPathFilterCollector(matchers []*regexp.Regexp, col Collector) Collec
 	}
 }
 
+// Returns the form of the URL's path that path filters are matched against.
+// The path is percent-decoded, repeated slashes are collapsed, and "." and
+// ".." segments are resolved, so that equivalent spellings of a path can't be
+// used to bypass a filter. A trailing slash is preserved.
+func normalizedPath(u *url.URL) string {
+	// url.URL.Path is already percent-decoded; the original encoding, if any,
+	// is kept in RawPath.
+	p := u.Path
+	if p == "" {
+		return p
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
 // Filter out matching HTTP hosts
 func NewHTTPHostFilterCollector(matchers []*regexp.Regexp, col Collector) Collector {
 	return &genericRequestFilter{
@@ -50,7 +72,7 @@ func NewHTTPPathAllowlistCollector(matchers []*regexp.Regexp, col Collector) Col
 		filterFunc: func(r akinet.HTTPRequest) bool {
 			if r.URL != nil {
 				for _, m := range matchers {
-					if m.MatchString(r.URL.Path) {
+					if m.MatchString(normalizedPath(r.URL)) {
 						return true
 					}
 				}
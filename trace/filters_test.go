@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizedPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rawPath  string
+		expected string
+	}{
+		{"plain", "/v1/users/123", "/v1/users/123"},
+		{"encoded slash", "/v1/users%2F123", "/v1/users/123"},
+		{"encoded letters", "/v1/%61dmin", "/v1/admin"},
+		{"double slash", "/v1//admin", "/v1/admin"},
+		{"dot segment", "/v1/./admin", "/v1/admin"},
+		{"dot-dot segment", "/v1/public/../admin", "/v1/admin"},
+		{"dot-dot above root", "/../admin", "/admin"},
+		{"encoded dot-dot", "/v1/public/%2E%2E/admin", "/v1/admin"},
+		{"trailing slash", "/v1/admin/", "/v1/admin/"},
+		{"root", "/", "/"},
+	}
+
+	for _, tc := range testCases {
+		u, err := url.ParseRequestURI(tc.rawPath)
+		if !assert.NoError(t, err, "["+tc.name+"]") {
+			continue
+		}
+		assert.Equal(t, tc.expected, normalizedPath(u), "["+tc.name+"]")
+	}
+}
+
+func TestPathFiltersUseNormalizedPath(t *testing.T) {
+	admin := []*regexp.Regexp{regexp.MustCompile(`^/v1/admin(/|$)`)}
+
+	testCases := []struct {
+		name    string
+		rawPath string
+
+		// Whether the path is considered a match for the filter.
+		expectMatch bool
+	}{
+		{"plain", "/v1/admin", true},
+		{"double slash", "/v1//admin", true},
+		{"dot-dot segment", "/v1/public/../admin/users", true},
+		{"encoded", "/v1/%61dmin", true},
+		{"unrelated", "/v1/users", false},
+	}
+
+	for _, tc := range testCases {
+		u, err := url.ParseRequestURI(tc.rawPath)
+		if !assert.NoError(t, err, "["+tc.name+"]") {
+			continue
+		}
+		req := akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPRequest{
+				StreamID: uuid.New(),
+				Seq:      1,
+				Method:   "GET",
+				URL:      u,
+				Host:     "example.com",
+			},
+		}
+
+		excluded := &countingCollector{}
+		assert.NoError(t, NewHTTPPathFilterCollector(admin, excluded).Process(req), "["+tc.name+"]")
+		assert.Equal(t, !tc.expectMatch, excluded.GetNumPackets() == 1, "["+tc.name+"] exclusion")
+
+		allowed := &requestRecorder{}
+		assert.NoError(t, NewHTTPPathAllowlistCollector(admin, allowed).Process(req), "["+tc.name+"]")
+		if !tc.expectMatch {
+			assert.Empty(t, allowed.requests, "["+tc.name+"] allowlist")
+		} else if assert.Equal(t, 1, len(allowed.requests), "["+tc.name+"] allowlist") {
+			// The witness keeps the original path.
+			assert.Equal(t, tc.rawPath, allowed.requests[0].URL.EscapedPath(), "["+tc.name+"] original path")
+		}
+	}
+}
+
+type requestRecorder struct {
+	requests []akinet.HTTPRequest
+}
+
+func (r *requestRecorder) Process(t akinet.ParsedNetworkTraffic) error {
+	if req, ok := t.Content.(akinet.HTTPRequest); ok {
+		r.requests = append(r.requests, req)
+	}
+	return nil
+}
+
+func (r *requestRecorder) Close() error {
+	return nil
+}
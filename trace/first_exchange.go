@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+)
+
+// Connections that haven't been seen for this long are forgotten. An exchange
+// on a forgotten connection is treated as its first.
+const firstExchangeIdleExpiration = 10 * time.Minute
+
+// Returns a collector that passes the first request and response on each
+// connection through unchanged, and strips the bodies from later ones, so
+// that only their metadata is captured. Connections beyond the first maxKeys
+// being tracked are passed through unchanged.
+func NewFirstExchangeCollector(col Collector) Collector {
+	return &firstExchangeCollector{
+		collector:   col,
+		connections: map[uuid.UUID]*exchangeConnection{},
+	}
+}
+
+type firstExchangeCollector struct {
+	collector Collector
+
+	// Protects the fields below. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mutex sync.Mutex
+
+	// Connections seen so far, keyed by stream ID.
+	connections map[uuid.UUID]*exchangeConnection
+
+	// Observation time of the most recent packet, and the time at which
+	// connections were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+type exchangeConnection struct {
+	// Sequence number of the first exchange seen on the connection.
+	firstSeq int
+
+	lastSeen time.Time
+}
+
+func (fc *firstExchangeCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	return fc.collector.Process(fc.stripBody(t))
+}
+
+// Returns the given traffic, with its body stripped unless it belongs to the
+// first exchange on its connection.
+func (fc *firstExchangeCollector) stripBody(t akinet.ParsedNetworkTraffic) akinet.ParsedNetworkTraffic {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if t.ObservationTime.After(fc.latestObservation) {
+		fc.latestObservation = t.ObservationTime
+	}
+	fc.expire()
+
+	switch c := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if !fc.isFirstExchange(c.StreamID, c.Seq, t.ObservationTime) {
+			c.Body = memview.MemView{}
+			t.Content = c
+		}
+	case akinet.HTTPResponse:
+		if !fc.isFirstExchange(c.StreamID, c.Seq, t.ObservationTime) {
+			c.Body = memview.MemView{}
+			t.Content = c
+		}
+	}
+	return t
+}
+
+// Determines whether the given exchange is the first seen on its connection,
+// starting to track the connection if it's new. Must be called with the mutex
+// held.
+func (fc *firstExchangeCollector) isFirstExchange(streamID uuid.UUID, seq int, observed time.Time) bool {
+	conn, ok := fc.connections[streamID]
+	if !ok {
+		if len(fc.connections) < maxKeys {
+			fc.connections[streamID] = &exchangeConnection{
+				firstSeq: seq,
+				lastSeen: observed,
+			}
+		}
+		return true
+	}
+	if observed.After(conn.lastSeen) {
+		conn.lastSeen = observed
+	}
+	return seq == conn.firstSeq
+}
+
+// Forgets connections that have been idle for too long. Must be called with
+// the mutex held.
+func (fc *firstExchangeCollector) expire() {
+	if fc.latestObservation.Sub(fc.lastSweep) < pendingRequestSweepInterval {
+		return
+	}
+	fc.lastSweep = fc.latestObservation
+
+	cutoff := fc.latestObservation.Add(-firstExchangeIdleExpiration)
+	for id, conn := range fc.connections {
+		if conn.lastSeen.Before(cutoff) {
+			delete(fc.connections, id)
+		}
+	}
+}
+
+func (fc *firstExchangeCollector) Close() error {
+	return fc.collector.Close()
+}
@@ -0,0 +1,96 @@
+package trace
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a request and response with bodies for the given exchange on the
+// given connection.
+func makeBodyExchange(streamID uuid.UUID, seq int, observed time.Time) (akinet.ParsedNetworkTraffic, akinet.ParsedNetworkTraffic) {
+	req := akinet.ParsedNetworkTraffic{
+		ObservationTime: observed,
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      seq,
+			Method:   "POST",
+			URL:      &url.URL{Path: "/v1/doggos"},
+			Host:     "example.com",
+			Body:     memview.New([]byte(`{"name": "prince"}`)),
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		ObservationTime: observed,
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        seq,
+			StatusCode: 200,
+			Body:       memview.New([]byte(`{"id": 1}`)),
+		},
+	}
+	return req, resp
+}
+
+func TestFirstExchangeCollector(t *testing.T) {
+	now := time.Now()
+	conn, other := uuid.New(), uuid.New()
+	firstReq, firstResp := makeBodyExchange(conn, 1, now)
+	secondReq, secondResp := makeBodyExchange(conn, 2, now.Add(time.Second))
+	otherReq, otherResp := makeBodyExchange(other, 5, now.Add(2*time.Second))
+
+	rec := &trafficRecorder{}
+	c := NewFirstExchangeCollector(rec)
+	for _, p := range []akinet.ParsedNetworkTraffic{firstReq, firstResp, secondReq, secondResp, otherReq, otherResp} {
+		assert.NoError(t, c.Process(p))
+	}
+	assert.NoError(t, c.Close())
+	assert.True(t, rec.closed)
+
+	if !assert.Equal(t, 6, len(rec.traffic)) {
+		return
+	}
+
+	// The first exchange on each connection is unchanged.
+	assert.Equal(t, firstReq, rec.traffic[0])
+	assert.Equal(t, firstResp, rec.traffic[1])
+	assert.Equal(t, otherReq, rec.traffic[4])
+	assert.Equal(t, otherResp, rec.traffic[5])
+
+	// The second exchange on the same connection has its bodies dropped, but
+	// keeps its metadata.
+	req := rec.traffic[2].Content.(akinet.HTTPRequest)
+	assert.Equal(t, int64(0), req.Body.Len())
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "/v1/doggos", req.URL.Path)
+
+	resp := rec.traffic[3].Content.(akinet.HTTPResponse)
+	assert.Equal(t, int64(0), resp.Body.Len())
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// The original traffic is not modified.
+	assert.Greater(t, secondReq.Content.(akinet.HTTPRequest).Body.Len(), int64(0))
+}
+
+func TestFirstExchangeCollectorConcurrentProcess(t *testing.T) {
+	rec := &countingCollector{}
+	c := NewFirstExchangeCollector(rec)
+
+	now := time.Now()
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 200; i++ {
+		conn := uuid.New()
+		firstReq, firstResp := makeBodyExchange(conn, 1, now)
+		secondReq, secondResp := makeBodyExchange(conn, 2, now)
+		batches[i%len(batches)] = append(batches[i%len(batches)], firstReq, firstResp, secondReq, secondResp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, 800, rec.GetNumPackets())
+}
@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// Identifies requests that are captured regardless of sampling and rate
+// limiting, so that clients can ask for specific requests to be captured when
+// debugging.
+type ForceCaptureHeader struct {
+	// Canonical header name.
+	name string
+
+	// If non-empty, the header forces capture only with this value, compared
+	// case-insensitively. Otherwise, the header forces capture whenever it is
+	// present.
+	value string
+}
+
+// Parses a force-capture header of the form "Name" or "Name=value".
+func ParseForceCaptureHeader(s string) (ForceCaptureHeader, error) {
+	name, value, _ := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ForceCaptureHeader{}, errors.Errorf("invalid force-capture header %q; expected Name or Name=value", s)
+	}
+	return ForceCaptureHeader{
+		name:  http.CanonicalHeaderKey(name),
+		value: strings.TrimSpace(value),
+	}, nil
+}
+
+func (h ForceCaptureHeader) matches(header http.Header) bool {
+	values, present := header[h.name]
+	if !present {
+		return false
+	}
+	if h.value == "" {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), h.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wraps the sampling and rate-limiting collectors, letting requests that carry
+// the force-capture header, and their responses, bypass them.
+type forceCaptureCollector struct {
+	header ForceCaptureHeader
+
+	// Collector that samples and rate-limits traffic before passing it on to
+	// unsampled.
+	sampled Collector
+
+	// Collector that receives forced traffic directly.
+	unsampled Collector
+
+	// Protects the fields below. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mutex sync.Mutex
+
+	// Forced requests whose response hasn't been seen yet, with the time each
+	// request was observed.
+	forced map[akid.WitnessID]time.Time
+
+	// Observation time of the most recent packet, and the time at which forced
+	// requests were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+// Returns a collector that passes traffic to sampled, except for requests
+// carrying the given header and their responses, which are passed directly to
+// unsampled. The sampled collector is expected to pass its traffic on to
+// unsampled, and is the only one closed by Close.
+func NewForceCaptureCollector(header ForceCaptureHeader, sampled Collector, unsampled Collector) Collector {
+	return &forceCaptureCollector{
+		header:    header,
+		sampled:   sampled,
+		unsampled: unsampled,
+		forced:    map[akid.WitnessID]time.Time{},
+	}
+}
+
+func (fc *forceCaptureCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	return fc.route(t).Process(t)
+}
+
+// Returns the collector to which the given traffic is passed, keeping track of
+// forced requests.
+func (fc *forceCaptureCollector) route(t akinet.ParsedNetworkTraffic) Collector {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if t.ObservationTime.After(fc.latestObservation) {
+		fc.latestObservation = t.ObservationTime
+	}
+	fc.expireForcedRequests()
+
+	switch c := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if fc.header.matches(c.Header) {
+			fc.forced[learn.ToWitnessID(c.StreamID, c.Seq)] = t.ObservationTime
+			return fc.unsampled
+		}
+
+	case akinet.HTTPResponse:
+		id := learn.ToWitnessID(c.StreamID, c.Seq)
+		if _, forced := fc.forced[id]; forced {
+			delete(fc.forced, id)
+			return fc.unsampled
+		}
+	}
+	return fc.sampled
+}
+
+// Forgets forced requests that have waited too long for their response. Must
+// be called with the mutex held.
+func (fc *forceCaptureCollector) expireForcedRequests() {
+	if fc.latestObservation.Sub(fc.lastSweep) < pendingRequestSweepInterval {
+		return
+	}
+	fc.lastSweep = fc.latestObservation
+
+	cutoff := fc.latestObservation.Add(-pendingRequestExpiration)
+	for id, observed := range fc.forced {
+		if observed.Before(cutoff) {
+			delete(fc.forced, id)
+		}
+	}
+}
+
+func (fc *forceCaptureCollector) Close() error {
+	return fc.sampled.Close()
+}
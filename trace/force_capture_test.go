@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceCapture(t *testing.T) {
+	header, err := ParseForceCaptureHeader("x-postman-capture")
+	assert.NoError(t, err)
+
+	rec := newPairRecorder()
+	sampled := NewErrorPreservingSamplingCollector(0.0, rec)
+	sampled = NewSamplingCollector(0.0, sampled)
+	c := NewForceCaptureCollector(header, sampled, rec)
+
+	now := time.Now()
+	forcedReq, forcedResp := makeExchange(1, 200, now)
+	forcedReq.Content = withHeader(forcedReq.Content.(akinet.HTTPRequest), "X-Postman-Capture", "1")
+	otherReq, otherResp := makeExchange(2, 200, now)
+
+	for _, p := range []akinet.ParsedNetworkTraffic{forcedReq, otherReq, otherResp, forcedResp} {
+		assert.NoError(t, c.Process(p))
+	}
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, map[string]struct{}{samplingKey(forcedReq): {}}, rec.requests)
+	assert.Equal(t, map[string]struct{}{samplingKey(forcedResp): {}}, rec.responses)
+}
+
+func TestForceCaptureConcurrentProcess(t *testing.T) {
+	header, err := ParseForceCaptureHeader("x-postman-capture")
+	assert.NoError(t, err)
+
+	unsampled := &countingCollector{}
+	c := NewForceCaptureCollector(header, NewSamplingCollector(0.0, unsampled), unsampled)
+
+	now := time.Now()
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 400; i++ {
+		req, resp := makeExchange(i, 200, now)
+		if i%2 == 0 {
+			req.Content = withHeader(req.Content.(akinet.HTTPRequest), "X-Postman-Capture", "1")
+		}
+		batches[i%len(batches)] = append(batches[i%len(batches)], req, resp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	// Only the forced exchanges bypass sampling.
+	assert.Equal(t, 400, unsampled.GetNumPackets())
+}
+
+func TestForceCaptureHeaderValue(t *testing.T) {
+	header, err := ParseForceCaptureHeader("X-Postman-Capture=1")
+	assert.NoError(t, err)
+
+	assert.True(t, header.matches(http.Header{"X-Postman-Capture": {"1"}}))
+	assert.False(t, header.matches(http.Header{"X-Postman-Capture": {"0"}}))
+	assert.False(t, header.matches(http.Header{}))
+
+	_, err = ParseForceCaptureHeader("=1")
+	assert.Error(t, err)
+}
+
+func withHeader(r akinet.HTTPRequest, name, value string) akinet.HTTPRequest {
+	r.Header = http.Header{}
+	r.Header.Set(name, value)
+	return r
+}
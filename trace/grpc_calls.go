@@ -0,0 +1,50 @@
+package trace
+
+import (
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// Counts the gRPC calls seen, to distinguish gRPC traffic from plain HTTP in
+// the summary. Shared by the collectors for all interfaces.
+type GRPCCallCounter struct {
+	calls int64
+}
+
+func NewGRPCCallCounter() *GRPCCallCounter {
+	return &GRPCCallCounter{}
+}
+
+// Returns the number of gRPC requests seen.
+func (c *GRPCCallCounter) Calls() int64 {
+	return atomic.LoadInt64(&c.calls)
+}
+
+// Returns a collector that counts gRPC requests and passes all traffic
+// through to the given collector.
+func (c *GRPCCallCounter) NewCollector(next Collector) Collector {
+	return &grpcCallCollector{
+		counter:   c,
+		collector: next,
+	}
+}
+
+type grpcCallCollector struct {
+	counter   *GRPCCallCounter
+	collector Collector
+}
+
+func (c *grpcCallCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if req, ok := t.Content.(akinet.HTTPRequest); ok {
+		if _, isGRPC := learn.GRPCMethodOfRequest(req); isGRPC {
+			atomic.AddInt64(&c.counter.calls, 1)
+		}
+	}
+	return c.collector.Process(t)
+}
+
+func (c *grpcCallCollector) Close() error {
+	return c.collector.Close()
+}
@@ -0,0 +1,40 @@
+package trace
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeContentTypeRequest(method, path, contentType string) akinet.ParsedNetworkTraffic {
+	return akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			Method: method,
+			URL:    &url.URL{Path: path},
+			Host:   "example.com",
+			Header: http.Header{"Content-Type": []string{contentType}},
+		},
+	}
+}
+
+func TestGRPCCallCounter(t *testing.T) {
+	traffic := []akinet.ParsedNetworkTraffic{
+		makeContentTypeRequest("POST", "/helloworld.Greeter/SayHello", "application/grpc"),
+		makeContentTypeRequest("POST", "/helloworld.Greeter/SayGoodbye", "application/grpc+proto"),
+		makeContentTypeRequest("POST", "/v1/orders", "application/json"),
+		makeContentTypeRequest("GET", "/helloworld.Greeter/SayHello", "application/grpc"),
+		{Content: akinet.HTTPResponse{StatusCode: 200}},
+	}
+
+	counter := NewGRPCCallCounter()
+	cc := &countingCollector{}
+	col := counter.NewCollector(cc)
+	for _, tr := range traffic {
+		assert.NoError(t, col.Process(tr))
+	}
+	assert.Equal(t, len(traffic), cc.GetNumPackets(), "all traffic should be passed through")
+	assert.Equal(t, int64(2), counter.Calls())
+}
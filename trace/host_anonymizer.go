@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Headers whose values are URLs that may contain a host name.
+var hostAnonymizedURLHeaders = []string{"Location", "Origin", "Referer"}
+
+// Replaces host names with pseudonyms, so that local outputs can be shared
+// without revealing internal host names. Each host is replaced with a salted
+// hash of its name, such as "host-1a2b3c4d5e6f". The salt is chosen randomly
+// for each run, so pseudonyms are consistent within a run but can't be linked
+// across runs. Ports are kept. Safe for concurrent use.
+type HostAnonymizer struct {
+	salt []byte
+}
+
+// Creates an anonymizer with a random salt.
+func NewHostAnonymizer() (*HostAnonymizer, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt for host anonymization")
+	}
+	return &HostAnonymizer{salt: salt}, nil
+}
+
+// Returns the pseudonym for the given host, which may include a port.
+func (a *HostAnonymizer) Pseudonym(host string) string {
+	if host == "" {
+		return ""
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	// IPv6 literals are bracketed in Host headers, but not in all values.
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(strings.ToLower(name)))
+	pseudonym := "host-" + hex.EncodeToString(mac.Sum(nil)[:6])
+	if port != "" {
+		return net.JoinHostPort(pseudonym, port)
+	}
+	return pseudonym
+}
+
+// Returns the URL with its host replaced. Values that aren't absolute URLs are
+// kept.
+func (a *HostAnonymizer) anonymizeURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return value
+	}
+	u.Host = a.Pseudonym(u.Host)
+	return u.String()
+}
+
+// Returns a copy of the headers with hosts replaced in URL-valued headers.
+func (a *HostAnonymizer) anonymizeHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range hostAnonymizedURLHeaders {
+		values := header.Values(name)
+		for i, v := range values {
+			values[i] = a.anonymizeURL(v)
+		}
+	}
+	return header
+}
+
+// Returns a collector that replaces host names in requests and responses
+// before passing them to the given collector. The traffic seen by other
+// collectors is not modified.
+func (a *HostAnonymizer) NewCollector(col Collector) Collector {
+	return &hostAnonymizingCollector{anonymizer: a, collector: col}
+}
+
+type hostAnonymizingCollector struct {
+	anonymizer *HostAnonymizer
+	collector  Collector
+}
+
+func (c *hostAnonymizingCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		content.Host = c.anonymizer.Pseudonym(content.Host)
+		if content.URL != nil {
+			u := *content.URL
+			u.Host = c.anonymizer.Pseudonym(u.Host)
+			content.URL = &u
+		}
+		content.Header = c.anonymizer.anonymizeHeader(content.Header)
+		t.Content = content
+	case akinet.HTTPResponse:
+		content.Header = c.anonymizer.anonymizeHeader(content.Header)
+		t.Content = content
+	}
+	return c.collector.Process(t)
+}
+
+func (c *hostAnonymizingCollector) Close() error {
+	return c.collector.Close()
+}
+
+// Returns a sink that replaces host names in witnesses before passing them to
+// the given sink. Witnesses are copied, so the witnesses seen by other sinks
+// and uploaded to the backend are not modified.
+func (a *HostAnonymizer) NewSink(sink WitnessSink) WitnessSink {
+	return &hostAnonymizingSink{anonymizer: a, sink: sink}
+}
+
+type hostAnonymizingSink struct {
+	anonymizer *HostAnonymizer
+	sink       WitnessSink
+}
+
+func (s *hostAnonymizingSink) ExportWitness(w *pb.Witness, observationTime time.Time, info WitnessInfo) {
+	w = proto.Clone(w).(*pb.Witness)
+	if meta := spec_util.HTTPMetaFromMethod(w.GetMethod()); meta != nil {
+		meta.Host = s.anonymizer.Pseudonym(meta.Host)
+	}
+
+	if len(info.RedirectedFrom) > 0 {
+		locations := make([]string, len(info.RedirectedFrom))
+		for i, loc := range info.RedirectedFrom {
+			host, path := loc, ""
+			if slash := strings.Index(loc, "/"); slash >= 0 {
+				host, path = loc[:slash], loc[slash:]
+			}
+			locations[i] = s.anonymizer.Pseudonym(host) + path
+		}
+		info.RedirectedFrom = locations
+	}
+
+	s.sink.ExportWitness(w, observationTime, info)
+}
@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeHostRequest(host, path string, header http.Header) akinet.ParsedNetworkTraffic {
+	u, _ := url.Parse("http://" + host + path)
+	return akinet.ParsedNetworkTraffic{
+		ObservationTime: time.Now(),
+		Content: akinet.HTTPRequest{
+			Method: "GET",
+			URL:    u,
+			Host:   host,
+			Header: header,
+		},
+	}
+}
+
+func TestHostAnonymizerLocalOnly(t *testing.T) {
+	anonymizer, err := NewHostAnonymizer()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	backend := &trafficRecorder{}
+	local := &trafficRecorder{}
+	col := TeeCollector{Dst1: backend, Dst2: anonymizer.NewCollector(local)}
+
+	first := makeHostRequest("api.internal:8080", "/users", http.Header{
+		"Referer": {"https://api.internal:8080/login"},
+	})
+	second := makeHostRequest("api.internal:8080", "/orders", http.Header{})
+	other := makeHostRequest("billing.internal", "/invoices", http.Header{})
+	redirect := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StatusCode: 302,
+			Header:     http.Header{"Location": {"http://billing.internal/invoices"}},
+		},
+	}
+	for _, p := range []akinet.ParsedNetworkTraffic{first, second, other, redirect} {
+		assert.NoError(t, col.Process(p))
+	}
+	assert.NoError(t, col.Close())
+
+	// Traffic sent to the backend is unchanged.
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{first, second, other, redirect}, backend.traffic)
+
+	if !assert.Equal(t, 4, len(local.traffic)) {
+		return
+	}
+	firstReq := local.traffic[0].Content.(akinet.HTTPRequest)
+	secondReq := local.traffic[1].Content.(akinet.HTTPRequest)
+	otherReq := local.traffic[2].Content.(akinet.HTTPRequest)
+	redirectResp := local.traffic[3].Content.(akinet.HTTPResponse)
+
+	// Both witnesses to the same host get the same pseudonym, and the port is
+	// kept.
+	pseudonym := firstReq.Host
+	assert.True(t, strings.HasPrefix(pseudonym, "host-"), pseudonym)
+	assert.True(t, strings.HasSuffix(pseudonym, ":8080"), pseudonym)
+	assert.NotContains(t, pseudonym, "api.internal")
+	assert.Equal(t, pseudonym, secondReq.Host)
+	assert.Equal(t, pseudonym, firstReq.URL.Host)
+	assert.Equal(t, pseudonym, secondReq.URL.Host)
+	assert.Equal(t, "/users", firstReq.URL.Path)
+	assert.Equal(t, "https://"+pseudonym+"/login", firstReq.Header.Get("Referer"))
+
+	// Other hosts get other pseudonyms, consistently across headers.
+	assert.NotEqual(t, anonymizer.Pseudonym("api.internal"), otherReq.Host)
+	assert.Equal(t, "http://"+otherReq.Host+"/invoices", redirectResp.Header.Get("Location"))
+
+	// The original traffic is not modified.
+	assert.Equal(t, "api.internal:8080", first.Content.(akinet.HTTPRequest).URL.Host)
+	assert.Equal(t, "https://api.internal:8080/login", first.Content.(akinet.HTTPRequest).Header.Get("Referer"))
+	assert.Equal(t, "http://billing.internal/invoices", redirect.Content.(akinet.HTTPResponse).Header.Get("Location"))
+}
+
+func TestHostAnonymizerSaltPerRun(t *testing.T) {
+	a1, err := NewHostAnonymizer()
+	assert.NoError(t, err)
+	a2, err := NewHostAnonymizer()
+	assert.NoError(t, err)
+
+	assert.Equal(t, a1.Pseudonym("Example.com"), a1.Pseudonym("example.com"))
+	assert.NotEqual(t, a1.Pseudonym("example.com"), a2.Pseudonym("example.com"))
+	assert.Equal(t, "", a1.Pseudonym(""))
+}
+
+func TestHostAnonymizerIPv6(t *testing.T) {
+	a, err := NewHostAnonymizer()
+	assert.NoError(t, err)
+
+	bare := a.Pseudonym("2001:db8::1")
+	assert.Equal(t, bare, a.Pseudonym("[2001:db8::1]"))
+	assert.Equal(t, bare, a.Pseudonym("[2001:DB8::1]"))
+	assert.Equal(t, bare+":8080", a.Pseudonym("[2001:db8::1]:8080"))
+}
+
+type exportedWitnessRecorder struct {
+	witnesses []*pb.Witness
+	infos     []WitnessInfo
+}
+
+func (r *exportedWitnessRecorder) ExportWitness(w *pb.Witness, _ time.Time, info WitnessInfo) {
+	r.witnesses = append(r.witnesses, w)
+	r.infos = append(r.infos, info)
+}
+
+func TestHostAnonymizerSink(t *testing.T) {
+	anonymizer, err := NewHostAnonymizer()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	other := &exportedWitnessRecorder{}
+	local := &exportedWitnessRecorder{}
+	sink := anonymizer.NewSink(local)
+
+	w := &pb.Witness{
+		Method: &pb.Method{
+			Meta: &pb.MethodMeta{
+				Meta: &pb.MethodMeta_Http{
+					Http: &pb.HTTPMethodMeta{Method: "GET", PathTemplate: "/users", Host: "api.internal:8080"},
+				},
+			},
+		},
+	}
+	info := WitnessInfo{RedirectedFrom: []string{"billing.internal/invoices", "api.internal:8080"}}
+	other.ExportWitness(w, time.Now(), info)
+	sink.ExportWitness(w, time.Now(), info)
+
+	if !assert.Equal(t, 1, len(local.witnesses)) {
+		return
+	}
+	host := anonymizer.Pseudonym("api.internal:8080")
+	assert.Equal(t, host, local.witnesses[0].GetMethod().GetMeta().GetHttp().GetHost())
+	assert.Equal(t, []string{anonymizer.Pseudonym("billing.internal") + "/invoices", host}, local.infos[0].RedirectedFrom)
+
+	// Witnesses seen by other sinks are unchanged.
+	assert.Equal(t, "api.internal:8080", other.witnesses[0].GetMethod().GetMeta().GetHttp().GetHost())
+	assert.Equal(t, []string{"billing.internal/invoices", "api.internal:8080"}, other.infos[0].RedirectedFrom)
+}
@@ -0,0 +1,36 @@
+package trace
+
+import (
+	"strings"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Limits the rate at which witnesses are captured for each host, as given by
+// the Host header, so that one chatty host doesn't use up the capture budget
+// set by --rate-limit. Requests without a host aren't limited here, and are
+// subject only to the other limits. Shared by the collectors for all
+// interfaces.
+type PerHostRateLimit struct {
+	keyedRateLimit[string]
+}
+
+// Creates a limit of the given number of witnesses per minute for each host.
+func NewPerHostRateLimit(perHostPerMinute float64) *PerHostRateLimit {
+	return &PerHostRateLimit{
+		keyedRateLimit: newKeyedRateLimit[string](perHostPerMinute),
+	}
+}
+
+// Returns a collector that passes to the given collector only the requests
+// allowed by the limit, along with their responses.
+func (l *PerHostRateLimit) NewCollector(next Collector) Collector {
+	return newRequestRateLimitCollector(func(r akinet.HTTPRequest, now time.Time) bool {
+		host := strings.ToLower(r.Host)
+		if host == "" {
+			return true
+		}
+		return l.allow(host, now)
+	}, next)
+}
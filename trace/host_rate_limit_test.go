@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func withHost(t akinet.ParsedNetworkTraffic, host string) akinet.ParsedNetworkTraffic {
+	r := t.Content.(akinet.HTTPRequest)
+	r.Host = host
+	t.Content = r
+	return t
+}
+
+func TestPerHostRateLimit(t *testing.T) {
+	rec := newPairRecorder()
+	limit := NewPerHostRateLimit(10)
+	c := limit.NewCollector(rec)
+
+	start := time.Now()
+	var chatty, quiet, hostless []string
+	for i := 0; i < 100; i++ {
+		now := start.Add(time.Duration(i) * 100 * time.Millisecond)
+
+		// Alternate the case of the host, which shouldn't matter.
+		host := "chatty.example.com"
+		if i%2 == 0 {
+			host = "Chatty.Example.com"
+		}
+		req, resp := makeExchange(i, 200, now)
+		req = withHost(req, host)
+		chatty = append(chatty, samplingKey(req))
+		assert.NoError(t, c.Process(req))
+		assert.NoError(t, c.Process(resp))
+
+		if i%20 == 0 {
+			req, resp := makeExchange(1000+i, 200, now)
+			req = withHost(req, "quiet.example.com")
+			quiet = append(quiet, samplingKey(req))
+			assert.NoError(t, c.Process(req))
+			assert.NoError(t, c.Process(resp))
+
+			req, resp = makeExchange(2000+i, 200, now)
+			req = withHost(req, "")
+			hostless = append(hostless, samplingKey(req))
+			assert.NoError(t, c.Process(req))
+			assert.NoError(t, c.Process(resp))
+		}
+	}
+	assert.NoError(t, c.Close())
+
+	// The chatty host gets its initial burst of 10, plus one more per 6
+	// seconds over the 10 seconds of traffic.
+	chattyCaptured := 0
+	for _, k := range chatty {
+		if _, ok := rec.requests[k]; ok {
+			chattyCaptured++
+			assert.Contains(t, rec.responses, k, "response should follow its request")
+		}
+	}
+	assert.Equal(t, 11, chattyCaptured)
+
+	// Every request to the quiet host, and every request without a host, is
+	// captured.
+	for _, k := range append(quiet, hostless...) {
+		assert.Contains(t, rec.requests, k)
+		assert.Contains(t, rec.responses, k)
+	}
+}
@@ -0,0 +1,296 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+type HTTPVersion string
+
+const (
+	HTTP1_0            HTTPVersion = "HTTP/1.0"
+	HTTP1_1            HTTPVersion = "HTTP/1.1"
+	HTTP2              HTTPVersion = "HTTP/2"
+	HTTPVersionUnknown HTTPVersion = "unknown"
+)
+
+// The order in which versions are reported.
+var httpVersions = []HTTPVersion{HTTP1_0, HTTP1_1, HTTP2, HTTPVersionUnknown}
+
+// Maps a TLS ALPN protocol ID to an HTTP version.
+func httpVersionOfALPN(protocol *string) HTTPVersion {
+	if protocol == nil {
+		return HTTPVersionUnknown
+	}
+	switch *protocol {
+	case "http/1.0":
+		return HTTP1_0
+	case "http/1.1":
+		return HTTP1_1
+	case "h2", "h2c":
+		return HTTP2
+	}
+	return HTTPVersionUnknown
+}
+
+func httpVersionOfRequest(r akinet.HTTPRequest) HTTPVersion {
+	switch {
+	case r.ProtoMajor == 1 && r.ProtoMinor == 0:
+		return HTTP1_0
+	case r.ProtoMajor == 1 && r.ProtoMinor == 1:
+		return HTTP1_1
+	case r.ProtoMajor == 2:
+		return HTTP2
+	}
+	return HTTPVersionUnknown
+}
+
+// HTTP versions observed for a single port or host.
+type HTTPVersionCounts struct {
+	// Parsed HTTP requests, by version. HTTP/2 requests are only parsed from
+	// cleartext connections.
+	Requests map[HTTPVersion]int
+
+	// Connections whose HTTP version was identified without parsing requests,
+	// either from an HTTP/2 connection preface or from the protocol negotiated
+	// by TLS ALPN. Unknown for TLS connections without ALPN.
+	Connections map[HTTPVersion]int
+}
+
+func newHTTPVersionCounts() *HTTPVersionCounts {
+	return &HTTPVersionCounts{
+		Requests:    map[HTTPVersion]int{},
+		Connections: map[HTTPVersion]int{},
+	}
+}
+
+func (c *HTTPVersionCounts) copy() HTTPVersionCounts {
+	result := HTTPVersionCounts{
+		Requests:    make(map[HTTPVersion]int, len(c.Requests)),
+		Connections: make(map[HTTPVersion]int, len(c.Connections)),
+	}
+	for v, n := range c.Requests {
+		result.Requests[v] = n
+	}
+	for v, n := range c.Connections {
+		result.Connections[v] = n
+	}
+	return result
+}
+
+// Total number of requests and connections counted.
+func (c HTTPVersionCounts) Total() int {
+	total := 0
+	for _, n := range c.Requests {
+		total += n
+	}
+	for _, n := range c.Connections {
+		total += n
+	}
+	return total
+}
+
+// Describes the counts, e.g. "HTTP/1.1: 95 requests, HTTP/2: 3 connections".
+func (c HTTPVersionCounts) String() string {
+	var parts []string
+	for _, v := range httpVersions {
+		if n := c.Requests[v]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d requests", v, n))
+		}
+	}
+	for _, v := range httpVersions {
+		if n := c.Connections[v]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d connections", v, n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// HTTP versions observed for a single server port.
+type PortHTTPVersions struct {
+	Port int
+	HTTPVersionCounts
+}
+
+// HTTP versions observed for a single server host.
+type HostHTTPVersions struct {
+	Host string
+	HTTPVersionCounts
+}
+
+// Tracks the HTTP versions observed per server port and host, so that users
+// can tell how much of their traffic is HTTP/2.
+//
+// Imposes a hard limit on the number of ports and hosts that are individually
+// tracked.
+type HTTPVersionCounter struct {
+	mutex sync.Mutex
+
+	byPort map[int]*HTTPVersionCounts
+	byHost map[string]*HTTPVersionCounts
+
+	// Number of observations not tracked because too many ports or hosts were
+	// seen.
+	overflow int64
+}
+
+func NewHTTPVersionCounter() *HTTPVersionCounter {
+	return &HTTPVersionCounter{
+		byPort: map[int]*HTTPVersionCounts{},
+		byHost: map[string]*HTTPVersionCounts{},
+	}
+}
+
+// Returns a collector that records HTTP versions with the counter and passes
+// all traffic through to the given collector.
+func (c *HTTPVersionCounter) NewCollector(next Collector) Collector {
+	return &httpVersionCollector{
+		counter:   c,
+		Collector: next,
+	}
+}
+
+func (c *HTTPVersionCounter) observe(t akinet.ParsedNetworkTraffic) {
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if learn.WebSocketMessageSender(content) != "" {
+			// Not an HTTP request.
+			return
+		}
+		c.record(t.DstPort, content.Host, httpVersionOfRequest(content), true)
+
+	case akinet.HTTP2ConnectionPreface:
+		// Sent by the client.
+		c.record(t.DstPort, "", HTTP2, false)
+
+	case akinet.TLSServerHello:
+		host := ""
+		if len(content.DNSNames) > 0 {
+			names := append([]string{}, content.DNSNames...)
+			sort.Strings(names)
+			host = names[len(names)-1]
+		}
+		c.record(t.SrcPort, host, httpVersionOfALPN(content.SelectedProtocol), false)
+
+	case akinet.TLSHandshakeMetadata:
+		// Produced by the TLS-connection tracker in place of the hello messages.
+		// The connection's source is the client. Only count handshakes in which
+		// the server's hello was seen, since that's where ALPN is negotiated.
+		if content.Version == nil {
+			return
+		}
+		host := ""
+		if content.SNIHostname != nil {
+			host = *content.SNIHostname
+		}
+		c.record(t.DstPort, host, httpVersionOfALPN(content.SelectedProtocol), false)
+	}
+}
+
+func (c *HTTPVersionCounter) record(port int, host string, version HTTPVersion, isRequest bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	add := func(counts *HTTPVersionCounts) {
+		if isRequest {
+			counts.Requests[version] += 1
+		} else {
+			counts.Connections[version] += 1
+		}
+	}
+
+	if counts, ok := c.byPort[port]; ok {
+		add(counts)
+	} else if len(c.byPort) < maxKeys {
+		counts := newHTTPVersionCounts()
+		add(counts)
+		c.byPort[port] = counts
+	} else {
+		c.overflow += 1
+	}
+
+	if host == "" {
+		return
+	}
+	if counts, ok := c.byHost[host]; ok {
+		add(counts)
+	} else if len(c.byHost) < maxKeys {
+		counts := newHTTPVersionCounts()
+		add(counts)
+		c.byHost[host] = counts
+	} else {
+		c.overflow += 1
+	}
+}
+
+// Returns the HTTP versions observed on the n ports with the most requests
+// and connections, in descending order of that number.
+func (c *HTTPVersionCounter) TopPorts(n int) []PortHTTPVersions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := make([]PortHTTPVersions, 0, len(c.byPort))
+	for port, counts := range c.byPort {
+		result = append(result, PortHTTPVersions{Port: port, HTTPVersionCounts: counts.copy()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ti, tj := result[i].Total(), result[j].Total()
+		if ti != tj {
+			return ti > tj
+		}
+		return result[i].Port < result[j].Port
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the HTTP versions observed on the n hosts with the most requests
+// and connections, in descending order of that number.
+func (c *HTTPVersionCounter) TopHosts(n int) []HostHTTPVersions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := make([]HostHTTPVersions, 0, len(c.byHost))
+	for host, counts := range c.byHost {
+		result = append(result, HostHTTPVersions{Host: host, HTTPVersionCounts: counts.copy()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ti, tj := result[i].Total(), result[j].Total()
+		if ti != tj {
+			return ti > tj
+		}
+		return result[i].Host < result[j].Host
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func (c *HTTPVersionCounter) Overflow() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.overflow
+}
+
+type httpVersionCollector struct {
+	counter *HTTPVersionCounter
+
+	Collector Collector
+}
+
+func (c *httpVersionCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	c.counter.observe(t)
+	return c.Collector.Process(t)
+}
+
+func (c *httpVersionCollector) Close() error {
+	return c.Collector.Close()
+}
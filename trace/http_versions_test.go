@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPVersionCounter(t *testing.T) {
+	h2 := "h2"
+	http11 := "http/1.1"
+	tls12 := akinet.TLS_v1_2
+	otherHost := "other.example.com"
+
+	request := func(host string, major, minor int) akinet.ParsedNetworkTraffic {
+		return akinet.ParsedNetworkTraffic{
+			SrcPort: 50000,
+			DstPort: 8080,
+			Content: akinet.HTTPRequest{Host: host, ProtoMajor: major, ProtoMinor: minor},
+		}
+	}
+
+	traffic := []akinet.ParsedNetworkTraffic{
+		request("api.example.com", 1, 1),
+		request("api.example.com", 1, 1),
+		request("api.example.com", 1, 0),
+		{
+			SrcPort: 50001,
+			DstPort: 8080,
+			Content: akinet.HTTP2ConnectionPreface{},
+		},
+		{
+			SrcPort: 443,
+			DstPort: 50002,
+			Content: akinet.TLSServerHello{SelectedProtocol: &h2, DNSNames: []string{"secure.example.com"}},
+		},
+		{
+			SrcPort: 443,
+			DstPort: 50003,
+			Content: akinet.TLSServerHello{DNSNames: []string{"secure.example.com"}},
+		},
+		{
+			// From the TLS-connection tracker; the source is the client.
+			SrcPort: 50004,
+			DstPort: 443,
+			Content: akinet.TLSHandshakeMetadata{
+				Version:          &tls12,
+				SNIHostname:      &otherHost,
+				SelectedProtocol: &http11,
+			},
+		},
+		{
+			// Server Hello not seen, so not counted.
+			SrcPort: 50005,
+			DstPort: 443,
+			Content: akinet.TLSHandshakeMetadata{},
+		},
+	}
+
+	counter := NewHTTPVersionCounter()
+	cc := &countingCollector{}
+	col := counter.NewCollector(cc)
+	for _, tr := range traffic {
+		assert.NoError(t, col.Process(tr))
+	}
+	assert.Equal(t, len(traffic), cc.GetNumPackets(), "all traffic should be passed through")
+
+	assert.Equal(t, []PortHTTPVersions{
+		{
+			Port: 8080,
+			HTTPVersionCounts: HTTPVersionCounts{
+				Requests:    map[HTTPVersion]int{HTTP1_0: 1, HTTP1_1: 2},
+				Connections: map[HTTPVersion]int{HTTP2: 1},
+			},
+		},
+		{
+			Port: 443,
+			HTTPVersionCounts: HTTPVersionCounts{
+				Requests:    map[HTTPVersion]int{},
+				Connections: map[HTTPVersion]int{HTTP1_1: 1, HTTP2: 1, HTTPVersionUnknown: 1},
+			},
+		},
+	}, counter.TopPorts(10))
+
+	hosts := counter.TopHosts(10)
+	assert.Len(t, hosts, 3)
+	assert.Equal(t, "api.example.com", hosts[0].Host)
+	assert.Equal(t, "HTTP/1.0: 1 requests, HTTP/1.1: 2 requests", hosts[0].String())
+	assert.Equal(t, "secure.example.com", hosts[1].Host)
+	assert.Equal(t, "HTTP/2: 1 connections, unknown: 1 connections", hosts[1].String())
+	assert.Equal(t, "other.example.com", hosts[2].Host)
+
+	assert.Equal(t, int64(0), counter.Overflow())
+}
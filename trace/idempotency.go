@@ -0,0 +1,299 @@
+package trace
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+const (
+	// Header used by clients to mark retries of the same logical request.
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// Requests with the same idempotency key are grouped together if they are
+	// observed within this long of the first request in the group.
+	idempotencyWindow = 10 * time.Minute
+
+	// Maximum number of idempotency keys tracked at once. Requests with new
+	// keys are not tracked while the limit is reached.
+	maxIdempotencyKeys = 10_000
+
+	// Maximum number of endpoints for which retries are counted.
+	maxIdempotencyEndpoints = 1000
+)
+
+type idempotencyGroupKey struct {
+	host string
+	key  string
+}
+
+// Requests observed with the same idempotency key.
+type idempotencyGroup struct {
+	firstSeen time.Time
+	count     int
+}
+
+// A request that repeated the idempotency key of an earlier request, waiting
+// to be reported in the WitnessInfo of its witness.
+type idempotencyRetry struct {
+	// Number of earlier requests with the same key.
+	attempt int
+
+	observed time.Time
+}
+
+type idempotencyCounts struct {
+	// Number of requests with an idempotency key.
+	requests int64
+
+	// Number of requests that repeated an idempotency key seen earlier in the
+	// window.
+	retries int64
+
+	// Number of idempotency keys that were used by more than one request.
+	retryGroups int64
+}
+
+// Retry statistics for a single endpoint.
+type EndpointRetrySummary struct {
+	Method string
+	Host   string
+
+	// Path template of the endpoint. At capture time, it is derived from the
+	// request path in the same way as in schema-only mode.
+	Path string
+
+	// Number of requests with an idempotency key.
+	Requests int64
+
+	// Number of requests that repeated an idempotency key.
+	Retries int64
+
+	// Number of idempotency keys used by more than one request.
+	RetryGroups int64
+}
+
+// Fraction of keyed requests that were retries.
+func (s EndpointRetrySummary) RetryRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Retries) / float64(s.Requests)
+}
+
+// Groups requests by their Idempotency-Key header to detect client retries.
+// Shared by the collectors for all interfaces; create a collector for each
+// with NewCollector.
+//
+// Retries are also recorded by the ID of their witness, and a backend
+// collector reports them in WitnessInfo.RetryAttempt when it parses the
+// request. Retries whose request never reaches the backend collector, because
+// it was sampled or filtered out in between, expire.
+//
+// A nil *IdempotencyTracker records nothing.
+type IdempotencyTracker struct {
+	mutex sync.Mutex
+
+	groups    map[idempotencyGroupKey]*idempotencyGroup
+	endpoints map[endpointKey]*idempotencyCounts
+	retries   map[akid.WitnessID]idempotencyRetry
+
+	// Number of keyed requests not tracked because a limit was reached.
+	overflow int64
+}
+
+func NewIdempotencyTracker() *IdempotencyTracker {
+	return &IdempotencyTracker{
+		groups:    make(map[idempotencyGroupKey]*idempotencyGroup),
+		endpoints: make(map[endpointKey]*idempotencyCounts),
+		retries:   make(map[akid.WitnessID]idempotencyRetry),
+	}
+}
+
+// Returns a collector that records requests with the tracker and passes all
+// traffic through to the given collector.
+func (t *IdempotencyTracker) NewCollector(next Collector) Collector {
+	return &idempotencyCollector{
+		tracker:   t,
+		Collector: next,
+	}
+}
+
+// Records a request with the given idempotency key. If the request is a retry
+// of an earlier request in the same window, returns the number of earlier
+// requests with the key, and records it for the request's witness. Otherwise,
+// returns 0.
+func (t *IdempotencyTracker) observe(r akinet.HTTPRequest, key string, observationTime time.Time) int {
+	endpoint := endpointKeyOfRequest(r)
+	groupKey := idempotencyGroupKey{host: r.Host, key: key}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counts, ok := t.endpoints[endpoint]
+	if !ok {
+		if len(t.endpoints) >= maxIdempotencyEndpoints {
+			t.overflow += 1
+			return 0
+		}
+		counts = &idempotencyCounts{}
+		t.endpoints[endpoint] = counts
+	}
+
+	group, ok := t.groups[groupKey]
+	if ok && observationTime.Sub(group.firstSeen) > idempotencyWindow {
+		// Too late to be a retry; start a new group.
+		delete(t.groups, groupKey)
+		ok = false
+	}
+
+	if !ok {
+		if len(t.groups) >= maxIdempotencyKeys {
+			t.expireGroups(observationTime)
+		}
+		if len(t.groups) >= maxIdempotencyKeys {
+			t.overflow += 1
+			return 0
+		}
+		t.groups[groupKey] = &idempotencyGroup{firstSeen: observationTime, count: 1}
+		counts.requests += 1
+		return 0
+	}
+
+	group.count += 1
+	counts.requests += 1
+	counts.retries += 1
+	if group.count == 2 {
+		counts.retryGroups += 1
+	}
+
+	attempt := group.count - 1
+	t.recordRetry(learn.ToWitnessID(r.StreamID, r.Seq), attempt, observationTime)
+	return attempt
+}
+
+// Records a retry for the witness with the given ID. Assumes the mutex is
+// held.
+func (t *IdempotencyTracker) recordRetry(id akid.WitnessID, attempt int, observed time.Time) {
+	if len(t.retries) >= maxKeys {
+		cutoff := observed.Add(-pendingRequestExpiration)
+		for k, r := range t.retries {
+			if r.observed.Before(cutoff) {
+				delete(t.retries, k)
+			}
+		}
+		if len(t.retries) >= maxKeys {
+			return
+		}
+	}
+	t.retries[id] = idempotencyRetry{attempt: attempt, observed: observed}
+}
+
+// Returns the number of earlier requests with the same idempotency key as the
+// request with the given witness ID, and forgets it. Returns 0 if the request
+// is not a retry.
+func (t *IdempotencyTracker) takeRetry(id akid.WitnessID) int {
+	if t == nil {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	r, ok := t.retries[id]
+	if !ok {
+		return 0
+	}
+	delete(t.retries, id)
+	return r.attempt
+}
+
+// Forgets groups whose window has passed. Assumes the mutex is held.
+func (t *IdempotencyTracker) expireGroups(now time.Time) {
+	for k, g := range t.groups {
+		if now.Sub(g.firstSeen) > idempotencyWindow {
+			delete(t.groups, k)
+		}
+	}
+}
+
+// Returns the n endpoints with the most retries, most first. Endpoints without
+// retries are omitted.
+func (t *IdempotencyTracker) TopN(n int) []EndpointRetrySummary {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]EndpointRetrySummary, 0, len(t.endpoints))
+	for k, c := range t.endpoints {
+		if c.retries == 0 {
+			continue
+		}
+		result = append(result, EndpointRetrySummary{
+			Method:      k.Method,
+			Host:        k.Host,
+			Path:        k.PathTemplate,
+			Requests:    c.requests,
+			Retries:     c.retries,
+			RetryGroups: c.retryGroups,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Retries != result[j].Retries {
+			return result[i].Retries > result[j].Retries
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of keyed requests that were not tracked because a limit
+// was reached.
+func (t *IdempotencyTracker) Overflow() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.overflow
+}
+
+type idempotencyCollector struct {
+	tracker *IdempotencyTracker
+
+	Collector Collector
+}
+
+func (c *idempotencyCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if r, ok := t.Content.(akinet.HTTPRequest); ok {
+		if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+			if attempt := c.tracker.observe(r, key, t.ObservationTime); attempt > 0 {
+				printer.Debugf("Request %s %s%s is retry %d (same %s)\n", r.Method, r.Host, pathOf(r), attempt, idempotencyKeyHeader)
+			}
+		}
+	}
+	return c.Collector.Process(t)
+}
+
+func (c *idempotencyCollector) Close() error {
+	return c.Collector.Close()
+}
+
+func pathOf(r akinet.HTTPRequest) string {
+	if r.URL == nil {
+		return ""
+	}
+	return r.URL.Path
+}
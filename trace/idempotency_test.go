@@ -0,0 +1,138 @@
+package trace
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeKeyedRequest(path, key string, observationTime time.Time) akinet.ParsedNetworkTraffic {
+	header := http.Header{}
+	if key != "" {
+		header.Set("Idempotency-Key", key)
+	}
+	return akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: uuid.New(),
+			Seq:      1,
+			Method:   "POST",
+			URL:      &url.URL{Path: path},
+			Host:     "example.com",
+			Header:   header,
+		},
+		ObservationTime: observationTime,
+	}
+}
+
+func TestIdempotencyTracker(t *testing.T) {
+	start := time.Now()
+
+	tracker := NewIdempotencyTracker()
+	cc := &countingCollector{}
+	col := tracker.NewCollector(cc)
+
+	requests := []akinet.ParsedNetworkTraffic{
+		// A retry group of three requests.
+		makeKeyedRequest("/v1/charges", "key-1", start),
+		makeKeyedRequest("/v1/charges", "key-1", start.Add(time.Second)),
+		makeKeyedRequest("/v1/charges", "key-1", start.Add(2*time.Second)),
+
+		// A request without retries.
+		makeKeyedRequest("/v1/charges", "key-2", start),
+
+		// Reuse of a key after the window is not a retry.
+		makeKeyedRequest("/v1/refunds", "key-3", start),
+		makeKeyedRequest("/v1/refunds", "key-3", start.Add(idempotencyWindow+time.Second)),
+
+		// Requests without a key are not tracked.
+		makeKeyedRequest("/v1/refunds", "", start),
+		makeKeyedRequest("/v1/refunds", "", start),
+	}
+	for _, r := range requests {
+		assert.NoError(t, col.Process(r))
+	}
+	assert.NoError(t, col.Close())
+
+	// All traffic is passed through.
+	assert.Equal(t, len(requests), cc.GetNumPackets())
+
+	assert.Equal(t, []EndpointRetrySummary{
+		{
+			Method:      "POST",
+			Host:        "example.com",
+			Path:        "/v1/charges",
+			Requests:    4,
+			Retries:     2,
+			RetryGroups: 1,
+		},
+	}, tracker.TopN(10))
+	assert.Equal(t, 0.5, tracker.TopN(1)[0].RetryRate())
+	assert.Equal(t, int64(0), tracker.Overflow())
+}
+
+func TestIdempotencyTrackerTemplatesPaths(t *testing.T) {
+	start := time.Now()
+
+	tracker := NewIdempotencyTracker()
+	col := tracker.NewCollector(&countingCollector{})
+
+	// Requests for different IDs are the same endpoint.
+	for _, r := range []akinet.ParsedNetworkTraffic{
+		makeKeyedRequest("/v1/orders/123", "key-1", start),
+		makeKeyedRequest("/v1/orders/123", "key-1", start.Add(time.Second)),
+		makeKeyedRequest("/v1/orders/124", "key-2", start),
+		makeKeyedRequest("/v1/orders/124", "key-2", start.Add(time.Second)),
+	} {
+		assert.NoError(t, col.Process(r))
+	}
+	assert.NoError(t, col.Close())
+
+	assert.Equal(t, []EndpointRetrySummary{
+		{
+			Method:      "POST",
+			Host:        "example.com",
+			Path:        "/v1/orders/{arg3}",
+			Requests:    4,
+			Retries:     2,
+			RetryGroups: 2,
+		},
+	}, tracker.TopN(10))
+}
+
+func TestRetriesReportedInWitnessInfo(t *testing.T) {
+	start := time.Now()
+
+	tracker := NewIdempotencyTracker()
+	sink := &sinkRecorder{}
+	bc := NewSinkCollector(nil, []WitnessSink{sink})
+	bc.SetIdempotencyTracker(tracker)
+	col := tracker.NewCollector(bc)
+
+	for i := 0; i < 3; i++ {
+		req := makeKeyedRequest("/v1/charges", "key-1", start.Add(time.Duration(i)*time.Second))
+		resp := akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPResponse{
+				StreamID:   req.Content.(akinet.HTTPRequest).StreamID,
+				Seq:        1,
+				StatusCode: 200,
+			},
+			ObservationTime: req.ObservationTime,
+		}
+		assert.NoError(t, col.Process(req))
+		assert.NoError(t, col.Process(resp))
+	}
+	assert.NoError(t, col.Close())
+
+	if assert.Equal(t, 3, sink.count()) {
+		attempts := []int{}
+		for _, info := range sink.infos {
+			attempts = append(attempts, info.RetryAttempt)
+		}
+		assert.ElementsMatch(t, []int{0, 1, 2}, attempts)
+	}
+}
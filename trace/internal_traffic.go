@@ -0,0 +1,108 @@
+package trace
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Paths conventionally used for health checks and metrics scraping rather
+// than API calls.
+var healthCheckPaths = map[string]struct{}{
+	"/health":  {},
+	"/healthz": {},
+	"/livez":   {},
+	"/readyz":  {},
+	"/ready":   {},
+	"/ping":    {},
+	"/status":  {},
+	"/metrics": {},
+}
+
+// Counts the HTTP requests that never left the capturing host, or that were
+// health checks, so that users who captured on the wrong interface or with the
+// wrong filter can be told. A request is internal if it was sent over
+// loopback, or from one of the host's own addresses to another; requests to
+// the host from elsewhere are the API traffic the agent is meant to capture.
+// Shared by the collectors for all interfaces.
+type InternalTrafficDetector struct {
+	localIPs []net.IP
+
+	internal int64
+	total    int64
+}
+
+// Creates a detector that treats the given addresses as the host's own, in
+// addition to loopback addresses.
+func NewInternalTrafficDetector(localIPs []net.IP) *InternalTrafficDetector {
+	return &InternalTrafficDetector{localIPs: localIPs}
+}
+
+// Returns the number of internal HTTP requests and the total number of HTTP
+// requests seen.
+func (d *InternalTrafficDetector) Counts() (internal, total int64) {
+	return atomic.LoadInt64(&d.internal), atomic.LoadInt64(&d.total)
+}
+
+// Returns true if HTTP requests were seen and all of them were internal.
+func (d *InternalTrafficDetector) AllInternal() bool {
+	internal, total := d.Counts()
+	return total > 0 && internal == total
+}
+
+// Returns a collector that counts HTTP requests with the detector and passes
+// all traffic through to the given collector.
+func (d *InternalTrafficDetector) NewCollector(next Collector) Collector {
+	return &internalTrafficCollector{
+		detector:  d,
+		Collector: next,
+	}
+}
+
+func (d *InternalTrafficDetector) observe(t akinet.ParsedNetworkTraffic) {
+	req, ok := t.Content.(akinet.HTTPRequest)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&d.total, 1)
+	if d.isLocal(t.SrcIP) && d.isLocal(t.DstIP) || isHealthCheck(req) {
+		atomic.AddInt64(&d.internal, 1)
+	}
+}
+
+func (d *InternalTrafficDetector) isLocal(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, local := range d.localIPs {
+		if local.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHealthCheck(req akinet.HTTPRequest) bool {
+	if req.URL == nil {
+		return false
+	}
+	_, ok := healthCheckPaths[strings.TrimSuffix(strings.ToLower(req.URL.Path), "/")]
+	return ok
+}
+
+type internalTrafficCollector struct {
+	detector *InternalTrafficDetector
+
+	Collector Collector
+}
+
+func (c *internalTrafficCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	c.detector.observe(t)
+	return c.Collector.Process(t)
+}
+
+func (c *internalTrafficCollector) Close() error {
+	return c.Collector.Close()
+}
@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeAddressedRequest(src, dst, path string) akinet.ParsedNetworkTraffic {
+	return akinet.ParsedNetworkTraffic{
+		SrcIP: net.ParseIP(src),
+		DstIP: net.ParseIP(dst),
+		Content: akinet.HTTPRequest{
+			Method: "GET",
+			URL:    &url.URL{Path: path},
+		},
+	}
+}
+
+func TestInternalTrafficDetector(t *testing.T) {
+	testCases := []struct {
+		name     string
+		request  akinet.ParsedNetworkTraffic
+		internal bool
+	}{
+		{"IPv4 loopback", makeAddressedRequest("127.0.0.1", "127.0.0.1", "/v1/users"), true},
+		{"IPv6 loopback", makeAddressedRequest("::1", "::1", "/v1/users"), true},
+		{"host to itself", makeAddressedRequest("10.0.0.5", "10.0.0.5", "/v1/users"), true},
+		{"inbound", makeAddressedRequest("10.0.0.9", "10.0.0.5", "/v1/users"), false},
+		{"outbound", makeAddressedRequest("10.0.0.5", "93.184.216.34", "/v1/users"), false},
+		{"health check", makeAddressedRequest("10.0.0.9", "10.0.0.5", "/healthz/"), true},
+	}
+	for _, c := range testCases {
+		d := NewInternalTrafficDetector([]net.IP{net.ParseIP("10.0.0.5")})
+		col := d.NewCollector(&trafficRecorder{})
+		assert.NoError(t, col.Process(c.request), c.name)
+		assert.Equal(t, c.internal, d.AllInternal(), c.name)
+	}
+}
+
+func TestInternalTrafficDetectorMixed(t *testing.T) {
+	d := NewInternalTrafficDetector(nil)
+	rec := &trafficRecorder{}
+	col := d.NewCollector(rec)
+
+	assert.False(t, d.AllInternal())
+	assert.NoError(t, col.Process(makeAddressedRequest("127.0.0.1", "127.0.0.1", "/v1/users")))
+	assert.True(t, d.AllInternal())
+	assert.NoError(t, col.Process(makeAddressedRequest("10.0.0.9", "10.0.0.5", "/v1/users")))
+	assert.False(t, d.AllInternal())
+
+	internal, total := d.Counts()
+	assert.Equal(t, int64(1), internal)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, rec.traffic, 2)
+}
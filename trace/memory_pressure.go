@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+// Fraction of the memory threshold at which the sample rate starts to drop.
+const memoryPressureOnset = 0.75
+
+// Lowers the sample rate as the agent's memory use rises toward a threshold,
+// and restores it as memory use falls. Below memoryPressureOnset of the
+// threshold, the full sample rate is used; from there, the rate drops
+// linearly, reaching the floor at the threshold. Shared by the sampling
+// collectors for all interfaces. Safe for concurrent use.
+type MemoryPressureSampling struct {
+	// The sample rate used when memory use is low.
+	maxRate float64
+
+	// The lowest sample rate used, however high memory use gets.
+	minRate float64
+
+	threshold_kB uint64
+
+	// Bits of the current sample rate, as a float64.
+	rateBits uint64
+}
+
+// Creates a policy that samples at maxRate until memory use, measured as the
+// resident set size, approaches threshold_kB, and lowers the rate to no less
+// than minRate as it rises further.
+func NewMemoryPressureSampling(maxRate, minRate float64, threshold_kB uint64) *MemoryPressureSampling {
+	if minRate > maxRate {
+		minRate = maxRate
+	}
+	return &MemoryPressureSampling{
+		maxRate:      maxRate,
+		minRate:      minRate,
+		threshold_kB: threshold_kB,
+		rateBits:     math.Float64bits(maxRate),
+	}
+}
+
+// Adjusts the sample rate for the given resident set size.
+func (m *MemoryPressureSampling) Update(rss_kB uint64) {
+	onset := memoryPressureOnset * float64(m.threshold_kB)
+
+	rate := m.maxRate
+	if float64(rss_kB) >= float64(m.threshold_kB) {
+		rate = m.minRate
+	} else if float64(rss_kB) > onset {
+		pressure := (float64(rss_kB) - onset) / (float64(m.threshold_kB) - onset)
+		rate = m.maxRate - pressure*(m.maxRate-m.minRate)
+	}
+
+	old := math.Float64frombits(atomic.SwapUint64(&m.rateBits, math.Float64bits(rate)))
+	if rate != old {
+		printer.Debugf("Memory use is %d kB; sample rate changed from %.3f to %.3f\n", rss_kB, old, rate)
+	}
+}
+
+// Returns the current sample rate.
+func (m *MemoryPressureSampling) SampleRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&m.rateBits))
+}
+
+// Wraps a collector and samples at the current rate. This takes the place of
+// NewSamplingCollector.
+func (m *MemoryPressureSampling) NewCollector(collector Collector) Collector {
+	return &SamplingCollector{
+		pressure:  m,
+		collector: collector,
+	}
+}
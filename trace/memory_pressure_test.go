@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPressureSampling(t *testing.T) {
+	m := NewMemoryPressureSampling(1.0, 0.1, 1000)
+
+	// As memory use rises, the rate falls progressively, reaching the floor at
+	// the threshold.
+	rates := []float64{}
+	for _, rss := range []uint64{500, 750, 800, 900, 1000, 2000} {
+		m.Update(rss)
+		rates = append(rates, m.SampleRate())
+	}
+	assert.Equal(t, 1.0, rates[0])
+	assert.Equal(t, 1.0, rates[1])
+	assert.InDelta(t, 0.82, rates[2], 1e-9)
+	assert.InDelta(t, 0.46, rates[3], 1e-9)
+	assert.Equal(t, 0.1, rates[4])
+	assert.Equal(t, 0.1, rates[5])
+
+	// The rate is restored as memory use recovers.
+	m.Update(600)
+	assert.Equal(t, 1.0, m.SampleRate())
+}
+
+func TestMemoryPressureSamplingCollector(t *testing.T) {
+	m := NewMemoryPressureSampling(1.0, 0.0, 1000)
+	col := &requestRecorder{}
+	c := m.NewCollector(col)
+
+	process := func(n int) {
+		for i := 0; i < n; i++ {
+			c.Process(akinet.ParsedNetworkTraffic{
+				Content: akinet.HTTPRequest{Seq: i},
+			})
+		}
+	}
+
+	process(100)
+	assert.Len(t, col.requests, 100)
+
+	// Under full memory pressure, nothing is sampled.
+	m.Update(1000)
+	process(100)
+	assert.Len(t, col.requests, 100)
+}
@@ -5,26 +5,53 @@ import (
 	"github.com/akitasoftware/akita-libs/spec_util"
 	. "github.com/akitasoftware/akita-libs/visitors"
 	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+	"github.com/postmanlabs/postman-insights-agent/learn"
 	"github.com/postmanlabs/postman-insights-agent/printer"
 )
 
-func obfuscate(m *pb.Method) {
+// Obfuscates the values in the given method. Returns the shapes of the request
+// and response bodies, which are measured along the way to avoid a separate
+// traversal.
+func obfuscate(m *pb.Method) (request, response BodyShape) {
 	var ov obfuscationVisitor
 	vis.Apply(&ov, m)
+	return ov.request, ov.response
 }
 
 type obfuscationVisitor struct {
 	vis.DefaultSpecVisitorImpl
+
+	request  BodyShape
+	response BodyShape
 }
 
 var _ vis.DefaultSpecVisitor = (*obfuscationVisitor)(nil)
 
-func (*obfuscationVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+func (ov *obfuscationVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	if ctx.GetValueType() == vis.BODY {
+		if ctx.IsArg() {
+			ov.request.add(ctx, d)
+		} else if ctx.IsResponse() {
+			ov.response.add(ctx, d)
+		}
+	}
+
 	dp, isPrimitive := d.GetValue().(*pb.Data_Primitive)
 	if !isPrimitive {
 		return Continue
 	}
 
+	// Authorization headers whose credential was redacted at parse time keep
+	// their scheme.
+	if learn.IsRedactedCredential(d) {
+		return Continue
+	}
+
+	// The correlation header is kept so that witnesses can be looked up by it.
+	if ctx.IsArg() && learn.IsCorrelationID(d) {
+		return Continue
+	}
+
 	pv, err := spec_util.PrimitiveValueFromProto(dp.Primitive)
 	if err != nil {
 		printer.Warningf("failed to obfuscate raw value, dropping\n")
@@ -0,0 +1,219 @@
+package trace
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+)
+
+const (
+	// Maximum number of endpoints for which request rates are tracked.
+	// Witnesses for additional endpoints are counted as overflow.
+	maxRateStatsEndpoints = 1000
+
+	// Width, in seconds, of the sliding window over which peak request rates
+	// are measured.
+	peakRateWindow_seconds = 10
+)
+
+// Requests per second for a single endpoint.
+type EndpointRateSummary struct {
+	Method       string
+	Host         string
+	PathTemplate string
+
+	// Number of witnesses observed.
+	Count int64
+
+	// Count divided by the duration of the capture.
+	AvgRPS float64
+
+	// Highest rate over any window of peakRateWindow_seconds, or over the whole
+	// capture if it was shorter than that.
+	PeakRPS float64
+}
+
+type endpointRate struct {
+	count int64
+
+	// Number of requests in each second of the sliding window, indexed by Unix
+	// second modulo the window width, and the second each bucket counts.
+	buckets       [peakRateWindow_seconds]int64
+	bucketSeconds [peakRateWindow_seconds]int64
+
+	// Largest number of requests seen in any window.
+	peakWindowCount int64
+}
+
+// Records a request observed at the given Unix second.
+func (e *endpointRate) add(second int64) {
+	e.count += 1
+
+	i := second % peakRateWindow_seconds
+	if e.bucketSeconds[i] > second {
+		// The bucket has moved on to a later second, so this request is too old
+		// to fall within any window still being measured.
+		return
+	}
+	if e.bucketSeconds[i] != second {
+		e.bucketSeconds[i] = second
+		e.buckets[i] = 0
+	}
+	e.buckets[i] += 1
+
+	var windowCount int64
+	for j := range e.buckets {
+		if s := e.bucketSeconds[j]; s > second-peakRateWindow_seconds && s <= second {
+			windowCount += e.buckets[j]
+		}
+	}
+	if windowCount > e.peakWindowCount {
+		e.peakWindowCount = windowCount
+	}
+}
+
+// Request rates aggregated across all endpoints, without identifying any of
+// them.
+type EndpointRateTotals struct {
+	// Number of endpoints tracked.
+	Endpoints int
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	Overflow int64
+
+	// The largest average and peak rates of any endpoint.
+	MaxAvgRPS  float64
+	MaxPeakRPS float64
+}
+
+// Measures the rate of requests to each endpoint, on average over the capture
+// and at its peak. Safe for concurrent use. Implements WitnessSink so it can
+// be attached to a BackendCollector.
+type EndpointRateStats struct {
+	mutex sync.Mutex
+
+	endpoints map[endpointKey]*endpointRate
+
+	// Observation times of the earliest and latest witnesses, for computing
+	// the duration of the capture.
+	first, last time.Time
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	overflow int64
+}
+
+var _ WitnessSink = (*EndpointRateStats)(nil)
+
+func NewEndpointRateStats() *EndpointRateStats {
+	return &EndpointRateStats{
+		endpoints: make(map[endpointKey]*endpointRate),
+	}
+}
+
+func (s *EndpointRateStats) ExportWitness(w *pb.Witness, observationTime time.Time, _ WitnessInfo) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return
+	}
+	s.Update(meta, observationTime)
+}
+
+// Records a witness of the given endpoint observed at the given time.
+func (s *EndpointRateStats) Update(meta *pb.HTTPMethodMeta, observationTime time.Time) {
+	key := endpointKeyOfMeta(meta)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.first.IsZero() || observationTime.Before(s.first) {
+		s.first = observationTime
+	}
+	if observationTime.After(s.last) {
+		s.last = observationTime
+	}
+
+	e, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= maxRateStatsEndpoints {
+			s.overflow += 1
+			return
+		}
+		e = &endpointRate{}
+		s.endpoints[key] = e
+	}
+	e.add(observationTime.Unix())
+}
+
+// Returns the n endpoints with the highest peak request rate, highest first.
+func (s *EndpointRateStats) TopN(n int) []EndpointRateSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Count the capture as lasting at least a second, so that a burst of
+	// requests within one second has a finite rate.
+	duration := s.last.Sub(s.first).Seconds()
+	if duration < 1 {
+		duration = 1
+	}
+	window := float64(peakRateWindow_seconds)
+	if duration < window {
+		window = duration
+	}
+
+	result := make([]EndpointRateSummary, 0, len(s.endpoints))
+	for k, e := range s.endpoints {
+		result = append(result, EndpointRateSummary{
+			Method:       k.Method,
+			Host:         k.Host,
+			PathTemplate: k.PathTemplate,
+			Count:        e.count,
+			AvgRPS:       float64(e.count) / duration,
+			PeakRPS:      float64(e.peakWindowCount) / window,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PeakRPS != result[j].PeakRPS {
+			return result[i].PeakRPS > result[j].PeakRPS
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].PathTemplate != result[j].PathTemplate {
+			return result[i].PathTemplate < result[j].PathTemplate
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of witnesses that were not tracked because the endpoint
+// limit was reached.
+func (s *EndpointRateStats) Overflow() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflow
+}
+
+// Returns statistics aggregated across all endpoints.
+func (s *EndpointRateStats) Totals() EndpointRateTotals {
+	all := s.TopN(maxRateStatsEndpoints)
+	totals := EndpointRateTotals{
+		Endpoints: len(all),
+		Overflow:  s.Overflow(),
+	}
+	for _, e := range all {
+		totals.MaxAvgRPS = math.Max(totals.MaxAvgRPS, e.AvgRPS)
+		totals.MaxPeakRPS = math.Max(totals.MaxPeakRPS, e.PeakRPS)
+	}
+	return totals
+}
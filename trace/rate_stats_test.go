@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointRateStats(t *testing.T) {
+	stats := NewEndpointRateStats()
+	orders := &pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/orders"}
+	login := &pb.HTTPMethodMeta{Method: "POST", Host: "example.com", PathTemplate: "/v1/login"}
+
+	// GET /v1/orders at a steady 50 requests per second for a minute.
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 50*60; i++ {
+		stats.Update(orders, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+
+	// POST /v1/login in a burst of 200 requests per second for 5 seconds,
+	// halfway through.
+	burst := start.Add(30 * time.Second)
+	for i := 0; i < 200*5; i++ {
+		stats.Update(login, burst.Add(time.Duration(i)*5*time.Millisecond))
+	}
+
+	top := stats.TopN(10)
+	if !assert.Equal(t, 2, len(top)) {
+		return
+	}
+
+	// The burst has the higher peak, spread over the 10-second window.
+	assert.Equal(t, "/v1/login", top[0].PathTemplate)
+	assert.Equal(t, int64(1000), top[0].Count)
+	assert.InDelta(t, 1000.0/60.0, top[0].AvgRPS, 0.5)
+	assert.InDelta(t, 100.0, top[0].PeakRPS, 1.0)
+
+	assert.Equal(t, "/v1/orders", top[1].PathTemplate)
+	assert.InDelta(t, 50.0, top[1].AvgRPS, 1.0)
+	assert.InDelta(t, 50.0, top[1].PeakRPS, 1.0)
+
+	assert.Equal(t, 1, len(stats.TopN(1)))
+	assert.Equal(t, int64(0), stats.Overflow())
+
+	totals := stats.Totals()
+	assert.Equal(t, 2, totals.Endpoints)
+	assert.InDelta(t, 50.0, totals.MaxAvgRPS, 1.0)
+	assert.InDelta(t, 100.0, totals.MaxPeakRPS, 1.0)
+}
+
+func TestEndpointRateStatsTemplatesPaths(t *testing.T) {
+	stats := NewEndpointRateStats()
+	start := time.Unix(1_700_000_000, 0)
+	stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/orders/17"}, start)
+	stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/orders/18"}, start)
+
+	top := stats.TopN(10)
+	if assert.Equal(t, 1, len(top)) {
+		assert.Equal(t, "/v1/orders/{arg3}", top[0].PathTemplate)
+		assert.Equal(t, int64(2), top[0].Count)
+	}
+}
+
+func TestEndpointRateStatsShortCapture(t *testing.T) {
+	stats := NewEndpointRateStats()
+	meta := &pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/orders"}
+
+	// 100 requests per second for 2 seconds. The peak can't be lower than the
+	// average just because the capture was shorter than the window.
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 200; i++ {
+		stats.Update(meta, start.Add(time.Duration(i)*10*time.Millisecond))
+	}
+
+	top := stats.TopN(1)
+	if assert.Equal(t, 1, len(top)) {
+		assert.InDelta(t, 100.0, top[0].AvgRPS, 1.0)
+		assert.InDelta(t, 100.0, top[0].PeakRPS, 1.0)
+	}
+}
+
+func TestEndpointRateStatsOutOfOrder(t *testing.T) {
+	stats := NewEndpointRateStats()
+	meta := &pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/orders"}
+
+	// A witness flushed late still counts toward the total, even if it's too
+	// old to count toward the peak.
+	start := time.Unix(1_700_000_000, 0)
+	stats.Update(meta, start.Add(time.Minute))
+	stats.Update(meta, start)
+
+	top := stats.TopN(1)
+	if assert.Equal(t, 1, len(top)) {
+		assert.Equal(t, int64(2), top[0].Count)
+		assert.InDelta(t, 2.0/60.0, top[0].AvgRPS, 0.001)
+	}
+}
@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"net/url"
+	"strings"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/postmanlabs/postman-insights-agent/redact"
+)
+
+// Records each request's raw query string in WitnessInfo.RawQuery, preserving
+// the order of parameters and repeated parameters, for consumers that depend
+// on them. Values are obfuscated like the parsed query parameters, except for
+// those of the allowed parameters, which are kept verbatim unless a plugin
+// redacted or dropped them.
+type RawQueryPolicy struct {
+	allowed map[string]struct{}
+}
+
+// Creates a policy that keeps the values of the given query parameters
+// verbatim.
+func NewRawQueryPolicy(allowed []string) *RawQueryPolicy {
+	p := &RawQueryPolicy{allowed: make(map[string]struct{}, len(allowed))}
+	for _, name := range allowed {
+		p.allowed[name] = struct{}{}
+	}
+	return p
+}
+
+// Returns the given raw query string of the given method, with each value
+// obfuscated, kept, or redacted. Must be called after plugins have been
+// applied to the method, and before it is obfuscated.
+func (p *RawQueryPolicy) redact(raw string, m *pb.Method) string {
+	if raw == "" {
+		return ""
+	}
+
+	params := map[string]*pb.Data{}
+	for _, d := range m.GetArgs() {
+		if q := d.GetMeta().GetHttp().GetQuery(); q != nil {
+			params[q.GetKey()] = d
+		}
+	}
+
+	pairs := strings.Split(raw, "&")
+	for i, pair := range pairs {
+		k, v, _ := strings.Cut(pair, "=")
+		if v == "" {
+			continue
+		}
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			key = k
+		}
+
+		d, ok := params[key]
+		switch {
+		case !ok || isRedactedQueryParam(d):
+			pairs[i] = k + "=" + redact.RedactedValue
+		case p.isAllowed(key):
+			continue
+		default:
+			pairs[i] = k + "=" + url.QueryEscape(obfuscatedString(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (p *RawQueryPolicy) isAllowed(name string) bool {
+	_, ok := p.allowed[name]
+	return ok
+}
+
+// Determines whether a plugin has redacted the value of the given query
+// parameter, or dropped its value.
+func isRedactedQueryParam(d *pb.Data) bool {
+	return d.GetValue() == nil || d.GetPrimitive().GetStringValue().GetValue() == redact.RedactedValue
+}
+
+// Returns the obfuscated form of a string value, as it would appear in an
+// uploaded witness.
+func obfuscatedString(s string) string {
+	pv, err := spec_util.PrimitiveValueFromProto(spec_util.NewPrimitiveString(s))
+	if err != nil {
+		return redact.RedactedValue
+	}
+	return pv.Obfuscate().String()
+}
@@ -0,0 +1,108 @@
+package trace
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	"github.com/postmanlabs/postman-insights-agent/redact"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawQueryIsRedacted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var rec witnessRecorder
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(rec.recordAsyncReportsUpload).
+		AnyTimes().
+		Return(nil)
+
+	streamID := uuid.New()
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/pets", RawQuery: "sort=name&access_token=tok123&flag&sort=age&q=fluffy+dog"},
+			Host:     "example.com",
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1,
+			StatusCode: 200,
+			Body:       memview.New([]byte("ok")),
+		},
+	}
+
+	redactor, err := redact.NewKeyPatternRedactor([]string{"*_token"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), []plugin.AkitaPlugin{redactor})
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	col.(*BackendCollector).SetRawQueryPolicy(NewRawQueryPolicy([]string{"sort", "access_token"}))
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(resp))
+	assert.NoError(t, col.Close())
+
+	// Allowed values are kept, unless redacted by a plugin, and other values
+	// are obfuscated.
+	if assert.Equal(t, 1, sink.count()) {
+		assert.Equal(t, "sort=name&access_token=*REDACTED*&flag&sort=age&q=", sink.infos[0].RawQuery)
+	}
+
+	// The raw query string is not added to the witness, and the parsed
+	// parameters are obfuscated as usual.
+	if assert.Len(t, rec.witnesses, 1) {
+		text := proto.MarshalTextString(rec.witnesses[0])
+		assert.NotContains(t, text, "sort=")
+		assert.NotContains(t, text, "name")
+		assert.NotContains(t, text, "fluffy")
+	}
+}
+
+func TestRawQueryNotCapturedByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	req := akinet.ParsedNetworkTraffic{
+		Content: akinet.HTTPRequest{
+			StreamID: uuid.New(),
+			Seq:      1,
+			Method:   "GET",
+			URL:      &url.URL{Path: "/v1/pets", RawQuery: "sort=name"},
+			Host:     "example.com",
+		},
+	}
+
+	sink := &sinkRecorder{}
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Close())
+
+	if assert.Equal(t, 1, sink.count()) {
+		assert.Empty(t, sink.infos[0].RawQuery)
+	}
+}
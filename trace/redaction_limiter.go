@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Returns the default number of witnesses that may be redacted concurrently:
+// one per CPU that Go may use.
+func DefaultRedactionConcurrency() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// Summary of a RedactionLimiter's activity.
+type RedactionLimiterStats struct {
+	// Maximum number of witnesses redacted concurrently.
+	Concurrency int
+
+	// Number of witnesses redacted.
+	Redactions int64
+
+	// Number of witnesses that had to wait for another redaction to finish.
+	Queued int64
+
+	// Largest number of witnesses waiting at once.
+	MaxQueueDepth int64
+
+	// Total and longest time spent waiting.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// Returns the average time spent waiting by witnesses that had to wait.
+func (s RedactionLimiterStats) AvgWait() time.Duration {
+	if s.Queued == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Queued)
+}
+
+// Bounds the number of witnesses being redacted at once, so that a burst of
+// witnesses doesn't spike CPU usage. Witnesses beyond the limit wait for a
+// redaction to finish. The limiter is shared by the backend collectors for all
+// interfaces. Safe for concurrent use.
+type RedactionLimiter struct {
+	slots chan struct{}
+
+	mu sync.Mutex
+
+	// Number of witnesses currently waiting.
+	queueDepth int64
+
+	stats RedactionLimiterStats
+}
+
+// Creates a limiter that allows the given number of concurrent redactions. If
+// concurrency is not positive, DefaultRedactionConcurrency is used.
+func NewRedactionLimiter(concurrency int) *RedactionLimiter {
+	if concurrency <= 0 {
+		concurrency = DefaultRedactionConcurrency()
+	}
+	return &RedactionLimiter{
+		slots: make(chan struct{}, concurrency),
+		stats: RedactionLimiterStats{Concurrency: concurrency},
+	}
+}
+
+// Runs redact once fewer than the maximum number of redactions are running.
+// If the limiter is nil, redact runs immediately.
+func (l *RedactionLimiter) Do(redact func()) {
+	if l == nil {
+		redact()
+		return
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.mu.Lock()
+		l.stats.Redactions += 1
+		l.mu.Unlock()
+	default:
+		l.wait()
+	}
+	defer func() { <-l.slots }()
+
+	redact()
+}
+
+// Waits for a slot, recording the wait.
+func (l *RedactionLimiter) wait() {
+	l.mu.Lock()
+	l.queueDepth += 1
+	if l.queueDepth > l.stats.MaxQueueDepth {
+		l.stats.MaxQueueDepth = l.queueDepth
+	}
+	l.mu.Unlock()
+
+	start := time.Now()
+	l.slots <- struct{}{}
+	waited := time.Since(start)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queueDepth -= 1
+	l.stats.Redactions += 1
+	l.stats.Queued += 1
+	l.stats.TotalWait += waited
+	if waited > l.stats.MaxWait {
+		l.stats.MaxWait = waited
+	}
+}
+
+func (l *RedactionLimiter) Stats() RedactionLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
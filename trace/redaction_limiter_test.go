@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/plugin"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tracks the number of concurrent calls to Transform.
+type concurrencyTrackingPlugin struct {
+	active int32
+	max    int32
+	calls  int32
+}
+
+func (p *concurrencyTrackingPlugin) Name() string {
+	return "concurrency tracker"
+}
+
+func (p *concurrencyTrackingPlugin) enter() {
+	atomic.AddInt32(&p.calls, 1)
+	active := atomic.AddInt32(&p.active, 1)
+	for {
+		max := atomic.LoadInt32(&p.max)
+		if active <= max || atomic.CompareAndSwapInt32(&p.max, max, active) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&p.active, -1)
+}
+
+func (p *concurrencyTrackingPlugin) Transform(*pb.Method) error {
+	p.enter()
+	return nil
+}
+
+func TestRedactionLimiterBoundsConcurrency(t *testing.T) {
+	limiter := NewRedactionLimiter(2)
+	tracker := &concurrencyTrackingPlugin{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Do(tracker.enter)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(50), tracker.calls)
+	assert.LessOrEqual(t, tracker.max, int32(2))
+
+	stats := limiter.Stats()
+	assert.Equal(t, 2, stats.Concurrency)
+	assert.Equal(t, int64(50), stats.Redactions)
+	assert.Greater(t, stats.Queued, int64(0))
+	assert.Greater(t, stats.MaxQueueDepth, int64(0))
+	assert.Greater(t, stats.MaxWait, time.Duration(0))
+
+	// A nil limiter doesn't limit.
+	var nilLimiter *RedactionLimiter
+	ran := false
+	nilLimiter.Do(func() { ran = true })
+	assert.True(t, ran)
+
+	assert.Equal(t, DefaultRedactionConcurrency(), NewRedactionLimiter(0).Stats().Concurrency)
+}
+
+// Witnesses from several interfaces, including unpaired witnesses flushed on
+// close, are all redacted without exceeding the limit or deadlocking.
+func TestRedactionLimiterBackendCollectors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	limiter := NewRedactionLimiter(1)
+	tracker := &concurrencyTrackingPlugin{}
+	plugins := []plugin.AkitaPlugin{tracker}
+
+	const interfaces, pairs, unpaired = 4, 10, 5
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < interfaces; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), plugins)
+				col.(*BackendCollector).SetRedactionLimiter(limiter)
+				for j := 0; j < pairs+unpaired; j++ {
+					streamID := uuid.New()
+					col.Process(akinet.ParsedNetworkTraffic{
+						Content: akinet.HTTPRequest{
+							StreamID: streamID,
+							Method:   "GET",
+							URL:      &url.URL{Path: "/v1/doggos"},
+							Host:     "example.com",
+						},
+					})
+					if j < pairs {
+						col.Process(akinet.ParsedNetworkTraffic{
+							Content: akinet.HTTPResponse{
+								StreamID:   streamID,
+								StatusCode: 200,
+							},
+						})
+					}
+				}
+				col.Close()
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("backend collectors did not finish")
+	}
+
+	assert.Equal(t, int32(interfaces*(pairs+unpaired)), tracker.calls)
+	assert.Equal(t, int32(1), tracker.max)
+	assert.Equal(t, int64(interfaces*(pairs+unpaired)), limiter.Stats().Redactions)
+}
+
+func BenchmarkRedactionLimiter(b *testing.B) {
+	limiter := NewRedactionLimiter(0)
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			limiter.Do(func() {})
+		}
+	})
+}
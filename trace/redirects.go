@@ -0,0 +1,334 @@
+package trace
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/pkg/errors"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// How HTTP redirects, which are 3xx responses with a Location header, are
+// captured.
+type RedirectPolicy string
+
+const (
+	// Redirects are captured like any other response.
+	RedirectKeep RedirectPolicy = "keep"
+
+	// Redirects are dropped, along with their requests. The locations that the
+	// request following a redirect was redirected from are recorded in
+	// RedirectChains, and reported in the WitnessInfo of its witness.
+	RedirectCollapse RedirectPolicy = "collapse"
+
+	// Redirects are dropped, along with their requests.
+	RedirectDrop RedirectPolicy = "drop"
+)
+
+var redirectPolicies = []RedirectPolicy{RedirectKeep, RedirectCollapse, RedirectDrop}
+
+// Locations that requests at the end of collapsed redirect chains were
+// redirected from, keyed by the ID of the request's witness. A redirect
+// collector records each chain, and a backend collector takes it when it
+// parses the request. Chains whose request never reaches the backend
+// collector, because it was sampled or filtered out in between, expire.
+//
+// A nil *RedirectChains records nothing.
+type RedirectChains struct {
+	mu     sync.Mutex
+	chains map[akid.WitnessID]redirectChain
+}
+
+type redirectChain struct {
+	// Locations of the earlier requests in the chain, as host and path, in the
+	// order they were requested.
+	locations []string
+
+	observed time.Time
+}
+
+func NewRedirectChains() *RedirectChains {
+	return &RedirectChains{
+		chains: map[akid.WitnessID]redirectChain{},
+	}
+}
+
+func (r *RedirectChains) record(id akid.WitnessID, locations []string, observed time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.chains) >= maxKeys {
+		cutoff := observed.Add(-pendingRequestExpiration)
+		for k, c := range r.chains {
+			if c.observed.Before(cutoff) {
+				delete(r.chains, k)
+			}
+		}
+		if len(r.chains) >= maxKeys {
+			return
+		}
+	}
+	r.chains[id] = redirectChain{locations: locations, observed: observed}
+}
+
+// Returns the locations that the request with the given witness ID was
+// redirected from, and forgets them. Returns nil if the request was not
+// redirected.
+func (r *RedirectChains) take(id akid.WitnessID) []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.chains[id]
+	if !ok {
+		return nil
+	}
+	delete(r.chains, id)
+	return c.locations
+}
+
+func ParseRedirectPolicy(s string) (RedirectPolicy, error) {
+	for _, p := range redirectPolicies {
+		if strings.EqualFold(s, string(p)) {
+			return p, nil
+		}
+	}
+	names := make([]string, 0, len(redirectPolicies))
+	for _, p := range redirectPolicies {
+		names = append(names, string(p))
+	}
+	return "", errors.Errorf("invalid redirect policy %q; must be one of %s", s, strings.Join(names, ", "))
+}
+
+// Returns a collector that applies the given redirect policy before passing
+// traffic to the given collector. Requests are held until their response is
+// seen, or until they expire, so that a request can be dropped along with its
+// redirect. Redirects are followed only within the traffic seen by a single
+// collector. In collapse mode, redirect chains are recorded in the given
+// chains.
+func NewRedirectCollector(policy RedirectPolicy, chains *RedirectChains, col Collector) Collector {
+	if policy == RedirectKeep {
+		return col
+	}
+	return &redirectCollector{
+		policy:    policy,
+		chains:    chains,
+		collector: col,
+		held:      map[akid.WitnessID]heldRequest{},
+		redirects: map[string]pendingRedirect{},
+	}
+}
+
+type redirectCollector struct {
+	policy    RedirectPolicy
+	chains    *RedirectChains
+	collector Collector
+
+	// Protects the fields below. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mu sync.Mutex
+
+	// Requests whose response hasn't been seen yet.
+	held map[akid.WitnessID]heldRequest
+
+	// In collapse mode, redirects whose target hasn't been requested yet,
+	// keyed by the target's location.
+	redirects map[string]pendingRedirect
+
+	// Observation time of the most recent packet, and the time at which held
+	// requests and redirects were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+type heldRequest struct {
+	traffic akinet.ParsedNetworkTraffic
+
+	// Locations this request was redirected from, if any.
+	redirectedFrom []string
+}
+
+type pendingRedirect struct {
+	// Locations of the requests in the chain so far.
+	chain []string
+
+	observed time.Time
+}
+
+func (rc *redirectCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if t.ObservationTime.After(rc.latestObservation) {
+		rc.latestObservation = t.ObservationTime
+	}
+	if err := rc.expire(); err != nil {
+		return err
+	}
+
+	switch c := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if len(rc.held) >= maxKeys {
+			// Too many requests without a response; don't hold any more.
+			return rc.collector.Process(t)
+		}
+		h := heldRequest{traffic: t}
+		if rc.policy == RedirectCollapse {
+			loc := requestLocation(c)
+			if r, ok := rc.redirects[loc]; ok {
+				delete(rc.redirects, loc)
+				h.redirectedFrom = r.chain
+			}
+		}
+		rc.held[learn.ToWitnessID(c.StreamID, c.Seq)] = h
+		return nil
+
+	case akinet.HTTPResponse:
+		id := learn.ToWitnessID(c.StreamID, c.Seq)
+		h, ok := rc.held[id]
+		if !ok {
+			// Either the request wasn't held, or it wasn't seen at all.
+			if isRedirect(c) {
+				return nil
+			}
+			return rc.collector.Process(t)
+		}
+		delete(rc.held, id)
+
+		if isRedirect(c) {
+			if rc.policy == RedirectCollapse {
+				rc.recordRedirect(h, c)
+			}
+			return nil
+		}
+		if err := rc.release(h); err != nil {
+			return err
+		}
+	}
+	return rc.collector.Process(t)
+}
+
+// Records a redirect so that the chain can be recorded for the request that
+// follows it. Must be called with the mutex held.
+func (rc *redirectCollector) recordRedirect(h heldRequest, resp akinet.HTTPResponse) {
+	req := h.traffic.Content.(akinet.HTTPRequest)
+	target, err := redirectTarget(req, resp)
+	if err != nil {
+		return
+	}
+	if _, exists := rc.redirects[target]; !exists && len(rc.redirects) >= maxKeys {
+		return
+	}
+
+	chain := make([]string, 0, len(h.redirectedFrom)+1)
+	chain = append(chain, h.redirectedFrom...)
+	chain = append(chain, requestLocation(req))
+	rc.redirects[target] = pendingRedirect{
+		chain:    chain,
+		observed: h.traffic.ObservationTime,
+	}
+}
+
+// Passes a held request on, recording the locations it was redirected from.
+func (rc *redirectCollector) release(h heldRequest) error {
+	if len(h.redirectedFrom) > 0 {
+		req := h.traffic.Content.(akinet.HTTPRequest)
+		rc.chains.record(learn.ToWitnessID(req.StreamID, req.Seq), h.redirectedFrom, h.traffic.ObservationTime)
+	}
+	return rc.collector.Process(h.traffic)
+}
+
+// Releases held requests that have waited too long for their response, and
+// forgets redirects whose target hasn't been requested in that time. Must be
+// called with the mutex held.
+func (rc *redirectCollector) expire() error {
+	if rc.latestObservation.Sub(rc.lastSweep) < pendingRequestSweepInterval {
+		return nil
+	}
+	rc.lastSweep = rc.latestObservation
+
+	cutoff := rc.latestObservation.Add(-pendingRequestExpiration)
+	for loc, r := range rc.redirects {
+		if r.observed.Before(cutoff) {
+			delete(rc.redirects, loc)
+		}
+	}
+
+	var expired []akid.WitnessID
+	for id, h := range rc.held {
+		if h.traffic.ObservationTime.Before(cutoff) {
+			expired = append(expired, id)
+		}
+	}
+	return rc.releaseHeld(expired)
+}
+
+// Releases the given held requests in the order they were observed.
+func (rc *redirectCollector) releaseHeld(ids []akid.WitnessID) error {
+	sort.Slice(ids, func(i, j int) bool {
+		return rc.held[ids[i]].traffic.ObservationTime.Before(rc.held[ids[j]].traffic.ObservationTime)
+	})
+	for _, id := range ids {
+		h := rc.held[id]
+		delete(rc.held, id)
+		if err := rc.release(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rc *redirectCollector) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	ids := make([]akid.WitnessID, 0, len(rc.held))
+	for id := range rc.held {
+		ids = append(ids, id)
+	}
+	if err := rc.releaseHeld(ids); err != nil {
+		rc.collector.Close()
+		return err
+	}
+	return rc.collector.Close()
+}
+
+// Determines whether the response is a redirect.
+func isRedirect(resp akinet.HTTPResponse) bool {
+	return resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != ""
+}
+
+// Returns the location of a request, as host and path, including any query.
+func requestLocation(req akinet.HTTPRequest) string {
+	if req.URL == nil {
+		return req.Host
+	}
+	return req.Host + req.URL.RequestURI()
+}
+
+// Returns the location that the response redirects the request to, resolving
+// a relative Location header against the request.
+func redirectTarget(req akinet.HTTPRequest, resp akinet.HTTPResponse) (string, error) {
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+	base := &url.URL{Scheme: "http", Host: req.Host}
+	if req.URL != nil {
+		base.Path = req.URL.Path
+		base.RawPath = req.URL.RawPath
+		base.RawQuery = req.URL.RawQuery
+	}
+	target := base.ResolveReference(loc)
+	return target.Host + target.RequestURI(), nil
+}
@@ -0,0 +1,214 @@
+package trace
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+type trafficRecorder struct {
+	traffic []akinet.ParsedNetworkTraffic
+	closed  bool
+}
+
+func (r *trafficRecorder) Process(t akinet.ParsedNetworkTraffic) error {
+	r.traffic = append(r.traffic, t)
+	return nil
+}
+
+func (r *trafficRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+// Returns a request for the given path on example.com, and a response to it
+// with the given status and Location header.
+func makeRedirectExchange(path string, status int, location string, observed time.Time) (akinet.ParsedNetworkTraffic, akinet.ParsedNetworkTraffic) {
+	u, _ := url.ParseRequestURI(path)
+	streamID := uuid.New()
+	header := http.Header{}
+	if location != "" {
+		header.Set("Location", location)
+	}
+	req := akinet.ParsedNetworkTraffic{
+		ObservationTime: observed,
+		Content: akinet.HTTPRequest{
+			StreamID: streamID,
+			Seq:      1,
+			Method:   "GET",
+			URL:      u,
+			Host:     "example.com",
+			Header:   http.Header{},
+		},
+	}
+	resp := akinet.ParsedNetworkTraffic{
+		ObservationTime: observed.Add(time.Millisecond),
+		Content: akinet.HTTPResponse{
+			StreamID:   streamID,
+			Seq:        1,
+			StatusCode: status,
+			Header:     header,
+		},
+	}
+	return req, resp
+}
+
+func TestRedirectPolicies(t *testing.T) {
+	now := time.Now()
+	redirectReq, redirectResp := makeRedirectExchange("/old?id=1", 302, "/new?id=1", now)
+	finalReq, finalResp := makeRedirectExchange("/new?id=1", 200, "", now.Add(time.Second))
+
+	finalID := learn.ToWitnessID(finalReq.Content.(akinet.HTTPRequest).StreamID, 1)
+
+	testCases := []struct {
+		policy   RedirectPolicy
+		expected []akinet.ParsedNetworkTraffic
+		chain    []string
+	}{
+		{
+			policy:   RedirectKeep,
+			expected: []akinet.ParsedNetworkTraffic{redirectReq, redirectResp, finalReq, finalResp},
+		},
+		{
+			policy:   RedirectDrop,
+			expected: []akinet.ParsedNetworkTraffic{finalReq, finalResp},
+		},
+		{
+			policy:   RedirectCollapse,
+			expected: []akinet.ParsedNetworkTraffic{finalReq, finalResp},
+			chain:    []string{"example.com/old?id=1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		rec := &trafficRecorder{}
+		chains := NewRedirectChains()
+		c := NewRedirectCollector(tc.policy, chains, rec)
+		for _, p := range []akinet.ParsedNetworkTraffic{redirectReq, redirectResp, finalReq, finalResp} {
+			assert.NoError(t, c.Process(p), string(tc.policy))
+		}
+		assert.NoError(t, c.Close(), string(tc.policy))
+
+		assert.Equal(t, tc.expected, rec.traffic, string(tc.policy))
+		assert.True(t, rec.closed, string(tc.policy))
+		assert.Equal(t, tc.chain, chains.take(finalID), string(tc.policy))
+	}
+
+	// The request is not modified.
+	assert.Empty(t, finalReq.Content.(akinet.HTTPRequest).Header)
+}
+
+func TestRedirectCollapseChain(t *testing.T) {
+	now := time.Now()
+	firstReq, firstResp := makeRedirectExchange("/a", 301, "http://example.com/b", now)
+	secondReq, secondResp := makeRedirectExchange("/b", 307, "c", now.Add(time.Second))
+	finalReq, finalResp := makeRedirectExchange("/c", 200, "", now.Add(2*time.Second))
+
+	rec := &trafficRecorder{}
+	chains := NewRedirectChains()
+	c := NewRedirectCollector(RedirectCollapse, chains, rec)
+	for _, p := range []akinet.ParsedNetworkTraffic{firstReq, firstResp, secondReq, secondResp, finalReq, finalResp} {
+		assert.NoError(t, c.Process(p))
+	}
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{finalReq, finalResp}, rec.traffic)
+	finalID := learn.ToWitnessID(finalReq.Content.(akinet.HTTPRequest).StreamID, 1)
+	assert.Equal(t, []string{"example.com/a", "example.com/b"}, chains.take(finalID))
+
+	// A chain is taken only once.
+	assert.Nil(t, chains.take(finalID))
+}
+
+func TestRedirectChainsReportedInWitnessInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	sink := &sinkRecorder{}
+	chains := NewRedirectChains()
+	bc := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	bc.(*BackendCollector).SetWitnessSinks([]WitnessSink{sink})
+	bc.(*BackendCollector).SetRedirectChains(chains)
+	c := NewRedirectCollector(RedirectCollapse, chains, bc)
+
+	now := time.Now()
+	redirectReq, redirectResp := makeRedirectExchange("/old", 302, "/new", now)
+	finalReq, finalResp := makeRedirectExchange("/new", 200, "", now.Add(time.Second))
+	for _, p := range []akinet.ParsedNetworkTraffic{redirectReq, redirectResp, finalReq, finalResp} {
+		assert.NoError(t, c.Process(p))
+	}
+	assert.NoError(t, c.Close())
+
+	if assert.Equal(t, 1, sink.count()) {
+		assert.Equal(t, []string{"example.com/old"}, sink.infos[0].RedirectedFrom)
+
+		// The chain is not added to the witness.
+		assert.Empty(t, sink.args[0])
+	}
+}
+
+func TestRedirectHeldRequests(t *testing.T) {
+	now := time.Now()
+	unansweredReq, _ := makeRedirectExchange("/slow", 200, "", now)
+	otherReq, otherResp := makeRedirectExchange("/other", 200, "", now.Add(time.Second))
+
+	// A request without a response is released once it expires.
+	rec := &trafficRecorder{}
+	c := NewRedirectCollector(RedirectDrop, nil, rec)
+	assert.NoError(t, c.Process(unansweredReq))
+	assert.Empty(t, rec.traffic)
+
+	later := now.Add(pendingRequestExpiration + pendingRequestSweepInterval)
+	otherReq.ObservationTime, otherResp.ObservationTime = later, later
+	assert.NoError(t, c.Process(otherReq))
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{unansweredReq}, rec.traffic)
+
+	// Held requests are released on close.
+	assert.NoError(t, c.Close())
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{unansweredReq, otherReq}, rec.traffic)
+}
+
+func TestRedirectConcurrentProcess(t *testing.T) {
+	rec := &trafficRecorder{}
+	c := NewRedirectCollector(RedirectDrop, nil, rec)
+
+	now := time.Now()
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 400; i++ {
+		status, location := 200, ""
+		if i%2 == 0 {
+			status, location = 302, "/new"
+		}
+		req, resp := makeRedirectExchange("/old", status, location, now)
+		batches[i%len(batches)] = append(batches[i%len(batches)], req, resp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	// Only the exchanges that weren't redirected remain.
+	assert.Equal(t, 400, len(rec.traffic))
+}
+
+func TestParseRedirectPolicy(t *testing.T) {
+	p, err := ParseRedirectPolicy("Collapse")
+	assert.NoError(t, err)
+	assert.Equal(t, RedirectCollapse, p)
+
+	_, err = ParseRedirectPolicy("follow")
+	assert.Error(t, err)
+}
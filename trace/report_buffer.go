@@ -14,6 +14,10 @@ import (
 	"github.com/postmanlabs/postman-insights-agent/rest"
 )
 
+// Number of times to attempt each request when a batch is split across
+// several requests.
+const splitRequestAttempts = 2
+
 // A report that hasn't yet been processed for upload.
 type rawReport struct {
 	Witness            *witnessWithInfo
@@ -28,6 +32,10 @@ type reportBuffer struct {
 	packetCounts         PacketCountConsumer
 	maxSize_bytes        int
 	maxWitnessSize_bytes optionals.Optional[int]
+
+	// If set, batches larger than this are uploaded in several requests. See
+	// BackendCollector.SetMaxUploadRequestSize.
+	maxRequestSize_bytes optionals.Optional[int]
 }
 
 var _ batcher.Buffer[rawReport] = (*reportBuffer)(nil)
@@ -82,17 +90,96 @@ func (buf *reportBuffer) Flush() error {
 		return nil
 	}
 
+	// While uploads are paused, hold on to reports until the buffer fills up,
+	// and drop them after that.
+	breaker := buf.collector.breaker
+	if breaker != nil && !breaker.allow(time.Now()) {
+		if buf.isFull() {
+			numReports := len(buf.Witnesses) + len(buf.TCPConnections) + len(buf.TLSHandshakes)
+			printer.Debugf("Dropping %d reports while uploads to Postman are paused\n", numReports)
+			breaker.recordDropped(numReports)
+			buf.UploadReportsRequest.Clear()
+		}
+		return nil
+	}
+
 	// Ensure the buffer is empty when we return.
 	defer buf.UploadReportsRequest.Clear()
 
-	// Upload to the back end.
+	requests := []*kgxapi.UploadReportsRequest{&buf.UploadReportsRequest}
+	if maxSize, exists := buf.maxRequestSize_bytes.Get(); exists {
+		requests = splitUploadRequest(&buf.UploadReportsRequest, maxSize)
+	}
+
+	// When a batch is split, a failed request is retried, so that the reports
+	// in it aren't lost while the others are uploaded. Unsplit batches are
+	// attempted once, as before.
+	attempts := 1
+	if len(requests) > 1 {
+		attempts = splitRequestAttempts
+	}
+
+	for i, req := range requests {
+		// The breaker already allowed the first request.
+		if i > 0 && breaker != nil && !breaker.allow(time.Now()) {
+			numReports := 0
+			for _, r := range requests[i:] {
+				numReports += len(r.Witnesses) + len(r.TCPConnections) + len(r.TLSHandshakes)
+			}
+			printer.Debugf("Dropping %d reports because uploads to Postman were paused\n", numReports)
+			breaker.recordDropped(numReports)
+			break
+		}
+		buf.upload(req, attempts)
+	}
+
+	return nil
+}
+
+// Drops the reports held in the buffer, which happens when uploads are paused
+// as the collector is closed, and counts them as dropped. Must be called once
+// the buffer is no longer in use.
+func (buf *reportBuffer) dropHeld() {
+	if buf.UploadReportsRequest.IsEmpty() {
+		return
+	}
+	numReports := len(buf.Witnesses) + len(buf.TCPConnections) + len(buf.TLSHandshakes)
+	printer.Debugf("Dropping %d reports held while uploads to Postman were paused\n", numReports)
+	if breaker := buf.collector.breaker; breaker != nil {
+		breaker.recordDropped(numReports)
+	}
+	buf.UploadReportsRequest.Clear()
+}
+
+// Uploads a request to the back end, making up to the given number of
+// attempts while the breaker allows.
+func (buf *reportBuffer) upload(req *kgxapi.UploadReportsRequest, attempts int) {
+	breaker := buf.collector.breaker
+	for attempt := 1; ; attempt++ {
+		err := buf.uploadOnce(req)
+		if err == nil || attempt >= attempts {
+			return
+		}
+		if breaker != nil && !breaker.allow(time.Now()) {
+			return
+		}
+	}
+}
+
+// Uploads a request to the back end, and reports the outcome to the breaker.
+func (buf *reportBuffer) uploadOnce(req *kgxapi.UploadReportsRequest) error {
+	breaker := buf.collector.breaker
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := buf.collector.learnClient.AsyncReportsUpload(ctx, buf.collector.getLearnSession(), &buf.UploadReportsRequest)
+	session := buf.collector.getLearnSession()
+	err := buf.collector.learnClient.AsyncReportsUpload(ctx, session, req)
 	if err != nil {
+		var retryAfter time.Duration
 		switch e := err.(type) {
 		case rest.HTTPError:
+			retryAfter = e.RetryAfter
 			if e.StatusCode == http.StatusTooManyRequests {
 				// XXX Not all commands that call into this code have a --rate-limit
 				// option.
@@ -101,12 +188,58 @@ func (buf *reportBuffer) Flush() error {
 		}
 
 		printer.Warningf("Failed to upload to Postman: %v\n", err)
+		if breaker != nil {
+			breaker.recordFailure(time.Now(), retryAfter)
+		}
+		return err
+	} else if breaker != nil {
+		breaker.recordSuccess()
 	}
-	printer.Debugf("Uploaded %d witnesses, %d TCP connection reports, and %d TLS handshake reports\n", len(buf.Witnesses), len(buf.TCPConnections), len(buf.TLSHandshakes))
-
+	if rotation := buf.collector.rotation; rotation != nil {
+		rotation.recordUpload(session, len(req.Witnesses))
+	}
+	printer.Debugf("Uploaded %d witnesses, %d TCP connection reports, and %d TLS handshake reports\n", len(req.Witnesses), len(req.TCPConnections), len(req.TLSHandshakes))
 	return nil
 }
 
+// Splits a request into requests of at most maxSize_bytes each, without
+// splitting any report. A report larger than maxSize_bytes is sent in a
+// request of its own. Returns the original request if it is small enough.
+func splitUploadRequest(req *kgxapi.UploadReportsRequest, maxSize_bytes int) []*kgxapi.UploadReportsRequest {
+	if req.SizeInBytes() <= maxSize_bytes {
+		return []*kgxapi.UploadReportsRequest{req}
+	}
+
+	var result []*kgxapi.UploadReportsRequest
+	current := &kgxapi.UploadReportsRequest{ClientID: req.ClientID}
+
+	// Starts a new request if adding a report of the given size would make the
+	// current request too large.
+	makeRoom := func(size_bytes int) {
+		if !current.IsEmpty() && current.SizeInBytes()+size_bytes > maxSize_bytes {
+			result = append(result, current)
+			current = &kgxapi.UploadReportsRequest{ClientID: req.ClientID}
+		}
+	}
+
+	for _, r := range req.Witnesses {
+		makeRoom(r.SizeInBytes())
+		current.AddWitnessReport(r)
+	}
+	for _, r := range req.TCPConnections {
+		makeRoom(r.SizeInBytes())
+		current.AddTCPConnectionReport(r)
+	}
+	for _, r := range req.TLSHandshakes {
+		makeRoom(r.SizeInBytes())
+		current.AddTLSHandshakeReport(r)
+	}
+	if !current.IsEmpty() {
+		result = append(result, current)
+	}
+	return result
+}
+
 // Determines whether the buffer is at or beyond capacity.
 func (buf *reportBuffer) isFull() bool {
 	return buf.UploadReportsRequest.SizeInBytes() >= buf.maxSize_bytes
@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a witness report with a 1000-byte witness.
+func newSizedWitnessReport(id int) *kgxapi.WitnessReport {
+	return &kgxapi.WitnessReport{
+		WitnessProto: strings.Repeat(string(rune('a'+id%26)), 1000),
+	}
+}
+
+func TestSplitUploadRequest(t *testing.T) {
+	var req kgxapi.UploadReportsRequest
+	for i := 0; i < 10; i++ {
+		req.AddWitnessReport(newSizedWitnessReport(i))
+	}
+	req.AddTCPConnectionReport(&kgxapi.TCPConnectionReport{})
+	witnessSize := req.Witnesses[0].SizeInBytes()
+
+	// Room for three witnesses per request.
+	requests := splitUploadRequest(&req, 3*witnessSize+26)
+	if assert.Equal(t, 4, len(requests)) {
+		assert.Equal(t, 3, len(requests[0].Witnesses))
+		assert.Equal(t, 3, len(requests[1].Witnesses))
+		assert.Equal(t, 3, len(requests[2].Witnesses))
+		assert.Equal(t, 1, len(requests[3].Witnesses))
+		assert.Equal(t, 1, len(requests[3].TCPConnections))
+	}
+
+	// Every report is sent exactly once, in order.
+	var witnesses []*kgxapi.WitnessReport
+	for _, r := range requests {
+		witnesses = append(witnesses, r.Witnesses...)
+	}
+	assert.Equal(t, req.Witnesses, witnesses)
+
+	// A report larger than the limit is sent on its own rather than split.
+	requests = splitUploadRequest(&req, witnessSize/2)
+	assert.Equal(t, 11, len(requests))
+
+	// Small requests aren't split.
+	requests = splitUploadRequest(&req, req.SizeInBytes())
+	assert.Equal(t, []*kgxapi.UploadReportsRequest{&req}, requests)
+}
+
+// Only the failed request of a split batch is retried.
+func TestFlushSplitBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var uploaded [][]*kgxapi.WitnessReport
+	calls := 0
+	mockClient.EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_, _ interface{}, req *kgxapi.UploadReportsRequest) error {
+			calls += 1
+			if calls == 2 {
+				return errors.New("request too large")
+			}
+			uploaded = append(uploaded, append([]*kgxapi.WitnessReport(nil), req.Witnesses...))
+			return nil
+		}).
+		Times(4)
+
+	col := &BackendCollector{learnClient: mockClient}
+	buf := newReportBuffer(col, NewPacketCounter(), uploadBatchMaxSize_bytes, optionals.None[int]())
+	buf.maxRequestSize_bytes = optionals.Some(2*newSizedWitnessReport(0).SizeInBytes() + 26)
+	for i := 0; i < 6; i++ {
+		buf.UploadReportsRequest.AddWitnessReport(newSizedWitnessReport(i))
+	}
+	witnesses := append([]*kgxapi.WitnessReport(nil), buf.Witnesses...)
+
+	assert.NoError(t, buf.Flush())
+	assert.True(t, buf.UploadReportsRequest.IsEmpty())
+	assert.Equal(t, [][]*kgxapi.WitnessReport{
+		witnesses[0:2],
+		witnesses[2:4],
+		witnesses[4:6],
+	}, uploaded)
+}
+
+// Reports held while uploads are paused are counted as dropped when the
+// collector is closed.
+func TestCloseDropsHeldReports(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+	mockClient.
+		EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+
+	breaker := NewUploadCircuitBreaker(1, time.Hour)
+	assert.True(t, breaker.allow(time.Now()))
+	breaker.recordFailure(time.Now(), 0)
+
+	col := NewBackendCollector(fakeSvc, fakeLrn, mockClient, optionals.None[int](), NewPacketCounter(), nil)
+	col.(*BackendCollector).SetUploadCircuitBreaker(breaker)
+
+	req, resp := makeExchange(1, 200, time.Now())
+	assert.NoError(t, col.Process(req))
+	assert.NoError(t, col.Process(resp))
+	assert.NoError(t, col.Close())
+
+	assert.Equal(t, 1, breaker.Stats().DroppedReports)
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+)
+
+// Strips HTTP response bodies larger than a limit before they are parsed and
+// redacted, so that services streaming large payloads don't cost CPU only for
+// the witnesses to be dropped as oversized later. The response's status and
+// headers are kept, so it is still paired with its request. Requests are
+// unaffected. Shared by the collectors for all interfaces.
+type ResponseBodyLimit struct {
+	maxSize_bytes int64
+
+	// Number of response bodies stripped.
+	skipped int64
+}
+
+func NewResponseBodyLimit(maxSize_bytes int) *ResponseBodyLimit {
+	return &ResponseBodyLimit{maxSize_bytes: int64(maxSize_bytes)}
+}
+
+// Returns the number of response bodies stripped.
+func (l *ResponseBodyLimit) Skipped() int64 {
+	return atomic.LoadInt64(&l.skipped)
+}
+
+// Returns a collector that strips response bodies over the limit before
+// passing traffic to the given collector.
+func (l *ResponseBodyLimit) NewCollector(col Collector) Collector {
+	return &responseBodyLimitCollector{
+		limit:     l,
+		collector: col,
+	}
+}
+
+type responseBodyLimitCollector struct {
+	limit     *ResponseBodyLimit
+	collector Collector
+}
+
+func (c *responseBodyLimitCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if content, ok := t.Content.(akinet.HTTPResponse); ok && content.Body.Len() > c.limit.maxSize_bytes {
+		content.Body = memview.MemView{}
+		t.Content = content
+		atomic.AddInt64(&c.limit.skipped, 1)
+	}
+	return c.collector.Process(t)
+}
+
+func (c *responseBodyLimitCollector) Close() error {
+	return c.collector.Close()
+}
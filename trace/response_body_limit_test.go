@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseBodyLimit(t *testing.T) {
+	limit := NewResponseBodyLimit(9)
+	rec := &trafficRecorder{}
+	c := limit.NewCollector(rec)
+
+	// The request body is over the limit too, but only responses are affected.
+	req, resp := makeBodyExchange(uuid.New(), 1, time.Now())
+	large := resp.Content.(akinet.HTTPResponse)
+	large.Body = memview.New([]byte(`{"id": 1, "name": "prince"}`))
+	resp.Content = large
+	smallReq, smallResp := makeBodyExchange(uuid.New(), 1, time.Now())
+
+	for _, pnt := range []akinet.ParsedNetworkTraffic{req, resp, smallReq, smallResp} {
+		assert.NoError(t, c.Process(pnt))
+	}
+	assert.NoError(t, c.Close())
+	assert.True(t, rec.closed)
+
+	if assert.Len(t, rec.traffic, 4) {
+		assert.Equal(t, req, rec.traffic[0])
+		stripped := rec.traffic[1].Content.(akinet.HTTPResponse)
+		assert.Equal(t, int64(0), stripped.Body.Len())
+		assert.Equal(t, 200, stripped.StatusCode)
+		assert.Equal(t, smallResp, rec.traffic[3])
+	}
+	assert.Equal(t, int64(1), limit.Skipped())
+}
@@ -0,0 +1,138 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	. "github.com/akitasoftware/akita-libs/visitors"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+)
+
+// Path segments kept verbatim in schema-only mode. These are words, such as
+// resource names, and version prefixes like "v1". Any other segment may
+// contain an identifier or other value and is replaced with a parameter.
+var schemaOnlyKeptSegment = regexp.MustCompile(`^([A-Za-z_.-]+|v[0-9]+)$`)
+
+// Decides which witnesses are reduced to endpoint shapes before upload. The
+// first few witnesses of each combination of endpoint and response status are
+// kept as examples, with their obfuscated values; the rest are schema-only.
+// Shared by the backend collectors for all interfaces, so that the number of
+// examples is bounded across interfaces.
+type SchemaOnlyPolicy struct {
+	examplesPerEndpointStatus int
+
+	mu sync.Mutex
+
+	// Number of examples kept for each endpoint and status.
+	examples map[endpointStatus]int
+}
+
+// An endpoint, identified by its method, host, and schema-only path, together
+// with a response status. The status is 0 if there is no response.
+type endpointStatus struct {
+	method string
+	host   string
+	path   string
+	status int32
+}
+
+// Creates a policy that keeps the given number of examples for each endpoint
+// and response status. With no examples, every witness is schema-only.
+func NewSchemaOnlyPolicy(examplesPerEndpointStatus int) *SchemaOnlyPolicy {
+	return &SchemaOnlyPolicy{
+		examplesPerEndpointStatus: examplesPerEndpointStatus,
+		examples:                  map[endpointStatus]int{},
+	}
+}
+
+// Applies the policy to an obfuscated witness, either keeping it as an
+// example or reducing it to its shape. Returns true if the witness was
+// reduced.
+func (p *SchemaOnlyPolicy) apply(m *pb.Method) bool {
+	if p.keepExample(m) {
+		return false
+	}
+	stripToSchema(m)
+	return true
+}
+
+// Determines whether the given witness should be kept as an example, counting
+// it if so.
+func (p *SchemaOnlyPolicy) keepExample(m *pb.Method) bool {
+	if p.examplesPerEndpointStatus <= 0 {
+		return false
+	}
+
+	key := endpointStatus{status: responseStatus(m)}
+	if meta := spec_util.HTTPMetaFromMethod(m); meta != nil {
+		key.method = meta.Method
+		key.host = meta.Host
+		key.path = schemaOnlyPath(meta.PathTemplate)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, tracked := p.examples[key]
+	if n >= p.examplesPerEndpointStatus || (!tracked && len(p.examples) >= maxKeys) {
+		return false
+	}
+	p.examples[key] = n + 1
+	return true
+}
+
+// Returns the response status of the given witness, or 0 if it has no
+// response.
+func responseStatus(m *pb.Method) int32 {
+	for _, d := range m.GetResponses() {
+		if code := d.GetMeta().GetHttp().GetResponseCode(); code != 0 {
+			return code
+		}
+	}
+	return 0
+}
+
+// Reduces an obfuscated witness to the shape of the endpoint: its method,
+// host, path template, field names, and value types. In addition to the
+// primitive values zeroed by obfuscation, this replaces path segments that
+// might hold values with parameters and removes example values.
+func stripToSchema(m *pb.Method) {
+	var sv schemaOnlyVisitor
+	vis.Apply(&sv, m)
+
+	if meta := spec_util.HTTPMetaFromMethod(m); meta != nil {
+		meta.PathTemplate = schemaOnlyPath(meta.PathTemplate)
+	}
+}
+
+// Replaces each path segment that might hold a value with a parameter named
+// after the segment's position, as in "/v1/users/{arg3}".
+func schemaOnlyPath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if s == "" || schemaOnlyKeptSegment.MatchString(s) {
+			continue
+		}
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			// Already a parameter.
+			continue
+		}
+		segments[i] = fmt.Sprintf("{arg%d}", i)
+	}
+	return strings.Join(segments, "/")
+}
+
+type schemaOnlyVisitor struct {
+	vis.DefaultSpecVisitorImpl
+}
+
+var _ vis.DefaultSpecVisitor = (*schemaOnlyVisitor)(nil)
+
+func (*schemaOnlyVisitor) EnterData(self interface{}, ctx vis.SpecVisitorContext, d *pb.Data) Cont {
+	d.ExampleValues = nil
+	return Continue
+}
@@ -0,0 +1,242 @@
+package trace
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	vis "github.com/akitasoftware/akita-libs/visitors/http_rest"
+)
+
+// Maximum number of endpoints for which body shapes are tracked. Witnesses for
+// additional endpoints are counted as overflow.
+const maxShapeStatsEndpoints = 1000
+
+// The shape of a request or response body, as captured.
+type BodyShape struct {
+	// Number of primitive values in the body.
+	Fields int
+
+	// Greatest nesting depth of any primitive value, counting each object field
+	// and array element enclosing it. Values at the top level of a JSON object
+	// have depth 1.
+	MaxDepth int
+
+	// Number of elements in the longest array in the body.
+	MaxArrayLength int
+}
+
+// Adds the given body value to the shape of the body that contains it.
+func (s *BodyShape) add(ctx vis.SpecVisitorContext, d *pb.Data) {
+	switch v := d.GetValue().(type) {
+	case *pb.Data_Primitive:
+		s.Fields += 1
+		depth := 0
+		for _, elt := range ctx.GetFieldPath() {
+			if elt.IsFieldName() || elt.IsArrayElement() {
+				depth += 1
+			}
+		}
+		if depth > s.MaxDepth {
+			s.MaxDepth = depth
+		}
+	case *pb.Data_List:
+		if n := len(v.List.GetElems()); n > s.MaxArrayLength {
+			s.MaxArrayLength = n
+		}
+	}
+}
+
+type endpointShapes struct {
+	// Number of witnesses observed.
+	count int64
+
+	fields         sizeDistribution
+	maxDepth       int
+	maxArrayLength sizeDistribution
+}
+
+func (e *endpointShapes) add(shape BodyShape, rng *rand.Rand) {
+	e.fields.add(int64(shape.Fields), rng)
+	e.maxArrayLength.add(int64(shape.MaxArrayLength), rng)
+	if shape.MaxDepth > e.maxDepth {
+		e.maxDepth = shape.MaxDepth
+	}
+}
+
+// Body shape statistics for a single endpoint, combining request and response
+// bodies.
+type EndpointShapeSummary struct {
+	Method       string
+	Host         string
+	PathTemplate string
+
+	// Number of witnesses observed.
+	Count int64
+
+	// Number of primitive values per body.
+	AvgFields int64
+	P95Fields int64
+
+	// Greatest nesting depth seen in any body.
+	MaxDepth int
+
+	// Length of the longest array per body.
+	AvgMaxArrayLength int64
+	P95MaxArrayLength int64
+}
+
+// Body shape statistics aggregated across all endpoints, without identifying
+// any of them.
+type EndpointShapeTotals struct {
+	// Number of endpoints with bodies.
+	Endpoints int
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	Overflow int64
+
+	// The largest of each statistic across endpoints.
+	MaxAvgFields         int64
+	MaxP95Fields         int64
+	MaxDepth             int
+	MaxAvgMaxArrayLength int64
+	MaxP95MaxArrayLength int64
+}
+
+// Accumulates body shape metrics per endpoint, so that overly complex payloads
+// can be spotted. Safe for concurrent use. Implements WitnessSink so it can be
+// attached to a BackendCollector.
+//
+// Shapes are computed by the BackendCollector while it obfuscates each
+// witness, so this requires no further traversal of the witness.
+type EndpointShapeStats struct {
+	mutex sync.Mutex
+
+	endpoints map[endpointKey]*endpointShapes
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	overflow int64
+
+	rng *rand.Rand
+}
+
+var _ WitnessSink = (*EndpointShapeStats)(nil)
+
+func NewEndpointShapeStats() *EndpointShapeStats {
+	return &EndpointShapeStats{
+		endpoints: make(map[endpointKey]*endpointShapes),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *EndpointShapeStats) ExportWitness(w *pb.Witness, _ time.Time, info WitnessInfo) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return
+	}
+	s.Update(meta, info)
+}
+
+// Records the body shapes for a witness of the given endpoint. Bodies that
+// were not seen or are empty are ignored.
+func (s *EndpointShapeStats) Update(meta *pb.HTTPMethodMeta, info WitnessInfo) {
+	key := endpointKeyOfMeta(meta)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= maxShapeStatsEndpoints {
+			s.overflow += 1
+			return
+		}
+		e = &endpointShapes{}
+		s.endpoints[key] = e
+	}
+
+	e.count += 1
+	if info.Request_bytes > 0 {
+		e.add(info.RequestShape, s.rng)
+	}
+	if info.Response_bytes > 0 {
+		e.add(info.ResponseShape, s.rng)
+	}
+}
+
+// Returns the n endpoints with the most fields per body on average, most
+// first.
+func (s *EndpointShapeStats) TopN(n int) []EndpointShapeSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]EndpointShapeSummary, 0, len(s.endpoints))
+	for k, e := range s.endpoints {
+		if e.fields.count == 0 {
+			continue
+		}
+		result = append(result, EndpointShapeSummary{
+			Method:            k.Method,
+			Host:              k.Host,
+			PathTemplate:      k.PathTemplate,
+			Count:             e.count,
+			AvgFields:         e.fields.mean(),
+			P95Fields:         e.fields.percentile(95),
+			MaxDepth:          e.maxDepth,
+			AvgMaxArrayLength: e.maxArrayLength.mean(),
+			P95MaxArrayLength: e.maxArrayLength.percentile(95),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AvgFields != result[j].AvgFields {
+			return result[i].AvgFields > result[j].AvgFields
+		}
+		if result[i].MaxDepth != result[j].MaxDepth {
+			return result[i].MaxDepth > result[j].MaxDepth
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].PathTemplate != result[j].PathTemplate {
+			return result[i].PathTemplate < result[j].PathTemplate
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of witnesses that were not tracked because the endpoint
+// limit was reached.
+func (s *EndpointShapeStats) Overflow() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflow
+}
+
+// Returns statistics aggregated across all endpoints.
+func (s *EndpointShapeStats) Totals() EndpointShapeTotals {
+	all := s.TopN(maxShapeStatsEndpoints)
+	totals := EndpointShapeTotals{
+		Endpoints: len(all),
+		Overflow:  s.Overflow(),
+	}
+	for _, e := range all {
+		totals.MaxAvgFields = maxInt64(totals.MaxAvgFields, e.AvgFields)
+		totals.MaxP95Fields = maxInt64(totals.MaxP95Fields, e.P95Fields)
+		if e.MaxDepth > totals.MaxDepth {
+			totals.MaxDepth = e.MaxDepth
+		}
+		totals.MaxAvgMaxArrayLength = maxInt64(totals.MaxAvgMaxArrayLength, e.AvgMaxArrayLength)
+		totals.MaxP95MaxArrayLength = maxInt64(totals.MaxP95MaxArrayLength, e.P95MaxArrayLength)
+	}
+	return totals
+}
@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/akitasoftware/akita-libs/memview"
+	"github.com/google/uuid"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+	"github.com/stretchr/testify/assert"
+)
+
+const shapeTestBody = `{
+	"id": 1,
+	"owner": {"name": "prince", "tags": ["good", "boy", "fluffy"]},
+	"toys": [{"name": "ball", "squeaks": true}]
+}`
+
+func TestObfuscateBodyShape(t *testing.T) {
+	partial, err := learn.ParseHTTP(akinet.HTTPRequest{
+		StreamID: uuid.New(),
+		Seq:      1,
+		Method:   "POST",
+		URL:      &url.URL{Path: "/v1/doggos"},
+		Host:     "example.com",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"X-Request-Id": {"abc"},
+		},
+		Body: memview.New([]byte(shapeTestBody)),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	request, response := obfuscate(partial.Witness.Method)
+
+	// Headers are not counted.
+	assert.Equal(t, BodyShape{Fields: 7, MaxDepth: 3, MaxArrayLength: 3}, request)
+	assert.Equal(t, BodyShape{}, response)
+}
+
+func TestEndpointShapeStats(t *testing.T) {
+	simple := &pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/simple"}
+	complex := &pb.HTTPMethodMeta{Method: "POST", Host: "example.com", PathTemplate: "/v1/complex"}
+
+	stats := NewEndpointShapeStats()
+	for i := 1; i <= 100; i++ {
+		stats.Update(simple, WitnessInfo{
+			Request_bytes:  0,
+			Response_bytes: 10,
+			ResponseShape:  BodyShape{Fields: 2, MaxDepth: 1},
+		})
+		stats.Update(complex, WitnessInfo{
+			Request_bytes:  100,
+			Response_bytes: -1,
+			RequestShape:   BodyShape{Fields: i, MaxDepth: i % 7, MaxArrayLength: i},
+		})
+	}
+
+	assert.Equal(t, []EndpointShapeSummary{
+		{
+			Method:            "POST",
+			Host:              "example.com",
+			PathTemplate:      "/v1/complex",
+			Count:             100,
+			AvgFields:         50,
+			P95Fields:         95,
+			MaxDepth:          6,
+			AvgMaxArrayLength: 50,
+			P95MaxArrayLength: 95,
+		},
+		{
+			Method:       "GET",
+			Host:         "example.com",
+			PathTemplate: "/v1/simple",
+			Count:        100,
+			AvgFields:    2,
+			P95Fields:    2,
+			MaxDepth:     1,
+		},
+	}, stats.TopN(10))
+
+	// Witnesses without HTTP metadata are ignored.
+	stats.ExportWitness(&pb.Witness{Method: &pb.Method{}}, time.Now(), WitnessInfo{})
+	assert.Len(t, stats.TopN(10), 2)
+	assert.Equal(t, int64(0), stats.Overflow())
+
+	assert.Equal(t, EndpointShapeTotals{
+		Endpoints:            2,
+		MaxAvgFields:         50,
+		MaxP95Fields:         95,
+		MaxDepth:             6,
+		MaxAvgMaxArrayLength: 50,
+		MaxP95MaxArrayLength: 95,
+	}, stats.Totals())
+}
+
+func TestEndpointShapeStatsTemplatesPaths(t *testing.T) {
+	stats := NewEndpointShapeStats()
+	for _, path := range []string{"/v1/users/123", "/v1/users/456"} {
+		stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: path}, WitnessInfo{
+			Request_bytes:  0,
+			Response_bytes: 10,
+			ResponseShape:  BodyShape{Fields: 2, MaxDepth: 1},
+		})
+	}
+
+	top := stats.TopN(10)
+	if assert.Equal(t, 1, len(top)) {
+		assert.Equal(t, "/v1/users/{arg3}", top[0].PathTemplate)
+		assert.Equal(t, int64(2), top[0].Count)
+	}
+}
@@ -0,0 +1,242 @@
+package trace
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+)
+
+const (
+	// Maximum number of endpoints for which body sizes are tracked. Witnesses
+	// for additional endpoints are counted as overflow.
+	maxSizeStatsEndpoints = 1000
+
+	// Number of body sizes retained per endpoint to estimate percentiles.
+	sizeSampleReservoirSize = 256
+)
+
+type endpointKey struct {
+	Method       string
+	Host         string
+	PathTemplate string
+}
+
+// Distribution of body sizes. Keeps the total for computing the mean, and a
+// uniform sample of the observed sizes for estimating percentiles.
+type sizeDistribution struct {
+	count   int64
+	total   int64
+	samples []int64
+}
+
+func (d *sizeDistribution) add(size_bytes int64, rng *rand.Rand) {
+	d.count += 1
+	d.total += size_bytes
+
+	// Reservoir sampling.
+	if len(d.samples) < sizeSampleReservoirSize {
+		d.samples = append(d.samples, size_bytes)
+	} else if i := rng.Int63n(d.count); i < sizeSampleReservoirSize {
+		d.samples[i] = size_bytes
+	}
+}
+
+func (d *sizeDistribution) mean() int64 {
+	if d.count == 0 {
+		return 0
+	}
+	return d.total / d.count
+}
+
+// Returns the p-th percentile (0 < p <= 100) of the sampled sizes, using the
+// nearest-rank method.
+func (d *sizeDistribution) percentile(p float64) int64 {
+	if len(d.samples) == 0 {
+		return 0
+	}
+	sorted := make([]int64, len(d.samples))
+	copy(sorted, d.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p/100.0*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type endpointSizes struct {
+	request  sizeDistribution
+	response sizeDistribution
+}
+
+// Size statistics for a single endpoint.
+type EndpointSizeSummary struct {
+	Method       string
+	Host         string
+	PathTemplate string
+
+	// Number of witnesses observed.
+	Count int64
+
+	AvgRequest_bytes  int64
+	P95Request_bytes  int64
+	AvgResponse_bytes int64
+	P95Response_bytes int64
+}
+
+// Size statistics aggregated across all endpoints, without identifying any of
+// them.
+type EndpointSizeTotals struct {
+	// Number of endpoints tracked.
+	Endpoints int
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	Overflow int64
+
+	// The largest of each statistic across endpoints.
+	MaxAvgRequest_bytes  int64
+	MaxP95Request_bytes  int64
+	MaxAvgResponse_bytes int64
+	MaxP95Response_bytes int64
+}
+
+// Accumulates request and response body sizes per endpoint. Safe for
+// concurrent use. Implements WitnessSink so it can be attached to a
+// BackendCollector.
+type EndpointSizeStats struct {
+	mutex sync.Mutex
+
+	endpoints map[endpointKey]*endpointSizes
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	overflow int64
+
+	rng *rand.Rand
+}
+
+var _ WitnessSink = (*EndpointSizeStats)(nil)
+
+func NewEndpointSizeStats() *EndpointSizeStats {
+	return &EndpointSizeStats{
+		endpoints: make(map[endpointKey]*endpointSizes),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *EndpointSizeStats) ExportWitness(w *pb.Witness, _ time.Time, info WitnessInfo) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return
+	}
+	s.Update(meta, info)
+}
+
+// Records the body sizes for a witness of the given endpoint. Negative sizes
+// are ignored.
+func (s *EndpointSizeStats) Update(meta *pb.HTTPMethodMeta, info WitnessInfo) {
+	key := endpointKeyOfMeta(meta)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= maxSizeStatsEndpoints {
+			s.overflow += 1
+			return
+		}
+		e = &endpointSizes{}
+		s.endpoints[key] = e
+	}
+
+	if info.Request_bytes >= 0 {
+		e.request.add(info.Request_bytes, s.rng)
+	}
+	if info.Response_bytes >= 0 {
+		e.response.add(info.Response_bytes, s.rng)
+	}
+}
+
+// Returns the n endpoints with the largest average combined request and
+// response body size, largest first.
+func (s *EndpointSizeStats) TopN(n int) []EndpointSizeSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]EndpointSizeSummary, 0, len(s.endpoints))
+	for k, e := range s.endpoints {
+		count := e.request.count
+		if e.response.count > count {
+			count = e.response.count
+		}
+		result = append(result, EndpointSizeSummary{
+			Method:            k.Method,
+			Host:              k.Host,
+			PathTemplate:      k.PathTemplate,
+			Count:             count,
+			AvgRequest_bytes:  e.request.mean(),
+			P95Request_bytes:  e.request.percentile(95),
+			AvgResponse_bytes: e.response.mean(),
+			P95Response_bytes: e.response.percentile(95),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ti := result[i].AvgRequest_bytes + result[i].AvgResponse_bytes
+		tj := result[j].AvgRequest_bytes + result[j].AvgResponse_bytes
+		if ti != tj {
+			return ti > tj
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].PathTemplate != result[j].PathTemplate {
+			return result[i].PathTemplate < result[j].PathTemplate
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of witnesses that were not tracked because the endpoint
+// limit was reached.
+func (s *EndpointSizeStats) Overflow() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflow
+}
+
+// Returns statistics aggregated across all endpoints.
+func (s *EndpointSizeStats) Totals() EndpointSizeTotals {
+	all := s.TopN(maxSizeStatsEndpoints)
+	totals := EndpointSizeTotals{
+		Endpoints: len(all),
+		Overflow:  s.Overflow(),
+	}
+	for _, e := range all {
+		totals.MaxAvgRequest_bytes = maxInt64(totals.MaxAvgRequest_bytes, e.AvgRequest_bytes)
+		totals.MaxP95Request_bytes = maxInt64(totals.MaxP95Request_bytes, e.P95Request_bytes)
+		totals.MaxAvgResponse_bytes = maxInt64(totals.MaxAvgResponse_bytes, e.AvgResponse_bytes)
+		totals.MaxP95Response_bytes = maxInt64(totals.MaxP95Response_bytes, e.P95Response_bytes)
+	}
+	return totals
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointSizeStats(t *testing.T) {
+	small := &pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/small"}
+	large := &pb.HTTPMethodMeta{Method: "POST", Host: "example.com", PathTemplate: "/v1/large"}
+
+	stats := NewEndpointSizeStats()
+
+	// Update concurrently to exercise locking.
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(2)
+		go func(i int64) {
+			defer wg.Done()
+			stats.Update(small, WitnessInfo{Request_bytes: 0, Response_bytes: i})
+		}(int64(i))
+		go func(i int64) {
+			defer wg.Done()
+			stats.Update(large, WitnessInfo{Request_bytes: 1000 * i, Response_bytes: -1})
+		}(int64(i))
+	}
+	wg.Wait()
+
+	top := stats.TopN(10)
+	assert.Equal(t, []EndpointSizeSummary{
+		{
+			Method:            "POST",
+			Host:              "example.com",
+			PathTemplate:      "/v1/large",
+			Count:             100,
+			AvgRequest_bytes:  50500,
+			P95Request_bytes:  95000,
+			AvgResponse_bytes: 0,
+			P95Response_bytes: 0,
+		},
+		{
+			Method:            "GET",
+			Host:              "example.com",
+			PathTemplate:      "/v1/small",
+			Count:             100,
+			AvgRequest_bytes:  0,
+			P95Request_bytes:  0,
+			AvgResponse_bytes: 50,
+			P95Response_bytes: 95,
+		},
+	}, top)
+
+	assert.Equal(t, 1, len(stats.TopN(1)))
+	assert.Equal(t, int64(0), stats.Overflow())
+
+	assert.Equal(t, EndpointSizeTotals{
+		Endpoints:            2,
+		MaxAvgRequest_bytes:  50500,
+		MaxP95Request_bytes:  95000,
+		MaxAvgResponse_bytes: 50,
+		MaxP95Response_bytes: 95,
+	}, stats.Totals())
+}
+
+func TestEndpointSizeStatsTemplatesPaths(t *testing.T) {
+	stats := NewEndpointSizeStats()
+	stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/users/123"}, WitnessInfo{Request_bytes: 0, Response_bytes: 10})
+	stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: "example.com", PathTemplate: "/v1/users/456"}, WitnessInfo{Request_bytes: 0, Response_bytes: 30})
+
+	top := stats.TopN(10)
+	if assert.Equal(t, 1, len(top)) {
+		assert.Equal(t, "/v1/users/{arg3}", top[0].PathTemplate)
+		assert.Equal(t, int64(2), top[0].Count)
+		assert.Equal(t, int64(20), top[0].AvgResponse_bytes)
+	}
+}
+
+func TestEndpointSizeStatsOverflow(t *testing.T) {
+	stats := NewEndpointSizeStats()
+	for i := 0; i < maxSizeStatsEndpoints+5; i++ {
+		stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: fmt.Sprintf("host%d.example.com", i), PathTemplate: "/v1/orders"}, WitnessInfo{Request_bytes: 1, Response_bytes: 1})
+	}
+	assert.Equal(t, maxSizeStatsEndpoints, len(stats.TopN(2*maxSizeStatsEndpoints)))
+	assert.Equal(t, int64(5), stats.Overflow())
+	assert.Equal(t, int64(5), stats.Totals().Overflow)
+}
@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"regexp"
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// Keeps TLS handshake reports only for connections whose SNI hostname matches
+// an allowlist and doesn't match an exclusion list, and counts the reports
+// excluded. Other traffic is unaffected. Shared by the collectors for all
+// interfaces.
+type SNIFilter struct {
+	// If non-empty, only hostnames matching one of these are kept. Handshakes
+	// without an SNI hostname are excluded.
+	allowlist []*regexp.Regexp
+
+	// Hostnames matching any of these are excluded.
+	exclusions []*regexp.Regexp
+
+	excluded int64
+}
+
+func NewSNIFilter(allowlist, exclusions []*regexp.Regexp) *SNIFilter {
+	return &SNIFilter{
+		allowlist:  allowlist,
+		exclusions: exclusions,
+	}
+}
+
+// Determines whether the handshake report should be kept.
+func (f *SNIFilter) allows(tls akinet.TLSHandshakeMetadata) bool {
+	if tls.SNIHostname == nil {
+		return len(f.allowlist) == 0
+	}
+	hostname := *tls.SNIHostname
+
+	for _, m := range f.exclusions {
+		if m.MatchString(hostname) {
+			return false
+		}
+	}
+
+	if len(f.allowlist) == 0 {
+		return true
+	}
+	for _, m := range f.allowlist {
+		if m.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the number of TLS handshake reports excluded.
+func (f *SNIFilter) Excluded() int64 {
+	return atomic.LoadInt64(&f.excluded)
+}
+
+// Returns a collector that drops excluded TLS handshake reports before
+// passing traffic to the given collector.
+func (f *SNIFilter) NewCollector(col Collector) Collector {
+	return &sniFilterCollector{
+		filter:    f,
+		collector: col,
+	}
+}
+
+type sniFilterCollector struct {
+	filter    *SNIFilter
+	collector Collector
+}
+
+func (c *sniFilterCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if tls, ok := t.Content.(akinet.TLSHandshakeMetadata); ok && !c.filter.allows(tls) {
+		atomic.AddInt64(&c.filter.excluded, 1)
+		return nil
+	}
+	return c.collector.Process(t)
+}
+
+func (c *sniFilterCollector) Close() error {
+	return c.collector.Close()
+}
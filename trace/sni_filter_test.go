@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTLSHandshake(sni string) akinet.ParsedNetworkTraffic {
+	tls := akinet.TLSHandshakeMetadata{}
+	if sni != "" {
+		tls.SNIHostname = &sni
+	}
+	return akinet.ParsedNetworkTraffic{Content: tls}
+}
+
+func TestSNIFilter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		allowlist  []*regexp.Regexp
+		exclusions []*regexp.Regexp
+		kept       []string
+		excluded   []string
+	}{
+		{
+			name:      "allow",
+			allowlist: []*regexp.Regexp{regexp.MustCompile(`\.example\.com$`)},
+			kept:      []string{"api.example.com"},
+			excluded:  []string{"tracker.ads.net", ""},
+		},
+		{
+			name:       "exclude",
+			exclusions: []*regexp.Regexp{regexp.MustCompile(`^telemetry\.`)},
+			kept:       []string{"api.example.com", ""},
+			excluded:   []string{"telemetry.example.com"},
+		},
+		{
+			name:       "exclusion overrides allow",
+			allowlist:  []*regexp.Regexp{regexp.MustCompile(`\.example\.com$`)},
+			exclusions: []*regexp.Regexp{regexp.MustCompile(`^telemetry\.`)},
+			kept:       []string{"api.example.com"},
+			excluded:   []string{"telemetry.example.com", "tracker.ads.net"},
+		},
+	}
+
+	for _, tc := range testCases {
+		filter := NewSNIFilter(tc.allowlist, tc.exclusions)
+		rec := &trafficRecorder{}
+		c := filter.NewCollector(rec)
+
+		var expected []akinet.ParsedNetworkTraffic
+		for _, sni := range tc.kept {
+			p := makeTLSHandshake(sni)
+			assert.NoError(t, c.Process(p), tc.name)
+			expected = append(expected, p)
+		}
+		for _, sni := range tc.excluded {
+			assert.NoError(t, c.Process(makeTLSHandshake(sni)), tc.name)
+		}
+
+		// Other traffic is unaffected.
+		tcp := akinet.ParsedNetworkTraffic{Content: akinet.TCPConnectionMetadata{}}
+		assert.NoError(t, c.Process(tcp), tc.name)
+		expected = append(expected, tcp)
+
+		assert.Equal(t, expected, rec.traffic, tc.name)
+		assert.Equal(t, int64(len(tc.excluded)), filter.Excluded(), tc.name)
+	}
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+)
+
+// File extensions of static assets that are dropped by default. Requests for
+// these rarely matter for API analysis and clutter traces.
+var DefaultStaticExtensions = []string{
+	".js", ".mjs", ".css", ".map",
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp", ".avif",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+}
+
+// Drops requests whose path ends in one of a set of file extensions, along
+// with their responses, and counts the requests dropped. Shared by the
+// collectors for all interfaces.
+type StaticAssetFilter struct {
+	// Lower-case extensions, each including the leading dot.
+	extensions map[string]struct{}
+
+	dropped int64
+}
+
+// Creates a filter for the given extensions, which are matched
+// case-insensitively. A leading dot is optional.
+func NewStaticAssetFilter(extensions []string) *StaticAssetFilter {
+	f := &StaticAssetFilter{
+		extensions: make(map[string]struct{}, len(extensions)),
+	}
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		f.extensions[ext] = struct{}{}
+	}
+	return f
+}
+
+// Determines whether the request is for a static asset. The query string is
+// not part of the path, so "/app.js?v=3" is a static asset.
+func (f *StaticAssetFilter) isStaticAsset(r akinet.HTTPRequest) bool {
+	if r.URL == nil {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(normalizedPath(r.URL)))
+	if ext == "" {
+		return false
+	}
+	_, ok := f.extensions[ext]
+	return ok
+}
+
+// Returns the number of static-asset requests dropped.
+func (f *StaticAssetFilter) Dropped() int64 {
+	return atomic.LoadInt64(&f.dropped)
+}
+
+// Returns a collector that drops static-asset requests, and their responses,
+// before passing traffic to the given collector.
+func (f *StaticAssetFilter) NewCollector(col Collector) Collector {
+	return &genericRequestFilter{
+		Collector: col,
+		filterFunc: func(r akinet.HTTPRequest) bool {
+			if f.isStaticAsset(r) {
+				atomic.AddInt64(&f.dropped, 1)
+				return false
+			}
+			return true
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticAssetFilter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rawPath string
+
+		// Whether the request is dropped as a static asset.
+		expectDropped bool
+	}{
+		{"script", "/static/app.js", true},
+		{"stylesheet", "/static/site.css", true},
+		{"image", "/img/logo.png", true},
+		{"font", "/fonts/inter.woff", true},
+		{"upper case", "/img/LOGO.PNG", true},
+		{"query string", "/static/app.js?v=3", true},
+		{"query string with dot", "/static/app.js?file=data.json", true},
+		{"encoded", "/static/app%2Ejs", true},
+		{"api", "/v1/users/123", false},
+		{"json", "/v1/users.json", false},
+		{"extension in query only", "/v1/render?template=page.css", false},
+		{"extension in directory", "/assets.js/list", false},
+		{"trailing slash", "/static/app.js/", false},
+		{"root", "/", false},
+	}
+
+	for _, tc := range testCases {
+		u, err := url.ParseRequestURI(tc.rawPath)
+		if !assert.NoError(t, err, "["+tc.name+"]") {
+			continue
+		}
+		id := uuid.New()
+		req := akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPRequest{
+				StreamID: id,
+				Seq:      1,
+				Method:   "GET",
+				URL:      u,
+				Host:     "example.com",
+			},
+		}
+		resp := akinet.ParsedNetworkTraffic{
+			Content: akinet.HTTPResponse{
+				StreamID:   id,
+				Seq:        1,
+				StatusCode: 200,
+			},
+		}
+
+		filter := NewStaticAssetFilter(DefaultStaticExtensions)
+		next := &countingCollector{}
+		col := filter.NewCollector(next)
+		assert.NoError(t, col.Process(req), "["+tc.name+"]")
+		assert.NoError(t, col.Process(resp), "["+tc.name+"]")
+
+		if tc.expectDropped {
+			assert.Equal(t, 0, next.GetNumPackets(), "["+tc.name+"]")
+			assert.Equal(t, int64(1), filter.Dropped(), "["+tc.name+"]")
+		} else {
+			assert.Equal(t, 2, next.GetNumPackets(), "["+tc.name+"]")
+			assert.Equal(t, int64(0), filter.Dropped(), "["+tc.name+"]")
+		}
+	}
+}
+
+func TestStaticAssetFilterExtensions(t *testing.T) {
+	// Leading dots are optional and case is ignored.
+	filter := NewStaticAssetFilter([]string{"PDF", ".Txt", " ", ""})
+
+	for rawPath, expected := range map[string]bool{
+		"/docs/manual.pdf": true,
+		"/docs/notes.TXT":  true,
+		"/static/app.js":   false,
+		"/docs/manual":     false,
+	} {
+		u, err := url.ParseRequestURI(rawPath)
+		if assert.NoError(t, err, rawPath) {
+			assert.Equal(t, expected, filter.isStaticAsset(akinet.HTTPRequest{URL: u}), rawPath)
+		}
+	}
+
+	// With no extensions, nothing is a static asset.
+	u, _ := url.ParseRequestURI("/static/app.js")
+	assert.False(t, NewStaticAssetFilter(nil).isStaticAsset(akinet.HTTPRequest{URL: u}))
+}
@@ -0,0 +1,144 @@
+package trace
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+)
+
+// Maximum number of endpoints for which response statuses are tracked.
+// Witnesses for additional endpoints are counted as overflow. The number of
+// statuses per endpoint is bounded by the range of HTTP status codes.
+const maxStatusStatsEndpoints = 1000
+
+// Number of witnesses with a given response status. A status of 0 means the
+// witness has no response.
+type StatusCount struct {
+	Status int32
+	Count  int64
+}
+
+// Distribution of response statuses for a single endpoint.
+type EndpointStatusSummary struct {
+	Method       string
+	Host         string
+	PathTemplate string
+
+	// Number of witnesses observed.
+	Count int64
+
+	// Most frequent status first.
+	Statuses []StatusCount
+}
+
+// Returns the fraction of witnesses with the given count.
+func (s EndpointStatusSummary) Fraction(c StatusCount) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(c.Count) / float64(s.Count)
+}
+
+// Counts response statuses per endpoint. Safe for concurrent use. Implements
+// WitnessSink so it can be attached to a BackendCollector.
+type EndpointStatusStats struct {
+	mutex sync.Mutex
+
+	endpoints map[endpointKey]map[int32]int64
+
+	// Number of witnesses not tracked because there were too many endpoints.
+	overflow int64
+}
+
+var _ WitnessSink = (*EndpointStatusStats)(nil)
+
+func NewEndpointStatusStats() *EndpointStatusStats {
+	return &EndpointStatusStats{
+		endpoints: make(map[endpointKey]map[int32]int64),
+	}
+}
+
+func (s *EndpointStatusStats) ExportWitness(w *pb.Witness, _ time.Time, _ WitnessInfo) {
+	meta := spec_util.HTTPMetaFromMethod(w.GetMethod())
+	if meta == nil {
+		return
+	}
+	s.Update(meta, responseStatus(w.GetMethod()))
+}
+
+// Records a witness of the given endpoint with the given response status, or
+// 0 if the witness has no response.
+func (s *EndpointStatusStats) Update(meta *pb.HTTPMethodMeta, status int32) {
+	key := endpointKeyOfMeta(meta)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= maxStatusStatsEndpoints {
+			s.overflow += 1
+			return
+		}
+		statuses = make(map[int32]int64)
+		s.endpoints[key] = statuses
+	}
+	statuses[status] += 1
+}
+
+// Returns the n endpoints with the most witnesses, busiest first.
+func (s *EndpointStatusStats) TopN(n int) []EndpointStatusSummary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]EndpointStatusSummary, 0, len(s.endpoints))
+	for k, statuses := range s.endpoints {
+		e := EndpointStatusSummary{
+			Method:       k.Method,
+			Host:         k.Host,
+			PathTemplate: k.PathTemplate,
+			Statuses:     make([]StatusCount, 0, len(statuses)),
+		}
+		for status, count := range statuses {
+			e.Count += count
+			e.Statuses = append(e.Statuses, StatusCount{Status: status, Count: count})
+		}
+		sort.Slice(e.Statuses, func(i, j int) bool {
+			if e.Statuses[i].Count != e.Statuses[j].Count {
+				return e.Statuses[i].Count > e.Statuses[j].Count
+			}
+			return e.Statuses[i].Status < e.Statuses[j].Status
+		})
+		result = append(result, e)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		// Break ties deterministically.
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		if result[i].PathTemplate != result[j].PathTemplate {
+			return result[i].PathTemplate < result[j].PathTemplate
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Returns the number of witnesses that were not tracked because the endpoint
+// limit was reached.
+func (s *EndpointStatusStats) Overflow() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflow
+}
@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/akitasoftware/akita-ir/go/api_spec"
+	"github.com/akitasoftware/akita-libs/spec_util"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a witness for the given endpoint with the given response status, or
+// with no response if the status is 0.
+func newStatusTestWitness(method, path string, status int) *pb.Witness {
+	m := &pb.Method{
+		Responses: map[string]*pb.Data{},
+		Meta: &pb.MethodMeta{
+			Meta: &pb.MethodMeta_Http{
+				Http: &pb.HTTPMethodMeta{
+					Method:       method,
+					PathTemplate: path,
+					Host:         "example.com",
+				},
+			},
+		},
+	}
+	if status != 0 {
+		m.Responses["body"] = newTestBodySpecFromData(status, pb.HTTPBody_JSON, "application/json",
+			dataFromPrimitive(spec_util.NewPrimitiveString("")))
+	}
+	return &pb.Witness{Method: m}
+}
+
+func TestEndpointStatusStats(t *testing.T) {
+	stats := NewEndpointStatusStats()
+
+	// POST /v1/orders: 80% 200, 15% 422, 5% 500.
+	// GET /v1/orders: 10 calls, 9 with 200 and 1 without a response.
+	var witnesses []*pb.Witness
+	for i := 0; i < 20; i++ {
+		status := 200
+		if i < 1 {
+			status = 500
+		} else if i < 4 {
+			status = 422
+		}
+		witnesses = append(witnesses, newStatusTestWitness("POST", "/v1/orders", status))
+	}
+	for i := 0; i < 10; i++ {
+		status := 200
+		if i == 0 {
+			status = 0
+		}
+		witnesses = append(witnesses, newStatusTestWitness("GET", "/v1/orders", status))
+	}
+
+	// Export concurrently to exercise locking.
+	var wg sync.WaitGroup
+	for _, w := range witnesses {
+		wg.Add(1)
+		go func(w *pb.Witness) {
+			defer wg.Done()
+			stats.ExportWitness(w, time.Now(), WitnessInfo{})
+		}(w)
+	}
+	wg.Wait()
+
+	top := stats.TopN(10)
+	assert.Equal(t, []EndpointStatusSummary{
+		{
+			Method:       "POST",
+			Host:         "example.com",
+			PathTemplate: "/v1/orders",
+			Count:        20,
+			Statuses: []StatusCount{
+				{Status: 200, Count: 16},
+				{Status: 422, Count: 3},
+				{Status: 500, Count: 1},
+			},
+		},
+		{
+			Method:       "GET",
+			Host:         "example.com",
+			PathTemplate: "/v1/orders",
+			Count:        10,
+			Statuses: []StatusCount{
+				{Status: 200, Count: 9},
+				{Status: 0, Count: 1},
+			},
+		},
+	}, top)
+
+	assert.InDelta(t, 0.80, top[0].Fraction(top[0].Statuses[0]), 1e-9)
+	assert.InDelta(t, 0.15, top[0].Fraction(top[0].Statuses[1]), 1e-9)
+	assert.InDelta(t, 0.05, top[0].Fraction(top[0].Statuses[2]), 1e-9)
+
+	assert.Equal(t, 1, len(stats.TopN(1)))
+	assert.Equal(t, int64(0), stats.Overflow())
+}
+
+func TestEndpointStatusStatsTemplatesPaths(t *testing.T) {
+	stats := NewEndpointStatusStats()
+	stats.ExportWitness(newStatusTestWitness("POST", "/orders/17", 201), time.Now(), WitnessInfo{})
+	stats.ExportWitness(newStatusTestWitness("POST", "/orders/18", 409), time.Now(), WitnessInfo{})
+
+	top := stats.TopN(10)
+	if assert.Equal(t, 1, len(top)) {
+		assert.Equal(t, "/orders/{arg2}", top[0].PathTemplate)
+		assert.Equal(t, int64(2), top[0].Count)
+	}
+}
+
+func TestEndpointStatusStatsOverflow(t *testing.T) {
+	stats := NewEndpointStatusStats()
+	for i := 0; i < maxStatusStatsEndpoints+5; i++ {
+		stats.Update(&pb.HTTPMethodMeta{Method: "GET", Host: fmt.Sprintf("host%d.example.com", i), PathTemplate: "/v1/orders"}, 200)
+	}
+	assert.Equal(t, maxStatusStatsEndpoints, len(stats.TopN(2*maxStatusStatsEndpoints)))
+	assert.Equal(t, int64(5), stats.Overflow())
+}
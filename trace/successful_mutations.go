@@ -0,0 +1,164 @@
+package trace
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// HTTP methods that change a resource.
+var mutatingMethods = map[string]struct{}{
+	http.MethodPost:   {},
+	http.MethodPut:    {},
+	http.MethodPatch:  {},
+	http.MethodDelete: {},
+}
+
+// Keeps only HTTP exchanges that changed a resource: POST, PUT, PATCH, and
+// DELETE requests with a 2xx response. Other exchanges are dropped and
+// counted. Shared by the collectors for all interfaces.
+type SuccessfulMutationFilter struct {
+	dropped int64
+}
+
+func NewSuccessfulMutationFilter() *SuccessfulMutationFilter {
+	return &SuccessfulMutationFilter{}
+}
+
+// Returns the number of HTTP exchanges dropped.
+func (f *SuccessfulMutationFilter) Dropped() int64 {
+	return atomic.LoadInt64(&f.dropped)
+}
+
+func (f *SuccessfulMutationFilter) drop() {
+	atomic.AddInt64(&f.dropped, 1)
+}
+
+// Returns a collector that passes only successful mutations, and non-HTTP
+// traffic, to the given collector.
+//
+// Mutating requests are held until the corresponding response arrives, so
+// that the decision can be made when the status is known. Requests whose
+// response does not arrive within pendingRequestExpiration are dropped.
+func (f *SuccessfulMutationFilter) NewCollector(col Collector) Collector {
+	return &successfulMutationCollector{
+		filter:          f,
+		collector:       col,
+		pendingRequests: map[akid.WitnessID]akinet.ParsedNetworkTraffic{},
+		droppedRequests: map[akid.WitnessID]time.Time{},
+	}
+}
+
+type successfulMutationCollector struct {
+	filter    *SuccessfulMutationFilter
+	collector Collector
+
+	// Protects the fields below. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mutex sync.Mutex
+
+	// Mutating requests waiting for their response.
+	pendingRequests map[akid.WitnessID]akinet.ParsedNetworkTraffic
+
+	// Observation times of dropped requests, so that their responses are
+	// dropped without being counted again.
+	droppedRequests map[akid.WitnessID]time.Time
+
+	// Observation time of the most recent packet, and the time at which held
+	// and dropped requests were last checked for expiration.
+	latestObservation time.Time
+	lastSweep         time.Time
+}
+
+func (c *successfulMutationCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t.ObservationTime.After(c.latestObservation) {
+		c.latestObservation = t.ObservationTime
+	}
+	c.expireRequests()
+
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		id := learn.ToWitnessID(content.StreamID, content.Seq)
+		if _, mutating := mutatingMethods[content.Method]; !mutating {
+			c.droppedRequests[id] = t.ObservationTime
+			c.filter.drop()
+			return nil
+		}
+
+		// The request's buffers are released once Process returns, so hold a
+		// copy of the request instead.
+		held := t
+		held.Content = copyHTTPRequest(content)
+		c.pendingRequests[id] = held
+		return nil
+
+	case akinet.HTTPResponse:
+		id := learn.ToWitnessID(content.StreamID, content.Seq)
+		if _, dropped := c.droppedRequests[id]; dropped {
+			delete(c.droppedRequests, id)
+			return nil
+		}
+
+		req, hasRequest := c.pendingRequests[id]
+		delete(c.pendingRequests, id)
+
+		// Without the request, the method is unknown.
+		if !hasRequest || content.StatusCode < 200 || content.StatusCode >= 300 {
+			c.filter.drop()
+			return nil
+		}
+
+		if err := c.collector.Process(req); err != nil {
+			return err
+		}
+		return c.collector.Process(t)
+
+	default:
+		return c.collector.Process(t)
+	}
+}
+
+// Drops held requests that have waited too long for their response, and
+// forgets dropped requests whose response never arrived. Must be called with
+// the mutex held.
+func (c *successfulMutationCollector) expireRequests() {
+	if c.latestObservation.Sub(c.lastSweep) < pendingRequestSweepInterval {
+		return
+	}
+	c.lastSweep = c.latestObservation
+
+	cutoff := c.latestObservation.Add(-pendingRequestExpiration)
+	for id, observed := range c.droppedRequests {
+		if observed.Before(cutoff) {
+			delete(c.droppedRequests, id)
+		}
+	}
+	for id, req := range c.pendingRequests {
+		if req.ObservationTime.Before(cutoff) {
+			delete(c.pendingRequests, id)
+			c.droppedRequests[id] = c.latestObservation
+			c.filter.drop()
+		}
+	}
+}
+
+func (c *successfulMutationCollector) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Requests that never received a response can't be known to have
+	// succeeded.
+	for id := range c.pendingRequests {
+		delete(c.pendingRequests, id)
+		c.filter.drop()
+	}
+	return c.collector.Close()
+}
@@ -0,0 +1,96 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuccessfulMutationFilter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		statusCode int
+		kept       bool
+	}{
+		{"200 POST", "POST", 200, true},
+		{"204 DELETE", "DELETE", 204, true},
+		{"500 POST", "POST", 500, false},
+		{"200 GET", "GET", 200, false},
+	}
+
+	for _, tc := range testCases {
+		f := NewSuccessfulMutationFilter()
+		rec := newPairRecorder()
+		c := f.NewCollector(rec)
+
+		req, resp := makeExchange(1, tc.statusCode, time.Now())
+		r := req.Content.(akinet.HTTPRequest)
+		r.Method = tc.method
+		req.Content = r
+
+		assert.NoError(t, c.Process(req), "["+tc.name+"]")
+		assert.NoError(t, c.Process(resp), "["+tc.name+"]")
+		assert.NoError(t, c.Close(), "["+tc.name+"]")
+
+		if tc.kept {
+			assert.Equal(t, 1, len(rec.requests), "["+tc.name+"]")
+			assert.Equal(t, 1, len(rec.responses), "["+tc.name+"]")
+			assert.Equal(t, int64(0), f.Dropped(), "["+tc.name+"]")
+		} else {
+			assert.Equal(t, 0, len(rec.requests), "["+tc.name+"]")
+			assert.Equal(t, 0, len(rec.responses), "["+tc.name+"]")
+			assert.Equal(t, int64(1), f.Dropped(), "["+tc.name+"]")
+		}
+	}
+}
+
+func TestSuccessfulMutationFilterExpiresRequests(t *testing.T) {
+	f := NewSuccessfulMutationFilter()
+	rec := newPairRecorder()
+	c := f.NewCollector(rec)
+
+	start := time.Now()
+	req, resp := makeExchange(1, 200, start)
+	r := req.Content.(akinet.HTTPRequest)
+	r.Method = "PUT"
+	req.Content = r
+	assert.NoError(t, c.Process(req))
+
+	// A later packet causes the held request to be dropped, and its response
+	// is dropped when it arrives, without being counted again. The other
+	// response has no request, so it is dropped as well.
+	_, other := makeExchange(2, 200, start.Add(2*pendingRequestExpiration))
+	assert.NoError(t, c.Process(other))
+	assert.NoError(t, c.Process(resp))
+
+	assert.Equal(t, 0, len(rec.requests))
+	assert.Equal(t, 0, len(rec.responses))
+	assert.Equal(t, int64(2), f.Dropped())
+}
+
+func TestSuccessfulMutationFilterConcurrentProcess(t *testing.T) {
+	f := NewSuccessfulMutationFilter()
+	rec := newPairRecorder()
+	c := f.NewCollector(rec)
+
+	now := time.Now()
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 400; i++ {
+		req, resp := makeExchange(i, 200, now)
+		if i%2 == 0 {
+			r := req.Content.(akinet.HTTPRequest)
+			r.Method = "POST"
+			req.Content = r
+		}
+		batches[i%len(batches)] = append(batches[i%len(batches)], req, resp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, 200, len(rec.requests))
+	assert.Equal(t, 200, len(rec.responses))
+	assert.Equal(t, int64(200), f.Dropped())
+}
@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/postmanlabs/postman-insights-agent/learn"
+)
+
+// Drops HTTP requests and responses observed during a warm-up period after
+// capture starts, so that noisy startup and health-check traffic is not
+// recorded. Packets are still captured and parsed, and TCP and TLS connection
+// metadata still flow, so the pipeline is warm when recording begins. Shared
+// by the collectors for all interfaces.
+type WarmupFilter struct {
+	// Traffic observed before this time is dropped.
+	end time.Time
+
+	// Number of witnesses skipped.
+	skipped int64
+}
+
+// Creates a filter that drops traffic observed within the given delay after
+// the given start time.
+func NewWarmupFilter(start time.Time, delay time.Duration) *WarmupFilter {
+	return &WarmupFilter{end: start.Add(delay)}
+}
+
+// Returns the number of witnesses skipped during the warm-up period.
+func (f *WarmupFilter) Skipped() int64 {
+	return atomic.LoadInt64(&f.skipped)
+}
+
+// Returns a collector that drops HTTP requests and responses observed during
+// the warm-up period, along with the responses to requests that were dropped,
+// and passes all other traffic to the given collector.
+func (f *WarmupFilter) NewCollector(col Collector) Collector {
+	return &warmupCollector{
+		filter:          f,
+		collector:       col,
+		droppedRequests: map[akid.WitnessID]struct{}{},
+	}
+}
+
+type warmupCollector struct {
+	filter    *WarmupFilter
+	collector Collector
+
+	// Protects droppedRequests. The TCP and TLS connection trackers flush
+	// reports from timer goroutines, concurrently with the capture goroutine.
+	mutex sync.Mutex
+
+	// Requests dropped during the warm-up period, so that responses arriving
+	// after it are also dropped. Nil once responses to them are no longer
+	// expected.
+	droppedRequests map[akid.WitnessID]struct{}
+}
+
+func (c *warmupCollector) Process(t akinet.ParsedNetworkTraffic) error {
+	if !c.keep(t) {
+		return nil
+	}
+	return c.collector.Process(t)
+}
+
+// Determines whether the given traffic is passed on, counting it if it is
+// skipped.
+func (c *warmupCollector) keep(t akinet.ParsedNetworkTraffic) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	warmingUp := t.ObservationTime.Before(c.filter.end)
+
+	// Stop remembering dropped requests once their responses would have
+	// expired from the pair cache anyway.
+	if c.droppedRequests != nil && t.ObservationTime.After(c.filter.end.Add(pendingRequestExpiration)) {
+		c.droppedRequests = nil
+	}
+
+	switch content := t.Content.(type) {
+	case akinet.HTTPRequest:
+		if warmingUp {
+			if c.droppedRequests != nil {
+				c.droppedRequests[learn.ToWitnessID(content.StreamID, content.Seq)] = struct{}{}
+			}
+			atomic.AddInt64(&c.filter.skipped, 1)
+			return false
+		}
+
+	case akinet.HTTPResponse:
+		id := learn.ToWitnessID(content.StreamID, content.Seq)
+		if _, dropped := c.droppedRequests[id]; dropped {
+			delete(c.droppedRequests, id)
+			return false
+		}
+		if warmingUp {
+			// The request wasn't seen, so this response would be a witness of
+			// its own.
+			atomic.AddInt64(&c.filter.skipped, 1)
+			return false
+		}
+	}
+	return true
+}
+
+func (c *warmupCollector) Close() error {
+	return c.collector.Close()
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/akinet"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmupFilter(t *testing.T) {
+	start := time.Now()
+	filter := NewWarmupFilter(start, 10*time.Second)
+	rec := &trafficRecorder{}
+	c := filter.NewCollector(rec)
+
+	earlyReq, earlyResp := makeBodyExchange(uuid.New(), 1, start.Add(time.Second))
+	straddleReq, straddleResp := makeBodyExchange(uuid.New(), 1, start.Add(9*time.Second))
+	straddleResp.ObservationTime = start.Add(11 * time.Second)
+	lateReq, lateResp := makeBodyExchange(uuid.New(), 1, start.Add(12*time.Second))
+	tcp := akinet.ParsedNetworkTraffic{
+		ObservationTime: start.Add(time.Second),
+		Content:         akinet.TCPConnectionMetadata{},
+	}
+
+	// Witnesses during warm-up are dropped, but connection metadata isn't.
+	assert.NoError(t, c.Process(earlyReq))
+	assert.NoError(t, c.Process(tcp))
+	assert.NoError(t, c.Process(earlyResp))
+
+	// A response after warm-up to a request during warm-up is dropped too.
+	assert.NoError(t, c.Process(straddleReq))
+	assert.NoError(t, c.Process(straddleResp))
+
+	// Witnesses after warm-up are kept.
+	assert.NoError(t, c.Process(lateReq))
+	assert.NoError(t, c.Process(lateResp))
+
+	assert.NoError(t, c.Close())
+	assert.True(t, rec.closed)
+
+	assert.Equal(t, []akinet.ParsedNetworkTraffic{tcp, lateReq, lateResp}, rec.traffic)
+	assert.Equal(t, int64(2), filter.Skipped())
+}
+
+func TestWarmupFilterConcurrentProcess(t *testing.T) {
+	start := time.Now()
+	filter := NewWarmupFilter(start, 10*time.Second)
+	rec := &countingCollector{}
+	c := filter.NewCollector(rec)
+
+	batches := make([][]akinet.ParsedNetworkTraffic, 4)
+	for i := 0; i < 400; i++ {
+		observed := start.Add(time.Second)
+		if i%2 == 0 {
+			observed = start.Add(time.Minute)
+		}
+		req, resp := makeBodyExchange(uuid.New(), 1, observed)
+		batches[i%len(batches)] = append(batches[i%len(batches)], req, resp)
+	}
+	processConcurrently(t, c, batches...)
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, 400, rec.GetNumPackets())
+	assert.Equal(t, int64(200), filter.Skipped())
+}
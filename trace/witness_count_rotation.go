@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/akitasoftware/akita-libs/akid"
+)
+
+// Counts the witnesses uploaded to the current learn session by all backend
+// collectors, and requests a new session once a given number have been
+// uploaded, so that traces have a predictable size. Shared by the collectors
+// for all interfaces.
+//
+// Witnesses continue to be uploaded to the full session until the collectors
+// are switched to a new one, so a session may receive a few more than the
+// given number.
+type WitnessCountRotation struct {
+	maxWitnesses int
+
+	mu sync.Mutex
+
+	// The session being counted, and the number of witnesses uploaded to it.
+	session akid.LearnSessionID
+	count   int
+
+	// Whether a new session has been requested for the current one.
+	requested bool
+
+	rotate chan struct{}
+}
+
+// Creates a rotation that requests a new session after each maxWitnesses
+// witnesses.
+func NewWitnessCountRotation(maxWitnesses int) *WitnessCountRotation {
+	return &WitnessCountRotation{
+		maxWitnesses: maxWitnesses,
+		rotate:       make(chan struct{}, 1),
+	}
+}
+
+// Receives a value when the current session is full. The receiver should
+// switch the collectors to a new session, or call Retry if it can't.
+func (r *WitnessCountRotation) C() <-chan struct{} {
+	return r.rotate
+}
+
+// Requests a new session again with the next upload, after a failure to
+// create one.
+func (r *WitnessCountRotation) Retry() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requested = false
+}
+
+// Records that the given number of witnesses were uploaded to the given
+// session. Counting restarts when the session changes.
+func (r *WitnessCountRotation) recordUpload(session akid.LearnSessionID, witnesses int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session != r.session {
+		r.session = session
+		r.count = 0
+		r.requested = false
+	}
+	r.count += witnesses
+
+	if r.count >= r.maxWitnesses && !r.requested {
+		r.requested = true
+		select {
+		case r.rotate <- struct{}{}:
+		default:
+		}
+	}
+}
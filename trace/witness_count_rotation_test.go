@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/akitasoftware/akita-libs/akid"
+	kgxapi "github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/akitasoftware/go-utils/optionals"
+	"github.com/golang/mock/gomock"
+	mockrest "github.com/postmanlabs/postman-insights-agent/rest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWitnessCountRotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockClient := mockrest.NewMockLearnClient(ctrl)
+	defer ctrl.Finish()
+
+	var sessions []akid.LearnSessionID
+	mockClient.EXPECT().
+		AsyncReportsUpload(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, lrn akid.LearnSessionID, req *kgxapi.UploadReportsRequest) error {
+			for range req.Witnesses {
+				sessions = append(sessions, lrn)
+			}
+			return nil
+		}).
+		AnyTimes()
+
+	first := akid.GenerateLearnSessionID()
+	second := akid.GenerateLearnSessionID()
+
+	const n = 3
+	rotation := NewWitnessCountRotation(n)
+	col := &BackendCollector{learnClient: mockClient, learnSessionID: first}
+	col.SetWitnessCountRotation(rotation)
+	buf := newReportBuffer(col, NewPacketCounter(), uploadBatchMaxSize_bytes, optionals.None[int]())
+
+	upload := func() {
+		buf.UploadReportsRequest.AddWitnessReport(newSizedWitnessReport(len(sessions)))
+		assert.NoError(t, buf.Flush())
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-rotation.C():
+			t.Fatalf("rotation requested after %d witnesses", i)
+		default:
+		}
+		upload()
+	}
+
+	// The session is full. Rotation is requested once.
+	select {
+	case <-rotation.C():
+		col.SwitchLearnSession(second)
+	default:
+		t.Fatalf("rotation not requested after %d witnesses", n)
+	}
+	upload()
+	assert.Equal(t, []akid.LearnSessionID{first, first, first, second}, sessions)
+
+	// Counting restarts with the new session.
+	for i := 1; i < n; i++ {
+		upload()
+	}
+	select {
+	case <-rotation.C():
+	default:
+		t.Fatalf("rotation not requested for the new session")
+	}
+
+	// If rotation fails, it is requested again with the next upload.
+	upload()
+	select {
+	case <-rotation.C():
+		t.Fatalf("rotation requested twice")
+	default:
+	}
+	rotation.Retry()
+	upload()
+	select {
+	case <-rotation.C():
+	default:
+		t.Fatalf("rotation not requested again after Retry")
+	}
+}
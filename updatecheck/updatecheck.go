@@ -0,0 +1,82 @@
+// updatecheck package checks whether a newer release of the agent is
+// available, so that operators running it by hand know to upgrade. Nothing is
+// downloaded or installed.
+package updatecheck
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	ver "github.com/hashicorp/go-version"
+	"github.com/postmanlabs/postman-insights-agent/ci"
+	"github.com/postmanlabs/postman-insights-agent/env"
+	"github.com/postmanlabs/postman-insights-agent/printer"
+	"github.com/postmanlabs/postman-insights-agent/rest"
+	"github.com/postmanlabs/postman-insights-agent/version"
+)
+
+const (
+	// Set to true to disable the check.
+	DisableEnvVar = "POSTMAN_INSIGHTS_AGENT_DISABLE_UPDATE_CHECK"
+
+	// Overrides the endpoint that reports the latest release.
+	EndpointEnvVar = "POSTMAN_INSIGHTS_AGENT_RELEASE_ENDPOINT"
+
+	DefaultEndpoint = "https://api.github.com/repos/postmanlabs/postman-insights-agent/releases/latest"
+
+	checkTimeout = 5 * time.Second
+)
+
+// Indicates whether the check should run. It is skipped if disabled by the
+// user, and in CI and Kubernetes, where the agent is not run by hand and
+// upgrades are managed elsewhere.
+func Enabled() bool {
+	if disabled, err := strconv.ParseBool(os.Getenv(DisableEnvVar)); err == nil && disabled {
+		return false
+	}
+	return !ci.InCI() && !env.InKubernetes()
+}
+
+// Returns the endpoint that reports the latest release.
+func Endpoint() string {
+	if endpoint := os.Getenv(EndpointEnvVar); endpoint != "" {
+		return endpoint
+	}
+	return DefaultEndpoint
+}
+
+// Returns the latest release reported by the given endpoint, if it is newer
+// than the current version. Otherwise, returns nil.
+func NewerVersion(ctx context.Context, endpoint string, current *ver.Version) (*ver.Version, error) {
+	latest, err := rest.GetLatestReleaseVersion(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if latest.GreaterThan(current) {
+		return latest, nil
+	}
+	return nil, nil
+}
+
+// Prints a notice if a newer release of the agent is available. Does nothing
+// if the check is disabled. Failures are only logged at debug level, since
+// the check is a courtesy and must not get in the way of the agent.
+func Notify(ctx context.Context) {
+	if !Enabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	latest, err := NewerVersion(ctx, Endpoint(), version.ReleaseVersion())
+	if err != nil {
+		printer.Debugf("Failed to check for a newer version of the agent: %v\n", err)
+		return
+	}
+	if latest != nil {
+		printer.Stderr.Infof("Postman Insights Agent %s is available; you are running %s. Set %s=true to disable this check.\n", latest, version.ReleaseVersion(), DisableEnvVar)
+	}
+}
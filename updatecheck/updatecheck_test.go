@@ -0,0 +1,80 @@
+package updatecheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ver "github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a server that reports the given tag as the latest release.
+func newReleaseServer(t *testing.T, tag string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Empty(t, r.Header.Get("x-api-key"), "no credentials are sent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"tag_name": "` + tag + `", "name": "Release ` + tag + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewerVersion(t *testing.T) {
+	current := ver.Must(ver.NewSemver("0.20.1"))
+
+	testCases := []struct {
+		tag      string
+		expected string
+	}{
+		{"v0.21.0", "0.21.0"},
+		{"0.20.2", "0.20.2"},
+		{"v0.20.1", ""},
+		{"v0.19.9", ""},
+	}
+
+	for _, tc := range testCases {
+		server := newReleaseServer(t, tc.tag)
+		latest, err := NewerVersion(context.Background(), server.URL, current)
+		if !assert.NoError(t, err, "["+tc.tag+"]") {
+			continue
+		}
+		if tc.expected == "" {
+			assert.Nil(t, latest, "["+tc.tag+"]")
+		} else if assert.NotNil(t, latest, "["+tc.tag+"]") {
+			assert.Equal(t, tc.expected, latest.String(), "["+tc.tag+"]")
+		}
+	}
+}
+
+func TestNewerVersionInvalidResponse(t *testing.T) {
+	current := ver.Must(ver.NewSemver("0.20.1"))
+
+	server := newReleaseServer(t, "nightly")
+	_, err := NewerVersion(context.Background(), server.URL, current)
+	assert.Error(t, err)
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	_, err = NewerVersion(context.Background(), notFound.URL, current)
+	assert.Error(t, err)
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("CI", "true")
+	assert.False(t, Enabled(), "disabled in CI")
+
+	t.Setenv("CI", "false")
+	t.Setenv(DisableEnvVar, "true")
+	assert.False(t, Enabled(), "disabled by opt-out")
+}
+
+func TestEndpoint(t *testing.T) {
+	t.Setenv(EndpointEnvVar, "")
+	assert.Equal(t, DefaultEndpoint, Endpoint())
+
+	t.Setenv(EndpointEnvVar, "https://example.com/latest")
+	assert.Equal(t, "https://example.com/latest", Endpoint())
+}
@@ -0,0 +1,136 @@
+package usage
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/postmanlabs/postman-insights-agent/printer"
+)
+
+// Reading memory statistics briefly stops the world, so they are read at most
+// this often.
+const runtimeStatsMinInterval = time.Minute
+
+// Go runtime statistics and the sizes of the agent's internal data
+// structures, for spotting growth in long-running agents.
+type RuntimeStats struct {
+	ObservedAt time.Time
+
+	Goroutines      int
+	HeapAlloc_bytes uint64
+	HeapObjects     uint64
+	NumGC           uint32
+
+	// Number of entries in each registered data structure, summed over all
+	// instances with the same name.
+	Sizes map[string]int
+}
+
+type sizeGauge struct {
+	name string
+	size func() int
+}
+
+var (
+	runtimeStats      *RuntimeStats
+	runtimeStatsMutex sync.Mutex
+
+	// Registered data structures, keyed by registration.
+	sizeGauges      = map[int]sizeGauge{}
+	nextSizeGauge   int
+	sizeGaugesMutex sync.Mutex
+)
+
+// Returns the latest runtime statistics, or nil if none have been collected.
+// Statistics are collected by the same worker as resource usage; see Poll().
+func GetRuntimeStats() *RuntimeStats {
+	runtimeStatsMutex.Lock()
+	defer runtimeStatsMutex.Unlock()
+
+	return runtimeStats
+}
+
+// Registers a data structure whose size is reported in RuntimeStats.Sizes
+// under the given name. The size function is called from the polling worker,
+// so it must be safe for concurrent use. Returns a function that unregisters
+// the data structure.
+func RegisterSize(name string, size func() int) (unregister func()) {
+	sizeGaugesMutex.Lock()
+	defer sizeGaugesMutex.Unlock()
+
+	id := nextSizeGauge
+	nextSizeGauge += 1
+	sizeGauges[id] = sizeGauge{name: name, size: size}
+
+	return func() {
+		sizeGaugesMutex.Lock()
+		defer sizeGaugesMutex.Unlock()
+		delete(sizeGauges, id)
+	}
+}
+
+// Updates the runtime statistics, unless they were updated less than
+// runtimeStatsMinInterval ago.
+func collectRuntimeStats(now time.Time) {
+	runtimeStatsMutex.Lock()
+	last := runtimeStats
+	runtimeStatsMutex.Unlock()
+	if last != nil && now.Sub(last.ObservedAt) < runtimeStatsMinInterval {
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := &RuntimeStats{
+		ObservedAt:      now,
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAlloc_bytes: mem.HeapAlloc,
+		HeapObjects:     mem.HeapObjects,
+		NumGC:           mem.NumGC,
+		Sizes:           readSizes(),
+	}
+
+	runtimeStatsMutex.Lock()
+	runtimeStats = stats
+	runtimeStatsMutex.Unlock()
+
+	printer.Debugf("Runtime stats: %s\n", stats)
+}
+
+func readSizes() map[string]int {
+	sizeGaugesMutex.Lock()
+	gauges := make([]sizeGauge, 0, len(sizeGauges))
+	for _, g := range sizeGauges {
+		gauges = append(gauges, g)
+	}
+	sizeGaugesMutex.Unlock()
+
+	// Call the size functions without holding the lock, so that they may take
+	// their own locks without risking a deadlock with RegisterSize.
+	sizes := make(map[string]int, len(gauges))
+	for _, g := range gauges {
+		sizes[g.name] += g.size()
+	}
+	return sizes
+}
+
+func (s *RuntimeStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goroutines=%d heap_alloc_bytes=%d heap_objects=%d num_gc=%d",
+		s.Goroutines, s.HeapAlloc_bytes, s.HeapObjects, s.NumGC)
+
+	names := make([]string, 0, len(s.Sizes))
+	for name := range s.Sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%d", name, s.Sizes[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akitasoftware/akita-libs/api_schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectRuntimeStats(t *testing.T) {
+	defer func() { runtimeStats = nil }()
+
+	unregisterA := RegisterSize("test_cache", func() int { return 3 })
+	unregisterB := RegisterSize("test_cache", func() int { return 4 })
+	defer unregisterA()
+
+	now := time.Now()
+	collectRuntimeStats(now)
+
+	stats := GetRuntimeStats()
+	if !assert.NotNil(t, stats) {
+		return
+	}
+	assert.Equal(t, now, stats.ObservedAt)
+	assert.Greater(t, stats.Goroutines, 0)
+	assert.Greater(t, stats.HeapAlloc_bytes, uint64(0))
+	assert.Greater(t, stats.HeapObjects, uint64(0))
+
+	// Sizes with the same name are summed.
+	assert.Equal(t, 7, stats.Sizes["test_cache"])
+
+	// Collection is throttled.
+	unregisterB()
+	collectRuntimeStats(now.Add(runtimeStatsMinInterval / 2))
+	assert.Equal(t, stats, GetRuntimeStats())
+
+	// Unregistered sizes are no longer reported.
+	collectRuntimeStats(now.Add(runtimeStatsMinInterval))
+	assert.Equal(t, 3, GetRuntimeStats().Sizes["test_cache"])
+}
+
+func TestPollListeners(t *testing.T) {
+	var got []uint64
+	unregister := RegisterPollListener(func(_ *api_schema.AgentResourceUsage, latestVmHWM_kB uint64) {
+		got = append(got, latestVmHWM_kB)
+	})
+
+	notifyPollListeners(&api_schema.AgentResourceUsage{}, 1000)
+	notifyPollListeners(&api_schema.AgentResourceUsage{}, 2000)
+	unregister()
+	notifyPollListeners(&api_schema.AgentResourceUsage{}, 3000)
+
+	assert.Equal(t, []uint64{1000, 2000}, got)
+}
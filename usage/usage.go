@@ -54,8 +54,48 @@ var (
 	// Ensure at most one worker is polling.
 	isPolling      bool
 	isPollingMutex sync.Mutex
+
+	// Functions called after each poll, keyed by registration.
+	pollListeners      = map[int]PollListener{}
+	nextPollListener   int
+	pollListenersMutex sync.Mutex
 )
 
+// Called after each poll with the latest usage, as returned by Get(), and the
+// peak resident set size in kB since the previous poll. Unlike the sliding
+// window in the usage, the latter falls as soon as memory use does.
+type PollListener func(u *api_schema.AgentResourceUsage, latestVmHWM_kB uint64)
+
+// Registers a function to call from the polling worker after each poll.
+// Returns a function that unregisters it.
+func RegisterPollListener(f PollListener) (unregister func()) {
+	pollListenersMutex.Lock()
+	defer pollListenersMutex.Unlock()
+
+	id := nextPollListener
+	nextPollListener += 1
+	pollListeners[id] = f
+
+	return func() {
+		pollListenersMutex.Lock()
+		defer pollListenersMutex.Unlock()
+		delete(pollListeners, id)
+	}
+}
+
+func notifyPollListeners(u *api_schema.AgentResourceUsage, latestVmHWM_kB uint64) {
+	pollListenersMutex.Lock()
+	listeners := make([]PollListener, 0, len(pollListeners))
+	for _, f := range pollListeners {
+		listeners = append(listeners, f)
+	}
+	pollListenersMutex.Unlock()
+
+	for _, f := range listeners {
+		f(u, latestVmHWM_kB)
+	}
+}
+
 // Returns a 1-hour sliding window reflecting this Postman Insights Agent's CPU and
 // memory usage, updated every pollingInterval minutes, or nil if resource
 // usage is unavailable.
@@ -73,7 +113,8 @@ func Get() *api_schema.AgentResourceUsage {
 
 // Waits delay seconds, then starts polling resource usage every N seconds.
 // If another process has already started polling, this call has no effect.
-// Use Get() to get the latest usage data.
+// Use Get() to get the latest usage data, and GetRuntimeStats() to get the
+// latest Go runtime statistics.
 func Poll(done <-chan struct{}, delay time.Duration, pollingInterval time.Duration) {
 	// Check if polling is disabled.
 	if pollingInterval <= 0 {
@@ -136,6 +177,9 @@ func poll(pollingInterval time.Duration) error {
 		printer.Infof(msg, args...)
 	}
 
+	// Runtime statistics don't depend on /proc, so collect them first.
+	collectRuntimeStats(time.Now())
+
 	stat, status, allStat, err := readProcFS()
 	if err != nil {
 		return err
@@ -200,10 +244,7 @@ func poll(pollingInterval time.Duration) error {
 	observedStartingAt := oldestStats.observedAt
 
 	// Update the usage data.
-	agentResourceUsageMutex.Lock()
-	defer agentResourceUsageMutex.Unlock()
-
-	agentResourceUsage = &api_schema.AgentResourceUsage{
+	usage := &api_schema.AgentResourceUsage{
 		Recent: api_schema.AgentResourceUsageData{
 			CoresUsed:   coresUsed,
 			RelativeCPU: relativeCPU,
@@ -218,6 +259,12 @@ func poll(pollingInterval time.Duration) error {
 		ObservedDurationInSeconds: int(observedDuration.Seconds()),
 	}
 
+	agentResourceUsageMutex.Lock()
+	agentResourceUsage = usage
+	agentResourceUsageMutex.Unlock()
+
+	notifyPollListeners(usage, status.VmHWM)
+
 	finishedFirstPoll = true
 	return nil
 }
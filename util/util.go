@@ -43,7 +43,12 @@ var (
 
 func NewLearnSession(domain string, clientID akid.ClientID, svc akid.ServiceID, sessionName string, tags map[tags.Key]string, baseSpecRef *kgxapi.APISpecReference) (akid.LearnSessionID, error) {
 	learnClient := rest.NewLearnClient(domain, clientID, svc)
+	return NewLearnSessionWithClient(learnClient, sessionName, tags, baseSpecRef)
+}
 
+// Like NewLearnSession, but uses the given client, which determines the
+// service in which the learn session is created.
+func NewLearnSessionWithClient(learnClient rest.LearnClient, sessionName string, tags map[tags.Key]string, baseSpecRef *kgxapi.APISpecReference) (akid.LearnSessionID, error) {
 	// Create a new learn session.
 	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
 	defer cancel()